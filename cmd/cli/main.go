@@ -1,27 +1,89 @@
 package main
 
 import (
+	"flag"
 	"log"
 
+	"lcma/internal/analysis"
 	"lcma/internal/config"
+	"lcma/internal/risk"
 	"lcma/internal/utils"
 )
 
 func main() {
+	phase := flag.Int("phase", -1, "run the code prompt for one phase of migration_plan.json only")
+	flag.Parse()
+
 	err := config.Init()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	err = utils.ReadLegacyCodeGenerateOutput("")
+	corpus, err := utils.ReadLegacyCodeGenerateOutput("")
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	project, err := analysis.Run(corpus)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Migrate one phase of the plan with only its legacy files
+	if *phase >= 0 {
+		if *phase >= len(project.Plan.Phases) {
+			log.Fatalf("Phase %d does not exist, migration_plan.json has phases 0 to %d", *phase, len(project.Plan.Phases)-1)
+		}
+		ph := project.Plan.Phases[*phase]
+		if err := utils.CallLLMForPhase(corpus, ph.Number, ph.Files, ph.Markdown()); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Nothing to re-send to the LLM after a run with no legacy code changes
+	if corpus.Changes.Empty() && utils.ReportsExist() && risk.Exists() {
+		log.Println("No legacy code changes since the last run, keeping existing reports")
+		return
+	}
+
 	err = utils.CallLLMWithContextAndSaveReport()
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	// Add the generated architecture, ERD and request flow diagrams to report.md
+	if err := analysis.EmbedDiagrams(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Check the generated router against the endpoints of the legacy app
+	coverage, err := analysis.CheckRouteCoverage(project)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(coverage.Missing) > 0 {
+		log.Printf("Generated router is missing %d of %d legacy routes, see route_coverage.md", len(coverage.Missing), len(project.Routes))
+	}
+
+	// Trace the business rules of the legacy code to the Go code citing them
+	trace, err := analysis.CheckRuleTraceability(project)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(trace.Missing) > 0 {
+		log.Printf("Generated code does not cite %d of %d business rules, see business_rules_trace.md", len(trace.Missing), len(project.Rules))
+	}
+
+	// Score a risk per module and planned change and add the register to report.md
+	if _, err := risk.Assess(project); err != nil {
+		log.Fatal(err)
+	}
+
+	// Only now are the reports complete; a run that failed above is redone next time
+	if err := utils.SaveManifest(corpus); err != nil {
+		log.Fatal(err)
+	}
 	// reportFile := filepath.Join(config.ReportPath, "report_code.md")
 	// err = utils.CreateProjectStructure(reportFile)
 	// // err = utils.CreateProjectStructure(reportFile, config.ModernCodePath)
@@ -0,0 +1,105 @@
+// Package analysis extracts facts from the ingested legacy code without calling
+// an LLM, so later stages and prompts work from ground truth instead of guesses.
+package analysis
+
+import (
+	"fmt"
+	"lcma/internal/utils"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Project is the parsed legacy code base shared by the analysis stages
+type Project struct {
+	Corpus       *utils.Corpus
+	Modules      []*PyModule
+	Graph        *ImportGraph
+	Symbols      []Symbol
+	Routes       []Route
+	Schema       *Schema
+	DataLayer    *DataLayer
+	Rules        []BusinessRule
+	Templates    []*Template
+	Translations []TemplTranslation
+	Dependencies *DependencyInventory
+	Audit        *DependencyAudit
+	Security     []SecurityFinding
+	Clones       []CloneCluster
+	Metrics      *Metrics
+	DeadCode     *DeadCode
+	Contexts     *ContextMap
+	Plan         *MigrationPlan
+	Diagrams     []Diagram
+
+	py    map[string]*pyFile
+	calls *callGraph
+}
+
+// stage is a deterministic analysis step run over the project
+type stage struct {
+	name string
+	run  func(p *Project) error
+}
+
+// stages run in order; later stages may use results of earlier ones
+var stages = []stage{
+	{name: "python symbols and import graph", run: analyzePython},
+	{name: "flask routes", run: analyzeRoutes},
+	{name: "openapi spec", run: analyzeOpenAPI},
+	{name: "sql schema", run: analyzeSchema},
+	{name: "data layer", run: analyzeDataLayer},
+	{name: "business rules", run: analyzeBusinessRules},
+	{name: "jinja templates", run: analyzeTemplates},
+	{name: "templ translation", run: analyzeTemplTranslation},
+	{name: "python dependencies", run: analyzeDependencies},
+	{name: "dependency audit", run: analyzeDependencyAudit},
+	{name: "security scan", run: analyzeSecurity},
+	{name: "code clones", run: analyzeClones},
+	{name: "complexity metrics", run: analyzeMetrics},
+	{name: "dead code", run: analyzeDeadCode},
+	{name: "bounded contexts", run: analyzeContexts},
+	{name: "migration plan", run: analyzeMigrationPlan},
+	{name: "architecture diagrams", run: analyzeDiagrams},
+}
+
+// Run parses the ingested corpus and writes the analysis artifacts into REPORT_PATH
+func Run(corpus *utils.Corpus) (*Project, error) {
+	p := &Project{Corpus: corpus, py: map[string]*pyFile{}}
+	for _, s := range stages {
+		fmt.Println("Running analysis:", s.name)
+		if err := s.run(p); err != nil {
+			return nil, fmt.Errorf("analysis %s failed: %w", s.name, err)
+		}
+	}
+	return p, nil
+}
+
+// pythonFiles returns the corpus files parsed as Python, including notebooks
+func (p *Project) pythonFiles() []utils.CorpusFile {
+	var files []utils.CorpusFile
+	for _, f := range p.Corpus.Files {
+		if f.Kind == utils.KindNotebook || strings.EqualFold(path.Ext(f.Path), ".py") {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// module returns the parsed module for a corpus path
+func (p *Project) module(filePath string) *PyModule {
+	if f, ok := p.py[filePath]; ok {
+		return f.Module
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of m in sorted order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
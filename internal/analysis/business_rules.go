@@ -0,0 +1,749 @@
+package analysis
+
+import (
+	"fmt"
+	"lcma/internal/utils"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Business rule kinds
+const (
+	RuleValidation      = "validation"
+	RuleCalculation     = "calculation"
+	RuleStateTransition = "state_transition"
+	RuleAuthorization   = "authorization"
+)
+
+// ruleKinds orders the kinds in the reports
+var ruleKinds = []string{RuleValidation, RuleAuthorization, RuleStateTransition, RuleCalculation}
+
+// BusinessRule is a rule of the legacy application found in a handler or a
+// function it calls. Its ID is what the Go code cites to trace the rule.
+type BusinessRule struct {
+	ID          string   `json:"id"`
+	Kind        string   `json:"kind"`
+	Description string   `json:"description"`
+	File        string   `json:"file"`
+	Line        int      `json:"line"`
+	Function    string   `json:"function,omitempty"`
+	Handlers    []string `json:"handlers,omitempty"` // endpoints of the routes that apply the rule
+	Data        []string `json:"data"`               // variables, request fields and columns involved
+	Code        string   `json:"code"`
+}
+
+var (
+	// stateField matches names holding the state of a business object
+	stateField = regexp.MustCompile(`(?i)^(status|state|stage|phase|step|[a-z0-9_]+_(status|state))$`)
+	// authCondition matches conditions about the user, the session or permissions
+	authCondition = regexp.MustCompile(`(?i)\b(current_user|is_authenticated|is_admin|is_staff|is_superuser|role|roles|permission|permissions|can_\w+|has_\w+|session|g\.user|owner_id|author_id|user_id)\b`)
+	// authDecorator matches decorators restricting who may call a view
+	authDecorator = regexp.MustCompile(`(?i)^(\w+_required|requires?_\w+|\w+_only|permission_classes|roles_accepted)$`)
+	// rejectError matches exception classes raised to reject input or access
+	rejectError = regexp.MustCompile(`(Error|Exception|Invalid\w*|Forbidden|Unauthorized|Denied|BadRequest|NotFound)$`)
+	authError   = regexp.MustCompile(`(Forbidden|Unauthorized|PermissionDenied|AccessDenied|NotAuthorized)`)
+	loginTarget = regexp.MustCompile(`(?i)url_for\(\s*['"][\w.]*login['"]|['"]/(auth/)?login`)
+	sqlSetState = regexp.MustCompile(`(?is)\bSET\b(.*?)(?:\bWHERE\b(.*))?$`)
+)
+
+// ruleBuiltins are names that carry no business data
+var ruleBuiltins = map[string]bool{
+	"True": true, "False": true, "None": true, "self": true, "cls": true, "request": true,
+	"len": true, "int": true, "float": true, "str": true, "bool": true, "round": true, "sum": true,
+	"min": true, "max": true, "abs": true, "list": true, "dict": true, "set": true, "tuple": true,
+	"isinstance": true, "any": true, "all": true, "sorted": true, "Decimal": true, "math": true,
+}
+
+// formValidators describes WTForms validators; %s are the named arguments
+var formValidators = map[string]string{
+	"DataRequired": "required", "InputRequired": "required", "Email": "an email address",
+	"URL": "a URL", "UUID": "a UUID", "IPAddress": "an IP address", "MacAddress": "a MAC address",
+}
+
+// analyzeBusinessRules extracts validation rules, calculations, state
+// transitions and authorization checks and writes them as JSON and Markdown
+func analyzeBusinessRules(p *Project) error {
+	s := &ruleScan{p: p, g: p.callGraph(), handlers: map[funcRef][]string{}, formRoutes: map[string][]string{}, seen: map[string]bool{}, columns: map[string][]string{}}
+	if p.Schema != nil {
+		for _, t := range p.Schema.Tables {
+			for _, c := range t.Columns {
+				s.columns[c.Name] = appendUnique(s.columns[c.Name], t.Name)
+			}
+		}
+	}
+
+	// Rules live in the handlers and the functions they call; without routes
+	// every function is a candidate
+	scope := map[funcRef]bool{}
+	for _, r := range p.Routes {
+		ref := funcRef{Module: r.Module, Qualname: r.Handler}
+		if info := s.g.funcs[ref]; info != nil {
+			s.decorators(info, r)
+		}
+		for _, f := range s.g.reachable(ref, 2) {
+			scope[f] = true
+			s.handlers[f] = appendUnique(s.handlers[f], r.Endpoint)
+		}
+	}
+	if len(p.Routes) == 0 {
+		for ref := range s.g.funcs {
+			scope[ref] = true
+		}
+	}
+	for _, m := range p.Modules {
+		s.forms(m, scope)
+	}
+
+	refs := make([]funcRef, 0, len(scope))
+	for ref := range scope {
+		if s.g.funcs[ref] != nil {
+			refs = append(refs, ref)
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].String() < refs[j].String() })
+	for _, ref := range refs {
+		info := s.g.funcs[ref]
+		s.block(info, info.Fn.body, nil)
+	}
+	if p.Schema != nil {
+		for _, q := range p.Schema.Queries {
+			s.sqlTransition(q)
+		}
+	}
+
+	sort.SliceStable(s.rules, func(i, j int) bool {
+		a, b := s.rules[i], s.rules[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Kind < b.Kind
+	})
+	for i := range s.rules {
+		s.rules[i].ID = fmt.Sprintf("BR-%03d", i+1)
+	}
+	p.Rules = nonNil(s.rules)
+
+	if err := utils.WriteReportJSON("business_rules.json", p.Rules); err != nil {
+		return err
+	}
+	return utils.WriteReportFile("business_rules.md", []byte(businessRulesMarkdown(p.Rules)))
+}
+
+// ruleScan collects rules, keeping one rule per kind and line
+type ruleScan struct {
+	p        *Project
+	g        *callGraph
+	handlers map[funcRef][]string
+	// formRoutes maps WTForms classes to the endpoints that use them
+	formRoutes map[string][]string
+	columns    map[string][]string // column name to the tables that have it
+	seen       map[string]bool
+	rules      []BusinessRule
+}
+
+func (s *ruleScan) add(r BusinessRule) {
+	key := fmt.Sprintf("%s %s:%d", r.Kind, r.File, r.Line)
+	if s.seen[key] {
+		return
+	}
+	s.seen[key] = true
+	r.Data = nonNil(r.Data)
+	sort.Strings(r.Handlers)
+	s.rules = append(s.rules, r)
+}
+
+// rule starts a rule at a statement of a function
+func (s *ruleScan) rule(info *funcInfo, st *pyStmt, kind, description string, data []string) BusinessRule {
+	return BusinessRule{
+		Kind:        kind,
+		Description: description,
+		File:        info.Module.Path,
+		Line:        st.Line,
+		Function:    info.Fn.Qualname,
+		Handlers:    append([]string(nil), s.handlers[info.Ref]...),
+		Data:        data,
+		Code:        s.source(info, st),
+	}
+}
+
+// source is the first line of a statement
+func (s *ruleScan) source(info *funcInfo, st *pyStmt) string {
+	f := s.p.py[info.Module.Path]
+	if f == nil || len(st.Tokens) == 0 {
+		return ""
+	}
+	text := f.Src[st.Tokens[0].Pos:st.Tokens[len(st.Tokens)-1].End]
+	line, _, _ := strings.Cut(text, "\n")
+	return strings.TrimSpace(line)
+}
+
+// block walks statements; conds are the conditions of the enclosing ifs
+func (s *ruleScan) block(info *funcInfo, stmts []*pyStmt, conds []string) {
+	for _, st := range stmts {
+		switch st.keyword() {
+		case "if", "elif", "while":
+			cond := s.condition(info, st)
+			s.guard(info, st, cond)
+			s.block(info, st.Body, append(conds[:len(conds):len(conds)], cond))
+			continue
+		case "assert":
+			cond := s.expression(info, st.Tokens[1:])
+			s.add(s.rule(info, st, RuleValidation, "Requires "+cond, s.data(st.Tokens[1:])))
+		case "return":
+			s.returned(info, st)
+		case "def", "class", "@":
+		default:
+			s.assignment(info, st, conds)
+		}
+		s.block(info, st.Body, conds)
+	}
+}
+
+// condition is the text of an if or while condition
+func (s *ruleScan) condition(info *funcInfo, st *pyStmt) string {
+	toks := st.Tokens[1:]
+	if colon := lastTopLevelColon(toks); colon >= 0 {
+		toks = toks[:colon]
+	}
+	return s.expression(info, toks)
+}
+
+// expression is the source of toks on one line, shortened for the reports
+func (s *ruleScan) expression(info *funcInfo, toks []pyToken) string {
+	f := s.p.py[info.Module.Path]
+	if f == nil || len(toks) == 0 {
+		return ""
+	}
+	text := strings.Join(strings.Fields(f.Src[toks[0].Pos:toks[len(toks)-1].End]), " ")
+	if len(text) > 120 {
+		text = text[:117] + "..."
+	}
+	return text
+}
+
+// guard records an if whose body rejects the request: an abort, a raised
+// error, an error message or a 4xx response make it a validation rule, and a
+// 401/403, a login redirect or a condition on the user an authorization check
+func (s *ruleScan) guard(info *funcInfo, st *pyStmt, cond string) {
+	code, message, auth, ok := s.rejection(info, st.Body)
+	if !ok {
+		return
+	}
+	kind := RuleValidation
+	if auth || code == 401 || code == 403 || authCondition.MatchString(cond) {
+		kind = RuleAuthorization
+	}
+	var sb strings.Builder
+	switch {
+	case kind == RuleAuthorization && code == 0 && auth:
+		sb.WriteString("Sends the user to the login page when " + cond)
+	case kind == RuleAuthorization:
+		sb.WriteString("Denies access when " + cond)
+	default:
+		sb.WriteString("Rejects the request when " + cond)
+	}
+	if code != 0 {
+		fmt.Fprintf(&sb, " (%d)", code)
+	}
+	if message != "" {
+		fmt.Fprintf(&sb, ": %q", message)
+	}
+	toks := st.Tokens[1:]
+	if colon := lastTopLevelColon(toks); colon >= 0 {
+		toks = toks[:colon]
+	}
+	s.add(s.rule(info, st, kind, sb.String(), s.data(toks)))
+}
+
+// rejection reports how the statements of an if body reject the request
+func (s *ruleScan) rejection(info *funcInfo, body []*pyStmt) (code int, message string, auth, ok bool) {
+	flashed := false
+	for _, st := range body {
+		toks := st.Tokens
+		text := s.expression(info, toks)
+		switch st.keyword() {
+		case "raise":
+			if len(toks) > 1 && rejectError.MatchString(lastSegment(dottedName(toks[1:]))) {
+				ok = true
+				auth = auth || authError.MatchString(dottedName(toks[1:]))
+				if message == "" {
+					message = firstLiteral(toks)
+				}
+			}
+		case "return":
+			switch {
+			case loginTarget.MatchString(text):
+				ok, auth = true, true
+			case flashed:
+				ok = true
+			}
+			if n := returnStatus(toks[1:]); n >= 400 && n < 500 {
+				ok, code = true, n
+				if message == "" {
+					message = firstLiteral(toks)
+				}
+			}
+		default:
+			name := dottedName(toks)
+			switch lastSegment(name) {
+			case "abort":
+				if len(toks) > 2 && toks[1].Value == "(" {
+					if n, err := strconv.Atoi(toks[2].Value); err == nil && n >= 400 {
+						ok, code = true, n
+						if message == "" {
+							message = firstLiteral(toks[3:])
+						}
+					}
+				}
+			case "flash":
+				flashed = true
+				if message == "" {
+					message = firstLiteral(toks)
+				}
+				// flash("...", "error") rejects even when the body goes on
+				if strings.Contains(text, "'error'") || strings.Contains(text, `"error"`) || strings.Contains(text, "danger") {
+					ok = true
+				}
+			case "append":
+				if strings.HasPrefix(name, "error") {
+					ok = true
+					if message == "" {
+						message = firstLiteral(toks)
+					}
+				}
+			}
+			if target, isAssign := assignmentTarget(st); isAssign && strings.HasPrefix(target, "error") && firstLiteral(toks) != "" {
+				ok = true
+				if message == "" {
+					message = firstLiteral(toks)
+				}
+			}
+		}
+	}
+	return code, message, auth, ok
+}
+
+// returnStatus is the status of return ..., 400 or 0
+func returnStatus(expr []pyToken) int {
+	depth := 0
+	for j, t := range expr {
+		switch t.Value {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+		case ",":
+			if depth == 0 && j+1 < len(expr) && expr[j+1].Kind == tokNumber {
+				n, _ := strconv.Atoi(expr[j+1].Value)
+				return n
+			}
+		}
+	}
+	return 0
+}
+
+// firstLiteral is the first plain string literal in toks that is not a dict key
+func firstLiteral(toks []pyToken) string {
+	for k, t := range toks {
+		if k+1 < len(toks) && toks[k+1].Value == ":" {
+			continue
+		}
+		if t.Kind == tokString && !isFString(t.Value) {
+			if v := stringLiteralValue(t.Value); v != "" && !strings.HasSuffix(v, ".html") {
+				return v
+			}
+		}
+	}
+	return ""
+}
+
+// assignment records state transitions (x.status = "shipped") and
+// calculations (total = price * quantity)
+func (s *ruleScan) assignment(info *funcInfo, st *pyStmt, conds []string) {
+	toks := st.Tokens
+	eq := -1
+	for k, t := range toks {
+		if t.Kind != tokOp {
+			continue
+		}
+		if t.Value == "(" || t.Value == "[" && k == 0 {
+			return
+		}
+		switch t.Value {
+		case "=", "+=", "-=", "*=", "/=", "//=", "%=", "**=":
+			eq = k
+		}
+		if eq >= 0 {
+			break
+		}
+	}
+	if eq <= 0 || eq+1 >= len(toks) {
+		return
+	}
+	target := s.expression(info, toks[:eq])
+	value := toks[eq+1:]
+	when := ""
+	if len(conds) > 0 {
+		when = " when " + conds[len(conds)-1]
+	}
+
+	if field := stateTarget(toks[:eq]); field != "" && toks[eq].Value == "=" {
+		if v, ok := stateValue(value); ok {
+			data := s.data(toks[:eq])
+			s.add(s.rule(info, st, RuleStateTransition, fmt.Sprintf("Sets %s to %s%s", target, v, when), data))
+			return
+		}
+	}
+
+	if !isCalculation(toks[eq].Value, value) {
+		return
+	}
+	expr := s.expression(info, value)
+	description := fmt.Sprintf("Computes %s = %s%s", target, expr, when)
+	if toks[eq].Value != "=" {
+		description = fmt.Sprintf("Computes %s %s %s%s", target, toks[eq].Value, expr, when)
+	}
+	s.add(s.rule(info, st, RuleCalculation, description, s.data(toks)))
+}
+
+// returned records calculations returned by helper functions; handlers return responses
+func (s *ruleScan) returned(info *funcInfo, st *pyStmt) {
+	if len(st.Tokens) < 2 || s.isHandler(info.Ref) || !isCalculation("=", st.Tokens[1:]) {
+		return
+	}
+	description := fmt.Sprintf("%s returns %s", info.Fn.Qualname, s.expression(info, st.Tokens[1:]))
+	s.add(s.rule(info, st, RuleCalculation, description, s.data(st.Tokens[1:])))
+}
+
+func (s *ruleScan) isHandler(ref funcRef) bool {
+	for _, r := range s.p.Routes {
+		if r.Module == ref.Module && r.Handler == ref.Qualname {
+			return true
+		}
+	}
+	return false
+}
+
+// stateTarget returns the field of x.status or x["status"], if it holds state
+func stateTarget(toks []pyToken) string {
+	last := toks[len(toks)-1]
+	switch {
+	case last.Kind == tokName && stateField.MatchString(last.Value):
+		return last.Value
+	case last.Value == "]" && len(toks) >= 3 && toks[len(toks)-2].Kind == tokString:
+		if v := stringLiteralValue(toks[len(toks)-2].Value); stateField.MatchString(v) {
+			return v
+		}
+	}
+	return ""
+}
+
+// stateValue accepts a string literal or a named constant such as Status.SHIPPED
+func stateValue(value []pyToken) (string, bool) {
+	if len(value) == 1 && value[0].Kind == tokString && !isFString(value[0].Value) {
+		return strconv.Quote(stringLiteralValue(value[0].Value)), true
+	}
+	name := dottedName(value)
+	if name == "" || len(value) != 2*strings.Count(name, ".")+1 {
+		return "", false
+	}
+	if last := lastSegment(name); last == strings.ToUpper(last) && last != strings.ToLower(last) {
+		return name, true
+	}
+	return "", false
+}
+
+// isCalculation reports whether an assigned value is arithmetic on business
+// data rather than a counter, string building or a plain copy
+func isCalculation(op string, value []pyToken) bool {
+	arithmetic := op != "="
+	names := 0
+	for k, t := range value {
+		switch {
+		case t.Kind == tokString:
+			return false
+		case t.Kind == tokName && !isPyKeyword(t.Value) && !ruleBuiltins[t.Value] && (k == 0 || value[k-1].Value != "."):
+			names++
+		case t.Kind == tokOp:
+			switch t.Value {
+			case "*", "/", "//", "%", "**":
+				arithmetic = true
+			case "+", "-":
+				// A leading minus is a sign, not a calculation
+				if k > 0 {
+					arithmetic = true
+				}
+			}
+		case t.Kind == tokName && (t.Value == "round" || t.Value == "sum") && k+1 < len(value) && value[k+1].Value == "(":
+			arithmetic = true
+		}
+	}
+	if !arithmetic {
+		return false
+	}
+	// i += 1 and n = n - 1 are counters
+	if len(value) == 1 && value[0].Kind == tokNumber && (value[0].Value == "1" || op == "=") {
+		return false
+	}
+	if len(value) == 3 && value[2].Kind == tokNumber && value[2].Value == "1" && (value[1].Value == "+" || value[1].Value == "-") {
+		return false
+	}
+	return names > 0
+}
+
+// data lists the variables, request fields and columns read in toks
+func (s *ruleScan) data(toks []pyToken) []string {
+	var data []string
+	for k := 0; k < len(toks); k++ {
+		t := toks[k]
+		if t.Kind != tokName || isPyKeyword(t.Value) || (k > 0 && toks[k-1].Value == ".") {
+			continue
+		}
+		end := k + 1
+		for end+1 < len(toks) && toks[end].Value == "." && toks[end+1].Kind == tokName {
+			end += 2
+		}
+		name := joinValues(toks[k:end])
+		// x["key"] and x.get("key") read a field of x
+		switch {
+		case end+2 < len(toks) && toks[end].Value == "[" && toks[end+1].Kind == tokString && toks[end+2].Value == "]":
+			name += "." + stringLiteralValue(toks[end+1].Value)
+		case end < len(toks) && toks[end].Value == "(":
+			if strings.HasSuffix(name, ".get") && end+1 < len(toks) && toks[end+1].Kind == tokString {
+				name = strings.TrimSuffix(name, ".get") + "." + stringLiteralValue(toks[end+1].Value)
+			} else if i := strings.LastIndex(name, "."); i > 0 {
+				// order.total() reads order
+				name = name[:i]
+			} else {
+				name = ""
+			}
+		}
+		k = end - 1
+		if name == "" || ruleBuiltins[name] || len(name) == 1 {
+			continue
+		}
+		data = appendUnique(data, name)
+		// order.total is the total column of the orders table
+		head, _, _ := strings.Cut(name, ".")
+		for _, table := range s.columns[lastSegment(name)] {
+			if head != lastSegment(name) && (head == table || head == singular(table)) {
+				data = appendUnique(data, table+"."+lastSegment(name))
+			}
+		}
+	}
+	if len(data) > 8 {
+		data = data[:8]
+	}
+	return data
+}
+
+// decorators records authorization decorators such as @login_required on a view
+func (s *ruleScan) decorators(info *funcInfo, r Route) {
+	for _, d := range info.Fn.Decorators {
+		name := lastSegment(d.Name)
+		if !authDecorator.MatchString(name) {
+			continue
+		}
+		description := fmt.Sprintf("Only callers passing %s may use %s", name, r.Path)
+		switch {
+		case name == "login_required":
+			description = fmt.Sprintf("Only signed-in users may use %s", r.Path)
+		case len(d.Args) > 0:
+			var args []string
+			for _, a := range d.Args {
+				args = append(args, a.Value)
+			}
+			description = fmt.Sprintf("Only callers passing %s(%s) may use %s", name, strings.Join(args, ", "), r.Path)
+		}
+		s.add(BusinessRule{
+			Kind:        RuleAuthorization,
+			Description: description,
+			File:        info.Module.Path,
+			Line:        d.Line,
+			Function:    info.Fn.Qualname,
+			Handlers:    []string{r.Endpoint},
+			Data:        []string{},
+			Code:        "@" + d.Name,
+		})
+	}
+}
+
+// forms records the validators of WTForms fields, such as
+// email = StringField("Email", validators=[DataRequired(), Email()]), and adds
+// the form methods (validate_<field>) to scope
+func (s *ruleScan) forms(m *PyModule, scope map[funcRef]bool) {
+	f := s.p.py[m.Path]
+	if f == nil {
+		return
+	}
+	for _, c := range m.Classes {
+		isForm := false
+		for _, b := range c.Bases {
+			isForm = isForm || strings.HasSuffix(b, "Form")
+		}
+		if !isForm {
+			continue
+		}
+		// The form applies to the routes whose functions instantiate it
+		var endpoints []string
+		for ref, info := range s.g.funcs {
+			for _, call := range info.Fn.Calls {
+				if lastSegment(call.Name) == c.Name {
+					for _, e := range s.handlers[ref] {
+						endpoints = appendUnique(endpoints, e)
+					}
+				}
+			}
+		}
+		s.formRoutes[c.Name] = endpoints
+		for _, fn := range c.Methods {
+			ref := funcRef{Module: m.Name, Qualname: fn.Qualname}
+			scope[ref] = true
+			for _, e := range endpoints {
+				s.handlers[ref] = appendUnique(s.handlers[ref], e)
+			}
+		}
+		for _, st := range f.Stmts {
+			if st.Line != c.Line || st.keyword() != "class" {
+				continue
+			}
+			for _, attr := range st.Body {
+				s.formField(m, c, attr)
+			}
+		}
+	}
+}
+
+func (s *ruleScan) formField(m *PyModule, c PyClass, st *pyStmt) {
+	name, ok := assignmentTarget(st)
+	if !ok {
+		return
+	}
+	var constraints []string
+	for _, call := range collectCalls(s.p.py[m.Path].Src, []*pyStmt{st}) {
+		v := lastSegment(call.Name)
+		switch v {
+		case "Length":
+			constraints = append(constraints, boundsText("characters", keywordArg(call.Args, "min"), keywordArg(call.Args, "max")))
+		case "NumberRange":
+			constraints = append(constraints, boundsText("", keywordArg(call.Args, "min"), keywordArg(call.Args, "max")))
+		case "EqualTo":
+			constraints = append(constraints, "equal to "+strings.Trim(positionalArg(call.Args, 0, "fieldname"), `'"`))
+		case "Regexp":
+			constraints = append(constraints, "matching "+positionalArg(call.Args, 0, "regex"))
+		case "AnyOf", "NoneOf":
+			prefix := "one of "
+			if v == "NoneOf" {
+				prefix = "none of "
+			}
+			constraints = append(constraints, prefix+positionalArg(call.Args, 0, "values"))
+		default:
+			if text, ok := formValidators[v]; ok {
+				constraints = append(constraints, text)
+			}
+		}
+	}
+	if len(constraints) == 0 {
+		return
+	}
+	s.add(BusinessRule{
+		Kind:        RuleValidation,
+		Description: fmt.Sprintf("%s.%s must be %s", c.Name, name, joinAnd(constraints)),
+		File:        m.Path,
+		Line:        st.Line,
+		Function:    c.Name,
+		Handlers:    append([]string(nil), s.formRoutes[c.Name]...),
+		Data:        []string{"form." + name},
+		Code:        strings.TrimSpace(strings.SplitN(s.p.py[m.Path].Src[st.Tokens[0].Pos:st.Tokens[len(st.Tokens)-1].End], "\n", 2)[0]),
+	})
+}
+
+// boundsText describes a min/max pair: "between 8 and 64 characters"
+func boundsText(unit, min, max string) string {
+	suffix := ""
+	if unit != "" {
+		suffix = " " + unit
+	}
+	switch {
+	case min != "" && max != "":
+		return fmt.Sprintf("between %s and %s%s", min, max, suffix)
+	case min != "":
+		return fmt.Sprintf("at least %s%s", min, suffix)
+	case max != "":
+		return fmt.Sprintf("at most %s%s", max, suffix)
+	}
+	return "bounded"
+}
+
+// sqlTransition records UPDATE statements that set a state column to a literal,
+// with the state it moves from when the WHERE clause tests the same column
+func (s *ruleScan) sqlTransition(q Query) {
+	if q.Operation != "UPDATE" || len(q.Tables) == 0 {
+		return
+	}
+	m := sqlSetState.FindStringSubmatch(q.SQL)
+	if m == nil {
+		return
+	}
+	for _, assign := range strings.Split(m[1], ",") {
+		col, value, ok := strings.Cut(assign, "=")
+		col = strings.Trim(strings.TrimSpace(col), "`\"")
+		value = strings.TrimSpace(value)
+		if !ok || !stateField.MatchString(lastSegment(col)) || !strings.HasPrefix(value, "'") {
+			continue
+		}
+		description := fmt.Sprintf("Sets %s.%s to %s", q.Tables[0], lastSegment(col), value)
+		if from := regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(lastSegment(col)) + `\s*(=\s*'[^']*'|IN\s*\([^)]*\))`).FindStringSubmatch(m[2]); from != nil {
+			description = fmt.Sprintf("Moves %s.%s from %s to %s", q.Tables[0], lastSegment(col), strings.TrimSpace(strings.TrimPrefix(from[1], "=")), value)
+		}
+		s.add(BusinessRule{
+			Kind:        RuleStateTransition,
+			Description: description,
+			File:        q.File,
+			Line:        q.Line,
+			Function:    q.Function,
+			Handlers:    append([]string(nil), q.Handlers...),
+			Data:        []string{q.Tables[0] + "." + lastSegment(col)},
+			Code:        strings.Join(strings.Fields(q.SQL), " "),
+		})
+	}
+}
+
+func businessRulesMarkdown(rules []BusinessRule) string {
+	var sb strings.Builder
+	sb.WriteString("# Business rules\n\n")
+	counts := map[string]int{}
+	for _, r := range rules {
+		counts[r.Kind]++
+	}
+	fmt.Fprintf(&sb, "%d rules found in the route handlers and the functions they call: %d validation, %d authorization, %d state transition and %d calculation. ",
+		len(rules), counts[RuleValidation], counts[RuleAuthorization], counts[RuleStateTransition], counts[RuleCalculation])
+	sb.WriteString("The Go code marks the code implementing each rule with a `// BR-001` comment, which business_rules_trace.md checks.\n")
+
+	titles := map[string]string{
+		RuleValidation:      "Validation",
+		RuleAuthorization:   "Authorization",
+		RuleStateTransition: "State transitions",
+		RuleCalculation:     "Calculations",
+	}
+	for _, kind := range ruleKinds {
+		if counts[kind] == 0 {
+			continue
+		}
+		fmt.Fprintf(&sb, "\n## %s\n\n", titles[kind])
+		sb.WriteString("| ID | Rule | Location | Function | Routes | Data |\n|---|---|---|---|---|---|\n")
+		for _, r := range rules {
+			if r.Kind != kind {
+				continue
+			}
+			fmt.Fprintf(&sb, "| %s | %s | %s:%d | %s | %s | %s |\n", r.ID, markdownCell(r.Description), r.File, r.Line, r.Function,
+				strings.Join(r.Handlers, ", "), markdownCell(strings.Join(r.Data, ", ")))
+		}
+	}
+	return sb.String()
+}
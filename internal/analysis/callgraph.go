@@ -0,0 +1,149 @@
+package analysis
+
+import (
+	"sort"
+	"strings"
+)
+
+// funcRef identifies a function or method of the legacy code
+type funcRef struct {
+	Module   string
+	Qualname string
+}
+
+func (r funcRef) String() string { return r.Module + ":" + r.Qualname }
+
+// funcInfo is a function together with the module it is defined in
+type funcInfo struct {
+	Ref    funcRef
+	Module *PyModule
+	Fn     *PyFunction
+}
+
+// callGraph links functions to the legacy functions they call. Calls are resolved
+// by name: a definition in the same module wins, then one in a module the caller
+// imports. Calls that match neither (library calls) are dropped.
+type callGraph struct {
+	funcs   map[funcRef]*funcInfo
+	callees map[funcRef][]funcRef
+	callers map[funcRef][]funcRef
+}
+
+// callGraph builds the call graph once and caches it on the project
+func (p *Project) callGraph() *callGraph {
+	if p.calls != nil {
+		return p.calls
+	}
+	g := &callGraph{funcs: map[funcRef]*funcInfo{}, callees: map[funcRef][]funcRef{}, callers: map[funcRef][]funcRef{}}
+	byName := map[string][]*funcInfo{}
+	for _, m := range p.Modules {
+		add := func(fn *PyFunction) {
+			info := &funcInfo{Ref: funcRef{Module: m.Name, Qualname: fn.Qualname}, Module: m, Fn: fn}
+			g.funcs[info.Ref] = info
+			byName[fn.Name] = append(byName[fn.Name], info)
+		}
+		for i := range m.Functions {
+			add(&m.Functions[i])
+		}
+		for c := range m.Classes {
+			for i := range m.Classes[c].Methods {
+				add(&m.Classes[c].Methods[i])
+			}
+		}
+	}
+
+	imported := map[string]map[string]bool{}
+	if p.Graph != nil {
+		for _, e := range p.Graph.Edges {
+			if imported[e.From] == nil {
+				imported[e.From] = map[string]bool{}
+			}
+			imported[e.From][e.To] = true
+		}
+	}
+
+	refs := make([]funcRef, 0, len(g.funcs))
+	for ref := range g.funcs {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].String() < refs[j].String() })
+
+	for _, ref := range refs {
+		caller := g.funcs[ref]
+		seen := map[funcRef]bool{}
+		for _, c := range caller.Fn.Calls {
+			target := resolveCall(byName[lastSegment(c.Name)], caller, imported)
+			if target == nil || target.Ref == ref || seen[target.Ref] {
+				continue
+			}
+			seen[target.Ref] = true
+			g.callees[ref] = append(g.callees[ref], target.Ref)
+			g.callers[target.Ref] = append(g.callers[target.Ref], ref)
+		}
+	}
+	p.calls = g
+	return g
+}
+
+func resolveCall(candidates []*funcInfo, caller *funcInfo, imported map[string]map[string]bool) *funcInfo {
+	var fromImport *funcInfo
+	for _, c := range candidates {
+		if c.Module == caller.Module {
+			// self.method() resolves to the caller's class first
+			if strings.Contains(c.Ref.Qualname, ".") && strings.Contains(caller.Ref.Qualname, ".") {
+				if classOf(c.Ref.Qualname) != classOf(caller.Ref.Qualname) {
+					continue
+				}
+			}
+			return c
+		}
+		if fromImport == nil && imported[caller.Module.Name][c.Module.Name] {
+			fromImport = c
+		}
+	}
+	return fromImport
+}
+
+func classOf(qualname string) string {
+	return qualname[:strings.LastIndex(qualname, ".")+1]
+}
+
+// reachable returns the functions reachable from ref within depth calls, including ref
+func (g *callGraph) reachable(ref funcRef, depth int) []funcRef {
+	seen := map[funcRef]bool{ref: true}
+	out := []funcRef{ref}
+	frontier := []funcRef{ref}
+	for d := 0; d < depth && len(frontier) > 0; d++ {
+		var next []funcRef
+		for _, f := range frontier {
+			for _, c := range g.callees[f] {
+				if !seen[c] {
+					seen[c] = true
+					out = append(out, c)
+					next = append(next, c)
+				}
+			}
+		}
+		frontier = next
+	}
+	return out
+}
+
+// enclosingFunction returns the innermost function or method of m containing line
+func enclosingFunction(m *PyModule, line int) *PyFunction {
+	var best *PyFunction
+	consider := func(fn *PyFunction) {
+		if fn.Line <= line && line <= fn.EndLine && (best == nil || fn.Line >= best.Line) {
+			best = fn
+		}
+	}
+	for i := range m.Functions {
+		consider(&m.Functions[i])
+	}
+	for c := range m.Classes {
+		for i := range m.Classes[c].Methods {
+			consider(&m.Classes[c].Methods[i])
+		}
+	}
+	return best
+}
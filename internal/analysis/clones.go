@@ -0,0 +1,381 @@
+package analysis
+
+import (
+	"fmt"
+	"hash/fnv"
+	"lcma/internal/utils"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Clone detection settings: units shorter than cloneMinTokens are ignored, and
+// two units are clones when the Jaccard similarity of their winnowed k-gram
+// fingerprints reaches cloneThreshold. Fingerprints shared by more than
+// cloneMaxPosting units are boilerplate such as "return None" and do not make
+// units candidates for comparison.
+const (
+	cloneKGram      = 8
+	cloneWindow     = 4
+	cloneMinTokens  = 40
+	cloneThreshold  = 0.6
+	cloneMaxPosting = 50
+)
+
+// CloneMember is a function or template fragment that belongs to a clone cluster
+type CloneMember struct {
+	Kind      string `json:"kind"` // function or template
+	Name      string `json:"name"` // qualified function name or template:block
+	File      string `json:"file"`
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	Tokens    int    `json:"tokens"`
+}
+
+// CloneCluster is a group of near-duplicate units, a candidate for one shared helper
+type CloneCluster struct {
+	ID      string        `json:"id"`
+	Kind    string        `json:"kind"`
+	Members []CloneMember `json:"members"`
+	// Similarity is the lowest pairwise fingerprint similarity in the cluster
+	Similarity float64 `json:"similarity"`
+	Lines      int     `json:"lines"`      // total lines of all members
+	Duplicated int     `json:"duplicated"` // lines saved by keeping only the largest member
+	// Helper is the suggested name of the shared Go helper or Templ component
+	Helper string `json:"helper"`
+}
+
+// cloneUnit is a normalized token stream with its winnowed fingerprints
+type cloneUnit struct {
+	member       CloneMember
+	fingerprints map[uint64]bool
+}
+
+var (
+	htmlCloneToken = regexp.MustCompile(`\{\{.*?\}\}|\{%-?\s*\w+|-?%\}|</?[A-Za-z][\w-]*|[\w-]+=|"[^"\n]*"|'[^'\n]*'|\w+|[^\s\w]`)
+	cloneWord      = regexp.MustCompile(`^\w+$`)
+)
+
+// analyzeClones fingerprints functions and template fragments and groups near-duplicates
+func analyzeClones(p *Project) error {
+	var units []*cloneUnit
+	for _, m := range p.Modules {
+		units = append(units, functionUnits(p.py[m.Path], m)...)
+	}
+	for _, t := range p.Templates {
+		units = append(units, templateUnits(p, t)...)
+	}
+	p.Clones = cloneClusters(units)
+
+	if err := utils.WriteReportJSON("clones.json", map[string]any{
+		"k_gram": cloneKGram, "window": cloneWindow, "min_tokens": cloneMinTokens, "threshold": cloneThreshold,
+		"clusters": nonNil(p.Clones),
+	}); err != nil {
+		return err
+	}
+	return utils.WriteReportFile("clones.md", []byte(clonesMarkdown(p.Clones)))
+}
+
+// functionUnits normalizes every function and method: identifiers become N,
+// literals S and 0, and blocks { and }, so renamed copies still match
+func functionUnits(f *pyFile, m *PyModule) []*cloneUnit {
+	fns := append([]PyFunction{}, m.Functions...)
+	for _, c := range m.Classes {
+		fns = append(fns, c.Methods...)
+	}
+	var units []*cloneUnit
+	for _, fn := range fns {
+		var tokens []string
+		for _, t := range f.Tokens {
+			if t.Line < fn.Line || t.Line > fn.EndLine {
+				continue
+			}
+			switch {
+			case t.Kind == tokName && !isPyKeyword(t.Value):
+				tokens = append(tokens, "N")
+			case t.Kind == tokString:
+				tokens = append(tokens, "S")
+			case t.Kind == tokNumber:
+				tokens = append(tokens, "0")
+			case t.Kind == tokIndent:
+				tokens = append(tokens, "{")
+			case t.Kind == tokDedent:
+				tokens = append(tokens, "}")
+			case t.Kind == tokNewline:
+				tokens = append(tokens, ";")
+			default:
+				tokens = append(tokens, t.Value)
+			}
+		}
+		units = appendCloneUnit(units, CloneMember{Kind: "function", Name: m.Name + "." + fn.Qualname, File: m.Path, StartLine: fn.Line, EndLine: fn.EndLine}, tokens)
+	}
+	return units
+}
+
+// templateUnits normalizes the blocks and macros of a template, or the whole
+// template when it has neither: markup is kept, text and expressions are not
+func templateUnits(p *Project, t *Template) []*cloneUnit {
+	var lines []string
+	for _, f := range p.Corpus.Files {
+		if f.Path == t.Path {
+			lines = strings.Split(f.Content, "\n")
+			break
+		}
+	}
+	fragment := func(name string, start, end int) CloneMember {
+		return CloneMember{Kind: "template", Name: name, File: t.Path, StartLine: start, EndLine: end}
+	}
+
+	var members []CloneMember
+	var walk func(nodes []*jinjaNode)
+	walk = func(nodes []*jinjaNode) {
+		for _, n := range nodes {
+			if n.Kind == jinjaTag && (n.Tag == "block" || n.Tag == "macro") {
+				name, _, _ := strings.Cut(strings.TrimSpace(n.Expr), "(")
+				members = append(members, fragment(t.Name+":"+strings.TrimSpace(name), n.Line, jinjaEndLine(n)))
+			}
+			walk(n.Body)
+			for _, b := range n.Branches {
+				walk(b.Body)
+			}
+		}
+	}
+	walk(t.nodes)
+	if len(members) == 0 {
+		members = append(members, fragment(t.Name, 1, len(lines)))
+	}
+
+	var units []*cloneUnit
+	for _, member := range members {
+		if member.StartLine < 1 || member.EndLine > len(lines) {
+			continue
+		}
+		var tokens []string
+		for _, tok := range htmlCloneToken.FindAllString(strings.Join(lines[member.StartLine-1:member.EndLine], "\n"), -1) {
+			switch {
+			case strings.HasPrefix(tok, "{{"):
+				tokens = append(tokens, "{{E}}")
+			case strings.HasPrefix(tok, "{%"):
+				tokens = append(tokens, "{%"+strings.TrimLeft(tok[2:], "- \t\r\n"))
+			case strings.HasPrefix(tok, "\""), strings.HasPrefix(tok, "'"):
+				tokens = append(tokens, "S")
+			case cloneWord.MatchString(tok):
+				tokens = append(tokens, "T")
+			default:
+				tokens = append(tokens, strings.ToLower(tok))
+			}
+		}
+		units = appendCloneUnit(units, member, tokens)
+	}
+	return units
+}
+
+// jinjaEndLine returns the last line a node and its children span; the text
+// before an end tag runs up to the end tag's line
+func jinjaEndLine(n *jinjaNode) int {
+	end := n.Line + strings.Count(n.Expr, "\n")
+	for _, c := range n.Body {
+		end = max(end, jinjaEndLine(c))
+	}
+	for _, b := range n.Branches {
+		for _, c := range b.Body {
+			end = max(end, jinjaEndLine(c))
+		}
+	}
+	return end
+}
+
+func appendCloneUnit(units []*cloneUnit, member CloneMember, tokens []string) []*cloneUnit {
+	if len(tokens) < cloneMinTokens {
+		return units
+	}
+	member.Tokens = len(tokens)
+	return append(units, &cloneUnit{member: member, fingerprints: winnow(tokens)})
+}
+
+// winnow selects the minimum k-gram hash of every window of cloneWindow hashes
+// (Schleimer et al., "Winnowing: local algorithms for document fingerprinting")
+func winnow(tokens []string) map[uint64]bool {
+	var hashes []uint64
+	for i := 0; i+cloneKGram <= len(tokens); i++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(tokens[i:i+cloneKGram], "\x00")))
+		hashes = append(hashes, h.Sum64())
+	}
+	fingerprints := map[uint64]bool{}
+	for i := 0; i+cloneWindow <= len(hashes); i++ {
+		minAt := i
+		for j := i + 1; j < i+cloneWindow; j++ {
+			if hashes[j] <= hashes[minAt] {
+				minAt = j
+			}
+		}
+		fingerprints[hashes[minAt]] = true
+	}
+	return fingerprints
+}
+
+// cloneClusters links units whose fingerprints are similar enough and returns
+// the connected groups, largest first
+func cloneClusters(units []*cloneUnit) []CloneCluster {
+	// Only units sharing a fingerprint are compared
+	index := map[uint64][]int{}
+	for i, u := range units {
+		for fp := range u.fingerprints {
+			index[fp] = append(index[fp], i)
+		}
+	}
+	parent := make([]int, len(units))
+	// minSimilarity is the lowest similarity of the links merged into each root
+	minSimilarity := make([]float64, len(units))
+	for i := range parent {
+		parent[i] = i
+		minSimilarity[i] = 1
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i, u := range units {
+		candidates := map[int]bool{}
+		for fp := range u.fingerprints {
+			if len(index[fp]) > cloneMaxPosting {
+				continue
+			}
+			for _, j := range index[fp] {
+				if j > i {
+					candidates[j] = true
+				}
+			}
+		}
+		for j := range candidates {
+			v := units[j]
+			if u.member.Kind != v.member.Kind || overlaps(u.member, v.member) {
+				continue
+			}
+			// The Jaccard similarity cannot reach the threshold when the sizes differ too much
+			small, large := min(len(u.fingerprints), len(v.fingerprints)), max(len(u.fingerprints), len(v.fingerprints))
+			if float64(small) < cloneThreshold*float64(large) {
+				continue
+			}
+			if s := jaccard(u.fingerprints, v.fingerprints); s >= cloneThreshold {
+				a, b := find(i), find(j)
+				parent[a] = b
+				minSimilarity[b] = min(minSimilarity[a], minSimilarity[b], s)
+			}
+		}
+	}
+
+	groups := map[int][]int{}
+	for i := range units {
+		groups[find(i)] = append(groups[find(i)], i)
+	}
+	var clusters []CloneCluster
+	for root, members := range groups {
+		if len(members) < 2 {
+			continue
+		}
+		sort.Ints(members)
+		c := CloneCluster{Kind: units[members[0]].member.Kind, Similarity: minSimilarity[root]}
+		largest := 0
+		for _, i := range members {
+			m := units[i].member
+			c.Members = append(c.Members, m)
+			lines := m.EndLine - m.StartLine + 1
+			c.Lines += lines
+			largest = max(largest, lines)
+		}
+		c.Duplicated = c.Lines - largest
+		c.Helper = cloneHelperName(c)
+		clusters = append(clusters, c)
+	}
+
+	sort.Slice(clusters, func(i, j int) bool {
+		a, b := clusters[i], clusters[j]
+		if a.Duplicated != b.Duplicated {
+			return a.Duplicated > b.Duplicated
+		}
+		if len(a.Members) != len(b.Members) {
+			return len(a.Members) > len(b.Members)
+		}
+		return a.Members[0].Name < b.Members[0].Name
+	})
+	for i := range clusters {
+		clusters[i].ID = fmt.Sprintf("C%d", i+1)
+	}
+	return clusters
+}
+
+// overlaps reports whether two units cover the same lines, e.g. nested blocks
+func overlaps(a, b CloneMember) bool {
+	return a.File == b.File && a.StartLine <= b.EndLine && b.StartLine <= a.EndLine
+}
+
+// jaccard is the share of fingerprints two units have in common
+func jaccard(a, b map[uint64]bool) float64 {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	if len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for fp := range a {
+		if b[fp] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// cloneHelperName suggests a Go name from the words all member names share,
+// so get_user_by_id and get_post_by_id become GetById
+func cloneHelperName(c CloneCluster) string {
+	split := func(m CloneMember) []string {
+		name := m.Name[strings.LastIndexAny(m.Name, ".:")+1:]
+		return strings.FieldsFunc(strings.ToLower(name), func(r rune) bool { return r == '_' || r == '-' || r == '/' })
+	}
+	common := split(c.Members[0])
+	for _, m := range c.Members[1:] {
+		words := split(m)
+		var kept []string
+		for _, w := range common {
+			if containsString(words, w) {
+				kept = append(kept, w)
+			}
+		}
+		common = kept
+	}
+	name := "shared"
+	if len(common) > 0 {
+		name = strings.Join(common, "_")
+	}
+	if c.Kind == "template" {
+		return goName(name) + "Fragment"
+	}
+	return goName(name)
+}
+
+// clonesMarkdown renders the clusters for the prompts and readers
+func clonesMarkdown(clusters []CloneCluster) string {
+	var sb strings.Builder
+	sb.WriteString("# Code clones\n\n")
+	duplicated := 0
+	for _, c := range clusters {
+		duplicated += c.Duplicated
+	}
+	fmt.Fprintf(&sb, "%d clusters of near-duplicate functions and template fragments, %d duplicated lines. Each cluster is a refactoring candidate: implement it once as the suggested Go helper or Templ component and call it from every member.\n",
+		len(clusters), duplicated)
+	for _, c := range clusters {
+		fmt.Fprintf(&sb, "\n## %s: %s (%s, %d members, %.0f%% similar, %d duplicated lines)\n\n", c.ID, c.Helper, c.Kind, len(c.Members), c.Similarity*100, c.Duplicated)
+		sb.WriteString("| Member | Location | Lines | Tokens |\n|---|---|---|---|\n")
+		for _, m := range c.Members {
+			fmt.Fprintf(&sb, "| %s | %s:%d-%d | %d | %d |\n", m.Name, m.File, m.StartLine, m.EndLine, m.EndLine-m.StartLine+1, m.Tokens)
+		}
+	}
+	return sb.String()
+}
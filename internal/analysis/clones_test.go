@@ -0,0 +1,107 @@
+package analysis
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// cloneTokens returns n distinct tokens starting at from
+func cloneTokens(from, n int) []string {
+	var toks []string
+	for i := from; i < from+n; i++ {
+		toks = append(toks, fmt.Sprintf("t%d", i))
+	}
+	return toks
+}
+
+func TestWinnow(t *testing.T) {
+	if got := winnow(cloneTokens(0, cloneKGram-1)); len(got) != 0 {
+		t.Errorf("fewer tokens than a k-gram gave %d fingerprints", len(got))
+	}
+	a := winnow(cloneTokens(0, 60))
+	if len(a) == 0 {
+		t.Fatal("no fingerprints")
+	}
+	// Every window of cloneWindow hashes keeps one, so at least one per window span
+	if minimum := (60 - cloneKGram + 1) / cloneWindow; len(a) < minimum {
+		t.Errorf("got %d fingerprints, want at least %d", len(a), minimum)
+	}
+	if b := winnow(cloneTokens(0, 60)); jaccard(a, b) != 1 {
+		t.Error("identical token streams have different fingerprints")
+	}
+	// A shared middle part keeps shared fingerprints despite a different prefix
+	shifted := append(cloneTokens(1000, 5), cloneTokens(0, 60)...)
+	if s := jaccard(a, winnow(shifted)); s < cloneThreshold {
+		t.Errorf("similarity after adding a prefix = %.2f, want at least %.2f", s, cloneThreshold)
+	}
+}
+
+func TestJaccard(t *testing.T) {
+	set := func(fps ...uint64) map[uint64]bool {
+		m := map[uint64]bool{}
+		for _, fp := range fps {
+			m[fp] = true
+		}
+		return m
+	}
+	tests := []struct {
+		name string
+		a, b map[uint64]bool
+		want float64
+	}{
+		{"empty", set(), set(), 0},
+		{"one empty", set(1, 2), set(), 0},
+		{"identical", set(1, 2, 3), set(1, 2, 3), 1},
+		{"disjoint", set(1, 2), set(3, 4), 0},
+		{"half", set(1, 2, 3), set(2, 3, 4), 0.5},
+		{"subset", set(1, 2), set(1, 2, 3, 4), 0.5},
+	}
+	for _, tt := range tests {
+		if got := jaccard(tt.a, tt.b); got != tt.want {
+			t.Errorf("%s: jaccard = %v, want %v", tt.name, got, tt.want)
+		}
+		if got := jaccard(tt.b, tt.a); got != tt.want {
+			t.Errorf("%s: jaccard is not symmetric: %v", tt.name, got)
+		}
+	}
+}
+
+func TestCloneClusters(t *testing.T) {
+	unit := func(kind, name, file string, start int, toks []string) *cloneUnit {
+		return &cloneUnit{member: CloneMember{Kind: kind, Name: name, File: file, StartLine: start, EndLine: start + 9, Tokens: len(toks)}, fingerprints: winnow(toks)}
+	}
+	body := cloneTokens(0, 80)
+	units := []*cloneUnit{
+		unit("function", "get_user", "a.py", 1, body),
+		unit("function", "get_post", "b.py", 1, body),
+		unit("function", "get_tag", "c.py", 1, append(cloneTokens(500, 4), body...)),
+		// Same tokens but a template: never clustered with functions
+		unit("template", "page.html:body", "page.html", 1, body),
+		unit("function", "unrelated", "d.py", 1, cloneTokens(2000, 80)),
+	}
+	clusters := cloneClusters(units)
+	if len(clusters) != 1 {
+		t.Fatalf("got %d clusters, want 1: %+v", len(clusters), clusters)
+	}
+	c := clusters[0]
+	var names []string
+	for _, m := range c.Members {
+		names = append(names, m.Name)
+	}
+	if got := strings.Join(names, ","); got != "get_user,get_post,get_tag" {
+		t.Errorf("members = %s", got)
+	}
+	if c.Similarity < cloneThreshold || c.Similarity >= 1 {
+		t.Errorf("similarity = %.2f, want the lowest link, in [%.2f, 1)", c.Similarity, cloneThreshold)
+	}
+	if c.ID != "C1" || c.Lines != 30 || c.Duplicated != 20 {
+		t.Errorf("cluster = %+v", c)
+	}
+
+	// A block nested in a function is not a clone of it
+	nested := []*cloneUnit{unit("function", "outer", "a.py", 1, body), unit("function", "outer.inner", "a.py", 3, body)}
+	if clusters := cloneClusters(nested); len(clusters) != 0 {
+		t.Errorf("overlapping units were clustered: %+v", clusters)
+	}
+}
@@ -0,0 +1,572 @@
+package analysis
+
+import (
+	"fmt"
+	"lcma/internal/utils"
+	"math"
+	"sort"
+	"strings"
+)
+
+// BoundedContext is a group of legacy modules that work on the same data and
+// URL space, proposed as one Go package or service
+type BoundedContext struct {
+	Name          string   `json:"name"`
+	Package       string   `json:"package"` // Go import path below the module root
+	Modules       []string `json:"modules"`
+	Routes        []string `json:"routes,omitempty"`
+	RoutePrefixes []string `json:"route_prefixes,omitempty"`
+	Tables        []string `json:"tables,omitempty"`        // used by no other context
+	SharedTables  []string `json:"shared_tables,omitempty"` // also used by other contexts
+	// Cohesion is the share of the context's link weight that stays inside it
+	Cohesion float64 `json:"cohesion"`
+	// Proposal is "service", "package" or "shared"
+	Proposal  string   `json:"proposal"`
+	Rationale []string `json:"rationale"`
+}
+
+// ContextLink is the coupling between two contexts
+type ContextLink struct {
+	From         string   `json:"from"`
+	To           string   `json:"to"`
+	Imports      int      `json:"imports"` // imports from modules of From into modules of To
+	SharedTables []string `json:"shared_tables,omitempty"`
+}
+
+// ContextMap is the layout of bounded_contexts.json
+type ContextMap struct {
+	Signals  string           `json:"signals"`
+	Contexts []BoundedContext `json:"contexts"`
+	Links    []ContextLink    `json:"links"`
+	// Entrypoints only wire the contexts together, such as the app factory; they become cmd/ main
+	Entrypoints []string `json:"entrypoints,omitempty"`
+	// Unassigned modules neither import nor are imported by another module
+	Unassigned []string `json:"unassigned,omitempty"`
+}
+
+// Link weights between two modules
+const (
+	contextWeightImport = 1.0 // per import between them
+	contextWeightTable  = 2.0 // per table both query
+	contextWeightPrefix = 3.0 // per route prefix or blueprint both serve
+
+	// sharedContext names the shared kernel of support modules used by several contexts
+	sharedContext = "platform"
+
+	// serviceCoupling is the most cross-context link weight share a service candidate may have
+	serviceCoupling = 0.25
+)
+
+var contextSignals = fmt.Sprintf("modules are linked by imports (weight %.0f each), tables queried by both (%.0f each) and "+
+	"route prefixes or blueprints served by both (%.0f each), then merged greedily while modularity increases",
+	contextWeightImport, contextWeightTable, contextWeightPrefix)
+
+// analyzeContexts clusters the modules into candidate bounded contexts and
+// proposes a Go package or service split with its rationale
+func analyzeContexts(p *Project) error {
+	cm := buildContextMap(p)
+	p.Contexts = cm
+	if err := utils.WriteReportJSON("bounded_contexts.json", cm); err != nil {
+		return err
+	}
+	return utils.WriteReportFile("bounded_contexts.md", []byte(contextsMarkdown(cm)))
+}
+
+// moduleFacts are the tables and route prefixes of one module
+type moduleFacts struct {
+	tables   []string
+	prefixes []string
+	routes   []string
+}
+
+func buildContextMap(p *Project) *ContextMap {
+	cm := &ContextMap{Signals: contextSignals, Contexts: []BoundedContext{}, Links: []ContextLink{}}
+	var names []string
+	facts := map[string]*moduleFacts{}
+	nameByPath := map[string]string{}
+	for _, m := range p.Modules {
+		names = append(names, m.Name)
+		facts[m.Name] = &moduleFacts{}
+		nameByPath[m.Path] = m.Name
+	}
+	sort.Strings(names)
+	if p.Schema != nil {
+		for _, q := range p.Schema.Queries {
+			if f, ok := facts[nameByPath[q.File]]; ok {
+				for _, t := range q.Tables {
+					f.tables = appendUnique(f.tables, t)
+				}
+			}
+		}
+	}
+	for _, r := range p.Routes {
+		if f, ok := facts[r.Module]; ok {
+			f.routes = append(f.routes, strings.Join(r.Methods, ",")+" "+r.Path)
+			if prefix := routePrefix(r); prefix != "" {
+				f.prefixes = appendUnique(f.prefixes, prefix)
+			}
+		}
+	}
+
+	// Weighted undirected module graph
+	weights := map[[2]string]float64{}
+	link := func(a, b string, w float64) {
+		if a == b {
+			return
+		}
+		if a > b {
+			a, b = b, a
+		}
+		weights[[2]string{a, b}] += w
+	}
+	if p.Graph != nil {
+		for _, e := range p.Graph.Edges {
+			if facts[e.From] != nil && facts[e.To] != nil {
+				link(e.From, e.To, contextWeightImport)
+			}
+		}
+	}
+	for i, a := range names {
+		for _, b := range names[i+1:] {
+			link(a, b, contextWeightTable*float64(len(intersect(facts[a].tables, facts[b].tables))))
+			link(a, b, contextWeightPrefix*float64(len(intersect(facts[a].prefixes, facts[b].prefixes))))
+		}
+	}
+
+	// Modules with routes or tables carry the domain and are clustered; the
+	// support modules follow the contexts that import them
+	var domain, support []string
+	for _, n := range names {
+		if len(facts[n].routes) > 0 || len(facts[n].tables) > 0 {
+			domain = append(domain, n)
+		} else {
+			support = append(support, n)
+		}
+	}
+	for _, members := range modularityClusters(domain, weights) {
+		cm.Contexts = append(cm.Contexts, newBoundedContext(members, facts))
+	}
+	nameContexts(cm.Contexts, facts)
+	contextOf := map[string]int{}
+	for i, c := range cm.Contexts {
+		for _, m := range c.Modules {
+			contextOf[m] = i
+		}
+	}
+	assignSupportModules(p, cm, support, contextOf)
+
+	links := contextLinks(p, cm, contextOf)
+	proposeSplit(cm, links, weights, contextOf)
+	return cm
+}
+
+// assignSupportModules puts a support module in the one context importing it,
+// in the shared kernel when several contexts import it, and lists modules that
+// only import others as entrypoints
+func assignSupportModules(p *Project, cm *ContextMap, support []string, contextOf map[string]int) {
+	importers := map[string][]string{}
+	fanOut := map[string]int{}
+	if p.Graph != nil {
+		for _, e := range p.Graph.Edges {
+			importers[e.To] = append(importers[e.To], e.From)
+			fanOut[e.From]++
+		}
+	}
+	shared := BoundedContext{Name: sharedContext, Package: "internal/" + sharedContext, Proposal: "shared"}
+	sharedUsers := map[string]bool{}
+	for _, n := range support {
+		contexts := map[int]bool{}
+		for _, from := range importers[n] {
+			if c, ok := contextOf[from]; ok {
+				contexts[c] = true
+			}
+		}
+		switch {
+		case len(contexts) == 1:
+			for c := range contexts {
+				cm.Contexts[c].Modules = append(cm.Contexts[c].Modules, n)
+				sort.Strings(cm.Contexts[c].Modules)
+				contextOf[n] = c
+			}
+		case len(contexts) > 1 || len(importers[n]) > 0:
+			shared.Modules = append(shared.Modules, n)
+			for c := range contexts {
+				sharedUsers[cm.Contexts[c].Name] = true
+			}
+		case fanOut[n] > 0:
+			cm.Entrypoints = append(cm.Entrypoints, n)
+		default:
+			cm.Unassigned = append(cm.Unassigned, n)
+		}
+	}
+	if len(shared.Modules) > 0 {
+		shared.Cohesion = 1
+		shared.Rationale = []string{fmt.Sprintf("%d modules without routes or tables", len(shared.Modules))}
+		if len(sharedUsers) > 0 {
+			shared.Rationale = append(shared.Rationale, "imported by "+strings.Join(sortedKeys(sharedUsers), ", ")+
+				"; keep it a library package every context links, not a service")
+		}
+		for _, m := range shared.Modules {
+			contextOf[m] = len(cm.Contexts)
+		}
+		cm.Contexts = append(cm.Contexts, shared)
+	}
+}
+
+// routePrefix is the blueprint of a route, or its first static path segment
+func routePrefix(r Route) string {
+	if r.Blueprint != "" {
+		return "blueprint " + r.Blueprint
+	}
+	for _, seg := range strings.Split(r.Path, "/") {
+		if seg != "" && !strings.HasPrefix(seg, "<") {
+			return "/" + seg
+		}
+		if seg != "" {
+			break
+		}
+	}
+	return ""
+}
+
+// modularityClusters starts with one cluster per module and merges the pair
+// that raises modularity most until no merge helps (Clauset-Newman-Moore)
+func modularityClusters(names []string, weights map[[2]string]float64) [][]string {
+	total := 0.0
+	clusters := make([][]string, len(names))
+	index := map[string]int{}
+	for i, n := range names {
+		clusters[i] = []string{n}
+		index[n] = i
+	}
+	// between[a][b] is the link weight between clusters a and b, merged as they are
+	between := make([][]float64, len(names))
+	degrees := make([]float64, len(names))
+	for i := range between {
+		between[i] = make([]float64, len(names))
+	}
+	// Sorted keys keep the float sums, and so the merges, deterministic
+	keys := make([][2]string, 0, len(weights))
+	for k := range weights {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i][0]+"\x00"+keys[i][1] < keys[j][0]+"\x00"+keys[j][1] })
+	for _, k := range keys {
+		w := weights[k]
+		a, ok1 := index[k[0]]
+		b, ok2 := index[k[1]]
+		if ok1 && ok2 {
+			between[a][b] += w
+			between[b][a] += w
+			degrees[a] += w
+			degrees[b] += w
+			total += w
+		}
+	}
+	for total > 0 {
+		bestA, bestB, bestGain := -1, -1, 1e-9
+		for a := range clusters {
+			if clusters[a] == nil {
+				continue
+			}
+			for b := a + 1; b < len(clusters); b++ {
+				if clusters[b] == nil || between[a][b] == 0 {
+					continue
+				}
+				gain := between[a][b]/total - degrees[a]*degrees[b]/(2*total*total)
+				if gain > bestGain {
+					bestA, bestB, bestGain = a, b, gain
+				}
+			}
+		}
+		if bestA < 0 {
+			break
+		}
+		clusters[bestA] = append(clusters[bestA], clusters[bestB]...)
+		degrees[bestA] += degrees[bestB]
+		for c := range clusters {
+			between[bestA][c] += between[bestB][c]
+			between[c][bestA] = between[bestA][c]
+		}
+		between[bestA][bestA] = 0
+		clusters[bestB] = nil
+	}
+
+	var out [][]string
+	for _, c := range clusters {
+		if c != nil {
+			sort.Strings(c)
+			out = append(out, c)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if len(out[i]) != len(out[j]) {
+			return len(out[i]) > len(out[j])
+		}
+		return out[i][0] < out[j][0]
+	})
+	return out
+}
+
+func newBoundedContext(members []string, facts map[string]*moduleFacts) BoundedContext {
+	c := BoundedContext{Modules: members}
+	for _, m := range members {
+		c.Routes = append(c.Routes, facts[m].routes...)
+		for _, t := range facts[m].tables {
+			c.Tables = appendUnique(c.Tables, t)
+		}
+		for _, prefix := range facts[m].prefixes {
+			c.RoutePrefixes = appendUnique(c.RoutePrefixes, prefix)
+		}
+	}
+	sort.Strings(c.Tables)
+	sort.Strings(c.RoutePrefixes)
+	return c
+}
+
+// nameContexts names each context after its main route prefix, else its most
+// used table, else its first module, and derives a unique Go package
+func nameContexts(contexts []BoundedContext, facts map[string]*moduleFacts) {
+	used := map[string]bool{sharedContext: true}
+	for i := range contexts {
+		c := &contexts[i]
+		counts := map[string]int{}
+		for _, m := range c.Modules {
+			for _, prefix := range facts[m].prefixes {
+				counts[strings.TrimPrefix(strings.TrimPrefix(prefix, "blueprint "), "/")] += 2
+			}
+			for _, t := range facts[m].tables {
+				counts[t]++
+			}
+		}
+		name, best := "", 0
+		for _, k := range sortedKeys(counts) {
+			if counts[k] > best {
+				name, best = k, counts[k]
+			}
+		}
+		if name == "" {
+			name = lastSegment(c.Modules[0])
+		}
+		pkg := goPackageName(name)
+		for n := 2; used[pkg]; n++ {
+			pkg = fmt.Sprintf("%s%d", goPackageName(name), n)
+		}
+		used[pkg] = true
+		c.Name, c.Package = pkg, "internal/"+pkg
+	}
+}
+
+// goPackageName lowercases name and drops characters Go package names avoid
+func goPackageName(name string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (sb.Len() > 0 && r >= '0' && r <= '9') {
+			sb.WriteRune(r)
+		}
+	}
+	if sb.Len() == 0 {
+		return "app"
+	}
+	return sb.String()
+}
+
+// contextLinks counts the imports and tables between contexts and moves tables
+// used by several contexts to SharedTables
+func contextLinks(p *Project, cm *ContextMap, contextOf map[string]int) []ContextLink {
+	users := map[string][]int{}
+	for i, c := range cm.Contexts {
+		for _, t := range c.Tables {
+			users[t] = append(users[t], i)
+		}
+	}
+	byPair := map[[2]int]*ContextLink{}
+	pair := func(a, b int) *ContextLink {
+		if l, ok := byPair[[2]int{a, b}]; ok {
+			return l
+		}
+		l := &ContextLink{From: cm.Contexts[a].Name, To: cm.Contexts[b].Name}
+		byPair[[2]int{a, b}] = l
+		return l
+	}
+	if p.Graph != nil {
+		for _, e := range p.Graph.Edges {
+			a, ok1 := contextOf[e.From]
+			b, ok2 := contextOf[e.To]
+			if ok1 && ok2 && a != b {
+				pair(a, b).Imports++
+			}
+		}
+	}
+	for _, t := range sortedKeys(users) {
+		ctxs := users[t]
+		if len(ctxs) < 2 {
+			continue
+		}
+		for i, a := range ctxs {
+			for _, b := range ctxs[i+1:] {
+				l := pair(a, b)
+				l.SharedTables = append(l.SharedTables, t)
+			}
+		}
+		for _, c := range ctxs {
+			cm.Contexts[c].SharedTables = append(cm.Contexts[c].SharedTables, t)
+			cm.Contexts[c].Tables = removeString(cm.Contexts[c].Tables, t)
+		}
+	}
+	keys := make([][2]int, 0, len(byPair))
+	for k := range byPair {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	for _, k := range keys {
+		cm.Links = append(cm.Links, *byPair[k])
+	}
+	return cm.Links
+}
+
+// proposeSplit decides per context between a separate service, a package of the
+// Go app and a shared package, and records why
+func proposeSplit(cm *ContextMap, links []ContextLink, weights map[[2]string]float64, contextOf map[string]int) {
+	// Links into the shared kernel are library use, not coupling between contexts
+	isShared := func(c int) bool { return cm.Contexts[c].Name == sharedContext }
+	internal, external := make([]float64, len(cm.Contexts)), make([]float64, len(cm.Contexts))
+	for k, w := range weights {
+		a, ok1 := contextOf[k[0]]
+		b, ok2 := contextOf[k[1]]
+		switch {
+		case !ok1 || !ok2 || isShared(a) || isShared(b):
+		case a == b:
+			internal[a] += w
+		default:
+			external[a] += w
+			external[b] += w
+		}
+	}
+	dependents := map[string][]string{}
+	for _, l := range links {
+		if l.Imports > 0 {
+			dependents[l.To] = appendUnique(dependents[l.To], l.From)
+		}
+	}
+
+	domains := 0
+	for i := range cm.Contexts {
+		if !isShared(i) {
+			domains++
+		}
+	}
+	for i := range cm.Contexts {
+		c := &cm.Contexts[i]
+		if isShared(i) {
+			continue
+		}
+		coupling := 0.0
+		if total := internal[i] + external[i]; total > 0 {
+			c.Cohesion = math.Round(internal[i]/total*100) / 100
+			coupling = external[i] / total
+		} else {
+			c.Cohesion = 1
+		}
+		c.Rationale = append(c.Rationale, fmt.Sprintf("%d modules, %d routes, cohesion %.2f", len(c.Modules), len(c.Routes), c.Cohesion))
+		if len(c.RoutePrefixes) > 0 {
+			c.Rationale = append(c.Rationale, "serves "+strings.Join(c.RoutePrefixes, ", "))
+		}
+		if len(c.Tables) > 0 {
+			c.Rationale = append(c.Rationale, "sole user of tables "+strings.Join(c.Tables, ", "))
+		}
+		if len(c.SharedTables) > 0 {
+			c.Rationale = append(c.Rationale, "shares tables "+strings.Join(c.SharedTables, ", ")+" with other contexts")
+		}
+
+		switch {
+		case domains == 1:
+			c.Proposal = "package"
+			c.Rationale = append(c.Rationale, "the whole application is one context; keep a single Go app with this package")
+		case len(c.Routes) == 0 && len(dependents[c.Name]) >= 2:
+			c.Proposal = "shared"
+			c.Rationale = append(c.Rationale, fmt.Sprintf("has no routes and is imported by %s; make it a shared library package",
+				strings.Join(dependents[c.Name], ", ")))
+		case len(c.Routes) > 0 && len(c.Tables) > 0 && len(c.SharedTables) == 0 && coupling <= serviceCoupling:
+			c.Proposal = "service"
+			c.Rationale = append(c.Rationale, fmt.Sprintf("owns its data and only %.0f%% of its links cross the boundary; it can be deployed as a separate service", coupling*100))
+		default:
+			c.Proposal = "package"
+			switch {
+			case len(c.SharedTables) > 0:
+				c.Rationale = append(c.Rationale, "shared tables tie it to the monolith; split the data before making it a service")
+			case coupling > serviceCoupling:
+				c.Rationale = append(c.Rationale, fmt.Sprintf("%.0f%% of its links cross the boundary; keep it in-process", coupling*100))
+			default:
+				c.Rationale = append(c.Rationale, "has no routes or tables of its own to justify a service")
+			}
+		}
+	}
+}
+
+// contextsMarkdown renders the proposed split and the coupling between contexts
+func contextsMarkdown(cm *ContextMap) string {
+	var sb strings.Builder
+	sb.WriteString("# Bounded contexts\n\n")
+	services := 0
+	for _, c := range cm.Contexts {
+		if c.Proposal == "service" {
+			services++
+		}
+	}
+	fmt.Fprintf(&sb, "%d candidate contexts, %d proposed as separate services. Method: %s.\n", len(cm.Contexts), services, cm.Signals)
+	if len(cm.Contexts) > 0 {
+		sb.WriteString("\n| Context | Go package | Proposal | Modules | Routes | Own tables | Shared tables | Cohesion |\n|---|---|---|---|---|---|---|---|\n")
+		for _, c := range cm.Contexts {
+			fmt.Fprintf(&sb, "| %s | %s | %s | %s | %d | %s | %s | %.2f |\n", c.Name, c.Package, c.Proposal, strings.Join(c.Modules, ", "),
+				len(c.Routes), strings.Join(c.Tables, ", "), strings.Join(c.SharedTables, ", "), c.Cohesion)
+		}
+		for _, c := range cm.Contexts {
+			fmt.Fprintf(&sb, "\n## %s (%s)\n\n", c.Name, c.Proposal)
+			for _, r := range c.Rationale {
+				sb.WriteString("- " + r + "\n")
+			}
+		}
+	}
+	if len(cm.Links) > 0 {
+		sb.WriteString("\n## Coupling\n\n| From | To | Imports | Shared tables |\n|---|---|---|---|\n")
+		for _, l := range cm.Links {
+			fmt.Fprintf(&sb, "| %s | %s | %d | %s |\n", l.From, l.To, l.Imports, strings.Join(l.SharedTables, ", "))
+		}
+	}
+	if len(cm.Entrypoints) > 0 {
+		fmt.Fprintf(&sb, "\nEntrypoints wiring the contexts, to become the Go main package under cmd/: %s.\n", strings.Join(cm.Entrypoints, ", "))
+	}
+	if len(cm.Unassigned) > 0 {
+		fmt.Fprintf(&sb, "\nModules that neither import nor are imported by another module: %s.\n", strings.Join(cm.Unassigned, ", "))
+	}
+	return sb.String()
+}
+
+func intersect(a, b []string) []string {
+	var out []string
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				out = append(out, x)
+				break
+			}
+		}
+	}
+	return out
+}
+
+func removeString(list []string, s string) []string {
+	out := list[:0]
+	for _, v := range list {
+		if v != s {
+			out = append(out, v)
+		}
+	}
+	return out
+}
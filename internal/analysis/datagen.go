@@ -0,0 +1,920 @@
+package analysis
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"lcma/internal/utils"
+	"path"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// dataOutputDir is where the generated data layer package is written, relative to REPORT_PATH
+const dataOutputDir = "db"
+
+// DataLayer is the Go data layer generated from the schema
+type DataLayer struct {
+	Package      string           `json:"package"`
+	Files        []string         `json:"files"` // relative to REPORT_PATH
+	Repositories []DataRepository `json:"repositories"`
+	Migrations   []string         `json:"migrations"`
+	// Custom are the legacy queries the generated CRUD methods do not cover
+	Custom []Query `json:"custom_queries"`
+	// Notes are the tables left out because their Go could not be generated
+	Notes []string `json:"notes,omitempty"`
+}
+
+// DataRepository is the model and repository generated for one table
+type DataRepository struct {
+	Table      string   `json:"table"`
+	Model      string   `json:"model"`
+	Repository string   `json:"repository"`
+	File       string   `json:"file"`
+	Methods    []string `json:"methods"`
+	Notes      []string `json:"notes,omitempty"`
+}
+
+// dataTable is a table prepared for the Go and SQL templates
+type dataTable struct {
+	Name     string
+	Ident    string // quoted when the name needs it
+	Label    string // name safe inside Go comments and strings
+	Struct   string
+	Repo     string
+	File     string
+	Inferred bool
+	Columns  []dataColumn
+	Key      []dataColumn
+	// KeyParams and KeyArgs are the key as Go parameters and arguments
+	KeyParams, KeyArgs string
+	ForeignKeys        []dataForeignKey
+	GetSQL, ListSQL    string
+	InsertSQL          string
+	InsertArgs         string
+	UpdateSQL          string
+	UpdateArgs         string
+	DeleteSQL          string
+	Generated          string // "id is set", the columns filled by the database on insert
+	Notes              []string
+}
+
+// dataColumn is a column with its PostgreSQL and Go types
+type dataColumn struct {
+	Name     string
+	Ident    string
+	Field    string
+	GoType   string
+	DDL      string // column definition in CREATE TABLE
+	Identity bool
+	Default  string // PostgreSQL default, empty when there is none
+	// Nilable is set when the Go type can hold NULL
+	Nilable bool
+}
+
+// dataForeignKey is a single column foreign key, listed with ListBy<Field>
+type dataForeignKey struct {
+	Method string
+	Column string
+	Ref    string
+	// ColumnLabel and RefLabel are Column and Ref safe inside Go comments and strings
+	ColumnLabel, RefLabel string
+	Param                 string
+	GoType                string
+	SQL                   string
+}
+
+// analyzeDataLayer generates Go models, pgx repositories and goose migrations
+// from the recovered schema and writes them next to the reports
+func analyzeDataLayer(p *Project) error {
+	layer := DataLayer{Package: dataOutputDir, Files: []string{}, Repositories: []DataRepository{}, Migrations: []string{}, Custom: []Query{}}
+	if p.Schema == nil || len(p.Schema.Tables) == 0 {
+		p.DataLayer = &layer
+		if err := utils.WriteReportJSON("data_layer.json", layer); err != nil {
+			return err
+		}
+		return utils.WriteReportFile("data_layer.md", []byte(dataLayerMarkdown(layer)))
+	}
+
+	pkg := path.Base(dataOutputDir)
+	write := func(file string, src []byte, err error) error {
+		if err != nil {
+			return err
+		}
+		layer.Files = append(layer.Files, file)
+		return utils.WriteReportFile(file, src)
+	}
+
+	// A table whose model or repository does not compile is left out with a
+	// note rather than failing the whole layer
+	var tables []*dataTable
+	repositories := map[*dataTable][]byte{}
+	for _, t := range dataTables(p.Schema) {
+		src, err := renderData(t.File, dataRepositoryTemplate, map[string]any{"Package": pkg, "Table": t, "Key": len(t.Key) > 0})
+		if err == nil {
+			one := []*dataTable{t}
+			_, err = renderData("models.go", dataModelsTemplate, map[string]any{"Package": pkg, "Tables": one, "Imports": dataImports(one)})
+		}
+		if err != nil {
+			layer.Notes = append(layer.Notes, fmt.Sprintf("table %s was skipped: %v", t.Name, err))
+			continue
+		}
+		tables = append(tables, t)
+		repositories[t] = src
+	}
+
+	file := path.Join(dataOutputDir, "db.go")
+	src, err := renderData(file, dataDBTemplate, map[string]any{"Package": pkg})
+	if err := write(file, src, err); err != nil {
+		return err
+	}
+	file = path.Join(dataOutputDir, "models.go")
+	src, err = renderData(file, dataModelsTemplate, map[string]any{"Package": pkg, "Tables": tables, "Imports": dataImports(tables)})
+	if err := write(file, src, err); err != nil {
+		return err
+	}
+	for _, t := range tables {
+		file := path.Join(dataOutputDir, t.File)
+		if err := write(file, repositories[t], nil); err != nil {
+			return err
+		}
+		layer.Repositories = append(layer.Repositories, DataRepository{Table: t.Name, Model: t.Struct, Repository: t.Repo, File: file, Methods: t.methods(), Notes: t.Notes})
+	}
+	for i, m := range dataMigrations(p.Schema, tables) {
+		file := path.Join(dataOutputDir, "migrations", fmt.Sprintf("%05d_%s.sql", i+1, m.name))
+		src, err := renderData(file, dataMigrationTemplate, m)
+		if err := write(file, src, err); err != nil {
+			return err
+		}
+		layer.Migrations = append(layer.Migrations, file)
+	}
+	layer.Custom = customQueries(p.Schema, tables)
+
+	p.DataLayer = &layer
+	if err := utils.WriteReportJSON("data_layer.json", layer); err != nil {
+		return err
+	}
+	return utils.WriteReportFile("data_layer.md", []byte(dataLayerMarkdown(layer)))
+}
+
+// renderData executes tmpl and formats the result when file is Go source
+func renderData(file string, tmpl *template.Template, data any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to render %s: %w", file, err)
+	}
+	if !strings.HasSuffix(file, ".go") {
+		return buf.Bytes(), nil
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to format %s: %w", path.Base(file), err)
+	}
+	return src, nil
+}
+
+// dataTables prepares the schema tables for the templates, in name order
+func dataTables(s *Schema) []*dataTable {
+	byName := map[string]*Table{}
+	for _, t := range s.Tables {
+		byName[t.Name] = t
+	}
+	structs := map[string]bool{}
+	var tables []*dataTable
+	for _, name := range sortedKeys(byName) {
+		t := byName[name]
+		dt := &dataTable{Name: t.Name, Ident: pgIdent(t.Name), Label: goText(t.Name), Inferred: t.Inferred}
+		dt.Struct = uniqueName(goField(singular(t.Name)), structs)
+		dt.Repo = dt.Struct + "Repository"
+		dt.File = strings.ToLower(strings.Trim(goNameSeparator.ReplaceAllString(t.Name, "_"), "_")) + "_repository.go"
+
+		key := map[string]bool{}
+		for _, c := range tablePrimaryKey(t) {
+			key[c] = true
+		}
+		fields := map[string]bool{}
+		for _, c := range t.Columns {
+			dc := dataColumnOf(c, key[c.Name] && len(key) == 1)
+			dc.Field = uniqueName(dc.Field, fields)
+			dt.Columns = append(dt.Columns, dc)
+			if key[c.Name] {
+				dt.Key = append(dt.Key, dc)
+			}
+		}
+		if t.Inferred {
+			dt.Notes = append(dt.Notes, "no DDL in the legacy code: columns come from queries and are typed text")
+		}
+		if len(dt.Key) == 0 {
+			dt.Notes = append(dt.Notes, "no primary key: only List, ListBy and Create are generated")
+		}
+		dt.queries()
+		tables = append(tables, dt)
+	}
+
+	structOf := map[string]*dataTable{}
+	for _, dt := range tables {
+		structOf[dt.Name] = dt
+	}
+	for _, r := range s.Relationships {
+		dt := structOf[r.From]
+		if r.Kind != RelationshipForeignKey || dt == nil || len(r.FromColumns) != 1 {
+			continue
+		}
+		for _, c := range dt.Columns {
+			if c.Name != r.FromColumns[0] {
+				continue
+			}
+			method := "ListBy" + c.Field
+			if dt.hasForeignKey(method) {
+				break
+			}
+			ref := r.To
+			if len(r.ToColumns) == 1 {
+				ref += "." + r.ToColumns[0]
+			}
+			param := goParam(c.Name)
+			dt.ForeignKeys = append(dt.ForeignKeys, dataForeignKey{
+				Method:      method,
+				Column:      c.Name,
+				Ref:         ref,
+				ColumnLabel: goText(c.Name),
+				RefLabel:    goText(ref),
+				Param:       param,
+				GoType:      strings.TrimPrefix(c.GoType, "*"),
+				SQL:         fmt.Sprintf("SELECT %s FROM %s WHERE %s = $1%s", dt.columnList(), dt.Ident, c.Ident, dt.orderBy()),
+			})
+		}
+	}
+	return tables
+}
+
+// queries builds the parameterized SQL of the CRUD methods
+func (t *dataTable) queries() {
+	cols := t.columnList()
+	var params, args []string
+	for _, c := range t.Key {
+		params = append(params, fmt.Sprintf("%s %s", goParam(c.Name), strings.TrimPrefix(c.GoType, "*")))
+		args = append(args, goParam(c.Name))
+	}
+	t.KeyParams = strings.Join(params, ", ")
+	t.KeyArgs = strings.Join(args, ", ")
+	where := t.keyWhere(1)
+
+	t.ListSQL = fmt.Sprintf("SELECT %s FROM %s%s LIMIT $1 OFFSET $2", cols, t.Ident, t.orderBy())
+	if len(t.Key) > 0 {
+		t.GetSQL = fmt.Sprintf("SELECT %s FROM %s WHERE %s", cols, t.Ident, where)
+		t.DeleteSQL = fmt.Sprintf("DELETE FROM %s WHERE %s", t.Ident, where)
+	}
+
+	// Identity columns are left to the database on insert. Every other column
+	// keeps the value set on the row; nilable ones fall back to their default
+	// when nil.
+	var insertCols, placeholders, insertArgs, generated []string
+	for _, c := range t.Columns {
+		if c.Identity {
+			generated = append(generated, goText(c.Name))
+			continue
+		}
+		param := fmt.Sprintf("$%d", len(placeholders)+1)
+		if c.Default != "" && c.Nilable {
+			param = fmt.Sprintf("COALESCE(%s, %s)", param, c.Default)
+		}
+		insertCols = append(insertCols, c.Ident)
+		placeholders = append(placeholders, param)
+		insertArgs = append(insertArgs, "row."+c.Field)
+	}
+	if len(insertCols) == 0 {
+		t.InsertSQL = fmt.Sprintf("INSERT INTO %s DEFAULT VALUES RETURNING %s", t.Ident, cols)
+	} else {
+		t.InsertSQL = fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) RETURNING %s", t.Ident, strings.Join(insertCols, ", "), strings.Join(placeholders, ", "), cols)
+	}
+	t.InsertArgs = strings.Join(insertArgs, ", ")
+	switch len(generated) {
+	case 0:
+	case 1:
+		t.Generated = generated[0] + " is set"
+	default:
+		t.Generated = joinAnd(generated) + " are set"
+	}
+
+	if len(t.Key) == 0 {
+		return
+	}
+	var sets, updateArgs []string
+	for _, c := range t.Columns {
+		if t.isKey(c.Name) {
+			continue
+		}
+		sets = append(sets, fmt.Sprintf("%s = $%d", c.Ident, len(sets)+1))
+		updateArgs = append(updateArgs, "row."+c.Field)
+	}
+	if len(sets) == 0 {
+		return
+	}
+	t.UpdateSQL = fmt.Sprintf("UPDATE %s SET %s WHERE %s", t.Ident, strings.Join(sets, ", "), t.keyWhere(len(sets)+1))
+	for _, c := range t.Key {
+		updateArgs = append(updateArgs, "row."+c.Field)
+	}
+	t.UpdateArgs = strings.Join(updateArgs, ", ")
+}
+
+// keyWhere is the primary key condition with parameters numbered from first
+func (t *dataTable) keyWhere(first int) string {
+	var conds []string
+	for i, c := range t.Key {
+		conds = append(conds, fmt.Sprintf("%s = $%d", c.Ident, first+i))
+	}
+	return strings.Join(conds, " AND ")
+}
+
+func (t *dataTable) columnList() string {
+	var cols []string
+	for _, c := range t.Columns {
+		cols = append(cols, c.Ident)
+	}
+	return strings.Join(cols, ", ")
+}
+
+// orderBy orders lists by primary key so pages are stable
+func (t *dataTable) orderBy() string {
+	if len(t.Key) == 0 {
+		return ""
+	}
+	var cols []string
+	for _, c := range t.Key {
+		cols = append(cols, c.Ident)
+	}
+	return " ORDER BY " + strings.Join(cols, ", ")
+}
+
+func (t *dataTable) isKey(name string) bool {
+	for _, c := range t.Key {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *dataTable) hasForeignKey(method string) bool {
+	for _, fk := range t.ForeignKeys {
+		if fk.Method == method {
+			return true
+		}
+	}
+	return false
+}
+
+// methods lists the repository methods generated for the table
+func (t *dataTable) methods() []string {
+	var methods []string
+	if len(t.Key) > 0 {
+		methods = append(methods, "Get")
+	}
+	methods = append(methods, "List")
+	for _, fk := range t.ForeignKeys {
+		methods = append(methods, fk.Method)
+	}
+	methods = append(methods, "Create")
+	if t.UpdateSQL != "" {
+		methods = append(methods, "Update")
+	}
+	if len(t.Key) > 0 {
+		methods = append(methods, "Delete")
+	}
+	return methods
+}
+
+// tablePrimaryKey returns the primary key columns of t
+func tablePrimaryKey(t *Table) []string {
+	if len(t.PrimaryKey) > 0 {
+		return t.PrimaryKey
+	}
+	var key []string
+	for _, c := range t.Columns {
+		if c.PrimaryKey {
+			key = append(key, c.Name)
+		}
+	}
+	return key
+}
+
+var pgTypeArgs = regexp.MustCompile(`\(([^)]*)\)`)
+
+// dataColumnOf maps a legacy column to PostgreSQL and Go. soleKey is set when
+// the column is the whole primary key, where a SQLite INTEGER key is a rowid.
+func dataColumnOf(c Column, soleKey bool) dataColumn {
+	dc := dataColumn{Name: c.Name, Ident: pgIdent(c.Name), Field: goField(c.Name)}
+	typ := strings.TrimSpace(strings.ReplaceAll(c.Type, "unsigned", ""))
+	array := strings.HasSuffix(typ, "[]")
+	typ = strings.TrimSpace(strings.TrimSuffix(typ, "[]"))
+	var args string
+	if m := pgTypeArgs.FindStringSubmatch(typ); m != nil {
+		args = strings.ReplaceAll(m[1], " ", "")
+		typ = strings.TrimSpace(pgTypeArgs.ReplaceAllString(typ, ""))
+	}
+	pgType, goType, nullable := pgTypeOf(typ, args)
+
+	dc.Identity = c.AutoIncrement || strings.Contains(strings.ToLower(c.Default), "nextval(") ||
+		(soleKey && !array && (typ == "integer" || typ == "int") && c.Default == "")
+	if dc.Identity && !array && (goType == "int16" || goType == "int32" || goType == "int64") {
+		if pgType == "smallint" {
+			pgType, goType = "integer", "int32"
+		}
+		pgType += " GENERATED BY DEFAULT AS IDENTITY"
+	} else {
+		dc.Identity = false
+	}
+	if array {
+		pgType += "[]"
+		goType = "[]" + goType
+		nullable = true
+	}
+
+	ddl := []string{dc.Ident, pgType}
+	if !c.Nullable && !dc.Identity {
+		ddl = append(ddl, "NOT NULL")
+	}
+	if def, ok := pgDefault(c.Default, pgType); ok && !dc.Identity {
+		ddl = append(ddl, "DEFAULT "+def)
+		dc.Default = def
+	}
+	if c.Unique && !c.PrimaryKey {
+		ddl = append(ddl, "UNIQUE")
+	}
+	if c.Check != "" {
+		ddl = append(ddl, "CHECK ("+c.Check+")")
+	}
+	dc.DDL = strings.Join(ddl, " ")
+
+	// Columns without DDL may hold NULL; types that represent NULL themselves
+	// stay values, the others become pointers
+	if (c.Nullable || c.Type == "") && !nullable && !dc.Identity {
+		goType = "*" + goType
+		nullable = true
+	}
+	dc.Nilable = nullable
+	dc.GoType = goType
+	return dc
+}
+
+// pgTypeOf maps a lowercase legacy type without arguments to its PostgreSQL
+// type and Go type. nullable is set when the Go type can hold NULL.
+func pgTypeOf(typ, args string) (pgType, goType string, nullable bool) {
+	withArgs := func(t string) string {
+		if args == "" {
+			return t
+		}
+		return t + "(" + args + ")"
+	}
+	switch typ {
+	case "smallint", "int2", "smallserial", "serial2", "year":
+		return "smallint", "int16", false
+	case "tinyint":
+		if args == "1" {
+			return "boolean", "bool", false
+		}
+		return "smallint", "int16", false
+	case "int", "integer", "int4", "mediumint", "serial", "serial4":
+		return "integer", "int32", false
+	case "bigint", "int8", "bigserial", "serial8":
+		return "bigint", "int64", false
+	case "real", "float4":
+		return "real", "float32", false
+	case "float", "double", "double precision", "float8":
+		return "double precision", "float64", false
+	case "numeric", "decimal", "money", "number":
+		return withArgs("numeric"), "pgtype.Numeric", true
+	case "bool", "boolean", "bit":
+		return "boolean", "bool", false
+	case "char", "character", "nchar":
+		return withArgs("char"), "string", false
+	case "varchar", "character varying", "nvarchar", "varchar2", "nvarchar2", "varying character":
+		return withArgs("varchar"), "string", false
+	case "date":
+		return "date", "time.Time", false
+	case "datetime", "timestamp", "timestamp without time zone", "smalldatetime":
+		return "timestamp", "time.Time", false
+	case "timestamptz", "timestamp with time zone":
+		return "timestamptz", "time.Time", false
+	case "time", "time without time zone":
+		return "time", "pgtype.Time", true
+	case "interval":
+		return "interval", "pgtype.Interval", true
+	case "blob", "bytea", "binary", "varbinary", "longblob", "mediumblob", "tinyblob", "image":
+		return "bytea", "[]byte", true
+	case "json", "jsonb":
+		return "jsonb", "json.RawMessage", true
+	case "uuid", "uniqueidentifier":
+		return "uuid", "string", false
+	}
+	// text, clob, enum and set, and columns of inferred tables
+	return "text", "string", false
+}
+
+var pgNumber = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// pgDefault translates a column default to PostgreSQL. Defaults that only make
+// sense in the legacy database (functions, sequences) are dropped.
+func pgDefault(def, pgType string) (string, bool) {
+	d := strings.TrimSpace(def)
+	for strings.HasPrefix(d, "(") && strings.HasSuffix(d, ")") {
+		d = strings.TrimSpace(d[1 : len(d)-1])
+	}
+	if d == "" {
+		return "", false
+	}
+	switch lower := strings.ToLower(d); {
+	case lower == "null":
+		return "", false
+	case lower == "now()" || lower == "current_timestamp" || lower == "current_timestamp()" ||
+		lower == "datetime('now')" || lower == "localtimestamp" || lower == "getdate()":
+		if pgType == "date" {
+			return "CURRENT_DATE", true
+		}
+		return "now()", true
+	case lower == "current_date" || lower == "date('now')":
+		return "CURRENT_DATE", true
+	case pgType == "boolean":
+		switch lower {
+		case "1", "true", "'1'", "b'1'":
+			return "true", true
+		case "0", "false", "'0'", "b'0'":
+			return "false", true
+		}
+		return "", false
+	case pgNumber.MatchString(d):
+		return d, true
+	case strings.HasPrefix(d, "'") && strings.HasSuffix(d, "'") && len(d) >= 2:
+		// pg_dump casts literals: 'draft'::character varying
+		return d, true
+	case strings.HasPrefix(d, "'") && strings.Contains(d, "'::"):
+		return d[:strings.LastIndex(d, "'::")+1], true
+	}
+	return "", false
+}
+
+// dataMigration is one goose migration file
+type dataMigration struct {
+	name     string
+	Source   string
+	Notes    []string
+	Up, Down []string
+}
+
+// dataMigrations creates one migration per table, referenced tables first.
+// Foreign keys between tables that reference each other get a final migration.
+func dataMigrations(s *Schema, tables []*dataTable) []dataMigration {
+	byName := map[string]*dataTable{}
+	schemaTables := map[string]*Table{}
+	for _, t := range tables {
+		byName[t.Name] = t
+	}
+	for _, t := range s.Tables {
+		schemaTables[t.Name] = t
+	}
+	refs := map[string][]Relationship{}
+	for _, r := range s.Relationships {
+		if r.Kind == RelationshipForeignKey && byName[r.From] != nil && byName[r.To] != nil {
+			refs[r.From] = append(refs[r.From], r)
+		}
+	}
+
+	// Depth-first topological order; a reference to a table still being
+	// visited closes a cycle and is deferred
+	created := map[string]bool{}
+	visiting := map[string]bool{}
+	var order []string
+	var deferred []Relationship
+	var visit func(name string)
+	visit = func(name string) {
+		if created[name] || visiting[name] {
+			return
+		}
+		visiting[name] = true
+		for _, r := range refs[name] {
+			if r.To != name {
+				visit(r.To)
+			}
+		}
+		visiting[name] = false
+		created[name] = true
+		order = append(order, name)
+	}
+	for _, t := range tables {
+		visit(t.Name)
+	}
+
+	position := map[string]int{}
+	for i, name := range order {
+		position[name] = i
+	}
+	var migrations []dataMigration
+	for _, name := range order {
+		t := byName[name]
+		m := dataMigration{name: "create_" + strings.TrimSuffix(strings.TrimSuffix(t.File, ".go"), "_repository"), Source: strings.Join(schemaTables[name].Sources, ", ")}
+		if t.Inferred {
+			m.Source = "queries in " + m.Source
+			m.Notes = append(m.Notes, "The legacy code has no DDL for this table; check the column types, nullability and keys.")
+		}
+		var defs []string
+		for _, c := range t.Columns {
+			defs = append(defs, c.DDL)
+		}
+		if len(t.Key) > 0 {
+			var key []string
+			for _, c := range t.Key {
+				key = append(key, c.Ident)
+			}
+			defs = append(defs, "PRIMARY KEY ("+strings.Join(key, ", ")+")")
+		}
+		for _, cols := range schemaTables[name].Unique {
+			defs = append(defs, "UNIQUE ("+identList(cols)+")")
+		}
+		for _, check := range schemaTables[name].Checks {
+			defs = append(defs, "CHECK ("+check+")")
+		}
+		for _, r := range refs[name] {
+			if r.To != name && position[r.To] > position[name] {
+				deferred = append(deferred, r)
+				continue
+			}
+			defs = append(defs, foreignKeyDDL(r))
+		}
+		up := fmt.Sprintf("CREATE TABLE %s (\n    %s\n);", t.Ident, strings.Join(defs, ",\n    "))
+		m.Up = append(m.Up, up)
+		for _, idx := range s.Indexes {
+			if idx.Table == name {
+				m.Up = append(m.Up, indexDDL(idx))
+			}
+		}
+		m.Down = append(m.Down, fmt.Sprintf("DROP TABLE IF EXISTS %s;", t.Ident))
+		migrations = append(migrations, m)
+	}
+
+	if len(deferred) > 0 {
+		m := dataMigration{name: "add_foreign_keys", Source: "foreign keys between tables that reference each other"}
+		for i, r := range deferred {
+			name := fmt.Sprintf("%s_%s_fkey", r.From, strings.Join(r.FromColumns, "_"))
+			m.Up = append(m.Up, fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s %s;", pgIdent(r.From), pgIdent(name), foreignKeyDDL(r)))
+			// Dropped in reverse order
+			d := deferred[len(deferred)-1-i]
+			m.Down = append(m.Down, fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT IF EXISTS %s;", pgIdent(d.From), pgIdent(fmt.Sprintf("%s_%s_fkey", d.From, strings.Join(d.FromColumns, "_")))))
+		}
+		migrations = append(migrations, m)
+	}
+	return migrations
+}
+
+func foreignKeyDDL(r Relationship) string {
+	ddl := "FOREIGN KEY (" + identList(r.FromColumns) + ") REFERENCES " + pgIdent(r.To)
+	if len(r.ToColumns) > 0 {
+		ddl += " (" + identList(r.ToColumns) + ")"
+	}
+	if r.OnDelete != "" {
+		ddl += " ON DELETE " + r.OnDelete
+	}
+	if r.OnUpdate != "" {
+		ddl += " ON UPDATE " + r.OnUpdate
+	}
+	return ddl
+}
+
+func indexDDL(idx Index) string {
+	name := idx.Name
+	if name == "" {
+		name = idx.Table + "_" + strings.Join(idx.Columns, "_") + "_idx"
+	}
+	unique := ""
+	if idx.Unique {
+		unique = "UNIQUE "
+	}
+	return fmt.Sprintf("CREATE %sINDEX %s ON %s (%s);", unique, pgIdent(name), pgIdent(idx.Table), identList(idx.Columns))
+}
+
+func identList(names []string) string {
+	var idents []string
+	for _, n := range names {
+		idents = append(idents, pgIdent(n))
+	}
+	return strings.Join(idents, ", ")
+}
+
+// customQueries are the legacy queries beyond single table CRUD: joins,
+// aggregates, subqueries and statements on tables without a model
+func customQueries(s *Schema, tables []*dataTable) []Query {
+	known := map[string]bool{}
+	for _, t := range tables {
+		known[t.Name] = true
+	}
+	custom := []Query{}
+	for _, q := range s.Queries {
+		upper := strings.ToUpper(q.SQL)
+		simple := len(q.Tables) == 1 && known[q.Tables[0]] &&
+			!strings.Contains(upper, " JOIN ") && !strings.Contains(upper, "GROUP BY") &&
+			strings.Count(upper, "SELECT") <= 1 && !aggregateCall.MatchString(upper)
+		if q.Operation == "SELECT" && !simple || q.Operation != "SELECT" && len(q.Tables) != 1 {
+			custom = append(custom, q)
+		}
+	}
+	return custom
+}
+
+var aggregateCall = regexp.MustCompile(`\b(COUNT|SUM|AVG|MIN|MAX)\s*\(`)
+
+// pgReserved are reserved words that must be quoted as identifiers
+var pgReserved = map[string]bool{
+	"all": true, "and": true, "any": true, "array": true, "as": true, "asc": true, "case": true, "check": true,
+	"column": true, "constraint": true, "create": true, "current_date": true, "current_time": true,
+	"current_timestamp": true, "current_user": true, "default": true, "desc": true, "distinct": true,
+	"do": true, "else": true, "end": true, "except": true, "false": true, "for": true, "foreign": true,
+	"from": true, "grant": true, "group": true, "having": true, "in": true, "intersect": true, "into": true,
+	"key": true, "limit": true, "not": true, "null": true, "offset": true, "on": true, "only": true,
+	"or": true, "order": true, "primary": true, "references": true, "select": true, "table": true,
+	"then": true, "to": true, "true": true, "union": true, "unique": true, "user": true, "using": true,
+	"when": true, "where": true, "window": true, "with": true,
+}
+
+var pgPlainIdent = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// pgIdent quotes name when PostgreSQL would fold its case or read it as a keyword
+func pgIdent(name string) string {
+	if pgPlainIdent.MatchString(name) && !pgReserved[name] {
+		return name
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// goInitialisms are written in upper case in Go names
+var goInitialisms = map[string]bool{
+	"id": true, "url": true, "uri": true, "uuid": true, "api": true, "ip": true, "json": true,
+	"html": true, "http": true, "sql": true, "xml": true, "csv": true, "sku": true, "utc": true,
+}
+
+// goField turns a column or table name into an exported Go name: user_id is UserID
+func goField(name string) string {
+	var sb strings.Builder
+	for _, part := range goNameSeparator.Split(name, -1) {
+		if part == "" {
+			continue
+		}
+		if goInitialisms[strings.ToLower(part)] {
+			sb.WriteString(strings.ToUpper(part))
+		} else {
+			sb.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+	s := sb.String()
+	if s == "" || (s[0] >= '0' && s[0] <= '9') {
+		s = "X" + s
+	}
+	return s
+}
+
+// goParam turns a column name into a Go parameter name: user_id is userID
+func goParam(name string) string {
+	s := goField(name)
+	var first string
+	for _, part := range goNameSeparator.Split(name, -1) {
+		if part != "" {
+			first = part
+			break
+		}
+	}
+	if goInitialisms[strings.ToLower(first)] && strings.HasPrefix(s, strings.ToUpper(first)) {
+		s = strings.ToLower(s[:len(first)]) + s[len(first):]
+	} else {
+		s = strings.ToLower(s[:1]) + s[1:]
+	}
+	if goReserved[s] || s == "row" || s == "r" || s == "rows" || s == "err" || s == "ctx" {
+		s += "Value"
+	}
+	return s
+}
+
+// goText drops the characters of a legacy name that would end a Go string
+// literal or comment, or read as a format verb
+func goText(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '"' || r == '\\' || r == '`' || r == '%' || r < ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+}
+
+// singular turns a plural table name into a model name: categories is category
+func singular(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, "ies") && len(name) > 3:
+		return name[:len(name)-3] + "y"
+	case strings.HasSuffix(lower, "sses"), strings.HasSuffix(lower, "xes"), strings.HasSuffix(lower, "ches"),
+		strings.HasSuffix(lower, "shes"), strings.HasSuffix(lower, "uses"):
+		return name[:len(name)-2]
+	case strings.HasSuffix(lower, "s") && !strings.HasSuffix(lower, "ss") && !strings.HasSuffix(lower, "us") && len(name) > 1:
+		return name[:len(name)-1]
+	}
+	return name
+}
+
+// uniqueName returns name, numbered if it was taken already
+func uniqueName(name string, taken map[string]bool) string {
+	unique := name
+	for i := 2; taken[unique]; i++ {
+		unique = fmt.Sprintf("%s%d", name, i)
+	}
+	taken[unique] = true
+	return unique
+}
+
+// dataImports are the packages the model field types need
+func dataImports(tables []*dataTable) []string {
+	imports := map[string]bool{}
+	for _, t := range tables {
+		for _, c := range t.Columns {
+			switch typ := strings.TrimLeft(c.GoType, "*[]"); {
+			case typ == "time.Time":
+				imports["time"] = true
+			case typ == "json.RawMessage":
+				imports["encoding/json"] = true
+			case strings.HasPrefix(typ, "pgtype."):
+				imports["github.com/jackc/pgx/v5/pgtype"] = true
+			}
+		}
+	}
+	// Standard library first, then a blank line before third party packages;
+	// gofmt only sorts within a group
+	var std, thirdParty []string
+	for _, imp := range sortedKeys(imports) {
+		if strings.Contains(imp, ".") {
+			thirdParty = append(thirdParty, imp)
+		} else {
+			std = append(std, imp)
+		}
+	}
+	if len(std) > 0 && len(thirdParty) > 0 {
+		std = append(std, "")
+	}
+	return append(std, thirdParty...)
+}
+
+// joinAnd joins names as "a, b and c"
+func joinAnd(names []string) string {
+	if len(names) <= 1 {
+		return strings.Join(names, "")
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
+
+func dataLayerMarkdown(l DataLayer) string {
+	var sb strings.Builder
+	sb.WriteString("# Data layer\n\n")
+	if len(l.Repositories) == 0 {
+		sb.WriteString("No tables were found, so no data layer was generated.\n")
+		return sb.String()
+	}
+	fmt.Fprintf(&sb, "Package `%s` (`%s/`) was generated from the schema without the LLM: one model struct per table in `models.go`, ", path.Base(l.Package), l.Package)
+	sb.WriteString("one pgx/v5 repository per table with parameterized queries over a `pgxpool.Pool`, `Connect` and `ErrNotFound` in `db.go`, ")
+	sb.WriteString("and goose migrations embedded as `Migrations`. Nullable columns are pointers; run `go mod tidy` to add pgx.\n\n")
+
+	sb.WriteString("| Table | Model | Repository | Methods | File |\n|---|---|---|---|---|\n")
+	for _, r := range l.Repositories {
+		fmt.Fprintf(&sb, "| %s | %s | %s | %s | %s |\n", r.Table, r.Model, r.Repository, strings.Join(r.Methods, ", "), r.File)
+	}
+
+	var notes []string
+	for _, r := range l.Repositories {
+		for _, n := range r.Notes {
+			notes = append(notes, fmt.Sprintf("- %s: %s", r.Table, n))
+		}
+	}
+	for _, n := range l.Notes {
+		notes = append(notes, "- "+n)
+	}
+	if len(notes) > 0 {
+		sb.WriteString("\n## Notes\n\n" + strings.Join(notes, "\n") + "\n")
+	}
+
+	sb.WriteString("\n## Migrations\n\n")
+	for _, m := range l.Migrations {
+		fmt.Fprintf(&sb, "- %s\n", m)
+	}
+
+	if len(l.Custom) == 0 {
+		sb.WriteString("\nEvery legacy query maps to a generated method.\n")
+		return sb.String()
+	}
+	sb.WriteString("\n## Queries left for the LLM\n\n")
+	sb.WriteString("These legacy queries go beyond single table CRUD; add them as methods on the repository of their main table.\n\n")
+	sb.WriteString("| Location | Function | Operation | Tables | SQL |\n|---|---|---|---|---|\n")
+	for _, q := range l.Custom {
+		sql := strings.Join(strings.Fields(q.SQL), " ")
+		if len(sql) > 160 {
+			sql = sql[:157] + "..."
+		}
+		fmt.Fprintf(&sb, "| %s:%d | %s | %s | %s | `%s` |\n", q.File, q.Line, q.Function, q.Operation, strings.Join(q.Tables, ", "), strings.ReplaceAll(strings.ReplaceAll(sql, "`", "'"), "|", "\\|"))
+	}
+	return sb.String()
+}
@@ -0,0 +1,177 @@
+package analysis
+
+import "text/template"
+
+// Templates of the generated data layer. The Go files are run through gofmt
+// after rendering, so the templates only need to be syntactically valid.
+
+var dataDBTemplate = template.Must(template.New("db.go").Parse(`// Code generated by lcma from the legacy schema. DO NOT EDIT.
+
+// Package {{.Package}} holds the models, pgx repositories and goose migrations
+// generated from the legacy database schema.
+package {{.Package}}
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrNotFound is returned when no row has the requested key
+var ErrNotFound = errors.New("not found")
+
+// Migrations are the goose migrations creating the schema, for goose.SetBaseFS
+//
+//go:embed migrations/*.sql
+var Migrations embed.FS
+
+// Connect opens a connection pool for databaseURL and checks it with a ping
+func Connect(ctx context.Context, databaseURL string) (*pgxpool.Pool, error) {
+	cfg, err := pgxpool.ParseConfig(databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse database url: %w", err)
+	}
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("create database pool: %w", err)
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("ping database: %w", err)
+	}
+	return pool, nil
+}
+`))
+
+var dataModelsTemplate = template.Must(template.New("models.go").Parse(`// Code generated by lcma from the legacy schema. DO NOT EDIT.
+
+package {{.Package}}
+{{if .Imports}}
+import (
+{{range .Imports}}{{if .}}	"{{.}}"{{end}}
+{{end}})
+{{end}}
+{{range .Tables}}
+// {{.Struct}} is a row of the {{.Label}} table{{if .Inferred}}. The table has no DDL in the legacy code;
+// its columns come from queries and their types need checking{{end}}
+type {{.Struct}} struct {
+{{range .Columns}}	{{.Field}} {{.GoType}} ` + "`" + `db:{{printf "%q" .Name}} json:{{printf "%q" .Name}}` + "`" + `
+{{end}}}
+{{end}}`))
+
+var dataRepositoryTemplate = template.Must(template.New("repository.go").Parse(`// Code generated by lcma from the legacy schema. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"context"
+	{{if .Key}}"errors"
+	{{end}}"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+{{with .Table}}
+// {{.Repo}} reads and writes the {{.Label}} table with parameterized queries
+type {{.Repo}} struct {
+	pool *pgxpool.Pool
+}
+
+// New{{.Repo}} returns a repository using pool
+func New{{.Repo}}(pool *pgxpool.Pool) *{{.Repo}} {
+	return &{{.Repo}}{pool: pool}
+}
+{{if .Key}}
+// Get returns the {{.Label}} row with the given key, or ErrNotFound
+func (r *{{.Repo}}) Get(ctx context.Context, {{.KeyParams}}) (*{{.Struct}}, error) {
+	rows, err := r.pool.Query(ctx, {{printf "%q" .GetSQL}}, {{.KeyArgs}})
+	if err != nil {
+		return nil, fmt.Errorf("get {{.Label}}: %w", err)
+	}
+	row, err := pgx.CollectExactlyOneRow(rows, pgx.RowToAddrOfStructByName[{{.Struct}}])
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get {{.Label}}: %w", err)
+	}
+	return row, nil
+}
+{{end}}
+// List returns up to limit {{.Label}} rows after skipping offset{{if .Key}}, in key order{{end}}
+func (r *{{.Repo}}) List(ctx context.Context, limit, offset int) ([]{{.Struct}}, error) {
+	rows, err := r.pool.Query(ctx, {{printf "%q" .ListSQL}}, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("list {{.Label}}: %w", err)
+	}
+	items, err := pgx.CollectRows(rows, pgx.RowToStructByName[{{.Struct}}])
+	if err != nil {
+		return nil, fmt.Errorf("list {{.Label}}: %w", err)
+	}
+	return items, nil
+}
+{{range .ForeignKeys}}
+// {{.Method}} returns the {{$.Table.Label}} rows whose {{.ColumnLabel}} references {{.RefLabel}}
+func (r *{{$.Table.Repo}}) {{.Method}}(ctx context.Context, {{.Param}} {{.GoType}}) ([]{{$.Table.Struct}}, error) {
+	rows, err := r.pool.Query(ctx, {{printf "%q" .SQL}}, {{.Param}})
+	if err != nil {
+		return nil, fmt.Errorf("list {{$.Table.Label}} by {{.ColumnLabel}}: %w", err)
+	}
+	items, err := pgx.CollectRows(rows, pgx.RowToStructByName[{{$.Table.Struct}}])
+	if err != nil {
+		return nil, fmt.Errorf("list {{$.Table.Label}} by {{.ColumnLabel}}: %w", err)
+	}
+	return items, nil
+}
+{{end}}
+// Create inserts row and refreshes it with the stored values{{if .Generated}}; {{.Generated}} by the database{{end}}
+func (r *{{.Repo}}) Create(ctx context.Context, row *{{.Struct}}) error {
+	rows, err := r.pool.Query(ctx, {{printf "%q" .InsertSQL}}{{if .InsertArgs}}, {{.InsertArgs}}{{end}})
+	if err != nil {
+		return fmt.Errorf("create {{.Label}}: %w", err)
+	}
+	stored, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[{{.Struct}}])
+	if err != nil {
+		return fmt.Errorf("create {{.Label}}: %w", err)
+	}
+	*row = stored
+	return nil
+}
+{{if .UpdateSQL}}
+// Update writes the non-key columns of row, or returns ErrNotFound
+func (r *{{.Repo}}) Update(ctx context.Context, row *{{.Struct}}) error {
+	tag, err := r.pool.Exec(ctx, {{printf "%q" .UpdateSQL}}, {{.UpdateArgs}})
+	if err != nil {
+		return fmt.Errorf("update {{.Label}}: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+{{end}}{{if .Key}}
+// Delete removes the {{.Label}} row with the given key, or returns ErrNotFound
+func (r *{{.Repo}}) Delete(ctx context.Context, {{.KeyParams}}) error {
+	tag, err := r.pool.Exec(ctx, {{printf "%q" .DeleteSQL}}, {{.KeyArgs}})
+	if err != nil {
+		return fmt.Errorf("delete {{.Label}}: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+{{end}}{{end}}`))
+
+var dataMigrationTemplate = template.Must(template.New("migration.sql").Parse(`-- Generated by lcma from {{.Source}}.
+{{range .Notes}}-- {{.}}
+{{end}}
+-- +goose Up
+{{range .Up}}{{.}}
+{{end}}
+-- +goose Down
+{{range .Down}}{{.}}
+{{end}}`))
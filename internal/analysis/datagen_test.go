@@ -0,0 +1,140 @@
+package analysis
+
+import (
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func TestGoIdentifiers(t *testing.T) {
+	tests := []struct {
+		name, field, param string
+	}{
+		{"user_id", "UserID", "userID"},
+		{"id", "ID", "id"},
+		{"created-at", "CreatedAt", "createdAt"},
+		{"_private", "Private", "private"},
+		{`we"ird`, "WeIrd", "weIrd"},
+		{`"quoted"`, "Quoted", "quoted"},
+		{"9lives", "X9lives", "x9lives"},
+		{"select", "Select", "selectValue"},
+		{"type", "Type", "typeValue"},
+		{"ctx", "Ctx", "ctxValue"},
+		{"%%", "X", "x"},
+		{"café", "Caf", "caf"},
+	}
+	for _, tt := range tests {
+		if got := goField(tt.name); got != tt.field {
+			t.Errorf("goField(%q) = %q, want %q", tt.name, got, tt.field)
+		}
+		if got := goParam(tt.name); got != tt.param {
+			t.Errorf("goParam(%q) = %q, want %q", tt.name, got, tt.param)
+		}
+		if !token.IsIdentifier(goParam(tt.name)) || token.IsKeyword(goParam(tt.name)) {
+			t.Errorf("goParam(%q) = %q is not a usable Go identifier", tt.name, goParam(tt.name))
+		}
+	}
+}
+
+// dataSchema parses CREATE TABLE statements into a schema with its foreign keys
+func dataSchema(t *testing.T, sql string) *Schema {
+	t.Helper()
+	s := &Schema{}
+	for _, toks := range splitSQLStatements(tokenizeSQL(sql)) {
+		st := parseSQL(toks)
+		if st.Table == nil {
+			t.Fatalf("no table in %v", toks)
+		}
+		st.Table.Sources = []string{"schema.sql"}
+		s.Tables = append(s.Tables, st.Table)
+		for _, c := range st.Table.Columns {
+			if table, col, ok := strings.Cut(c.References, "."); ok {
+				s.Relationships = append(s.Relationships, Relationship{From: st.Table.Name, FromColumns: []string{c.Name}, To: table, ToColumns: []string{col}, Kind: RelationshipForeignKey, OnDelete: c.OnDelete, OnUpdate: c.OnUpdate})
+			}
+		}
+	}
+	return s
+}
+
+const dataTestSchema = `
+CREATE TABLE products (id INTEGER PRIMARY KEY, sku TEXT NOT NULL, name TEXT, price NUMERIC NOT NULL CHECK (price >= 0), UNIQUE (sku, name));
+CREATE TABLE orders (
+    id INTEGER PRIMARY KEY,
+    status VARCHAR(20) NOT NULL DEFAULT 'new',
+    note TEXT DEFAULT '',
+    product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    CHECK (status <> '')
+);
+CREATE TABLE "quoted""table" ("we""ird" INTEGER PRIMARY KEY, "select" TEXT, "9lives" TEXT, "100%" TEXT, "back\slash" TEXT);
+`
+
+func TestDataLayerCompiles(t *testing.T) {
+	tables := dataTables(dataSchema(t, dataTestSchema))
+	if len(tables) != 3 {
+		t.Fatalf("got %d tables, want 3", len(tables))
+	}
+	for _, dt := range tables {
+		src, err := renderData(dt.File, dataRepositoryTemplate, map[string]any{"Package": "db", "Table": dt, "Key": len(dt.Key) > 0})
+		if err != nil {
+			t.Errorf("repository of %s: %v", dt.Name, err)
+			continue
+		}
+		if _, err := parser.ParseFile(token.NewFileSet(), dt.File, src, 0); err != nil {
+			t.Errorf("repository of %s does not parse: %v", dt.Name, err)
+		}
+	}
+	if _, err := renderData("models.go", dataModelsTemplate, map[string]any{"Package": "db", "Tables": tables, "Imports": dataImports(tables)}); err != nil {
+		t.Errorf("models: %v", err)
+	}
+}
+
+func TestDataQueries(t *testing.T) {
+	tables := dataTables(dataSchema(t, dataTestSchema))
+	var orders *dataTable
+	for _, dt := range tables {
+		if dt.Name == "orders" {
+			orders = dt
+		}
+	}
+	tests := []struct {
+		name, got, want string
+	}{
+		// Only the identity column is left to the database; a NOT NULL
+		// default keeps the caller's value and a nilable one falls back when nil
+		{"insert", orders.InsertSQL, "INSERT INTO orders (status, note, product_id) VALUES ($1, COALESCE($2, ''), $3) RETURNING id, status, note, product_id"},
+		{"insert args", orders.InsertArgs, "row.Status, row.Note, row.ProductID"},
+		{"generated", orders.Generated, "id is set"},
+		{"get", orders.GetSQL, "SELECT id, status, note, product_id FROM orders WHERE id = $1"},
+		{"update", orders.UpdateSQL, "UPDATE orders SET status = $1, note = $2, product_id = $3 WHERE id = $4"},
+		{"list by", orders.ForeignKeys[0].SQL, "SELECT id, status, note, product_id FROM orders WHERE product_id = $1 ORDER BY id"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestDataMigrationsKeepConstraints(t *testing.T) {
+	s := dataSchema(t, dataTestSchema)
+	var up []string
+	for _, m := range dataMigrations(s, dataTables(s)) {
+		up = append(up, m.Up...)
+	}
+	ddl := strings.Join(up, "\n")
+	for _, want := range []string{
+		"price numeric NOT NULL CHECK (price >= 0)",
+		"UNIQUE (sku, name)",
+		"CHECK (status <> '')",
+		"FOREIGN KEY (product_id) REFERENCES products (id) ON DELETE CASCADE",
+		`CREATE TABLE "quoted""table"`,
+	} {
+		if !strings.Contains(ddl, want) {
+			t.Errorf("migrations lack %q:\n%s", want, ddl)
+		}
+	}
+	if strings.Index(ddl, "CREATE TABLE products") > strings.Index(ddl, "CREATE TABLE orders") {
+		t.Error("orders is created before the products table it references")
+	}
+}
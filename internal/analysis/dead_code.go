@@ -0,0 +1,706 @@
+package analysis
+
+import (
+	"fmt"
+	"lcma/internal/utils"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DeadCodeCandidate is legacy code nothing appears to use, a candidate to leave
+// out of the migration
+type DeadCodeCandidate struct {
+	Kind       string `json:"kind"` // module, route, function or template
+	Name       string `json:"name"`
+	File       string `json:"file"`
+	Line       int    `json:"line,omitempty"`
+	Lines      int    `json:"lines"`
+	Confidence string `json:"confidence"` // high, medium or low
+	Reason     string `json:"reason"`
+}
+
+// DeadCode is the layout of dead_code.json
+type DeadCode struct {
+	Candidates []DeadCodeCandidate `json:"candidates"`
+	// Entrypoints are the modules run directly, which nothing is expected to import
+	Entrypoints []string `json:"entrypoints"`
+	// DynamicRenders counts render_template calls whose template name is not a literal
+	DynamicRenders int `json:"dynamic_renders"`
+}
+
+// Dropped reports whether a route is a high confidence candidate, one the
+// generated code is expected to leave out
+func (d *DeadCode) Dropped(r Route) bool {
+	if d == nil {
+		return false
+	}
+	for _, c := range d.Candidates {
+		if c.Kind == "route" && c.Confidence == "high" && c.File == r.File && c.Line == r.Line {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	deadCodeWord    = regexp.MustCompile(`\b[A-Za-z_]\w*`)
+	deadCodeLiteral = regexp.MustCompile("\"([^\"\\n]*)\"|'([^'\\n]*)'|`([^`\\n]*)`")
+	mainGuard       = regexp.MustCompile(`if\s+__name__\s*==\s*['"]__main__['"]`)
+	// jinjaDelimited is a Jinja expression or statement, whose quotes nest inside HTML attribute quotes
+	jinjaDelimited = regexp.MustCompile(`(?s)\{\{.*?\}\}|\{%.*?%\}`)
+	// fromImport and importAlias find "from views import bp as views_bp"
+	fromImport  = regexp.MustCompile(`from\s+\.*([\w.]*)\s+import\s+([^\n]*)`)
+	importAlias = regexp.MustCompile(`\b(\w+)\s+as\s+(\w+)\b`)
+	// linkPlaceholder is a Jinja expression, f-string or JS template part in a URL
+	linkPlaceholder = regexp.MustCompile(`\{\{.*?\}\}|\$\{[^}]*\}|\{[^}]*\}`)
+)
+
+// entrypointModules are run by a server, a CLI or a packaging tool rather than imported
+var entrypointModules = map[string]bool{
+	"app": true, "wsgi": true, "asgi": true, "main": true, "__main__": true, "manage": true,
+	"run": true, "server": true, "application": true, "setup": true, "conftest": true,
+}
+
+// appFactories are the function names Flask looks up to build the app
+var appFactories = map[string]bool{"create_app": true, "make_app": true}
+
+// pureDecorators wrap a function without registering it anywhere, so the
+// function still needs a caller
+var pureDecorators = map[string]bool{
+	"staticmethod": true, "classmethod": true, "property": true, "abstractmethod": true,
+	"cached_property": true, "lru_cache": true, "cache": true, "wraps": true,
+}
+
+// frameworkMethods are called by Flask, WTForms or unittest through the class
+var frameworkMethods = map[string]bool{
+	"get": true, "post": true, "put": true, "patch": true, "delete": true, "head": true, "options": true,
+	"dispatch_request": true, "setUp": true, "tearDown": true, "setUpClass": true, "tearDownClass": true,
+}
+
+// deadCodeKinds orders the report sections
+var deadCodeKinds = []string{"module", "route", "function", "template"}
+
+// corpusText indexes the words and quoted literals of every corpus file, to
+// tell names nothing mentions from names used in ways the graphs do not see
+type corpusText struct {
+	words    map[string]int
+	fileWord map[string]map[string]int
+	literals map[string]int
+	// codeLiterals are the literals outside templates
+	codeLiterals map[string]int
+}
+
+func newCorpusText(files []utils.CorpusFile) *corpusText {
+	c := &corpusText{words: map[string]int{}, fileWord: map[string]map[string]int{}, literals: map[string]int{}, codeLiterals: map[string]int{}}
+	for _, f := range files {
+		c.fileWord[f.Path] = map[string]int{}
+		for _, w := range deadCodeWord.FindAllString(f.Content, -1) {
+			c.words[w]++
+			c.fileWord[f.Path][w]++
+		}
+		if !isTemplateFile(f.Path) {
+			c.addLiterals(f.Content, true)
+			continue
+		}
+		// Scan the Jinja tags on their own, then the markup with each tag left
+		// as a placeholder, so href="{{ url_for('a', q='x') }}" yields 'a'
+		for _, tag := range jinjaDelimited.FindAllString(f.Content, -1) {
+			c.addLiterals(tag, false)
+		}
+		c.addLiterals(jinjaDelimited.ReplaceAllString(f.Content, "{{}}"), false)
+	}
+	return c
+}
+
+func (c *corpusText) addLiterals(text string, code bool) {
+	for _, m := range deadCodeLiteral.FindAllStringSubmatch(text, -1) {
+		lit := m[1] + m[2] + m[3]
+		c.literals[lit]++
+		if code {
+			c.codeLiterals[lit]++
+		}
+	}
+}
+
+// mentions counts the occurrences of word outside file
+func (c *corpusText) mentions(word, file string) int {
+	return c.words[word] - c.fileWord[file][word]
+}
+
+// deadCodeScan holds the state shared by the candidate finders
+type deadCodeScan struct {
+	p        *Project
+	text     *corpusText
+	graph    *callGraph
+	out      *DeadCode
+	deadMods map[string]DeadCodeCandidate
+	deadFns  map[funcRef]bool
+	// dropped are the handlers of the routes that are never served
+	dropped map[funcRef]bool
+}
+
+// analyzeDeadCode finds modules never imported, routes nothing links to,
+// functions never called and templates never rendered
+func analyzeDeadCode(p *Project) error {
+	s := &deadCodeScan{p: p, text: newCorpusText(p.Corpus.Files), graph: p.callGraph(),
+		out: &DeadCode{Candidates: []DeadCodeCandidate{}, Entrypoints: []string{}}, deadMods: map[string]DeadCodeCandidate{}, deadFns: map[funcRef]bool{}, dropped: map[funcRef]bool{}}
+	s.modules()
+	s.routes()
+	s.functions()
+	s.templates()
+
+	rank := map[string]int{"high": 0, "medium": 1, "low": 2}
+	kind := map[string]int{}
+	for i, k := range deadCodeKinds {
+		kind[k] = i
+	}
+	c := s.out.Candidates
+	sort.SliceStable(c, func(i, j int) bool {
+		if c[i].Kind != c[j].Kind {
+			return kind[c[i].Kind] < kind[c[j].Kind]
+		}
+		if c[i].Confidence != c[j].Confidence {
+			return rank[c[i].Confidence] < rank[c[j].Confidence]
+		}
+		if c[i].File != c[j].File {
+			return c[i].File < c[j].File
+		}
+		return c[i].Line < c[j].Line
+	})
+	p.DeadCode = s.out
+
+	if err := utils.WriteReportJSON("dead_code.json", s.out); err != nil {
+		return err
+	}
+	return utils.WriteReportFile("dead_code.md", []byte(deadCodeMarkdown(s.out)))
+}
+
+func (s *deadCodeScan) add(c DeadCodeCandidate) {
+	s.out.Candidates = append(s.out.Candidates, c)
+}
+
+// isTestModule reports whether a module only holds tests, which are not migrated
+func isTestModule(m *PyModule) bool {
+	stem := lastSegment(m.Name)
+	return strings.HasPrefix(stem, "test_") || strings.HasSuffix(stem, "_test") || stem == "conftest" ||
+		strings.HasPrefix(m.Path, "tests/") || strings.Contains(m.Path, "/tests/")
+}
+
+// isEntrypoint reports whether a module is run directly: it creates the Flask
+// app, has a __main__ guard or has the name of a conventional entrypoint
+func (s *deadCodeScan) isEntrypoint(m *PyModule) bool {
+	if entrypointModules[lastSegment(m.Name)] || mainGuard.MatchString(s.p.py[m.Path].Src) {
+		return true
+	}
+	for _, fn := range moduleFunctions(m) {
+		for _, c := range fn.Calls {
+			if c.Name == "Flask" || c.Name == "flask.Flask" {
+				return true
+			}
+		}
+	}
+	for _, c := range m.Calls {
+		if c.Name == "Flask" || c.Name == "flask.Flask" {
+			return true
+		}
+	}
+	return false
+}
+
+// modules marks the modules not imported, directly or through other modules,
+// by an entrypoint. Packages are live when one of their modules is.
+func (s *deadCodeScan) modules() {
+	live := map[string]bool{}
+	var queue []string
+	for _, m := range s.p.Modules {
+		entry := s.isEntrypoint(m)
+		if entry {
+			s.out.Entrypoints = append(s.out.Entrypoints, m.Name)
+		}
+		if entry || isTestModule(m) {
+			live[m.Name] = true
+			queue = append(queue, m.Name)
+		}
+	}
+	imports := map[string][]string{}
+	importers := map[string][]string{}
+	if s.p.Graph != nil {
+		for _, e := range s.p.Graph.Edges {
+			imports[e.From] = appendUnique(imports[e.From], e.To)
+			importers[e.To] = appendUnique(importers[e.To], e.From)
+		}
+	}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		next := append([]string{}, imports[name]...)
+		// Importing pkg.mod runs pkg/__init__.py first
+		for pkg := name; strings.Contains(pkg, "."); {
+			pkg = pkg[:strings.LastIndex(pkg, ".")]
+			next = append(next, pkg)
+		}
+		for _, to := range next {
+			if !live[to] {
+				live[to] = true
+				queue = append(queue, to)
+			}
+		}
+	}
+	for _, m := range s.p.Modules {
+		if live[m.Name] {
+			continue
+		}
+		// A package is used when anything inside it is
+		if m.Package && s.liveInside(m.Name, live) {
+			continue
+		}
+		c := DeadCodeCandidate{Kind: "module", Name: m.Name, File: m.Path, Lines: m.Lines}
+		stem := lastSegment(m.Name)
+		switch {
+		case len(s.out.Entrypoints) == 0:
+			c.Confidence, c.Reason = "low", "no entrypoint was found, so every module looks unused; check how the app is started"
+		case len(importers[m.Name]) > 0:
+			c.Confidence, c.Reason = "medium", "only imported by unused modules: "+strings.Join(importers[m.Name], ", ")
+		case s.text.mentions(stem, m.Path) > 0 || s.text.codeLiterals[m.Name] > 0:
+			c.Confidence, c.Reason = "low", fmt.Sprintf("never imported, but %q is named elsewhere (importlib, config or a process file may load it)", stem)
+		default:
+			c.Confidence, c.Reason = "high", "never imported and never named outside its own file"
+		}
+		s.deadMods[m.Name] = c
+		s.add(c)
+	}
+	sort.Strings(s.out.Entrypoints)
+}
+
+func (s *deadCodeScan) liveInside(pkg string, live map[string]bool) bool {
+	for name := range live {
+		if strings.HasPrefix(name, pkg+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// routes marks the routes of unused modules and unregistered blueprints, and
+// the routes no url_for, redirect, link or other string points to
+func (s *deadCodeScan) routes() {
+	apps := findFlaskApps(s.p)
+	registered := map[string]bool{}
+	resolved := true
+	for _, m := range s.p.Modules {
+		for _, fn := range moduleFunctions(m) {
+			resolved = s.registrations(m, fn.Calls, apps, registered) && resolved
+		}
+		resolved = s.registrations(m, m.Calls, apps, registered) && resolved
+	}
+	blueprints := map[string]bool{}
+	for _, a := range apps {
+		if a.Blueprint != "" {
+			blueprints[a.Blueprint] = true
+		}
+	}
+	// The decorators and add_url_rule calls quote the rules themselves
+	ruleUses := map[string]int{}
+	for _, r := range s.p.Routes {
+		ruleUses[r.Rule]++
+	}
+	prefixes := map[string]bool{}
+	for _, a := range apps {
+		if a.Prefix != "" {
+			prefixes[a.Prefix] = true
+		}
+	}
+	for _, r := range s.p.Routes {
+		c := DeadCodeCandidate{Kind: "route", Name: strings.Join(r.Methods, ", ") + " " + r.Path, File: r.File, Line: r.Line}
+		handler := funcRef{Module: r.Module, Qualname: r.Handler}
+		if info := s.graph.funcs[handler]; info != nil {
+			c.Lines = info.Fn.EndLine - info.Fn.Line + 1
+		}
+		if mod, ok := s.deadMods[r.Module]; ok {
+			c.Confidence, c.Reason = mod.Confidence, "defined in module "+r.Module+", which is never imported, so the route is never registered"
+			s.add(c)
+			continue
+		}
+		if r.Blueprint != "" && resolved && blueprints[r.Blueprint] && !registered[r.Blueprint] {
+			c.Confidence, c.Reason = "high", "blueprint "+r.Blueprint+" is never registered with the app, so the route is not served"
+			s.dropped[handler] = true
+			s.add(c)
+			continue
+		}
+		if r.Path == "/" || s.linked(r, ruleUses, prefixes) {
+			continue
+		}
+		if containsString(r.Methods, "GET") && len(r.Templates) > 0 {
+			c.Confidence, c.Reason = "medium", "page that no url_for, redirect or link in the code or templates points to"
+		} else {
+			c.Confidence, c.Reason = "low", "nothing in the code or templates links to it; API clients, external forms or bookmarks may still call it"
+		}
+		s.add(c)
+	}
+}
+
+// registrations records the blueprints passed to register_blueprint. It
+// returns false when a registered name cannot be traced to a blueprint.
+func (s *deadCodeScan) registrations(m *PyModule, calls []PyCall, apps []*flaskApp, registered map[string]bool) bool {
+	resolved := true
+	for _, c := range calls {
+		if !strings.HasSuffix(c.Name, "register_blueprint") || len(c.Args) == 0 {
+			continue
+		}
+		ref := strings.TrimSpace(c.Args[0].Value)
+		bp := lookupApp(apps, m, ref)
+		// from views import bp as views_bp: the import keeps only the original name
+		if from, name := importedAs(s.p.py[m.Path].Src, ref); name != "" {
+			bp = lookupApp(apps, m, lastSegment(from)+"."+name)
+		}
+		if bp == nil || bp.Blueprint == "" {
+			resolved = false
+			continue
+		}
+		registered[bp.Blueprint] = true
+	}
+	return resolved
+}
+
+// importedAs returns the module and original name of a "from ... import name as alias" in src
+func importedAs(src, alias string) (from, name string) {
+	for _, imp := range fromImport.FindAllStringSubmatch(src, -1) {
+		for _, m := range importAlias.FindAllStringSubmatch(imp[2], -1) {
+			if m[2] == alias {
+				return imp[1], m[1]
+			}
+		}
+	}
+	return "", ""
+}
+
+// linked reports whether a quoted string anywhere in the corpus names the
+// route's endpoint (url_for, login_view) or a URL matching its path
+func (s *deadCodeScan) linked(r Route, ruleUses map[string]int, prefixes map[string]bool) bool {
+	pattern := routePathPattern(r.Path)
+	for lit, n := range s.text.literals {
+		switch {
+		case lit == "":
+		case lit == r.Endpoint || strings.HasPrefix(lit, ".") && strings.HasSuffix(r.Endpoint, lit):
+			return true
+		case strings.HasPrefix(lit, "/"):
+			if prefixes[lit] {
+				continue
+			}
+			url := lit
+			if i := strings.IndexAny(url, "?#"); i >= 0 {
+				url = url[:i]
+			}
+			url = linkPlaceholder.ReplaceAllString(url, "x")
+			if pattern.MatchString(url) && n > ruleUses[lit] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// routePathPattern matches the URLs a Flask rule serves, with any value for its parameters
+func routePathPattern(rule string) *regexp.Regexp {
+	var sb strings.Builder
+	sb.WriteString("^")
+	last := 0
+	for _, loc := range urlParamPattern.FindAllStringIndex(rule, -1) {
+		sb.WriteString(regexp.QuoteMeta(rule[last:loc[0]]))
+		if strings.HasPrefix(rule[loc[0]:], "<path:") {
+			sb.WriteString(".+")
+		} else {
+			sb.WriteString("[^/]+")
+		}
+		last = loc[1]
+	}
+	sb.WriteString(regexp.QuoteMeta(strings.TrimSuffix(rule[last:], "/")))
+	sb.WriteString("/?$")
+	return regexp.MustCompile(sb.String())
+}
+
+// functions marks the functions not reachable from a route handler, a
+// registering decorator, a framework hook or module-level code
+func (s *deadCodeScan) functions() {
+	g := s.graph
+	byName := map[string][]*funcInfo{}
+	for _, info := range g.funcs {
+		byName[info.Fn.Name] = append(byName[info.Fn.Name], info)
+	}
+	for _, list := range byName {
+		sort.Slice(list, func(i, j int) bool { return list[i].Ref.String() < list[j].Ref.String() })
+	}
+	imported := map[string]map[string]bool{}
+	if s.p.Graph != nil {
+		for _, e := range s.p.Graph.Edges {
+			if imported[e.From] == nil {
+				imported[e.From] = map[string]bool{}
+			}
+			imported[e.From][e.To] = true
+		}
+	}
+	// resolve finds the function a name refers to from module m, as calls are resolved
+	resolve := func(m *PyModule, name string) *funcInfo {
+		return resolveCall(byName[lastSegment(name)], &funcInfo{Module: m}, imported)
+	}
+
+	reached := map[funcRef]bool{}
+	var queue []funcRef
+	reach := func(info *funcInfo) {
+		if info != nil && !reached[info.Ref] {
+			reached[info.Ref] = true
+			queue = append(queue, info.Ref)
+		}
+	}
+	// Functions passed by name, e.g. sorted(key=f) or Thread(target=f), count as called
+	callbacks := func(m *PyModule, calls []PyCall) {
+		for _, c := range calls {
+			for _, a := range c.Args {
+				if v := strings.TrimSpace(a.Value); dottedIdentifier(v) {
+					reach(resolve(m, v))
+				}
+			}
+		}
+	}
+	for _, r := range s.p.Routes {
+		if ref := (funcRef{Module: r.Module, Qualname: r.Handler}); !s.dropped[ref] {
+			reach(g.funcs[ref])
+		}
+	}
+	for _, m := range s.p.Modules {
+		for _, c := range m.Calls {
+			reach(resolve(m, c.Name))
+		}
+		callbacks(m, m.Calls)
+		for _, fn := range moduleFunctions(m) {
+			if ref := (funcRef{Module: m.Name, Qualname: fn.Qualname}); s.isRoot(m, fn) && !s.dropped[ref] {
+				reach(g.funcs[ref])
+			}
+		}
+	}
+	for len(queue) > 0 {
+		ref := queue[0]
+		queue = queue[1:]
+		for _, callee := range g.callees[ref] {
+			reach(g.funcs[callee])
+		}
+		info := g.funcs[ref]
+		callbacks(info.Module, info.Fn.Calls)
+	}
+
+	bases := map[string]bool{}
+	for _, m := range s.p.Modules {
+		for _, c := range m.Classes {
+			for _, b := range c.Bases {
+				if b != "object" {
+					bases[m.Name+":"+c.Name] = true
+				}
+			}
+		}
+	}
+	refs := make([]funcRef, 0, len(g.funcs))
+	for ref := range g.funcs {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].String() < refs[j].String() })
+	for _, ref := range refs {
+		info := g.funcs[ref]
+		if reached[ref] || isTestModule(info.Module) {
+			continue
+		}
+		s.deadFns[ref] = true
+		if _, ok := s.deadMods[ref.Module]; ok || s.dropped[ref] {
+			// The module or route candidate covers the function
+			continue
+		}
+		c := DeadCodeCandidate{Kind: "function", Name: ref.String(), File: info.Module.Path, Line: info.Fn.Line, Lines: info.Fn.EndLine - info.Fn.Line + 1}
+		method := strings.Contains(ref.Qualname, ".")
+		mentions := s.text.words[info.Fn.Name] - len(byName[info.Fn.Name])
+		switch {
+		case len(g.callers[ref]) > 0:
+			var callers []string
+			for _, caller := range g.callers[ref] {
+				callers = append(callers, caller.String())
+			}
+			c.Confidence, c.Reason = "medium", "only called from unused functions: "+strings.Join(callers, ", ")
+		case method && bases[ref.Module+":"+strings.TrimSuffix(classOf(ref.Qualname), ".")]:
+			c.Confidence, c.Reason = "low", "method of a subclass; the base class or framework may call it"
+		case mentions > 0:
+			c.Confidence, c.Reason = "low", fmt.Sprintf("no call resolves to it, but %q is named %s elsewhere (attribute call, getattr or registration)", info.Fn.Name, plural(mentions, "time"))
+		default:
+			c.Confidence, c.Reason = "high", "never called and never named outside its definition"
+		}
+		s.add(c)
+	}
+}
+
+// isRoot reports whether the framework or the Python runtime calls fn
+func (s *deadCodeScan) isRoot(m *PyModule, fn *PyFunction) bool {
+	if strings.HasPrefix(fn.Name, "__") && strings.HasSuffix(fn.Name, "__") {
+		return true
+	}
+	// flask run and WSGI servers find the app factory by name
+	if appFactories[fn.Qualname] && (m.Package || entrypointModules[lastSegment(m.Name)]) {
+		return true
+	}
+	if strings.Contains(fn.Qualname, ".") && (frameworkMethods[fn.Name] || strings.HasPrefix(fn.Name, "validate_")) {
+		return true
+	}
+	for _, d := range fn.Decorators {
+		name := lastSegment(d.Name)
+		if !pureDecorators[name] && name != "setter" && name != "getter" && name != "deleter" {
+			return true
+		}
+	}
+	return false
+}
+
+// dottedIdentifier reports whether s is a name such as module.func
+func dottedIdentifier(s string) bool {
+	for _, part := range strings.Split(s, ".") {
+		if part == "" || deadCodeWord.FindString(part) != part {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// templates marks the templates no used function renders and no rendered
+// template extends, includes or imports
+func (s *deadCodeScan) templates() {
+	lines := map[string]int{}
+	for _, f := range s.p.Corpus.Files {
+		lines[f.Path] = strings.Count(f.Content, "\n") + 1
+	}
+	for _, m := range s.p.Modules {
+		for _, fn := range moduleFunctions(m) {
+			for _, c := range fn.Calls {
+				if lastSegment(c.Name) != "render_template" {
+					continue
+				}
+				if _, ok := literalString(positionalArg(c.Args, 0, "template_name_or_list")); !ok {
+					s.out.DynamicRenders++
+				}
+			}
+		}
+	}
+
+	moduleOf := map[string]string{}
+	for _, m := range s.p.Modules {
+		moduleOf[m.Path] = m.Name
+	}
+	byName := map[string]*Template{}
+	used := map[string]bool{}
+	renderedByDead := map[string][]string{}
+	var queue []string
+	for _, t := range s.p.Templates {
+		byName[t.Name] = t
+		for _, r := range t.RenderedBy {
+			if s.deadFns[funcRef{Module: moduleOf[r.File], Qualname: r.Function}] {
+				renderedByDead[t.Name] = appendUnique(renderedByDead[t.Name], r.Function)
+				continue
+			}
+			if !used[t.Name] {
+				used[t.Name] = true
+				queue = append(queue, t.Name)
+			}
+		}
+	}
+	usedBy := map[string][]string{}
+	for len(queue) > 0 {
+		t := byName[queue[0]]
+		queue = queue[1:]
+		for _, to := range append(append([]string{t.Extends}, t.Includes...), t.Imports...) {
+			if to == "" {
+				continue
+			}
+			usedBy[to] = appendUnique(usedBy[to], t.Name)
+			if byName[to] != nil && !used[to] {
+				used[to] = true
+				queue = append(queue, to)
+			}
+		}
+	}
+	referrers := map[string][]string{}
+	for _, t := range s.p.Templates {
+		for _, to := range append(append([]string{t.Extends}, t.Includes...), t.Imports...) {
+			if to != "" {
+				referrers[to] = appendUnique(referrers[to], t.Name)
+			}
+		}
+	}
+
+	for _, t := range s.p.Templates {
+		if used[t.Name] {
+			continue
+		}
+		c := DeadCodeCandidate{Kind: "template", Name: t.Name, File: t.Path, Lines: lines[t.Path]}
+		switch {
+		case len(renderedByDead[t.Name]) > 0:
+			c.Confidence, c.Reason = "medium", "only rendered by unused functions: "+strings.Join(renderedByDead[t.Name], ", ")
+		case s.namedInCode(t.Name):
+			c.Confidence, c.Reason = "low", "not rendered by name, but the code quotes its name (mail bodies or a template chosen at runtime)"
+		case len(referrers[t.Name]) > 0:
+			c.Confidence, c.Reason = "medium", "only used by unused templates: "+strings.Join(referrers[t.Name], ", ")
+		case s.out.DynamicRenders > 0:
+			c.Confidence, c.Reason = "medium", fmt.Sprintf("never rendered by name, but %d render_template calls choose the template at runtime", s.out.DynamicRenders)
+		default:
+			c.Confidence, c.Reason = "high", "never rendered, extended, included or imported"
+		}
+		s.add(c)
+	}
+}
+
+// namedInCode reports whether a string outside the templates names the template
+func (s *deadCodeScan) namedInCode(name string) bool {
+	for lit := range s.text.codeLiterals {
+		if lit == name || strings.HasSuffix(lit, "/"+name) || lit == path.Base(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// deadCodeMarkdown renders the candidates for the prompts and readers
+func deadCodeMarkdown(d *DeadCode) string {
+	var sb strings.Builder
+	sb.WriteString("# Dead code\n\n")
+	counts, lines := map[string]int{}, map[string]int{}
+	for _, c := range d.Candidates {
+		counts[c.Confidence]++
+		lines[c.Confidence] += c.Lines
+	}
+	fmt.Fprintf(&sb, "%d \"do not migrate\" candidates: %d high confidence (%d lines), %d medium (%d lines) and %d low (%d lines). "+
+		"High confidence code is unreachable from the entrypoints, routes and framework hooks and nothing names it; "+
+		"medium is only used by other dead code or may be picked at runtime; low has no resolved use but is named somewhere, so check it before dropping it.\n\n",
+		len(d.Candidates), counts["high"], lines["high"], counts["medium"], lines["medium"], counts["low"], lines["low"])
+	if len(d.Entrypoints) > 0 {
+		fmt.Fprintf(&sb, "Entrypoints: %s.\n", strings.Join(d.Entrypoints, ", "))
+	} else {
+		sb.WriteString("No entrypoint module was found.\n")
+	}
+	titles := map[string]string{"module": "Modules never imported", "route": "Routes nothing links to",
+		"function": "Functions never called", "template": "Templates never rendered"}
+	for _, kind := range deadCodeKinds {
+		var rows []DeadCodeCandidate
+		for _, c := range d.Candidates {
+			if c.Kind == kind {
+				rows = append(rows, c)
+			}
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		fmt.Fprintf(&sb, "\n## %s\n\n| Confidence | Name | Location | Lines | Reason |\n|---|---|---|---|---|\n", titles[kind])
+		for _, c := range rows {
+			location := c.File
+			if c.Line > 0 {
+				location = fmt.Sprintf("%s:%d", c.File, c.Line)
+			}
+			fmt.Fprintf(&sb, "| %s | %s | %s | %d | %s |\n", c.Confidence, markdownCell(c.Name), location, c.Lines, markdownCell(c.Reason))
+		}
+	}
+	return sb.String()
+}
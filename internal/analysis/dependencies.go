@@ -0,0 +1,490 @@
+package analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"lcma/internal/config"
+	"lcma/internal/utils"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Dependency is a package declared in a requirements file, Pipfile,
+// pyproject.toml or setup.py, with its recommended Go equivalent
+type Dependency struct {
+	Name      string   `json:"name"`    // as declared
+	Package   string   `json:"package"` // normalized PyPI name
+	Specifier string   `json:"specifier,omitempty"`
+	Version   string   `json:"version,omitempty"` // set when the version is pinned with ==
+	Extras    []string `json:"extras,omitempty"`
+	Markers   string   `json:"markers,omitempty"`
+	// Group is "main", "dev" or the name of an optional extra
+	Group        string   `json:"group"`
+	Source       string   `json:"source"`
+	Line         int      `json:"line"`
+	Go           string   `json:"go,omitempty"`
+	Alternatives []string `json:"alternatives,omitempty"`
+	Notes        string   `json:"notes,omitempty"`
+	// Mapped is set when the knowledge base has an entry, even one saying no
+	// Go library is needed
+	Mapped     bool     `json:"mapped"`
+	ImportedBy []string `json:"imported_by,omitempty"`
+}
+
+// UndeclaredImport is a third-party package the code imports without declaring it
+type UndeclaredImport struct {
+	Import     string   `json:"import"`
+	Package    string   `json:"package,omitempty"` // knowledge base package providing the import
+	Go         string   `json:"go,omitempty"`
+	Mapped     bool     `json:"mapped"`
+	ImportedBy []string `json:"imported_by"`
+}
+
+// StdlibImport is a standard library module and its Go counterpart
+type StdlibImport struct {
+	Module     string   `json:"module"`
+	Go         string   `json:"go,omitempty"`
+	ImportedBy []string `json:"imported_by"`
+}
+
+// DependencyInventory is the layout of dependencies.json
+type DependencyInventory struct {
+	Dependencies []Dependency       `json:"dependencies"`
+	Undeclared   []UndeclaredImport `json:"undeclared"`
+	Stdlib       []StdlibImport     `json:"stdlib"`
+	// Unmapped lists packages without a knowledge base entry; they are migration risks
+	Unmapped []string `json:"unmapped"`
+}
+
+// libraryMap is the curated knowledge base in GO_LIBRARY_MAP
+type libraryMap struct {
+	Packages map[string]libraryEntry `json:"packages"`
+	Stdlib   map[string]string       `json:"stdlib"`
+}
+
+// libraryEntry is the Go replacement of a Python package. An empty Go means the
+// package is not needed in Go, which the notes explain.
+type libraryEntry struct {
+	Go           string   `json:"go"`
+	Alternatives []string `json:"alternatives,omitempty"`
+	Notes        string   `json:"notes,omitempty"`
+	Imports      []string `json:"imports,omitempty"` // import names, when they differ from the package name
+}
+
+var (
+	requirementPattern = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9._-]*)\s*(?:\[([^\]]*)\])?\s*(.*)$`)
+	pinnedPattern      = regexp.MustCompile(`^===?\s*([^,\s]+)$`)
+	packageSeparator   = regexp.MustCompile(`[-_.]+`)
+	eggPattern         = regexp.MustCompile(`#egg=([A-Za-z0-9][A-Za-z0-9._-]*)`)
+)
+
+// analyzeDependencies builds the dependency inventory and maps it to Go libraries
+func analyzeDependencies(p *Project) error {
+	libs, err := loadLibraryMap(config.LibraryMapPath)
+	if err != nil {
+		return err
+	}
+
+	inv := &DependencyInventory{}
+	for _, f := range p.Corpus.Files {
+		base := strings.ToLower(path.Base(f.Path))
+		switch {
+		case base == "pipfile":
+			inv.Dependencies = append(inv.Dependencies, parsePipfile(f.Path, f.Content)...)
+		case base == "pyproject.toml":
+			inv.Dependencies = append(inv.Dependencies, parsePyproject(f.Path, f.Content)...)
+		case base == "setup.py":
+			inv.Dependencies = append(inv.Dependencies, parseSetupPy(p, f.Path)...)
+		case utils.IsDependencyFile(f.Path):
+			inv.Dependencies = append(inv.Dependencies, parseRequirements(f.Path, f.Content)...)
+		}
+	}
+	mapDependencies(p, inv, libs)
+	p.Dependencies = inv
+
+	if err := utils.WriteReportJSON("dependencies.json", inv); err != nil {
+		return err
+	}
+	return utils.WriteReportFile("dependencies.md", []byte(dependenciesMarkdown(inv)))
+}
+
+// loadLibraryMap reads the knowledge base; a missing file leaves every package unmapped
+func loadLibraryMap(file string) (*libraryMap, error) {
+	libs := &libraryMap{Packages: map[string]libraryEntry{}, Stdlib: map[string]string{}}
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		fmt.Printf("Warning: Go library map %s not found, every dependency is reported as unmapped\n", file)
+		return libs, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Go library map: %w", err)
+	}
+	var raw libraryMap
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse Go library map %s: %w", file, err)
+	}
+	for name, entry := range raw.Packages {
+		libs.Packages[normalizePackage(name)] = entry
+	}
+	for name, goPkg := range raw.Stdlib {
+		libs.Stdlib[name] = goPkg
+	}
+	return libs, nil
+}
+
+// normalizePackage normalizes a PyPI name as pip does: Flask_WTF is flask-wtf
+func normalizePackage(name string) string {
+	return strings.ToLower(packageSeparator.ReplaceAllString(name, "-"))
+}
+
+// parseRequirement parses a PEP 508 requirement such as "Flask[async]>=2.0; python_version>'3.8'"
+func parseRequirement(spec, source string, line int, group string) (Dependency, bool) {
+	spec = strings.TrimSpace(spec)
+	m := requirementPattern.FindStringSubmatch(spec)
+	if m == nil {
+		return Dependency{}, false
+	}
+	d := Dependency{Name: m[1], Package: normalizePackage(m[1]), Group: group, Source: source, Line: line}
+	for _, e := range strings.Split(m[2], ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			d.Extras = append(d.Extras, e)
+		}
+	}
+	rest := m[3]
+	if i := strings.Index(rest, ";"); i >= 0 {
+		d.Markers = strings.TrimSpace(rest[i+1:])
+		rest = rest[:i]
+	}
+	rest = strings.TrimSpace(rest)
+	if strings.HasPrefix(rest, "@") {
+		// Direct reference: name @ https://...
+		d.Specifier = rest
+		return d, true
+	}
+	d.Specifier = strings.TrimSpace(strings.Trim(rest, "()"))
+	if pin := pinnedPattern.FindStringSubmatch(d.Specifier); pin != nil {
+		d.Version = pin[1]
+	}
+	return d, true
+}
+
+// parseRequirements reads a pip requirements file. Includes (-r) are separate
+// corpus files, so they are parsed on their own.
+func parseRequirements(source, src string) []Dependency {
+	group := "main"
+	if base := strings.ToLower(path.Base(source)); strings.Contains(base, "dev") || strings.Contains(base, "test") {
+		group = "dev"
+	}
+	var deps []Dependency
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		start := i
+		line := lines[i]
+		for strings.HasSuffix(line, "\\") && i+1 < len(lines) {
+			i++
+			line = strings.TrimSuffix(line, "\\") + " " + lines[i]
+		}
+		if k := strings.Index(line, "#"); k >= 0 && (k == 0 || line[k-1] == ' ' || line[k-1] == '\t') {
+			line = line[:k]
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "-e ") || strings.HasPrefix(line, "--editable"):
+			// Editable installs only name the package in #egg=
+			if m := eggPattern.FindStringSubmatch(lines[i]); m != nil {
+				deps = append(deps, Dependency{Name: m[1], Package: normalizePackage(m[1]), Specifier: "editable", Group: group, Source: source, Line: start + 1})
+			}
+			continue
+		case strings.HasPrefix(line, "-"), strings.Contains(line, "://") && !strings.Contains(line, "@"):
+			continue
+		}
+		// Hash checking options follow the requirement
+		if k := strings.Index(line, " --"); k >= 0 {
+			line = line[:k]
+		}
+		if d, ok := parseRequirement(line, source, start+1, group); ok {
+			deps = append(deps, d)
+		}
+	}
+	return deps
+}
+
+// parsePipfile reads the [packages] and [dev-packages] tables of a Pipfile
+func parsePipfile(source, src string) []Dependency {
+	var deps []Dependency
+	for _, e := range parseTOMLEntries(src) {
+		group := map[string]string{"packages": "main", "dev-packages": "dev"}[e.Table]
+		if group == "" {
+			continue
+		}
+		deps = append(deps, tomlDependency(e, source, group))
+	}
+	return deps
+}
+
+// parsePyproject reads PEP 621 and Poetry dependencies
+func parsePyproject(source, src string) []Dependency {
+	var deps []Dependency
+	for _, e := range parseTOMLEntries(src) {
+		switch {
+		case e.Table == "project" && e.Key == "dependencies":
+			deps = append(deps, requirementList(e, source, "main")...)
+		case e.Table == "project.optional-dependencies":
+			deps = append(deps, requirementList(e, source, optionalGroup(e.Key))...)
+		case e.Table == "dependency-groups":
+			deps = append(deps, requirementList(e, source, optionalGroup(e.Key))...)
+		case e.Table == "tool.poetry.dependencies" && e.Key != "python":
+			deps = append(deps, tomlDependency(e, source, "main"))
+		case e.Table == "tool.poetry.dev-dependencies":
+			deps = append(deps, tomlDependency(e, source, "dev"))
+		case strings.HasPrefix(e.Table, "tool.poetry.group.") && strings.HasSuffix(e.Table, ".dependencies"):
+			name := strings.TrimSuffix(strings.TrimPrefix(e.Table, "tool.poetry.group."), ".dependencies")
+			deps = append(deps, tomlDependency(e, source, optionalGroup(name)))
+		}
+	}
+	return deps
+}
+
+// optionalGroup folds the usual names of development extras into "dev"
+func optionalGroup(name string) string {
+	switch strings.ToLower(name) {
+	case "dev", "develop", "development", "test", "tests", "testing", "lint", "docs", "typing":
+		return "dev"
+	}
+	return name
+}
+
+// requirementList parses a TOML array of PEP 508 strings
+func requirementList(e tomlEntry, source, group string) []Dependency {
+	var deps []Dependency
+	for _, spec := range literalStrings(e.Value) {
+		if d, ok := parseRequirement(spec, source, e.Line, group); ok {
+			deps = append(deps, d)
+		}
+	}
+	return deps
+}
+
+// tomlDependency reads name = "spec" or name = {version = "spec", extras = [...]}
+func tomlDependency(e tomlEntry, source, group string) Dependency {
+	d := Dependency{Name: e.Key, Package: normalizePackage(e.Key), Group: group, Source: source, Line: e.Line}
+	spec, _ := literalString(e.Value)
+	if table := tomlInlineTable(e.Value); table != nil {
+		spec, _ = literalString(table["version"])
+		d.Extras = literalStrings(table["extras"])
+		d.Markers, _ = literalString(table["markers"])
+		for _, k := range []string{"git", "path", "url"} {
+			if v, ok := literalString(table[k]); ok {
+				spec = k + " " + v
+			}
+		}
+	}
+	if spec != "*" {
+		d.Specifier = spec
+	}
+	if pin := pinnedPattern.FindStringSubmatch(spec); pin != nil {
+		d.Version = pin[1]
+	} else if isBareVersion(spec) {
+		// Poetry treats a bare version as an exact pin
+		d.Version = spec
+	}
+	return d
+}
+
+func isBareVersion(s string) bool {
+	return s != "" && s[0] >= '0' && s[0] <= '9' && !strings.ContainsAny(s, "<>=~^*, ")
+}
+
+// parseSetupPy reads install_requires, tests_require and extras_require of setup()
+func parseSetupPy(p *Project, source string) []Dependency {
+	f := p.py[source]
+	if f == nil {
+		return nil
+	}
+	var deps []Dependency
+	for _, c := range allCalls(f.Module) {
+		if c.Name != "setup" && c.Name != "setuptools.setup" {
+			continue
+		}
+		for _, kw := range []struct{ name, group string }{{"install_requires", "main"}, {"tests_require", "dev"}, {"setup_requires", "build"}} {
+			for _, spec := range literalStrings(moduleValue(f, keywordArg(c.Args, kw.name))) {
+				if d, ok := parseRequirement(spec, source, c.Line, kw.group); ok {
+					deps = append(deps, d)
+				}
+			}
+		}
+		// extras_require = {"postgres": ["psycopg2"], ...}
+		group := ""
+		toks := tokenizePython(moduleValue(f, keywordArg(c.Args, "extras_require")))
+		for i, t := range toks {
+			if t.Kind != tokString {
+				continue
+			}
+			value := stringLiteralValue(t.Value)
+			if i+1 < len(toks) && toks[i+1].Value == ":" {
+				group = optionalGroup(value)
+				continue
+			}
+			if d, ok := parseRequirement(value, source, c.Line, group); ok && group != "" {
+				deps = append(deps, d)
+			}
+		}
+	}
+	return deps
+}
+
+// moduleValue resolves a module-level variable to the expression assigned to it,
+// so install_requires=REQUIREMENTS finds the list
+func moduleValue(f *pyFile, expr string) string {
+	name := strings.TrimSpace(expr)
+	if !isIdentifier(name) {
+		return expr
+	}
+	for _, st := range f.Stmts {
+		if target, ok := assignmentTarget(st); ok && target == name {
+			if k := indexOp(st.Tokens, "=", 1); k >= 0 && k+1 < len(st.Tokens) {
+				return f.Src[st.Tokens[k+1].Pos:st.Tokens[len(st.Tokens)-1].End]
+			}
+		}
+	}
+	return expr
+}
+
+// mapDependencies attaches Go equivalents and importers, and finds undeclared
+// and standard library imports
+func mapDependencies(p *Project, inv *DependencyInventory, libs *libraryMap) {
+	importers := map[string][]string{}
+	if p.Graph != nil {
+		for _, e := range p.Graph.External {
+			importers[e.Package] = e.ImportedBy
+		}
+	}
+	// Import names provided by each knowledge base package
+	providers := map[string]string{}
+	for _, name := range sortedKeys(libs.Packages) {
+		for _, imp := range libs.Packages[name].Imports {
+			if _, ok := providers[imp]; !ok {
+				providers[imp] = name
+			}
+		}
+	}
+
+	declaredImports := map[string]bool{}
+	unmapped := map[string]bool{}
+	for i := range inv.Dependencies {
+		d := &inv.Dependencies[i]
+		entry, ok := libs.Packages[d.Package]
+		d.Mapped = ok
+		d.Go, d.Alternatives, d.Notes = entry.Go, entry.Alternatives, entry.Notes
+		if !ok {
+			unmapped[d.Package] = true
+		}
+		imports := entry.Imports
+		if len(imports) == 0 {
+			imports = []string{strings.ReplaceAll(d.Package, "-", "_")}
+		}
+		for _, imp := range imports {
+			declaredImports[imp] = true
+			for _, m := range importers[imp] {
+				d.ImportedBy = appendUnique(d.ImportedBy, m)
+			}
+		}
+	}
+
+	for _, imp := range sortedKeys(importers) {
+		switch {
+		case declaredImports[imp]:
+		case isStdlibModule(libs, imp):
+			inv.Stdlib = append(inv.Stdlib, StdlibImport{Module: imp, Go: libs.Stdlib[imp], ImportedBy: importers[imp]})
+		default:
+			u := UndeclaredImport{Import: imp, ImportedBy: importers[imp]}
+			if pkg, ok := providers[imp]; ok {
+				u.Package, u.Go, u.Mapped = pkg, libs.Packages[pkg].Go, true
+			} else if entry, ok := libs.Packages[normalizePackage(imp)]; ok {
+				u.Package, u.Go, u.Mapped = normalizePackage(imp), entry.Go, true
+			} else {
+				unmapped[normalizePackage(imp)] = true
+			}
+			inv.Undeclared = append(inv.Undeclared, u)
+		}
+	}
+
+	sort.SliceStable(inv.Dependencies, func(i, j int) bool {
+		return inv.Dependencies[i].Package < inv.Dependencies[j].Package
+	})
+	inv.Dependencies = nonNil(inv.Dependencies)
+	inv.Undeclared = nonNil(inv.Undeclared)
+	inv.Stdlib = nonNil(inv.Stdlib)
+	inv.Unmapped = sortedKeys(unmapped)
+}
+
+func isStdlibModule(libs *libraryMap, module string) bool {
+	_, ok := libs.Stdlib[module]
+	return ok
+}
+
+// dependenciesMarkdown renders the inventory for the code prompt and readers
+func dependenciesMarkdown(inv *DependencyInventory) string {
+	var sb strings.Builder
+	sb.WriteString("# Python dependencies\n\n")
+	mapped := 0
+	for _, d := range inv.Dependencies {
+		if d.Mapped {
+			mapped++
+		}
+	}
+	fmt.Fprintf(&sb, "%d declared dependencies, %d mapped to Go, %d packages without a known Go equivalent, %d undeclared third-party imports.\n\n",
+		len(inv.Dependencies), mapped, len(inv.Unmapped), len(inv.Undeclared))
+
+	if len(inv.Dependencies) > 0 {
+		sb.WriteString("| Package | Version | Group | Declared in | Go equivalent | Notes |\n|---|---|---|---|---|---|\n")
+		for _, d := range inv.Dependencies {
+			fmt.Fprintf(&sb, "| %s | %s | %s | %s:%d | %s | %s |\n", d.Name, markdownCell(d.Specifier), d.Group, d.Source, d.Line, goEquivalent(d.Go, d.Alternatives, d.Mapped), markdownCell(d.Notes))
+		}
+	}
+
+	if len(inv.Undeclared) > 0 {
+		sb.WriteString("\n## Imported but not declared\n\n| Import | Package | Go equivalent | Imported by |\n|---|---|---|---|\n")
+		for _, u := range inv.Undeclared {
+			fmt.Fprintf(&sb, "| %s | %s | %s | %s |\n", u.Import, u.Package, goEquivalent(u.Go, nil, u.Mapped), strings.Join(u.ImportedBy, ", "))
+		}
+	}
+
+	if len(inv.Unmapped) > 0 {
+		sb.WriteString("\n## Migration risks\n\nNo vetted Go equivalent is known for these packages; choose one deliberately or add it to the library map:\n\n")
+		for _, pkg := range inv.Unmapped {
+			fmt.Fprintf(&sb, "- %s\n", pkg)
+		}
+	}
+
+	if len(inv.Stdlib) > 0 {
+		sb.WriteString("\n## Standard library\n\n| Module | Go package | Imported by |\n|---|---|---|\n")
+		for _, s := range inv.Stdlib {
+			fmt.Fprintf(&sb, "| %s | %s | %s |\n", s.Module, s.Go, strings.Join(s.ImportedBy, ", "))
+		}
+	}
+	return sb.String()
+}
+
+// goEquivalent renders a Go mapping for a table cell
+func goEquivalent(goPkg string, alternatives []string, mapped bool) string {
+	switch {
+	case !mapped:
+		return "**unmapped**"
+	case goPkg == "":
+		return "none, see notes"
+	case len(alternatives) > 0:
+		return goPkg + " (or " + strings.Join(alternatives, ", ") + ")"
+	}
+	return goPkg
+}
+
+// markdownCell escapes pipes in table cells
+func markdownCell(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
@@ -0,0 +1,412 @@
+package analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"lcma/internal/config"
+	"lcma/internal/utils"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// DependencyVulnerability is an advisory affecting a pinned dependency
+type DependencyVulnerability struct {
+	Package  string   `json:"package"`
+	Version  string   `json:"version"`
+	ID       string   `json:"id"`
+	CVEs     []string `json:"cves,omitempty"`
+	Summary  string   `json:"summary,omitempty"`
+	Severity string   `json:"severity"`
+	Score    float64  `json:"score,omitempty"` // CVSS v3 base score
+	Fixed    string   `json:"fixed,omitempty"` // lowest release with the fix
+	Source   string   `json:"source"`
+	Line     int      `json:"line"`
+}
+
+// DependencyEOL is a pinned dependency whose release cycle no longer gets fixes
+type DependencyEOL struct {
+	Package string `json:"package"`
+	Version string `json:"version"`
+	Cycle   string `json:"cycle,omitempty"` // empty when older than every known cycle
+	EOL     string `json:"eol,omitempty"`
+	Source  string `json:"source"`
+	Line    int    `json:"line"`
+}
+
+// DependencyLicense is the license of a dependency and its copyleft class:
+// "strong", "network", "weak", "permissive" or "unknown"
+type DependencyLicense struct {
+	Package  string `json:"package"`
+	License  string `json:"license,omitempty"`
+	Copyleft string `json:"copyleft"`
+}
+
+// DependencyAudit is the layout of dependency_audit.json
+type DependencyAudit struct {
+	AdvisorySource  string                    `json:"advisory_source,omitempty"`
+	LicenseSource   string                    `json:"license_source,omitempty"`
+	Audited         int                       `json:"audited"`
+	Vulnerabilities []DependencyVulnerability `json:"vulnerabilities"`
+	EOL             []DependencyEOL           `json:"eol"`
+	EOLDate         string                    `json:"eol_date"` // cycles ended on or before this date are reported
+	Licenses        []DependencyLicense       `json:"licenses"`
+	// Unpinned dependencies cannot be matched against advisories
+	Unpinned []string `json:"unpinned"`
+}
+
+// eolCycle is a release cycle of the curated PACKAGE_EOL_DATABASE
+type eolCycle struct {
+	Cycle string `json:"cycle"`
+	EOL   string `json:"eol"` // YYYY-MM-DD
+}
+
+// analyzeDependencyAudit checks the pinned dependencies against the offline
+// advisory, end-of-life and license databases
+func analyzeDependencyAudit(p *Project) error {
+	audit := &DependencyAudit{}
+	packages := map[string]bool{}
+	var pinned []Dependency
+	for _, d := range p.Dependencies.Dependencies {
+		packages[d.Package] = true
+		if d.Version == "" {
+			audit.Unpinned = appendUnique(audit.Unpinned, d.Package)
+			continue
+		}
+		pinned = append(pinned, d)
+	}
+	audit.Audited = len(pinned)
+
+	if config.OSVDatabasePath != "" {
+		db, err := loadOSV(config.OSVDatabasePath, packages)
+		if err != nil {
+			return err
+		}
+		audit.AdvisorySource = config.OSVDatabasePath
+		audit.Vulnerabilities = matchAdvisories(pinned, db)
+	}
+
+	eol, err := loadEOLDatabase(config.PackageEOLPath)
+	if err != nil {
+		return err
+	}
+	audit.EOLDate = config.EOLDate
+	audit.EOL = matchEOL(append(pythonRuntime(p), pinned...), eol, audit.EOLDate)
+
+	if config.LicenseDBPath != "" {
+		licenses, err := loadLicenseDatabase(config.LicenseDBPath)
+		if err != nil {
+			return err
+		}
+		audit.LicenseSource = config.LicenseDBPath
+		for pkg := range packages {
+			license := licenses[pkg]
+			audit.Licenses = append(audit.Licenses, DependencyLicense{Package: pkg, License: license, Copyleft: copyleftClass(license)})
+		}
+		sort.Slice(audit.Licenses, func(i, j int) bool { return audit.Licenses[i].Package < audit.Licenses[j].Package })
+	}
+
+	p.Audit = audit
+
+	if err := utils.WriteReportJSON("dependency_audit.json", audit); err != nil {
+		return err
+	}
+	return utils.WriteReportFile("dependency_audit.md", []byte(dependencyAuditMarkdown(audit)))
+}
+
+// matchAdvisories returns the advisories affecting each pinned version,
+// most severe first
+func matchAdvisories(pinned []Dependency, db map[string][]osvVuln) []DependencyVulnerability {
+	var out []DependencyVulnerability
+	for _, d := range pinned {
+		for _, v := range db[d.Package] {
+			affected, fixed := v.affects(d.Package, d.Version)
+			if !affected {
+				continue
+			}
+			score, severity := v.severity()
+			summary := v.Summary
+			if summary == "" {
+				summary, _, _ = strings.Cut(strings.TrimSpace(v.Details), "\n")
+			}
+			out = append(out, DependencyVulnerability{
+				Package: d.Package, Version: d.Version, ID: v.ID, CVEs: v.cves(), Summary: summary,
+				Severity: severity, Score: score, Fixed: fixed, Source: d.Source, Line: d.Line,
+			})
+		}
+	}
+	rank := map[string]int{"CRITICAL": 0, "HIGH": 1, "MODERATE": 2, "MEDIUM": 2, "LOW": 3}
+	sort.SliceStable(out, func(i, j int) bool {
+		ri, ok := rank[out[i].Severity]
+		if !ok {
+			ri = 4
+		}
+		rj, ok := rank[out[j].Severity]
+		if !ok {
+			rj = 4
+		}
+		if ri != rj {
+			return ri < rj
+		}
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		return out[i].Package < out[j].Package
+	})
+	return out
+}
+
+// loadEOLDatabase reads the release cycles per package; a missing file
+// disables the end-of-life check
+func loadEOLDatabase(file string) (map[string][]eolCycle, error) {
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		fmt.Printf("Warning: package EOL database %s not found, end-of-life versions are not reported\n", file)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read package EOL database: %w", err)
+	}
+	var raw map[string][]eolCycle
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse package EOL database %s: %w", file, err)
+	}
+	db := map[string][]eolCycle{}
+	for name, cycles := range raw {
+		db[normalizePackage(name)] = cycles
+	}
+	return db, nil
+}
+
+// pythonRuntime returns the Python version a Pipfile [requires] section or a
+// Poetry python constraint pins, to check against the "python" release cycles.
+// A range such as ^3.8 counts as its lowest version.
+func pythonRuntime(p *Project) []Dependency {
+	var out []Dependency
+	for _, f := range p.Corpus.Files {
+		base := strings.ToLower(path.Base(f.Path))
+		if base != "pipfile" && base != "pyproject.toml" {
+			continue
+		}
+		for _, e := range parseTOMLEntries(f.Content) {
+			if !(e.Table == "requires" && (e.Key == "python_version" || e.Key == "python_full_version")) &&
+				!(e.Table == "tool.poetry.dependencies" && e.Key == "python") {
+				continue
+			}
+			v, _ := literalString(e.Value)
+			v = strings.TrimSuffix(strings.TrimLeft(strings.TrimSpace(v), "=^~> "), ".*")
+			if isBareVersion(v) {
+				out = append(out, Dependency{Name: "python", Package: "python", Version: v, Source: f.Path, Line: e.Line})
+			}
+		}
+	}
+	return out
+}
+
+// eolAliases are distributions released on the cycles of another package
+var eolAliases = map[string]string{
+	"psycopg2-binary": "psycopg2",
+}
+
+// matchEOL reports pinned versions whose cycle ended on or before today
+// (YYYY-MM-DD), and versions older than every known cycle
+func matchEOL(pinned []Dependency, db map[string][]eolCycle, today string) []DependencyEOL {
+	var out []DependencyEOL
+	for _, d := range pinned {
+		pkg := d.Package
+		if alias, ok := eolAliases[pkg]; ok {
+			pkg = alias
+		}
+		cycles := db[pkg]
+		if len(cycles) == 0 {
+			continue
+		}
+		matched, older := false, true
+		for _, c := range cycles {
+			if versionInCycle(d.Version, c.Cycle) {
+				matched = true
+				if c.EOL != "" && c.EOL <= today {
+					out = append(out, DependencyEOL{Package: d.Package, Version: d.Version, Cycle: c.Cycle, EOL: c.EOL, Source: d.Source, Line: d.Line})
+				}
+				break
+			}
+			if comparePyVersions(d.Version, c.Cycle) >= 0 {
+				older = false
+			}
+		}
+		if !matched && older {
+			out = append(out, DependencyEOL{Package: d.Package, Version: d.Version, Source: d.Source, Line: d.Line})
+		}
+	}
+	return out
+}
+
+// versionInCycle reports whether version belongs to a release cycle such as
+// "4.2", which covers 4.2, 4.2.11 and 4.2rc1
+func versionInCycle(version, cycle string) bool {
+	v, ok := parsePyVersion(version)
+	c, okCycle := parsePyVersion(cycle)
+	if !ok || !okCycle {
+		return strings.HasPrefix(version, cycle+".") || version == cycle
+	}
+	parts := len(strings.Split(cycle, "."))
+	for i := 0; i < parts; i++ {
+		if segment(v.release, i) != segment(c.release, i) {
+			return false
+		}
+	}
+	return v.epoch == c.epoch
+}
+
+// loadLicenseDatabase reads package licenses either as a JSON object keyed by
+// package, whose values are a license string or an object with a "license"
+// field, or as the array written by pip-licenses --format=json
+func loadLicenseDatabase(file string) (map[string]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read license database: %w", err)
+	}
+	licenses := map[string]string{}
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "[") {
+		var rows []map[string]any
+		if err := json.Unmarshal(data, &rows); err != nil {
+			return nil, fmt.Errorf("failed to parse license database %s: %w", file, err)
+		}
+		for _, row := range rows {
+			name, license := stringField(row, "name"), stringField(row, "license")
+			if name != "" {
+				licenses[normalizePackage(name)] = license
+			}
+		}
+		return licenses, nil
+	}
+
+	var entries map[string]json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse license database %s: %w", file, err)
+	}
+	for name, raw := range entries {
+		var license string
+		if err := json.Unmarshal(raw, &license); err != nil {
+			var obj map[string]any
+			if err := json.Unmarshal(raw, &obj); err != nil {
+				return nil, fmt.Errorf("failed to parse license of %s in %s: %w", name, file, err)
+			}
+			license = stringField(obj, "license")
+		}
+		licenses[normalizePackage(name)] = license
+	}
+	return licenses, nil
+}
+
+// stringField reads a string field by case-insensitive key
+func stringField(obj map[string]any, key string) string {
+	for k, v := range obj {
+		if s, ok := v.(string); ok && strings.EqualFold(k, key) {
+			return strings.TrimSpace(s)
+		}
+	}
+	return ""
+}
+
+// copyleftClass classifies a license name or SPDX expression
+func copyleftClass(license string) string {
+	l := strings.ToUpper(license)
+	switch {
+	case l == "" || l == "UNKNOWN":
+		return "unknown"
+	case strings.Contains(l, "AGPL") || strings.Contains(l, "AFFERO") || strings.Contains(l, "SSPL"):
+		return "network"
+	case strings.Contains(l, "LGPL") || strings.Contains(l, "LESSER GENERAL"):
+		return "weak"
+	case strings.Contains(l, "GPL") || strings.Contains(l, "GENERAL PUBLIC"):
+		return "strong"
+	}
+	for _, weak := range []string{"MPL", "MOZILLA", "EPL", "ECLIPSE", "CDDL", "EUPL", "OSL", "CPL"} {
+		if strings.Contains(l, weak) {
+			return "weak"
+		}
+	}
+	return "permissive"
+}
+
+// dependencyAuditMarkdown renders the Dependencies section of the report
+func dependencyAuditMarkdown(audit *DependencyAudit) string {
+	var sb strings.Builder
+	sb.WriteString("# Dependencies\n\n")
+	fmt.Fprintf(&sb, "%d pinned dependencies audited, %d not pinned. %d known vulnerabilities, %d end-of-life versions.\n",
+		audit.Audited, len(audit.Unpinned), len(audit.Vulnerabilities), len(audit.EOL))
+
+	sb.WriteString("\n## Known vulnerabilities\n\n")
+	switch {
+	case audit.AdvisorySource == "":
+		sb.WriteString("Not checked: no OSV advisory database was configured (OSV_DATABASE).\n")
+	case len(audit.Vulnerabilities) == 0:
+		fmt.Fprintf(&sb, "No advisory in %s affects the pinned versions.\n", audit.AdvisorySource)
+	default:
+		sb.WriteString("| Package | Version | Advisory | CVE | Severity | Fixed in | Declared in | Summary |\n|---|---|---|---|---|---|---|---|\n")
+		for _, v := range audit.Vulnerabilities {
+			severity := v.Severity
+			if score := formatScore(v.Score); score != "" {
+				severity += " (" + score + ")"
+			}
+			fixed := v.Fixed
+			if fixed == "" {
+				fixed = "no fix"
+			}
+			fmt.Fprintf(&sb, "| %s | %s | %s | %s | %s | %s | %s:%d | %s |\n", v.Package, v.Version, v.ID, strings.Join(v.CVEs, ", "), severity, fixed, v.Source, v.Line, markdownCell(v.Summary))
+		}
+	}
+
+	sb.WriteString("\n## End-of-life versions\n\n")
+	fmt.Fprintf(&sb, "Release cycles checked as of %s (EOL_DATE).\n\n", audit.EOLDate)
+	if len(audit.EOL) == 0 {
+		sb.WriteString("No pinned version is past the end of life of its release cycle.\n")
+	} else {
+		sb.WriteString("| Package | Version | Release cycle | End of life | Declared in |\n|---|---|---|---|---|\n")
+		for _, e := range audit.EOL {
+			cycle, eol := e.Cycle, e.EOL
+			if cycle == "" {
+				cycle, eol = "older than every tracked cycle", "passed"
+			}
+			fmt.Fprintf(&sb, "| %s | %s | %s | %s | %s:%d |\n", e.Package, e.Version, cycle, eol, e.Source, e.Line)
+		}
+	}
+
+	sb.WriteString("\n## Copyleft licenses\n\n")
+	var copyleft, unknown []DependencyLicense
+	for _, l := range audit.Licenses {
+		switch l.Copyleft {
+		case "strong", "network", "weak":
+			copyleft = append(copyleft, l)
+		case "unknown":
+			unknown = append(unknown, l)
+		}
+	}
+	switch {
+	case audit.LicenseSource == "":
+		sb.WriteString("Not checked: no license database was configured (LICENSE_DATABASE).\n")
+	case len(copyleft) == 0:
+		sb.WriteString("No copyleft license found.\n")
+	default:
+		sb.WriteString("| Package | License | Copyleft |\n|---|---|---|\n")
+		for _, l := range copyleft {
+			fmt.Fprintf(&sb, "| %s | %s | %s |\n", l.Package, markdownCell(l.License), l.Copyleft)
+		}
+	}
+	if len(unknown) > 0 {
+		sb.WriteString("\nLicense unknown, review manually:\n\n")
+		for _, l := range unknown {
+			fmt.Fprintf(&sb, "- %s\n", l.Package)
+		}
+	}
+
+	if len(audit.Unpinned) > 0 {
+		sb.WriteString("\n## Not audited\n\nThese dependencies are not pinned with ==, so their installed version and its advisories are unknown:\n\n")
+		for _, pkg := range audit.Unpinned {
+			fmt.Fprintf(&sb, "- %s\n", pkg)
+		}
+	}
+	return sb.String()
+}
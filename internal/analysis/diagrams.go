@@ -0,0 +1,496 @@
+package analysis
+
+import (
+	"fmt"
+	"lcma/internal/config"
+	"lcma/internal/utils"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// diagramsDir holds the Mermaid sources, relative to REPORT_PATH
+	diagramsDir = "diagrams"
+	// maxComponentNodes is where the component diagram switches from modules to packages
+	maxComponentNodes = 40
+	// maxSequenceRoutes caps the request flow diagrams
+	maxSequenceRoutes = 25
+	// sequenceDepth is how many calls below the handler a flow follows
+	sequenceDepth = 3
+
+	diagramsStart = "<!-- diagrams:start -->"
+	diagramsEnd   = "<!-- diagrams:end -->"
+)
+
+// Diagram is a Mermaid diagram written to diagrams/
+type Diagram struct {
+	Title string `json:"title"`
+	File  string `json:"file"` // relative to REPORT_PATH
+	Kind  string `json:"kind"` // component, architecture, erd or sequence
+	Code  string `json:"-"`
+}
+
+// analyzeDiagrams renders the component, architecture, ERD and request flow
+// diagrams from the other analysis results and writes diagrams.md
+func analyzeDiagrams(p *Project) error {
+	var diagrams []Diagram
+	add := func(kind, name, title, code string) {
+		diagrams = append(diagrams, Diagram{Title: title, File: path.Join(diagramsDir, name+".mmd"), Kind: kind, Code: code})
+	}
+	add("component", "components", "Components", componentMermaid(p))
+	add("architecture", "architecture_legacy", "Legacy architecture", legacyArchitectureMermaid(p))
+	add("architecture", "architecture_target", "Target architecture", targetArchitectureMermaid(p))
+	if p.Schema != nil && len(p.Schema.Tables) > 0 {
+		add("erd", "erd", "Database", erdMermaid(p.Schema))
+	}
+	taken := map[string]bool{}
+	for i, r := range p.Routes {
+		if i == maxSequenceRoutes {
+			break
+		}
+		name := uniqueName("sequence_"+strings.ToLower(mermaidID(r.Endpoint)), taken)
+		add("sequence", name, strings.Join(r.Methods, ", ")+" "+r.Path, sequenceMermaid(p, r))
+	}
+
+	p.Diagrams = diagrams
+	for _, d := range diagrams {
+		if err := utils.WriteReportFile(d.File, []byte(d.Code)); err != nil {
+			return err
+		}
+	}
+	if err := utils.WriteReportJSON("diagrams.json", diagrams); err != nil {
+		return err
+	}
+	return utils.WriteReportFile("diagrams.md", []byte(diagramsMarkdown(diagrams, len(p.Routes))))
+}
+
+// moduleStats counts the routes and tables of each module for diagram labels
+func moduleStats(p *Project) (routes map[string]int, tables map[string][]string) {
+	routes, tables = map[string]int{}, map[string][]string{}
+	for _, r := range p.Routes {
+		routes[r.Module]++
+	}
+	if p.Schema == nil {
+		return routes, tables
+	}
+	nameByPath := map[string]string{}
+	for _, m := range p.Modules {
+		nameByPath[m.Path] = m.Name
+	}
+	for _, q := range p.Schema.Queries {
+		if name, ok := nameByPath[q.File]; ok {
+			for _, t := range q.Tables {
+				tables[name] = appendUnique(tables[name], t)
+			}
+		}
+	}
+	return routes, tables
+}
+
+// statsLabel is "name<br/>2 routes, 1 table"
+func statsLabel(name string, routes, tables int) string {
+	var parts []string
+	if routes > 0 {
+		parts = append(parts, plural(routes, "route"))
+	}
+	if tables > 0 {
+		parts = append(parts, plural(tables, "table"))
+	}
+	if len(parts) == 0 {
+		return mermaidLabel(name)
+	}
+	return mermaidLabel(name) + "<br/>" + strings.Join(parts, ", ")
+}
+
+func plural(n int, noun string) string {
+	switch {
+	case n == 1:
+		return fmt.Sprintf("1 %s", noun)
+	case strings.HasSuffix(noun, "y"):
+		return fmt.Sprintf("%d %sies", n, strings.TrimSuffix(noun, "y"))
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// componentMermaid draws the import graph, with modules grouped by bounded
+// context. Large code bases are drawn per top-level package instead.
+func componentMermaid(p *Project) string {
+	var sb strings.Builder
+	sb.WriteString("flowchart LR\n")
+	if p.Graph == nil || len(p.Graph.Nodes) == 0 {
+		sb.WriteString("    empty[\"No Python modules\"]\n")
+		return sb.String()
+	}
+	routes, tables := moduleStats(p)
+
+	if len(p.Graph.Nodes) > maxComponentNodes {
+		pkgRoutes, pkgTables := map[string]int{}, map[string][]string{}
+		for _, n := range p.Graph.Nodes {
+			pkg, _, _ := strings.Cut(n.Module, ".")
+			pkgRoutes[pkg] += routes[n.Module]
+			for _, t := range tables[n.Module] {
+				pkgTables[pkg] = appendUnique(pkgTables[pkg], t)
+			}
+		}
+		for _, pkg := range sortedKeys(pkgRoutes) {
+			fmt.Fprintf(&sb, "    %s[\"%s\"]\n", mermaidID("m_"+pkg), statsLabel(pkg+"/", pkgRoutes[pkg], len(pkgTables[pkg])))
+		}
+		weights := map[[2]string]int{}
+		for _, e := range p.Graph.Edges {
+			from, _, _ := strings.Cut(e.From, ".")
+			to, _, _ := strings.Cut(e.To, ".")
+			if from != to {
+				weights[[2]string{from, to}]++
+			}
+		}
+		keys := make([][2]string, 0, len(weights))
+		for k := range weights {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i][0]+" "+keys[i][1] < keys[j][0]+" "+keys[j][1] })
+		for _, k := range keys {
+			fmt.Fprintf(&sb, "    %s -->|%d| %s\n", mermaidID("m_"+k[0]), weights[k], mermaidID("m_"+k[1]))
+		}
+		return sb.String()
+	}
+
+	node := func(indent, module string) {
+		fmt.Fprintf(&sb, "%s%s[\"%s\"]\n", indent, mermaidID("m_"+module), statsLabel(module, routes[module], len(tables[module])))
+	}
+	placed := map[string]bool{}
+	if p.Contexts != nil {
+		group := func(id, title string, modules []string) {
+			if len(modules) == 0 {
+				return
+			}
+			fmt.Fprintf(&sb, "    subgraph %s[\"%s\"]\n", mermaidID(id), mermaidLabel(title))
+			for _, m := range modules {
+				node("        ", m)
+				placed[m] = true
+			}
+			sb.WriteString("    end\n")
+		}
+		for _, c := range p.Contexts.Contexts {
+			group("ctx_"+c.Name, c.Name+" ("+c.Proposal+")", c.Modules)
+		}
+		group("ctx_entrypoints", "entrypoints", p.Contexts.Entrypoints)
+	}
+	for _, n := range p.Graph.Nodes {
+		if !placed[n.Module] {
+			node("    ", n.Module)
+		}
+	}
+	seen := map[[2]string]bool{}
+	for _, e := range p.Graph.Edges {
+		if key := [2]string{e.From, e.To}; !seen[key] {
+			seen[key] = true
+			fmt.Fprintf(&sb, "    %s --> %s\n", mermaidID("m_"+e.From), mermaidID("m_"+e.To))
+		}
+	}
+	return sb.String()
+}
+
+// contextFacts summarizes each bounded context for the architecture diagrams
+type contextFacts struct {
+	name, pkg, proposal string
+	modules, routes     int
+	tables              int
+	templates           bool
+}
+
+func architectureContexts(p *Project) []contextFacts {
+	routeCount, _ := moduleStats(p)
+	renders := map[string]bool{}
+	for _, r := range p.Routes {
+		if len(r.Templates) > 0 {
+			renders[r.Module] = true
+		}
+	}
+	var facts []contextFacts
+	if p.Contexts == nil || len(p.Contexts.Contexts) == 0 {
+		f := contextFacts{name: "app", pkg: "internal/app", proposal: "package", modules: len(p.Modules), routes: len(p.Routes)}
+		if p.Schema != nil {
+			f.tables = len(p.Schema.Tables)
+		}
+		for _, m := range p.Modules {
+			f.templates = f.templates || renders[m.Name]
+		}
+		return append(facts, f)
+	}
+	for _, c := range p.Contexts.Contexts {
+		f := contextFacts{name: c.Name, pkg: c.Package, proposal: c.Proposal, modules: len(c.Modules), tables: len(c.Tables) + len(c.SharedTables)}
+		for _, m := range c.Modules {
+			f.routes += routeCount[m]
+			f.templates = f.templates || renders[m]
+		}
+		facts = append(facts, f)
+	}
+	return facts
+}
+
+// legacyArchitectureMermaid draws the Flask application as it is today
+func legacyArchitectureMermaid(p *Project) string {
+	var sb strings.Builder
+	sb.WriteString("flowchart LR\n")
+	sb.WriteString("    user([\"Browser\"])\n")
+	fmt.Fprintf(&sb, "    subgraph legacy[\"%s\"]\n", mermaidLabel(stackLabel(config.LegacyTechStack, "Legacy application")))
+	fmt.Fprintf(&sb, "        flask[\"Flask app<br/>%s\"]\n", plural(len(p.Routes), "route"))
+	contexts := architectureContexts(p)
+	for _, c := range contexts {
+		fmt.Fprintf(&sb, "        %s[\"%s<br/>%s\"]\n", mermaidID("l_"+c.name), mermaidLabel(c.name), plural(c.modules, "module"))
+	}
+	if len(p.Templates) > 0 {
+		fmt.Fprintf(&sb, "        jinja[\"Jinja templates<br/>%d\"]\n", len(p.Templates))
+	}
+	sb.WriteString("    end\n")
+	tables := 0
+	if p.Schema != nil {
+		tables = len(p.Schema.Tables)
+	}
+	if tables > 0 {
+		fmt.Fprintf(&sb, "    db[(\"Database<br/>%s\")]\n", plural(tables, "table"))
+	}
+	sb.WriteString("    user --> flask\n")
+	for _, c := range contexts {
+		id := mermaidID("l_" + c.name)
+		fmt.Fprintf(&sb, "    flask --> %s\n", id)
+		if c.templates && len(p.Templates) > 0 {
+			fmt.Fprintf(&sb, "    %s --> jinja\n", id)
+		}
+		if c.tables > 0 && tables > 0 {
+			fmt.Fprintf(&sb, "    %s --> db\n", id)
+		}
+	}
+	return sb.String()
+}
+
+// targetArchitectureMermaid draws the Go application the migration produces:
+// chi router, one package per bounded context (services marked), Templ views
+// and the generated pgx data layer
+func targetArchitectureMermaid(p *Project) string {
+	var sb strings.Builder
+	sb.WriteString("flowchart LR\n")
+	sb.WriteString("    user([\"Browser + HTMX\"])\n")
+	fmt.Fprintf(&sb, "    subgraph target[\"%s\"]\n", mermaidLabel(stackLabel(config.ModernTechStack, "Go application")))
+	fmt.Fprintf(&sb, "        router[\"chi router<br/>%s\"]\n", plural(len(p.Routes), "route"))
+	contexts := architectureContexts(p)
+	for _, c := range contexts {
+		shape := "[\"%s<br/>%s\"]"
+		if c.proposal == "service" {
+			// Stadium shape for contexts that can become separate services
+			shape = "([\"%s<br/>%s\"])"
+		}
+		fmt.Fprintf(&sb, "        %s"+shape+"\n", mermaidID("t_"+c.name), mermaidLabel(c.pkg), c.proposal)
+	}
+	if len(p.Templates) > 0 {
+		fmt.Fprintf(&sb, "        templ[\"Templ views<br/>%s\"]\n", plural(len(p.Templates), "component"))
+	}
+	repos := 0
+	if p.DataLayer != nil {
+		repos = len(p.DataLayer.Repositories)
+	}
+	if repos > 0 {
+		fmt.Fprintf(&sb, "        dbpkg[\"db package<br/>%s, pgxpool\"]\n", plural(repos, "repository"))
+	}
+	sb.WriteString("    end\n")
+	if repos > 0 {
+		sb.WriteString("    pg[(\"PostgreSQL\")]\n")
+	}
+	sb.WriteString("    user --> router\n")
+	for _, c := range contexts {
+		id := mermaidID("t_" + c.name)
+		if c.routes > 0 || c.proposal != "shared" {
+			fmt.Fprintf(&sb, "    router --> %s\n", id)
+		}
+		if c.templates && len(p.Templates) > 0 {
+			fmt.Fprintf(&sb, "    %s --> templ\n", id)
+		}
+		if c.tables > 0 && repos > 0 {
+			fmt.Fprintf(&sb, "    %s --> dbpkg\n", id)
+		}
+	}
+	if p.Contexts != nil {
+		// Imports between contexts become calls through interfaces
+		for _, l := range p.Contexts.Links {
+			if l.Imports > 0 {
+				fmt.Fprintf(&sb, "    %s -.-> %s\n", mermaidID("t_"+l.From), mermaidID("t_"+l.To))
+			}
+		}
+	}
+	if repos > 0 {
+		sb.WriteString("    dbpkg --> pg\n")
+	}
+	return sb.String()
+}
+
+// stackLabel is the first line of a configured tech stack, or fallback
+func stackLabel(stack, fallback string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(stack), "\n")
+	line = strings.TrimSpace(line)
+	if line == "" || len(line) > 60 {
+		return fallback
+	}
+	return line
+}
+
+// sequenceMermaid draws a request to a route: the handler, the legacy
+// functions on the way to the database, the queries and the response
+func sequenceMermaid(p *Project, r Route) string {
+	var sb strings.Builder
+	sb.WriteString("sequenceDiagram\n")
+	sb.WriteString("    actor User\n")
+	sb.WriteString("    participant App as Flask\n")
+
+	g := p.callGraph()
+	handler := funcRef{Module: r.Module, Qualname: r.Handler}
+	queries := map[funcRef][]Query{}
+	if p.Schema != nil {
+		pathOf := map[string]string{}
+		for _, m := range p.Modules {
+			pathOf[m.Name] = m.Path
+		}
+		for _, q := range p.Schema.Queries {
+			for ref := range g.funcs {
+				if pathOf[ref.Module] == q.File && ref.Qualname == q.Function {
+					queries[ref] = append(queries[ref], q)
+				}
+			}
+		}
+	}
+
+	// Breadth-first from the handler, remembering who called whom, then keep
+	// only the functions that run queries and their callers
+	parent := map[funcRef]funcRef{}
+	order := []funcRef{handler}
+	seen := map[funcRef]bool{handler: true}
+	frontier := []funcRef{handler}
+	for d := 0; d < sequenceDepth && len(frontier) > 0; d++ {
+		var next []funcRef
+		for _, f := range frontier {
+			for _, c := range g.callees[f] {
+				if !seen[c] {
+					seen[c] = true
+					parent[c] = f
+					order = append(order, c)
+					next = append(next, c)
+				}
+			}
+		}
+		frontier = next
+	}
+	shown := map[funcRef]bool{handler: true}
+	for _, f := range order {
+		if len(queries[f]) == 0 {
+			continue
+		}
+		for cur := f; !shown[cur]; cur = parent[cur] {
+			shown[cur] = true
+		}
+	}
+
+	ids := map[funcRef]string{}
+	for i, f := range order {
+		if shown[f] {
+			ids[f] = fmt.Sprintf("F%d", i)
+			fmt.Fprintf(&sb, "    participant %s as %s\n", ids[f], sequenceText(f.Qualname+"()"))
+		}
+	}
+	hasQueries := false
+	for f := range shown {
+		hasQueries = hasQueries || len(queries[f]) > 0
+	}
+	if hasQueries {
+		sb.WriteString("    participant DB as Database\n")
+	}
+	if len(r.Templates) > 0 {
+		sb.WriteString("    participant Jinja\n")
+	}
+
+	fmt.Fprintf(&sb, "    User->>App: %s\n", sequenceText(strings.Join(r.Methods, "/")+" "+r.Path))
+	fmt.Fprintf(&sb, "    App->>%s: %s\n", ids[handler], sequenceText(r.Endpoint))
+	for _, f := range order {
+		if !shown[f] {
+			continue
+		}
+		if f != handler {
+			fmt.Fprintf(&sb, "    %s->>%s: call\n", ids[parent[f]], ids[f])
+		}
+		for _, q := range queries[f] {
+			fmt.Fprintf(&sb, "    %s->>DB: %s\n", ids[f], sequenceText(q.Operation+" "+strings.Join(q.Tables, ", ")))
+			if q.Operation == "SELECT" {
+				fmt.Fprintf(&sb, "    DB-->>%s: rows\n", ids[f])
+			}
+		}
+	}
+	for _, t := range r.Templates {
+		fmt.Fprintf(&sb, "    %s->>Jinja: %s\n", ids[handler], sequenceText("render "+t))
+	}
+	switch {
+	case len(r.Templates) > 0:
+		fmt.Fprintf(&sb, "    %s-->>User: HTML\n", ids[handler])
+	case len(r.Redirects) > 0:
+		fmt.Fprintf(&sb, "    %s-->>User: %s\n", ids[handler], sequenceText("redirect to "+strings.Join(r.Redirects, ", ")))
+	default:
+		fmt.Fprintf(&sb, "    %s-->>User: response\n", ids[handler])
+	}
+	return sb.String()
+}
+
+// sequenceText escapes the characters Mermaid treats specially in sequence text
+func sequenceText(s string) string {
+	return strings.NewReplacer("#", "#35;", ";", "#59;", "<", "#lt;", ">", "#gt;", "\n", " ").Replace(s)
+}
+
+func diagramsMarkdown(diagrams []Diagram, routes int) string {
+	var sb strings.Builder
+	sb.WriteString("# Architecture diagrams\n\n")
+	fmt.Fprintf(&sb, "Generated from the import graph, schema, routes and bounded contexts. The Mermaid sources are in `%s/` for rendering with mermaid-cli.\n", diagramsDir)
+	section := ""
+	titles := map[string]string{"component": "Components", "architecture": "Legacy and target architecture", "erd": "Database", "sequence": "Request flows"}
+	for _, d := range diagrams {
+		if d.Kind != section {
+			section = d.Kind
+			fmt.Fprintf(&sb, "\n## %s\n", titles[d.Kind])
+			if d.Kind == "sequence" && routes > maxSequenceRoutes {
+				fmt.Fprintf(&sb, "\nThe first %d of %d routes; the others follow the same pattern.\n", maxSequenceRoutes, routes)
+			}
+		}
+		if d.Kind == "architecture" || d.Kind == "sequence" {
+			fmt.Fprintf(&sb, "\n### %s\n", d.Title)
+		}
+		sb.WriteString("\n```mermaid\n" + d.Code + "```\n")
+	}
+	return sb.String()
+}
+
+// EmbedDiagrams adds diagrams.md to report.md, replacing the diagrams of a
+// previous run, so the report the LLM wrote carries the generated diagrams
+func EmbedDiagrams() error {
+	diagrams, err := os.ReadFile(filepath.Join(config.ReportPath, "diagrams.md"))
+	if err != nil {
+		return fmt.Errorf("failed to read diagrams: %w", err)
+	}
+	data, err := os.ReadFile(filepath.Join(config.ReportPath, "report.md"))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read report.md: %w", err)
+	}
+	report := string(data)
+	if start := strings.Index(report, diagramsStart); start >= 0 {
+		if end := strings.Index(report, diagramsEnd); end > start {
+			report = report[:start] + report[end+len(diagramsEnd):]
+		}
+	}
+	// One heading level down, below the report's own sections
+	var section strings.Builder
+	for _, line := range strings.Split(strings.TrimRight(string(diagrams), "\n"), "\n") {
+		if strings.HasPrefix(line, "#") {
+			line = "#" + line
+		}
+		section.WriteString(line + "\n")
+	}
+	report = strings.TrimRight(report, "\n") + "\n\n" + diagramsStart + "\n" + section.String() + diagramsEnd + "\n"
+	return utils.WriteReportFile("report.md", []byte(report))
+}
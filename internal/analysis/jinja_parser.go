@@ -0,0 +1,178 @@
+package analysis
+
+import (
+	"strings"
+)
+
+// Kinds of nodes in a parsed Jinja template
+const (
+	jinjaText = iota
+	jinjaOutput
+	jinjaTag
+	jinjaComment
+)
+
+// jinjaNode is a node of a Jinja template. Tags with a body ({% for %}, {% block %},
+// ...) hold it in Body; {% elif %}/{% else %} parts of if and for tags are Branches.
+type jinjaNode struct {
+	Kind     int
+	Tag      string // tag name for jinjaTag nodes
+	Expr     string // tag arguments, output expression, or text
+	Line     int
+	Body     []*jinjaNode
+	Branches []*jinjaBranch
+	Closed   bool // the matching end tag was found
+}
+
+// jinjaBranch is an elif or else part of an if or for tag
+type jinjaBranch struct {
+	Tag  string
+	Expr string
+	Line int
+	Body []*jinjaNode
+}
+
+// jinjaBlockTags are the tags closed by a matching end tag
+var jinjaBlockTags = map[string]bool{
+	"block": true, "for": true, "if": true, "macro": true, "call": true, "filter": true,
+	"with": true, "autoescape": true, "trans": true, "set": true,
+}
+
+// parseJinja parses a template into a node tree. Malformed templates are parsed on
+// a best-effort basis: unclosed tags extend to the end of the template.
+func parseJinja(src string) []*jinjaNode {
+	root := &jinjaNode{Kind: jinjaTag}
+	stack := []*jinjaNode{root}
+	// body returns where new nodes of the innermost open tag go
+	body := func() *[]*jinjaNode {
+		top := stack[len(stack)-1]
+		if n := len(top.Branches); n > 0 {
+			return &top.Branches[n-1].Body
+		}
+		return &top.Body
+	}
+
+	line := 1
+	for i := 0; i < len(src); {
+		open := nextJinjaDelim(src, i)
+		if open < 0 {
+			open = len(src)
+		}
+		if open > i {
+			*body() = append(*body(), &jinjaNode{Kind: jinjaText, Expr: src[i:open], Line: line})
+			line += strings.Count(src[i:open], "\n")
+		}
+		if open >= len(src) {
+			break
+		}
+
+		closer := map[byte]string{'{': "}}", '%': "%}", '#': "#}"}[src[open+1]]
+		end := strings.Index(src[open+2:], closer)
+		if end < 0 {
+			end = len(src) - open - 2
+		}
+		inner := src[open+2 : open+2+end]
+		next := open + 2 + end + len(closer)
+		if next > len(src) {
+			next = len(src)
+		}
+		tagLine := line
+		line += strings.Count(src[open:next], "\n")
+		inner = strings.TrimSpace(strings.Trim(inner, "-+"))
+
+		switch src[open+1] {
+		case '#':
+			*body() = append(*body(), &jinjaNode{Kind: jinjaComment, Expr: inner, Line: tagLine})
+		case '{':
+			*body() = append(*body(), &jinjaNode{Kind: jinjaOutput, Expr: inner, Line: tagLine})
+		case '%':
+			name, args := inner, ""
+			if k := strings.IndexAny(inner, " \t\r\n"); k >= 0 {
+				name, args = inner[:k], strings.TrimSpace(inner[k:])
+			}
+
+			switch {
+			case name == "raw":
+				// Everything up to endraw is text
+				rawEnd := indexJinjaTag(src, next, "endraw")
+				if rawEnd < 0 {
+					rawEnd = len(src)
+				}
+				*body() = append(*body(), &jinjaNode{Kind: jinjaText, Expr: src[next:rawEnd], Line: line})
+				line += strings.Count(src[next:rawEnd], "\n")
+				next = rawEnd
+				if e := strings.Index(src[rawEnd:], "%}"); e >= 0 {
+					line += strings.Count(src[rawEnd:rawEnd+e], "\n")
+					next = rawEnd + e + 2
+				}
+			case strings.HasPrefix(name, "end"):
+				// Close the innermost matching tag, and any unclosed tags inside it
+				tag := strings.TrimPrefix(name, "end")
+				for k := len(stack) - 1; k > 0; k-- {
+					if stack[k].Tag == tag {
+						stack[k].Closed = true
+						stack = stack[:k]
+						break
+					}
+				}
+			case name == "elif" || name == "else":
+				top := stack[len(stack)-1]
+				if top.Tag == "if" || top.Tag == "for" {
+					top.Branches = append(top.Branches, &jinjaBranch{Tag: name, Expr: args, Line: tagLine})
+				}
+			default:
+				node := &jinjaNode{Kind: jinjaTag, Tag: name, Expr: args, Line: tagLine}
+				*body() = append(*body(), node)
+				// {% set x = 1 %} is a statement, {% set x %}...{% endset %} a block
+				if jinjaBlockTags[name] && !(name == "set" && strings.Contains(args, "=")) {
+					stack = append(stack, node)
+				}
+			}
+		}
+		i = next
+	}
+	return root.Body
+}
+
+// nextJinjaDelim returns the index of the next "{{", "{%" or "{#" at or after i
+func nextJinjaDelim(src string, i int) int {
+	for {
+		k := strings.IndexByte(src[i:], '{')
+		if k < 0 || i+k+1 >= len(src) {
+			return -1
+		}
+		i += k
+		switch src[i+1] {
+		case '{', '%', '#':
+			return i
+		}
+		i++
+	}
+}
+
+// indexJinjaTag returns the index of the "{%" opening the given tag at or after i
+func indexJinjaTag(src string, i int, tag string) int {
+	for {
+		k := strings.Index(src[i:], "{%")
+		if k < 0 {
+			return -1
+		}
+		i += k
+		rest := strings.TrimLeft(src[i+2:], "-+ \t\r\n")
+		if strings.HasPrefix(rest, tag) {
+			return i
+		}
+		i += 2
+	}
+}
+
+// walkJinja calls fn for every node in depth-first order, including branch bodies
+func walkJinja(nodes []*jinjaNode, fn func(n *jinjaNode)) {
+	for _, n := range nodes {
+		fn(n)
+		walkJinja(n.Body, fn)
+		for _, b := range n.Branches {
+			walkJinja(b.Body, fn)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package analysis
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var mermaidUnsafe = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// mermaidID turns a name into an identifier Mermaid accepts
+func mermaidID(name string) string {
+	id := strings.Trim(mermaidUnsafe.ReplaceAllString(name, "_"), "_")
+	if id == "" || (id[0] >= '0' && id[0] <= '9') {
+		id = "n_" + id
+	}
+	return id
+}
+
+// mermaidLabel escapes text for a quoted Mermaid label
+func mermaidLabel(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "\n", " ").Replace(s)
+}
+
+// erdMermaid renders the schema as a Mermaid erDiagram
+func erdMermaid(s *Schema) string {
+	var sb strings.Builder
+	sb.WriteString("erDiagram\n")
+	for _, t := range s.Tables {
+		fmt.Fprintf(&sb, "    %s {\n", mermaidID(t.Name))
+		for _, c := range t.Columns {
+			typ := c.Type
+			if i := strings.IndexAny(typ, "(["); i >= 0 {
+				typ = typ[:i]
+			}
+			if typ == "" {
+				typ = "unknown"
+			}
+			var keys []string
+			if c.PrimaryKey {
+				keys = append(keys, "PK")
+			}
+			if c.References != "" {
+				keys = append(keys, "FK")
+			}
+			if c.Unique && !c.PrimaryKey {
+				keys = append(keys, "UK")
+			}
+			fmt.Fprintf(&sb, "        %s %s %s\n", mermaidID(typ), mermaidID(c.Name), strings.Join(keys, ","))
+		}
+		sb.WriteString("    }\n")
+	}
+	for _, r := range s.Relationships {
+		// Declared foreign keys are identifying lines, joins seen in queries are dotted
+		line := "||--o{"
+		if r.Kind == RelationshipJoin {
+			line = "||..o{"
+		}
+		fmt.Fprintf(&sb, "    %s %s %s : \"%s\"\n", mermaidID(r.To), line, mermaidID(r.From), mermaidLabel(strings.Join(r.FromColumns, ", ")))
+	}
+	return sb.String()
+}
@@ -0,0 +1,228 @@
+package analysis
+
+import (
+	"fmt"
+	"lcma/internal/utils"
+	"math"
+	"sort"
+	"strings"
+)
+
+// FunctionMetrics are the size and complexity numbers of a function or method
+type FunctionMetrics struct {
+	Module     string `json:"module"`
+	Function   string `json:"function"`
+	File       string `json:"file"`
+	Line       int    `json:"line"`
+	Length     int    `json:"length"`     // lines
+	Complexity int    `json:"complexity"` // McCabe cyclomatic complexity
+	Nesting    int    `json:"nesting"`    // deepest block nesting inside the body
+	FanIn      int    `json:"fan_in"`     // legacy functions calling it
+	FanOut     int    `json:"fan_out"`    // legacy functions it calls
+}
+
+// ModuleMetrics aggregates a module's functions with its imports and git churn
+type ModuleMetrics struct {
+	Module        string  `json:"module"`
+	File          string  `json:"file"`
+	Lines         int     `json:"lines"`
+	Functions     int     `json:"functions"`
+	Complexity    int     `json:"complexity"` // sum over functions
+	MaxComplexity int     `json:"max_complexity"`
+	MaxNesting    int     `json:"max_nesting"`
+	FanIn         int     `json:"fan_in"` // legacy modules importing it
+	FanOut        int     `json:"fan_out"`
+	Commits       int     `json:"commits,omitempty"`
+	LinesChanged  int     `json:"lines_changed,omitempty"`
+	Authors       int     `json:"authors,omitempty"`
+	Hotspot       float64 `json:"hotspot"` // 0..1, complexity weighted by churn
+}
+
+// HeatCell is a module sized by lines and colored by hotspot score, ready for a treemap
+type HeatCell struct {
+	Path  string  `json:"path"`
+	Size  int     `json:"size"`
+	Value float64 `json:"value"`
+}
+
+// Metrics is the layout of metrics.json
+type Metrics struct {
+	// Churn is set when the hotspot score includes git history
+	Churn     bool              `json:"churn"`
+	Functions []FunctionMetrics `json:"functions"`
+	Modules   []ModuleMetrics   `json:"modules"`
+	Heatmap   []HeatCell        `json:"heatmap"`
+}
+
+// Complexity thresholds used to flag functions in the report
+const (
+	complexityHigh     = 10
+	complexityVeryHigh = 20
+)
+
+// decisionKeywords add a path through a function: branches, loops, handlers,
+// boolean operators and comprehension clauses
+var decisionKeywords = map[string]bool{"if": true, "elif": true, "for": true, "while": true, "except": true, "and": true, "or": true}
+
+// analyzeMetrics computes complexity and coupling per function and module and
+// ranks modules as hotspots, using git churn when the legacy code has history
+func analyzeMetrics(p *Project) error {
+	churn, hasChurn, err := utils.CorpusChurn(p.Corpus)
+	if err != nil {
+		fmt.Println("Warning: churn not available:", err)
+	}
+	metrics := &Metrics{Churn: hasChurn}
+	g := p.callGraph()
+
+	fanIn, fanOut := map[string]int{}, map[string]int{}
+	if p.Graph != nil {
+		for _, n := range p.Graph.Nodes {
+			fanIn[n.Module], fanOut[n.Module] = n.FanIn, n.FanOut
+		}
+	}
+
+	for _, m := range p.Modules {
+		f := p.py[m.Path]
+		mm := ModuleMetrics{Module: m.Name, File: m.Path, Lines: m.Lines, FanIn: fanIn[m.Name], FanOut: fanOut[m.Name]}
+		fns := append([]PyFunction{}, m.Functions...)
+		for _, c := range m.Classes {
+			fns = append(fns, c.Methods...)
+		}
+		for _, fn := range fns {
+			ref := funcRef{Module: m.Name, Qualname: fn.Qualname}
+			fm := FunctionMetrics{
+				Module: m.Name, Function: fn.Qualname, File: m.Path, Line: fn.Line,
+				Length:     fn.EndLine - fn.Line + 1,
+				Complexity: cyclomaticComplexity(f, fn),
+				Nesting:    nestingDepth(fn.body),
+				FanIn:      len(g.callers[ref]),
+				FanOut:     len(g.callees[ref]),
+			}
+			metrics.Functions = append(metrics.Functions, fm)
+			mm.Functions++
+			mm.Complexity += fm.Complexity
+			mm.MaxComplexity = max(mm.MaxComplexity, fm.Complexity)
+			mm.MaxNesting = max(mm.MaxNesting, fm.Nesting)
+		}
+		if c, ok := churn[m.Path]; ok {
+			mm.Commits, mm.LinesChanged, mm.Authors = c.Commits, c.LinesChanged, c.Authors
+		}
+		metrics.Modules = append(metrics.Modules, mm)
+	}
+	scoreHotspots(metrics.Modules, hasChurn)
+
+	sort.SliceStable(metrics.Functions, func(i, j int) bool {
+		return metrics.Functions[i].Complexity > metrics.Functions[j].Complexity
+	})
+	sort.SliceStable(metrics.Modules, func(i, j int) bool {
+		return metrics.Modules[i].Hotspot > metrics.Modules[j].Hotspot
+	})
+	for _, mm := range metrics.Modules {
+		metrics.Heatmap = append(metrics.Heatmap, HeatCell{Path: mm.File, Size: mm.Lines, Value: mm.Hotspot})
+	}
+	sort.Slice(metrics.Heatmap, func(i, j int) bool { return metrics.Heatmap[i].Path < metrics.Heatmap[j].Path })
+	p.Metrics = metrics
+
+	if err := utils.WriteReportJSON("metrics.json", metrics); err != nil {
+		return err
+	}
+	return utils.WriteReportFile("metrics.md", []byte(metricsMarkdown(metrics)))
+}
+
+// cyclomaticComplexity is 1 plus the decision points in the function's tokens
+func cyclomaticComplexity(f *pyFile, fn PyFunction) int {
+	complexity := 1
+	for _, t := range f.Tokens {
+		if t.Line > fn.Line && t.Line <= fn.EndLine && t.Kind == tokName && decisionKeywords[t.Value] {
+			complexity++
+		}
+	}
+	return complexity
+}
+
+// nestingDepth returns how deep blocks nest below stmts
+func nestingDepth(stmts []*pyStmt) int {
+	depth := 0
+	for _, st := range stmts {
+		if len(st.Body) > 0 {
+			depth = max(depth, 1+nestingDepth(st.Body))
+		}
+	}
+	return depth
+}
+
+// scoreHotspots scores each module in [0,1] as its share of the largest total
+// complexity, multiplied by its share of the most commits when churn is known:
+// complex code that changes often is where migration bugs hide
+func scoreHotspots(modules []ModuleMetrics, withChurn bool) {
+	maxComplexity, maxCommits := 0, 0
+	for _, m := range modules {
+		maxComplexity = max(maxComplexity, m.Complexity)
+		maxCommits = max(maxCommits, m.Commits)
+	}
+	for i := range modules {
+		if maxComplexity == 0 {
+			continue
+		}
+		score := float64(modules[i].Complexity) / float64(maxComplexity)
+		if withChurn && maxCommits > 0 {
+			score *= float64(modules[i].Commits) / float64(maxCommits)
+		}
+		modules[i].Hotspot = math.Round(score*100) / 100
+	}
+}
+
+// metricsMarkdown renders the hotspot and complexity tables
+func metricsMarkdown(metrics *Metrics) string {
+	var sb strings.Builder
+	sb.WriteString("# Complexity and hotspots\n\n")
+	high := 0
+	for _, f := range metrics.Functions {
+		if f.Complexity > complexityHigh {
+			high++
+		}
+	}
+	basis := "total cyclomatic complexity only; the legacy code has no git history"
+	if metrics.Churn {
+		basis = "total cyclomatic complexity multiplied by git commit count, both relative to the maximum"
+	}
+	fmt.Fprintf(&sb, "%d modules, %d functions, %d functions above complexity %d. Hotspot score: %s.\n",
+		len(metrics.Modules), len(metrics.Functions), high, complexityHigh, basis)
+
+	if len(metrics.Modules) > 0 {
+		sb.WriteString("\n## Hotspots\n\n| Module | Lines | Functions | Complexity | Max | Nesting | Fan-in | Fan-out | Commits | Lines changed | Hotspot |\n|---|---|---|---|---|---|---|---|---|---|---|\n")
+		for i, m := range metrics.Modules {
+			if i == 20 {
+				fmt.Fprintf(&sb, "\n%d more modules in metrics.json.\n", len(metrics.Modules)-i)
+				break
+			}
+			fmt.Fprintf(&sb, "| %s | %d | %d | %d | %d | %d | %d | %d | %d | %d | %.2f |\n",
+				m.Module, m.Lines, m.Functions, m.Complexity, m.MaxComplexity, m.MaxNesting, m.FanIn, m.FanOut, m.Commits, m.LinesChanged, m.Hotspot)
+		}
+	}
+
+	if len(metrics.Functions) > 0 {
+		sb.WriteString("\n## Most complex functions\n\n| Function | Location | Complexity | Nesting | Length | Fan-in | Fan-out | Rating |\n|---|---|---|---|---|---|---|---|\n")
+		for i, f := range metrics.Functions {
+			if i == 20 {
+				fmt.Fprintf(&sb, "\n%d more functions in metrics.json.\n", len(metrics.Functions)-i)
+				break
+			}
+			fmt.Fprintf(&sb, "| %s.%s | %s:%d | %d | %d | %d | %d | %d | %s |\n",
+				f.Module, f.Function, f.File, f.Line, f.Complexity, f.Nesting, f.Length, f.FanIn, f.FanOut, complexityRating(f.Complexity))
+		}
+	}
+	return sb.String()
+}
+
+func complexityRating(complexity int) string {
+	switch {
+	case complexity > complexityVeryHigh:
+		return "very high"
+	case complexity > complexityHigh:
+		return "high"
+	case complexity > 5:
+		return "moderate"
+	}
+	return "low"
+}
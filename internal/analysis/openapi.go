@@ -0,0 +1,746 @@
+package analysis
+
+import (
+	"fmt"
+	"lcma/internal/utils"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OpenAPI 3.1 document types, limited to what the legacy routes can fill
+
+type openAPIDoc struct {
+	OpenAPI string                       `json:"openapi"`
+	Info    openAPIInfo                  `json:"info"`
+	Paths   map[string]map[string]*apiOp `json:"paths"`
+	Tags    []openAPITag                 `json:"tags,omitempty"`
+}
+
+type openAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description"`
+}
+
+type openAPITag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+type apiOp struct {
+	OperationID string                  `json:"operationId"`
+	Summary     string                  `json:"summary"`
+	Tags        []string                `json:"tags,omitempty"`
+	Parameters  []apiParam              `json:"parameters,omitempty"`
+	RequestBody *apiBody                `json:"requestBody,omitempty"`
+	Responses   map[string]*apiResponse `json:"responses"`
+	// Legacy is the Flask handler the operation comes from, as file:line
+	Legacy string `json:"x-legacy-handler"`
+}
+
+type apiParam struct {
+	Name     string   `json:"name"`
+	In       string   `json:"in"` // path, query, header or cookie
+	Required bool     `json:"required"`
+	Schema   *jsonSch `json:"schema"`
+}
+
+type apiBody struct {
+	Required bool                    `json:"required"`
+	Content  map[string]apiMediaType `json:"content"`
+}
+
+type apiMediaType struct {
+	Schema *jsonSch `json:"schema"`
+}
+
+type apiResponse struct {
+	Description string                  `json:"description"`
+	Headers     map[string]apiHeader    `json:"headers,omitempty"`
+	Content     map[string]apiMediaType `json:"content,omitempty"`
+}
+
+type apiHeader struct {
+	Schema *jsonSch `json:"schema"`
+}
+
+// jsonSch is a JSON Schema (2020-12, as used by OpenAPI 3.1)
+type jsonSch struct {
+	Type       string              `json:"type,omitempty"`
+	Format     string              `json:"format,omitempty"`
+	Items      *jsonSch            `json:"items,omitempty"`
+	Properties map[string]*jsonSch `json:"properties,omitempty"`
+	Required   []string            `json:"required,omitempty"`
+}
+
+// requestField is a value a handler reads from the request
+type requestField struct {
+	Name     string
+	Source   string // form, query, json, files, header or cookie
+	Type     string // JSON Schema type
+	Required bool   // read with [] so a missing value fails the request
+	Array    bool   // read with getlist
+}
+
+// requestSources maps request attributes to where the value comes from
+var requestSources = map[string]string{
+	"form": "form", "args": "query", "values": "query", "json": "json", "get_json": "json",
+	"files": "files", "headers": "header", "cookies": "cookie",
+}
+
+// pythonTypes maps conversions such as int(...) or type=int to JSON Schema types
+var pythonTypes = map[string]string{"int": "integer", "float": "number", "bool": "boolean", "str": "string"}
+
+// urlConverterSchemas maps Flask URL converters to schemas
+var urlConverterSchemas = map[string]jsonSch{
+	"int": {Type: "integer"}, "float": {Type: "number"}, "uuid": {Type: "string", Format: "uuid"},
+}
+
+// analyzeOpenAPI describes the legacy HTTP surface as an OpenAPI 3.1 document,
+// the contract the Chi handlers must meet
+func analyzeOpenAPI(p *Project) error {
+	doc := buildOpenAPI(p)
+	if err := utils.WriteReportJSON("openapi.json", doc); err != nil {
+		return err
+	}
+	return utils.WriteReportFile("openapi.md", []byte(openAPIMarkdown(doc)))
+}
+
+func buildOpenAPI(p *Project) *openAPIDoc {
+	title := "Legacy application"
+	if p.Corpus != nil && p.Corpus.Source != "" {
+		title = path.Base(strings.TrimSuffix(p.Corpus.Source, "/"))
+	}
+	doc := &openAPIDoc{
+		OpenAPI: "3.1.0",
+		Info: openAPIInfo{Title: title + " HTTP API", Version: "legacy",
+			Description: "Generated from the Flask routes, request parsing and responses of the legacy code. It is the contract the Go handlers must meet."},
+		Paths: map[string]map[string]*apiOp{},
+	}
+	g := p.callGraph()
+	tags := map[string]bool{}
+	ids := map[string]int{}
+	for _, r := range p.Routes {
+		ref := funcRef{Module: r.Module, Qualname: r.Handler}
+		var fields []requestField
+		info := g.funcs[ref]
+		if info != nil {
+			for _, f := range g.reachable(ref, 1) {
+				if fi := g.funcs[f]; fi != nil {
+					fields = mergeFields(fields, requestFields(p.py[fi.Module.Path], fi.Fn))
+				}
+			}
+		}
+
+		specPath := urlParamPattern.ReplaceAllString(r.Path, "{$2}")
+		if doc.Paths[specPath] == nil {
+			doc.Paths[specPath] = map[string]*apiOp{}
+		}
+		tag := r.Blueprint
+		if tag == "" {
+			tag = r.Module
+		}
+		tags[tag] = true
+		for _, method := range r.Methods {
+			if method == "HEAD" || method == "OPTIONS" {
+				continue
+			}
+			op := &apiOp{
+				OperationID: operationID(r, method, len(r.Methods) > 1, ids),
+				Summary:     handlerSummary(g, ref, r),
+				Tags:        []string{tag},
+				Responses:   map[string]*apiResponse{},
+				Legacy:      fmt.Sprintf("%s:%d", r.File, r.Line),
+			}
+			for _, prm := range r.Params {
+				schema := jsonSch{Type: "string"}
+				if s, ok := urlConverterSchemas[prm.Converter]; ok {
+					schema = s
+				}
+				op.Parameters = append(op.Parameters, apiParam{Name: prm.Name, In: "path", Required: true, Schema: &schema})
+			}
+			body := method != "GET" && method != "DELETE"
+			for _, f := range fields {
+				if in := f.Source; in == "query" || in == "header" || in == "cookie" {
+					op.Parameters = append(op.Parameters, apiParam{Name: f.Name, In: in, Required: f.Required, Schema: fieldSchema(f)})
+				}
+			}
+			if body {
+				op.RequestBody = requestBody(fields)
+			}
+			if info != nil {
+				op.Responses = handlerResponses(p.py[info.Module.Path], info.Fn, method)
+			} else {
+				op.Responses["200"] = &apiResponse{Description: "Response of " + r.Handler}
+			}
+			if hasRequired(fields, body) {
+				op.Responses["400"] = &apiResponse{Description: "Bad Request: a required field is missing or invalid"}
+			}
+			doc.Paths[specPath][strings.ToLower(method)] = op
+		}
+	}
+	for _, t := range sortedKeys(tags) {
+		doc.Tags = append(doc.Tags, openAPITag{Name: t})
+	}
+	return doc
+}
+
+// requestFields scans a function for reads of request.form, args, json, files,
+// headers and cookies, directly or through a variable holding one of them
+func requestFields(f *pyFile, fn *PyFunction) []requestField {
+	if f == nil {
+		return nil
+	}
+	var toks []pyToken
+	for _, t := range f.Tokens {
+		if t.Line >= fn.Line && t.Line <= fn.EndLine && t.Kind != tokNewline && t.Kind != tokIndent && t.Kind != tokDedent {
+			toks = append(toks, t)
+		}
+	}
+	aliases := map[string]string{}
+	var fields []requestField
+	for i := 0; i < len(toks); i++ {
+		source, next := requestSourceAt(toks, i, aliases)
+		if source == "" {
+			continue
+		}
+		// data = request.get_json() makes data an alias of the JSON body
+		if i >= 2 && toks[i-1].Value == "=" && toks[i-2].Kind == tokName && !isAccess(toks, next) {
+			aliases[toks[i-2].Value] = source
+			if source == "json" {
+				fields = append(fields, requestField{Source: "json"})
+			}
+			continue
+		}
+		field, ok := fieldAccess(toks, next, source)
+		if !ok {
+			if source == "json" {
+				fields = append(fields, requestField{Source: "json"})
+			}
+			continue
+		}
+		// int(request.form["age"]) gives the field a type
+		if field.Type == "" && i >= 2 && toks[i-1].Value == "(" {
+			field.Type = pythonTypes[toks[i-2].Value]
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// requestSourceAt returns the source read at toks[i] (request.form, request.get_json()
+// or an alias) and the index after it
+func requestSourceAt(toks []pyToken, i int, aliases map[string]string) (string, int) {
+	t := toks[i]
+	if t.Kind != tokName || (i > 0 && toks[i-1].Value == ".") {
+		return "", i
+	}
+	if source, ok := aliases[t.Value]; ok {
+		return source, i + 1
+	}
+	if t.Value != "request" || i+2 >= len(toks) || toks[i+1].Value != "." {
+		return "", i
+	}
+	source, ok := requestSources[toks[i+2].Value]
+	if !ok {
+		return "", i
+	}
+	next := i + 3
+	if toks[i+2].Value == "get_json" && next < len(toks) && toks[next].Value == "(" {
+		next = closingParen(toks, next) + 1
+	}
+	return source, next
+}
+
+// isAccess reports whether toks[i] starts ["x"], .get(...) or .getlist(...)
+func isAccess(toks []pyToken, i int) bool {
+	if i >= len(toks) {
+		return false
+	}
+	return toks[i].Value == "[" || (toks[i].Value == "." && i+1 < len(toks) && (toks[i+1].Value == "get" || toks[i+1].Value == "getlist"))
+}
+
+// fieldAccess reads ["name"], .get("name", default, type=int) or .getlist("name") at toks[i]
+func fieldAccess(toks []pyToken, i int, source string) (requestField, bool) {
+	if !isAccess(toks, i) {
+		return requestField{}, false
+	}
+	field := requestField{Source: source}
+	if toks[i].Value == "[" {
+		if i+2 >= len(toks) || toks[i+2].Value != "]" {
+			return requestField{}, false
+		}
+		name, ok := literalString(toks[i+1].Value)
+		field.Name, field.Required = name, true
+		return field, ok && name != ""
+	}
+	if i+3 >= len(toks) || toks[i+2].Value != "(" {
+		return requestField{}, false
+	}
+	name, ok := literalString(toks[i+3].Value)
+	if !ok || name == "" {
+		return requestField{}, false
+	}
+	field.Name, field.Array = name, toks[i+1].Value == "getlist"
+	end := closingParen(toks, i+2)
+	for j := i + 4; j+2 < end; j++ {
+		if toks[j].Value == "type" && toks[j+1].Value == "=" {
+			field.Type = pythonTypes[toks[j+2].Value]
+		}
+	}
+	return field, true
+}
+
+// closingParen returns the index of the bracket closing the one at open
+func closingParen(toks []pyToken, open int) int {
+	depth := 0
+	for j := open; j < len(toks); j++ {
+		switch toks[j].Value {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+			if depth == 0 {
+				return j
+			}
+		}
+	}
+	return len(toks) - 1
+}
+
+// mergeFields adds fields not read before; a field read both ways is required
+// and keeps the first known type
+func mergeFields(fields, more []requestField) []requestField {
+	for _, f := range more {
+		merged := false
+		for i := range fields {
+			if fields[i].Name == f.Name && fields[i].Source == f.Source {
+				fields[i].Required = fields[i].Required || f.Required
+				fields[i].Array = fields[i].Array || f.Array
+				if fields[i].Type == "" {
+					fields[i].Type = f.Type
+				}
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+func fieldSchema(f requestField) *jsonSch {
+	s := &jsonSch{Type: f.Type}
+	if s.Type == "" && f.Source != "json" {
+		s.Type = "string" // form, query and header values arrive as text; JSON values keep any type
+	}
+	if f.Source == "files" {
+		s = &jsonSch{Type: "string", Format: "binary"}
+	}
+	if f.Array {
+		return &jsonSch{Type: "array", Items: s}
+	}
+	return s
+}
+
+// requestBody builds the form, multipart and JSON bodies from the fields read
+func requestBody(fields []requestField) *apiBody {
+	bodies := map[string]*jsonSch{}
+	required := false
+	for _, f := range fields {
+		var media string
+		switch f.Source {
+		case "form":
+			media = "application/x-www-form-urlencoded"
+		case "files":
+			media = "multipart/form-data"
+		case "json":
+			media = "application/json"
+		default:
+			continue
+		}
+		if bodies[media] == nil {
+			bodies[media] = &jsonSch{Type: "object", Properties: map[string]*jsonSch{}}
+		}
+		if f.Name == "" {
+			continue // the body is read as a whole
+		}
+		bodies[media].Properties[f.Name] = fieldSchema(f)
+		if f.Required {
+			bodies[media].Required = appendUnique(bodies[media].Required, f.Name)
+			required = true
+		}
+	}
+	// Files and form fields travel together in a multipart body
+	if files, ok := bodies["multipart/form-data"]; ok {
+		if form, ok := bodies["application/x-www-form-urlencoded"]; ok {
+			for name, s := range form.Properties {
+				files.Properties[name] = s
+			}
+			files.Required = append(files.Required, form.Required...)
+			delete(bodies, "application/x-www-form-urlencoded")
+		}
+	}
+	if len(bodies) == 0 {
+		return nil
+	}
+	body := &apiBody{Required: required, Content: map[string]apiMediaType{}}
+	for media, s := range bodies {
+		sort.Strings(s.Required)
+		body.Content[media] = apiMediaType{Schema: s}
+	}
+	return body
+}
+
+func hasRequired(fields []requestField, body bool) bool {
+	for _, f := range fields {
+		if f.Required && (body || (f.Source != "form" && f.Source != "json" && f.Source != "files")) {
+			return true
+		}
+	}
+	return false
+}
+
+// handlerResponses derives the responses of one HTTP method from the handler's
+// return statements and abort calls. Branches on request.method that the method
+// cannot take are skipped.
+func handlerResponses(f *pyFile, fn *PyFunction, method string) map[string]*apiResponse {
+	responses := map[string]*apiResponse{}
+	if f == nil {
+		return responses
+	}
+	w := &responseWalk{src: f.Src, method: method, responses: responses}
+	w.block(fn.body)
+	if len(responses) == 0 {
+		responses["200"] = &apiResponse{Description: "OK"}
+	}
+	return responses
+}
+
+// responseWalk collects the responses along the paths one HTTP method can take
+type responseWalk struct {
+	src       string
+	method    string
+	responses map[string]*apiResponse
+}
+
+// block walks statements in order and reports whether the block always ends
+// in a return, raise or abort for the method
+func (w *responseWalk) block(stmts []*pyStmt) bool {
+	for i := 0; i < len(stmts); i++ {
+		st := stmts[i]
+		switch st.keyword() {
+		case "def", "class", "@":
+			// Nested definitions run later, if at all
+		case "if":
+			// Gather the elif and else clauses of the chain
+			chain := []*pyStmt{st}
+			for i+1 < len(stmts) && (stmts[i+1].keyword() == "elif" || stmts[i+1].keyword() == "else") {
+				i++
+				chain = append(chain, stmts[i])
+				if stmts[i].keyword() == "else" {
+					break
+				}
+			}
+			if w.ifChain(chain) {
+				return true
+			}
+		case "with":
+			if w.clause(st) {
+				return true
+			}
+		case "for", "while", "try", "else", "except", "finally", "elif":
+			w.clause(st)
+		default:
+			if w.simple(st.Tokens) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ifChain walks the clauses the method may take. It returns true when the
+// clause the method certainly takes always ends the handler.
+func (w *responseWalk) ifChain(chain []*pyStmt) bool {
+	for _, st := range chain {
+		taken, known := true, true
+		if st.keyword() != "else" {
+			taken, known = requestMethodTest(st.Tokens, w.method)
+		}
+		switch {
+		case !known:
+			w.clause(st)
+		case taken:
+			return w.clause(st)
+		}
+	}
+	return false
+}
+
+// clause walks the body of a compound statement, including a one-line body after the colon
+func (w *responseWalk) clause(st *pyStmt) bool {
+	if len(st.Body) == 0 {
+		if colon := lastTopLevelColon(st.Tokens); colon >= 0 && colon+1 < len(st.Tokens) {
+			return w.simple(st.Tokens[colon+1:])
+		}
+		return false
+	}
+	return w.block(st.Body)
+}
+
+// simple records the response of a return or abort statement and reports
+// whether the statement ends the handler
+func (w *responseWalk) simple(toks []pyToken) bool {
+	if len(toks) == 0 {
+		return false
+	}
+	switch toks[0].Value {
+	case "return":
+		code, resp := returnResponse(toks[1:])
+		if w.responses[code] == nil {
+			w.responses[code] = resp
+		}
+		return true
+	case "raise":
+		return true
+	}
+	for _, c := range collectCalls(w.src, []*pyStmt{{Tokens: toks}}) {
+		if lastSegment(c.Name) != "abort" || len(c.Args) == 0 {
+			continue
+		}
+		if n, err := strconv.Atoi(c.Args[0].Value); err == nil {
+			if w.responses[c.Args[0].Value] == nil {
+				w.responses[c.Args[0].Value] = &apiResponse{Description: http.StatusText(n)}
+			}
+			// A statement that is the abort call itself ends the handler
+			return joinValues(toks[:min(len(toks), 2*strings.Count(c.Name, ".")+1)]) == c.Name
+		}
+	}
+	return false
+}
+
+// requestMethodTest evaluates an if or elif condition such as
+// request.method == "POST" or request.method in ("PUT", "PATCH") for method.
+// known is false for any other condition.
+func requestMethodTest(toks []pyToken, method string) (taken, known bool) {
+	cond := toks[1:]
+	if colon := lastTopLevelColon(cond); colon >= 0 {
+		cond = cond[:colon]
+	}
+	if len(cond) < 5 || joinValues(cond[:3]) != "request.method" {
+		return false, false
+	}
+	op, rest := cond[3].Value, cond[4:]
+	if op == "not" && len(rest) > 0 && rest[0].Value == "in" {
+		op, rest = "not in", rest[1:]
+	}
+	var methods []string
+	switch op {
+	case "==", "!=":
+		if len(rest) != 1 {
+			return false, false
+		}
+		m, ok := literalString(rest[0].Value)
+		if !ok {
+			return false, false
+		}
+		methods = []string{m}
+	case "in", "not in":
+		for _, t := range rest {
+			switch {
+			case t.Kind == tokString:
+				m, _ := literalString(t.Value)
+				methods = append(methods, m)
+			case t.Value != "(" && t.Value != ")" && t.Value != "[" && t.Value != "]" && t.Value != "{" && t.Value != "}" && t.Value != ",":
+				return false, false
+			}
+		}
+	default:
+		return false, false
+	}
+	match := false
+	for _, m := range methods {
+		if strings.EqualFold(m, method) {
+			match = true
+		}
+	}
+	return match != (op == "!=" || op == "not in"), true
+}
+
+// returnResponse classifies the expression of a return statement
+func returnResponse(expr []pyToken) (string, *apiResponse) {
+	code := ""
+	depth := 0
+	for j, t := range expr {
+		switch t.Value {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+		case ",":
+			if depth == 0 && j+1 < len(expr) && expr[j+1].Kind == tokNumber {
+				code = expr[j+1].Value
+			}
+		}
+	}
+	html := map[string]apiMediaType{"text/html": {Schema: &jsonSch{Type: "string"}}}
+	json := map[string]apiMediaType{"application/json": {Schema: &jsonSch{}}}
+	resp := &apiResponse{Description: "OK"}
+	switch {
+	case len(expr) == 0:
+		resp.Description = "Empty response"
+	case expr[0].Value == "render_template" || expr[0].Value == "render_template_string":
+		resp.Content = html
+		if len(expr) > 2 {
+			if name, ok := literalString(expr[2].Value); ok {
+				resp.Description = "HTML page rendered from " + name
+			}
+		}
+	case expr[0].Value == "jsonify" || expr[0].Value == "{":
+		resp.Content, resp.Description = json, "JSON response"
+		if keys := dictKeys(expr); len(keys) > 0 {
+			schema := &jsonSch{Type: "object", Properties: map[string]*jsonSch{}}
+			for _, k := range keys {
+				schema.Properties[k] = &jsonSch{}
+			}
+			resp.Content = map[string]apiMediaType{"application/json": {Schema: schema}}
+		}
+	case expr[0].Value == "redirect":
+		if code == "" {
+			code = "302"
+			for j := 0; j+2 < len(expr); j++ {
+				if expr[j].Value == "code" && expr[j+1].Value == "=" && expr[j+2].Kind == tokNumber {
+					code = expr[j+2].Value
+				}
+			}
+		}
+		resp.Description = "Redirect"
+		resp.Headers = map[string]apiHeader{"Location": {Schema: &jsonSch{Type: "string"}}}
+	case expr[0].Kind == tokString:
+		resp.Content, resp.Description = html, "Text response"
+	}
+	if code == "" {
+		code = "200"
+	}
+	if code == "204" || code == "304" {
+		// These statuses never carry a body, whatever the handler returns with them
+		resp.Content = nil
+		resp.Description = "OK"
+	}
+	if n, err := strconv.Atoi(code); err == nil && resp.Description == "OK" {
+		resp.Description = http.StatusText(n)
+	}
+	return code, resp
+}
+
+// dictKeys returns the string keys of the first dict literal in expr
+func dictKeys(expr []pyToken) []string {
+	var keys []string
+	for j, t := range expr {
+		if t.Value != "{" {
+			continue
+		}
+		end := closingParen(expr, j)
+		for k, depth := j+1, 0; k < end; k++ {
+			switch expr[k].Value {
+			case "(", "[", "{":
+				depth++
+			case ")", "]", "}":
+				depth--
+			}
+			if depth == 0 && expr[k].Kind == tokString && k+1 < end && expr[k+1].Value == ":" {
+				if key, ok := literalString(expr[k].Value); ok {
+					keys = append(keys, key)
+				}
+			}
+		}
+		break
+	}
+	return keys
+}
+
+// operationID is the endpoint in lowerCamelCase, suffixed with the method for
+// routes serving several and numbered when still taken
+func operationID(r Route, method string, multi bool, taken map[string]int) string {
+	id := goName(r.Endpoint)
+	if multi {
+		id += goName(strings.ToLower(method))
+	}
+	id = strings.ToLower(id[:1]) + id[1:]
+	taken[id]++
+	if taken[id] > 1 {
+		id = fmt.Sprintf("%s%d", id, taken[id])
+	}
+	return id
+}
+
+// handlerSummary is the first docstring line of the handler, or its name
+func handlerSummary(g *callGraph, ref funcRef, r Route) string {
+	if info, ok := g.funcs[ref]; ok && info.Fn.Docstring != "" {
+		return strings.TrimSpace(strings.SplitN(info.Fn.Docstring, "\n", 2)[0])
+	}
+	return r.Endpoint
+}
+
+// openAPIMarkdown lists the operations as the contract table for the prompts
+func openAPIMarkdown(doc *openAPIDoc) string {
+	var sb strings.Builder
+	sb.WriteString("# API contract\n\n")
+	ops := 0
+	for _, methods := range doc.Paths {
+		ops += len(methods)
+	}
+	fmt.Fprintf(&sb, "%d operations on %d paths, from the legacy route handlers. The full OpenAPI %s document is openapi.json.\n\n", ops, len(doc.Paths), doc.OpenAPI)
+	sb.WriteString("| Method | Path | Operation | Parameters | Body | Responses |\n|---|---|---|---|---|---|\n")
+	for _, p := range sortedKeys(doc.Paths) {
+		for _, method := range sortedKeys(doc.Paths[p]) {
+			op := doc.Paths[p][method]
+			var params []string
+			for _, prm := range op.Parameters {
+				params = append(params, fmt.Sprintf("%s %s: %s%s", prm.In, prm.Name, schemaText(prm.Schema), requiredMark(prm.Required)))
+			}
+			var bodies []string
+			if op.RequestBody != nil {
+				for _, media := range sortedKeys(op.RequestBody.Content) {
+					s := op.RequestBody.Content[media].Schema
+					var props []string
+					for _, name := range sortedKeys(s.Properties) {
+						props = append(props, name+": "+schemaText(s.Properties[name])+requiredMark(containsString(s.Required, name)))
+					}
+					if len(props) == 0 {
+						props = []string{"any"}
+					}
+					bodies = append(bodies, media+" {"+strings.Join(props, ", ")+"}")
+				}
+			}
+			fmt.Fprintf(&sb, "| %s | `%s` | %s | %s | %s | %s |\n", strings.ToUpper(method), p, op.OperationID,
+				strings.Join(params, "; "), strings.Join(bodies, "; "), strings.Join(sortedKeys(op.Responses), ", "))
+		}
+	}
+	return sb.String()
+}
+
+func schemaText(s *jsonSch) string {
+	switch {
+	case s == nil || (s.Type == "" && s.Format == ""):
+		return "any"
+	case s.Type == "array" && s.Items != nil:
+		return schemaText(s.Items) + "[]"
+	case s.Format != "":
+		return s.Type + "(" + s.Format + ")"
+	}
+	return s.Type
+}
+
+func requiredMark(required bool) string {
+	if required {
+		return " (required)"
+	}
+	return ""
+}
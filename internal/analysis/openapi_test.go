@@ -0,0 +1,62 @@
+package analysis
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestHandlerResponses(t *testing.T) {
+	src := `def order(order_id):
+    if request.method == "POST":
+        if not request.form.get("qty"):
+            return "bad", 400
+        return redirect(url_for("orders"))
+    return render_template("order.html")
+
+
+def item(item_id):
+    if request.method in ("PUT", "DELETE"):
+        if request.method == "DELETE":
+            return "", 204
+        return jsonify({"id": item_id})
+    elif request.method != "GET":
+        abort(405)
+    else:
+        if not exists(item_id): abort(404)
+        return render_template("item.html")
+
+
+def delete_user(username):
+    if request.method == "POST" and request.form:
+        return redirect("/")
+    db.delete(username)
+    return "", 204
+`
+	f := parsePython("views.py", src)
+	fns := f.Module.Functions
+	tests := []struct {
+		fn     int
+		method string
+		codes  []string
+	}{
+		{0, "GET", []string{"200"}},
+		{0, "POST", []string{"302", "400"}},
+		{1, "GET", []string{"200", "404"}},
+		{1, "PUT", []string{"200"}},
+		{1, "DELETE", []string{"204"}},
+		{1, "PATCH", []string{"405"}},
+		{2, "DELETE", []string{"204", "302"}},
+	}
+	for _, tt := range tests {
+		responses := handlerResponses(f, &fns[tt.fn], tt.method)
+		codes := sortedKeys(responses)
+		sort.Strings(codes)
+		if !reflect.DeepEqual(codes, tt.codes) {
+			t.Errorf("%s %s responses = %v, want %v", tt.method, fns[tt.fn].Name, codes, tt.codes)
+		}
+		if r := responses["204"]; r != nil && r.Content != nil {
+			t.Errorf("%s %s: 204 response declares content %v", tt.method, fns[tt.fn].Name, r.Content)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package analysis
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// osvVuln is the subset of an OSV advisory (https://ossf.github.io/osv-schema/)
+// the dependency audit needs
+type osvVuln struct {
+	ID        string   `json:"id"`
+	Aliases   []string `json:"aliases"`
+	Summary   string   `json:"summary"`
+	Details   string   `json:"details"`
+	Withdrawn string   `json:"withdrawn"`
+	Severity  []struct {
+		Type  string `json:"type"`
+		Score string `json:"score"`
+	} `json:"severity"`
+	Affected []struct {
+		Package struct {
+			Ecosystem string `json:"ecosystem"`
+			Name      string `json:"name"`
+		} `json:"package"`
+		Ranges []struct {
+			Type   string              `json:"type"`
+			Events []map[string]string `json:"events"`
+		} `json:"ranges"`
+		Versions []string `json:"versions"`
+	} `json:"affected"`
+	DatabaseSpecific struct {
+		Severity string `json:"severity"`
+	} `json:"database_specific"`
+}
+
+// loadOSV reads PyPI advisories for the given normalized packages from a
+// directory of OSV JSON files, a single JSON file holding one advisory or an
+// array, or a zip dump as published by osv.dev
+func loadOSV(root string, packages map[string]bool) (map[string][]osvVuln, error) {
+	db := map[string][]osvVuln{}
+	add := func(name string, data []byte) error {
+		vulns, err := decodeOSV(data)
+		if err != nil {
+			return fmt.Errorf("failed to parse OSV advisory %s: %w", name, err)
+		}
+		for _, v := range vulns {
+			if v.Withdrawn != "" {
+				continue
+			}
+			seen := map[string]bool{}
+			for _, a := range v.Affected {
+				pkg := normalizePackage(a.Package.Name)
+				if !strings.EqualFold(a.Package.Ecosystem, "PyPI") || !packages[pkg] || seen[pkg] {
+					continue
+				}
+				seen[pkg] = true
+				db[pkg] = append(db[pkg], v)
+			}
+		}
+		return nil
+	}
+
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open OSV database: %w", err)
+	}
+	if !info.IsDir() {
+		if strings.EqualFold(filepath.Ext(root), ".zip") {
+			return db, loadOSVZip(root, add)
+		}
+		data, err := os.ReadFile(root)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read OSV database: %w", err)
+		}
+		return db, add(root, data)
+	}
+
+	err = filepath.WalkDir(root, func(file string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".json":
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("failed to read OSV advisory: %w", err)
+			}
+			return add(file, data)
+		case ".zip":
+			return loadOSVZip(file, add)
+		}
+		return nil
+	})
+	return db, err
+}
+
+// loadOSVZip passes every JSON file of a zip archive to add
+func loadOSVZip(file string, add func(string, []byte) error) error {
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return fmt.Errorf("failed to open OSV archive: %w", err)
+	}
+	defer zr.Close()
+	for _, zf := range zr.File {
+		if !strings.EqualFold(filepath.Ext(zf.Name), ".json") {
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return fmt.Errorf("failed to open %s in OSV archive: %w", zf.Name, err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read %s in OSV archive: %w", zf.Name, err)
+		}
+		if err := add(zf.Name, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeOSV accepts a single advisory or an array of advisories
+func decodeOSV(data []byte) ([]osvVuln, error) {
+	trimmed := strings.TrimSpace(string(data))
+	if strings.HasPrefix(trimmed, "[") {
+		var vulns []osvVuln
+		err := json.Unmarshal(data, &vulns)
+		return vulns, err
+	}
+	var v osvVuln
+	err := json.Unmarshal(data, &v)
+	return []osvVuln{v}, err
+}
+
+// affects reports whether the advisory applies to pkg at version, and the
+// lowest fixed version above it when one is known
+func (v osvVuln) affects(pkg, version string) (bool, string) {
+	for _, a := range v.Affected {
+		if normalizePackage(a.Package.Name) != pkg {
+			continue
+		}
+		for _, listed := range a.Versions {
+			if comparePyVersions(listed, version) == 0 {
+				return true, v.fixedAbove(pkg, version)
+			}
+		}
+		for _, r := range a.Ranges {
+			if r.Type != "ECOSYSTEM" {
+				continue
+			}
+			// Events are ordered; each introduced opens an affected range that
+			// the following fixed or last_affected closes
+			affected := false
+			for _, e := range r.Events {
+				switch {
+				case e["introduced"] != "":
+					if e["introduced"] == "0" || comparePyVersions(version, e["introduced"]) >= 0 {
+						affected = true
+					}
+				case e["fixed"] != "":
+					if comparePyVersions(version, e["fixed"]) >= 0 {
+						affected = false
+					}
+				case e["last_affected"] != "":
+					if comparePyVersions(version, e["last_affected"]) > 0 {
+						affected = false
+					}
+				}
+			}
+			if affected {
+				return true, v.fixedAbove(pkg, version)
+			}
+		}
+	}
+	return false, ""
+}
+
+// fixedAbove returns the lowest fixed version greater than version
+func (v osvVuln) fixedAbove(pkg, version string) string {
+	best := ""
+	for _, a := range v.Affected {
+		if normalizePackage(a.Package.Name) != pkg {
+			continue
+		}
+		for _, r := range a.Ranges {
+			for _, e := range r.Events {
+				fixed := e["fixed"]
+				if fixed != "" && comparePyVersions(fixed, version) > 0 && (best == "" || comparePyVersions(fixed, best) < 0) {
+					best = fixed
+				}
+			}
+		}
+	}
+	return best
+}
+
+// cves returns the CVE identifiers among the advisory ID and aliases
+func (v osvVuln) cves() []string {
+	var out []string
+	for _, id := range append([]string{v.ID}, v.Aliases...) {
+		if strings.HasPrefix(id, "CVE-") {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// severity returns the CVSS v3 base score and rating, falling back to the
+// database specific rating when no vector is given
+func (v osvVuln) severity() (float64, string) {
+	for _, s := range v.Severity {
+		if strings.HasPrefix(s.Type, "CVSS_V3") {
+			if score, ok := cvss3BaseScore(s.Score); ok {
+				return score, cvssRating(score)
+			}
+		}
+	}
+	if v.DatabaseSpecific.Severity != "" {
+		return 0, strings.ToUpper(v.DatabaseSpecific.Severity)
+	}
+	return 0, "UNKNOWN"
+}
+
+var cvss3Weights = map[string]map[string]float64{
+	"AV": {"N": 0.85, "A": 0.62, "L": 0.55, "P": 0.2},
+	"AC": {"L": 0.77, "H": 0.44},
+	"UI": {"N": 0.85, "R": 0.62},
+	"C":  {"H": 0.56, "L": 0.22, "N": 0},
+	"I":  {"H": 0.56, "L": 0.22, "N": 0},
+	"A":  {"H": 0.56, "L": 0.22, "N": 0},
+}
+
+// cvss3BaseScore computes the base score of a CVSS v3.x vector such as
+// CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H
+func cvss3BaseScore(vector string) (float64, bool) {
+	metrics := map[string]string{}
+	for _, part := range strings.Split(vector, "/") {
+		if k, val, ok := strings.Cut(part, ":"); ok {
+			metrics[k] = val
+		}
+	}
+	changed := metrics["S"] == "C"
+	w := map[string]float64{}
+	for metric, weights := range cvss3Weights {
+		value, ok := weights[metrics[metric]]
+		if !ok {
+			return 0, false
+		}
+		w[metric] = value
+	}
+	pr := map[string]float64{"N": 0.85, "L": 0.62, "H": 0.27}
+	if changed {
+		pr["L"], pr["H"] = 0.68, 0.5
+	}
+	privileges, ok := pr[metrics["PR"]]
+	if !ok || (metrics["S"] != "U" && !changed) {
+		return 0, false
+	}
+
+	iss := 1 - (1-w["C"])*(1-w["I"])*(1-w["A"])
+	impact := 6.42 * iss
+	if changed {
+		impact = 7.52*(iss-0.029) - 3.25*math.Pow(iss-0.02, 15)
+	}
+	if impact <= 0 {
+		return 0, true
+	}
+	base := impact + 8.22*w["AV"]*w["AC"]*privileges*w["UI"]
+	if changed {
+		base *= 1.08
+	}
+	return cvssRoundUp(math.Min(base, 10)), true
+}
+
+// cvssRoundUp is the Roundup function of the CVSS v3.1 specification
+func cvssRoundUp(x float64) float64 {
+	i := int(math.Round(x * 100000))
+	if i%10000 == 0 {
+		return float64(i) / 100000
+	}
+	return float64(i/10000+1) / 10
+}
+
+func cvssRating(score float64) string {
+	switch {
+	case score == 0:
+		return "NONE"
+	case score < 4:
+		return "LOW"
+	case score < 7:
+		return "MEDIUM"
+	case score < 9:
+		return "HIGH"
+	}
+	return "CRITICAL"
+}
+
+// formatScore renders a CVSS score, or nothing when only a rating is known
+func formatScore(score float64) string {
+	if score == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(score, 'f', 1, 64)
+}
@@ -0,0 +1,138 @@
+package analysis
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// pyVersion is a parsed PEP 440 version
+type pyVersion struct {
+	epoch   int
+	release []int
+	pre     [2]int // phase (a=0, b=1, rc=2) and number
+	hasPre  bool
+	post    int // -1 when absent
+	dev     int // -1 when absent
+}
+
+var pep440Pattern = regexp.MustCompile(`^v?(?:(\d+)!)?(\d+(?:\.\d+)*)` +
+	`(?:[-_.]?(a|alpha|b|beta|c|rc|pre|preview)[-_.]?(\d*))?` +
+	`(?:-(\d+)|[-_.]?(post|rev|r)[-_.]?(\d*))?` +
+	`(?:[-_.]?dev[-_.]?(\d*))?(?:\+[a-z0-9.]+)?$`)
+
+// parsePyVersion parses a version such as "1.4.0rc1.post2"; ok is false for
+// strings that are not PEP 440 versions
+func parsePyVersion(s string) (pyVersion, bool) {
+	m := pep440Pattern.FindStringSubmatch(strings.ToLower(strings.TrimSpace(s)))
+	if m == nil {
+		return pyVersion{}, false
+	}
+	v := pyVersion{post: -1, dev: -1}
+	v.epoch, _ = strconv.Atoi(m[1])
+	for _, part := range strings.Split(m[2], ".") {
+		n, _ := strconv.Atoi(part)
+		v.release = append(v.release, n)
+	}
+	// Trailing zeros do not count: 1.0 == 1.0.0
+	for len(v.release) > 1 && v.release[len(v.release)-1] == 0 {
+		v.release = v.release[:len(v.release)-1]
+	}
+	if m[3] != "" {
+		v.hasPre = true
+		v.pre[0] = map[string]int{"a": 0, "alpha": 0, "b": 1, "beta": 1}[m[3]]
+		if m[3] == "c" || m[3] == "rc" || m[3] == "pre" || m[3] == "preview" {
+			v.pre[0] = 2
+		}
+		v.pre[1], _ = strconv.Atoi(m[4])
+	}
+	switch {
+	case m[5] != "":
+		v.post, _ = strconv.Atoi(m[5])
+	case m[6] != "":
+		v.post, _ = strconv.Atoi(m[7])
+	}
+	if strings.Contains(m[0], "dev") {
+		v.dev, _ = strconv.Atoi(m[8])
+	}
+	return v, true
+}
+
+// compare returns -1, 0 or 1 as v sorts before, equal to or after o
+func (v pyVersion) compare(o pyVersion) int {
+	if c := compareInt(v.epoch, o.epoch); c != 0 {
+		return c
+	}
+	for i := 0; i < len(v.release) || i < len(o.release); i++ {
+		if c := compareInt(segment(v.release, i), segment(o.release, i)); c != 0 {
+			return c
+		}
+	}
+	for i, a := range v.preKey() {
+		if c := compareFloat(a, o.preKey()[i]); c != 0 {
+			return c
+		}
+	}
+	if c := compareInt(v.post, o.post); c != 0 {
+		return c
+	}
+	return compareFloat(v.devKey(), o.devKey())
+}
+
+// preKey sorts dev releases of a final version before its pre-releases, and
+// final releases after them
+func (v pyVersion) preKey() [2]float64 {
+	switch {
+	case v.hasPre:
+		return [2]float64{float64(v.pre[0]), float64(v.pre[1])}
+	case v.dev >= 0 && v.post < 0:
+		return [2]float64{math.Inf(-1), 0}
+	}
+	return [2]float64{math.Inf(1), 0}
+}
+
+func (v pyVersion) devKey() float64 {
+	if v.dev < 0 {
+		return math.Inf(1)
+	}
+	return float64(v.dev)
+}
+
+func segment(release []int, i int) int {
+	if i < len(release) {
+		return release[i]
+	}
+	return 0
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// comparePyVersions compares two version strings, falling back to string
+// comparison when either is not a PEP 440 version
+func comparePyVersions(a, b string) int {
+	va, okA := parsePyVersion(a)
+	vb, okB := parsePyVersion(b)
+	if !okA || !okB {
+		return strings.Compare(a, b)
+	}
+	return va.compare(vb)
+}
@@ -0,0 +1,111 @@
+package analysis
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestComparePyVersions(t *testing.T) {
+	// Each version sorts strictly before the next
+	ordered := []string{
+		"1.0.dev1", "1.0a1", "1.0a2.dev1", "1.0a2", "1.0b1", "1.0rc1", "1.0", "1.0.post1", "1.0.1", "1.1", "1.10", "1!0.5",
+	}
+	for i := 0; i+1 < len(ordered); i++ {
+		a, b := ordered[i], ordered[i+1]
+		if got := comparePyVersions(a, b); got != -1 {
+			t.Errorf("compare(%s, %s) = %d, want -1", a, b, got)
+		}
+		if got := comparePyVersions(b, a); got != 1 {
+			t.Errorf("compare(%s, %s) = %d, want 1", b, a, got)
+		}
+	}
+
+	equal := [][2]string{
+		{"1.0", "1.0.0"}, {"1.0rc1", "1.0c1"}, {"1.0alpha1", "1.0a1"}, {"1.0-1", "1.0.post1"}, {"v2.1", "2.1"}, {"1.0+local", "1.0"},
+	}
+	for _, e := range equal {
+		if got := comparePyVersions(e[0], e[1]); got != 0 {
+			t.Errorf("compare(%s, %s) = %d, want 0", e[0], e[1], got)
+		}
+	}
+}
+
+func TestVersionInCycle(t *testing.T) {
+	tests := []struct {
+		version, cycle string
+		want           bool
+	}{
+		{"4.2", "4.2", true},
+		{"4.2.11", "4.2", true},
+		{"4.2rc1", "4.2", true},
+		{"4.20", "4.2", false},
+		{"4.1.9", "4.2", false},
+		{"3.0.1", "3", true},
+		{"1!4.2", "4.2", false},
+	}
+	for _, tt := range tests {
+		if got := versionInCycle(tt.version, tt.cycle); got != tt.want {
+			t.Errorf("versionInCycle(%s, %s) = %v, want %v", tt.version, tt.cycle, got, tt.want)
+		}
+	}
+}
+
+func TestOSVAffects(t *testing.T) {
+	var v osvVuln
+	advisory := `{"id": "GHSA-test", "affected": [{"package": {"ecosystem": "PyPI", "name": "Flask"},
+		"ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "0"}, {"fixed": "2.2.5"}, {"introduced": "2.3.0"}, {"fixed": "2.3.2"}]}],
+		"versions": ["3.0.0rc1"]}]}`
+	if err := json.Unmarshal([]byte(advisory), &v); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		version  string
+		affected bool
+		fixed    string
+	}{
+		{"1.0", true, "2.2.5"},
+		{"2.2.5", false, ""},
+		{"2.2.10", false, ""},
+		{"2.3.0", true, "2.3.2"},
+		{"2.3.1", true, "2.3.2"},
+		{"2.3.2", false, ""},
+		{"3.0.0rc1", true, ""},
+	}
+	for _, tt := range tests {
+		affected, fixed := v.affects("flask", tt.version)
+		if affected != tt.affected || fixed != tt.fixed {
+			t.Errorf("affects(%s) = %v, %q, want %v, %q", tt.version, affected, fixed, tt.affected, tt.fixed)
+		}
+	}
+}
+
+func TestMatchEOL(t *testing.T) {
+	db := map[string][]eolCycle{
+		"django":   {{Cycle: "4.2", EOL: "2026-04-30"}, {Cycle: "3.2", EOL: "2024-04-01"}},
+		"psycopg2": {{Cycle: "2.9"}, {Cycle: "2.8", EOL: "2021-06-14"}},
+	}
+	tests := []struct {
+		pkg, version, today string
+		want                string // cycle reported, "-" when none, "" for older than every cycle
+	}{
+		{"django", "4.2.11", "2026-04-29", "-"},
+		{"django", "4.2.11", "2026-04-30", "4.2"},
+		{"django", "3.2", "2025-01-01", "3.2"},
+		{"django", "2.2.28", "2025-01-01", ""},
+		{"django", "5.0", "2025-01-01", "-"},
+		{"psycopg2", "2.8.6", "2025-01-01", "2.8"},
+		{"psycopg2-binary", "2.8.6", "2025-01-01", "2.8"},
+		{"psycopg2-binary", "2.9.9", "2025-01-01", "-"},
+		{"flask", "0.12", "2025-01-01", "-"},
+	}
+	for _, tt := range tests {
+		out := matchEOL([]Dependency{{Package: tt.pkg, Version: tt.version}}, db, tt.today)
+		got := "-"
+		if len(out) > 0 {
+			got = out[0].Cycle
+		}
+		if got != tt.want {
+			t.Errorf("matchEOL(%s==%s, %s) cycle = %q, want %q", tt.pkg, tt.version, tt.today, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,559 @@
+package analysis
+
+import (
+	"fmt"
+	"lcma/internal/utils"
+	"math"
+	"sort"
+	"strings"
+)
+
+// MigrationPhase is a group of legacy modules, with their routes and templates,
+// that can be migrated once the phases it depends on are done
+type MigrationPhase struct {
+	Number    int      `json:"number"` // 0 is the foundation phase
+	Title     string   `json:"title"`
+	Level     int      `json:"level"` // import depth; 0 for modules importing no legacy module
+	Modules   []string `json:"modules"`
+	Routes    []string `json:"routes,omitempty"` // METHODS path
+	Templates []string `json:"templates,omitempty"`
+	Tables    []string `json:"tables,omitempty"`
+	// Files are the corpus paths sent to the LLM when the phase runs on its own
+	Files       []string `json:"files"`
+	DependsOn   []int    `json:"depends_on"`
+	EffortHours float64  `json:"effort_hours"`
+	EffortDays  float64  `json:"effort_days"`
+	Size        string   `json:"size"` // S, M, L or XL
+	Acceptance  []string `json:"acceptance"`
+	Notes       []string `json:"notes,omitempty"`
+}
+
+// MigrationPlan is the layout of migration_plan.json
+type MigrationPlan struct {
+	EffortModel string           `json:"effort_model"`
+	TotalHours  float64          `json:"total_hours"`
+	TotalDays   float64          `json:"total_days"`
+	Cycles      [][]string       `json:"cycles,omitempty"` // import cycles migrated as one unit
+	Phases      []MigrationPhase `json:"phases"`
+}
+
+// Effort model in hours; a day is hoursPerDay of focused work
+const (
+	effortModule       = 1.0
+	effortLinesPerHour = 40.0
+	effortComplexity   = 0.25 // per point of cyclomatic complexity
+	effortRoute        = 1.5
+	effortTemplate     = 1.0
+	effortTemplTODO    = 0.5
+	effortFoundation   = 4.0
+	effortTable        = 1.0
+	effortLibrary      = 0.5
+	effortUnmapped     = 2.0
+	hoursPerDay        = 6.0
+
+	// phaseBudget is the most hours put in one phase; a larger level is split
+	phaseBudget = 60.0
+)
+
+var effortModel = fmt.Sprintf("per module %.1fh + lines/%.0f + %.2fh per complexity point; %.1fh per route; "+
+	"%.1fh per template + %.1fh per Templ TODO; foundation %.1fh + %.1fh per table + %.1fh per mapped and %.1fh per unmapped library; "+
+	"%.0fh per day, at most %.0fh per phase",
+	effortModule, effortLinesPerHour, effortComplexity, effortRoute, effortTemplate, effortTemplTODO,
+	effortFoundation, effortTable, effortLibrary, effortUnmapped, hoursPerDay, phaseBudget)
+
+// planUnit is a module, or the modules of an import cycle, placed as one
+type planUnit struct {
+	modules []*PyModule
+	deps    map[int]bool // indexes of the units it imports
+	level   int
+	hours   float64
+}
+
+// analyzeMigrationPlan orders the modules so leaf modules come first and groups
+// them with their routes and templates into phases with effort and acceptance
+// criteria
+func analyzeMigrationPlan(p *Project) error {
+	plan := buildMigrationPlan(p)
+	p.Plan = plan
+	if err := utils.WriteReportJSON("migration_plan.json", plan); err != nil {
+		return err
+	}
+	return utils.WriteReportFile("migration_plan.md", []byte(migrationPlanMarkdown(plan)))
+}
+
+func buildMigrationPlan(p *Project) *MigrationPlan {
+	plan := &MigrationPlan{EffortModel: effortModel, Phases: []MigrationPhase{foundationPhase(p)}}
+
+	units, cycles := planUnits(p)
+	plan.Cycles = cycles
+	routes := map[string][]Route{}
+	for _, r := range p.Routes {
+		routes[r.Module] = append(routes[r.Module], r)
+	}
+	complexity := map[string]int{}
+	if p.Metrics != nil {
+		for _, m := range p.Metrics.Modules {
+			complexity[m.Module] = m.Complexity
+		}
+	}
+	for _, u := range units {
+		for _, m := range u.modules {
+			u.hours += effortModule + float64(m.Lines)/effortLinesPerHour + effortComplexity*float64(complexity[m.Name]) +
+				effortRoute*float64(len(routes[m.Name]))
+		}
+	}
+
+	// Fill phases level by level, largest units first so the budget packs well
+	byLevel := map[int][]*planUnit{}
+	maxLevel := -1
+	for _, u := range units {
+		byLevel[u.level] = append(byLevel[u.level], u)
+		maxLevel = max(maxLevel, u.level)
+	}
+	phaseOf := map[string]int{} // module name to phase number
+	for level := 0; level <= maxLevel; level++ {
+		pending := byLevel[level]
+		sort.SliceStable(pending, func(i, j int) bool { return pending[i].hours > pending[j].hours })
+		var bins [][]*planUnit
+		var hours []float64
+		for _, u := range pending {
+			placed := false
+			for i := range bins {
+				if hours[i]+u.hours <= phaseBudget {
+					bins[i], hours[i], placed = append(bins[i], u), hours[i]+u.hours, true
+					break
+				}
+			}
+			if !placed {
+				bins, hours = append(bins, []*planUnit{u}), append(hours, u.hours)
+			}
+		}
+		for _, bin := range bins {
+			ph := MigrationPhase{Number: len(plan.Phases), Level: level}
+			for _, u := range bin {
+				for _, m := range u.modules {
+					ph.Modules = append(ph.Modules, m.Name)
+					ph.Files = append(ph.Files, m.Path)
+					phaseOf[m.Name] = ph.Number
+					for _, r := range routes[m.Name] {
+						ph.Routes = append(ph.Routes, strings.Join(r.Methods, ",")+" "+r.Path)
+					}
+				}
+				ph.EffortHours += u.hours
+			}
+			sort.Strings(ph.Modules)
+			plan.Phases = append(plan.Phases, ph)
+		}
+	}
+
+	// A phase depends on the foundation and on the phases of the modules it imports
+	if p.Graph != nil {
+		for _, e := range p.Graph.Edges {
+			from, ok1 := phaseOf[e.From]
+			to, ok2 := phaseOf[e.To]
+			if ok1 && ok2 && from != to {
+				plan.Phases[from].DependsOn = appendUniqueInt(plan.Phases[from].DependsOn, to)
+			}
+		}
+	}
+	for i := 1; i < len(plan.Phases); i++ {
+		plan.Phases[i].DependsOn = appendUniqueInt(plan.Phases[i].DependsOn, 0)
+		sort.Ints(plan.Phases[i].DependsOn)
+	}
+
+	assignTemplates(p, plan, phaseOf)
+	assignTables(p, plan)
+	for i := range plan.Phases {
+		ph := &plan.Phases[i]
+		if i > 0 {
+			ph.Title = phaseTitle(ph)
+			ph.Acceptance = phaseAcceptance(p, ph)
+			ph.Notes = phaseNotes(ph, cycles)
+		}
+		ph.EffortHours = math.Round(ph.EffortHours*10) / 10
+		ph.EffortDays = math.Ceil(ph.EffortHours/hoursPerDay*2) / 2
+		ph.Size = phaseSize(ph.EffortDays)
+		plan.TotalHours += ph.EffortHours
+		plan.TotalDays += ph.EffortDays
+	}
+	plan.TotalHours = math.Round(plan.TotalHours*10) / 10
+	return plan
+}
+
+// planUnits condenses import cycles into single units and gives each unit its
+// level: 0 when it imports no other unit, else one more than its deepest import
+func planUnits(p *Project) ([]*planUnit, [][]string) {
+	deps := map[string][]string{}
+	if p.Graph != nil {
+		for _, e := range p.Graph.Edges {
+			deps[e.From] = append(deps[e.From], e.To)
+		}
+	}
+	byName := map[string]*PyModule{}
+	var names []string
+	for _, m := range p.Modules {
+		byName[m.Name] = m
+		names = append(names, m.Name)
+	}
+	sort.Strings(names)
+
+	// Tarjan's strongly connected components
+	index, low, unitOf := map[string]int{}, map[string]int{}, map[string]int{}
+	onStack := map[string]bool{}
+	var stack []string
+	var units []*planUnit
+	var cycles [][]string
+	var connect func(name string)
+	connect = func(name string) {
+		index[name], low[name] = len(index), len(index)
+		stack = append(stack, name)
+		onStack[name] = true
+		for _, d := range deps[name] {
+			if _, ok := byName[d]; !ok {
+				continue
+			}
+			if _, seen := index[d]; !seen {
+				connect(d)
+				low[name] = min(low[name], low[d])
+			} else if onStack[d] {
+				low[name] = min(low[name], index[d])
+			}
+		}
+		if low[name] != index[name] {
+			return
+		}
+		u := &planUnit{deps: map[int]bool{}}
+		var members []string
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			unitOf[top] = len(units)
+			members = append(members, top)
+			if top == name {
+				break
+			}
+		}
+		sort.Strings(members)
+		for _, n := range members {
+			u.modules = append(u.modules, byName[n])
+		}
+		if len(members) > 1 {
+			cycles = append(cycles, members)
+		}
+		// Components complete in reverse topological order, so imports already have a level
+		for _, n := range members {
+			for _, d := range deps[n] {
+				if dep, ok := unitOf[d]; ok && dep != len(units) {
+					u.deps[dep] = true
+					u.level = max(u.level, units[dep].level+1)
+				}
+			}
+		}
+		units = append(units, u)
+	}
+	for _, name := range names {
+		if _, seen := index[name]; !seen {
+			connect(name)
+		}
+	}
+	return units, cycles
+}
+
+// foundationPhase is the Go project skeleton, configuration, libraries and
+// database migrations every later phase builds on
+func foundationPhase(p *Project) MigrationPhase {
+	ph := MigrationPhase{Number: 0, Title: "Foundation: project skeleton, configuration, libraries and database schema", Level: -1,
+		Modules: []string{}, Files: []string{}, DependsOn: []int{}, EffortHours: effortFoundation}
+	files := map[string]bool{}
+	for _, f := range p.Corpus.Files {
+		if f.Kind == utils.KindConfig || f.Kind == utils.KindSchema {
+			files[f.Path] = true
+		}
+	}
+	libraries := map[string]bool{}
+	unmapped := 0
+	if p.Dependencies != nil {
+		for _, d := range p.Dependencies.Dependencies {
+			if d.Group != "main" {
+				continue
+			}
+			files[d.Source] = true
+			switch {
+			case !d.Mapped:
+				unmapped++
+				ph.EffortHours += effortUnmapped
+			case d.Go != "" && !libraries[d.Go]:
+				libraries[d.Go] = true
+				ph.EffortHours += effortLibrary
+			}
+		}
+	}
+	ph.Files = sortedKeys(files)
+
+	ph.Acceptance = []string{"`go build ./...` and `go vet ./...` pass on the new project skeleton",
+		"Configuration is read from the environment with the settings of the legacy config files, without hardcoded secrets"}
+	// Standard library packages need no go.mod requirement
+	var required []string
+	for _, lib := range sortedKeys(libraries) {
+		if !isStdlibImport(lib) {
+			required = append(required, lib)
+		}
+	}
+	if len(required) > 0 {
+		ph.Acceptance = append(ph.Acceptance, fmt.Sprintf("go.mod requires the %d Go libraries mapped in dependencies.md: %s",
+			len(required), strings.Join(required, ", ")))
+	}
+	if unmapped > 0 {
+		ph.Notes = append(ph.Notes, fmt.Sprintf("%d Python packages have no known Go equivalent; choose replacements before phase 1", unmapped))
+	}
+	if p.Schema != nil && len(p.Schema.Tables) > 0 {
+		var tables []string
+		for _, t := range p.Schema.Tables {
+			tables = append(tables, t.Name)
+		}
+		ph.Tables = tables
+		ph.EffortHours += effortTable * float64(len(tables))
+		ph.Acceptance = append(ph.Acceptance,
+			fmt.Sprintf("Migrations create every table of erd.md (%d) with its columns, keys and indexes and apply to an empty database", len(tables)),
+			"The database pool opens from configuration and closes on shutdown")
+	}
+	return ph
+}
+
+// isStdlibImport reports whether a Go import path is in the standard library,
+// whose first path element has no dot
+func isStdlibImport(importPath string) bool {
+	first, _, _ := strings.Cut(importPath, "/")
+	return !strings.Contains(first, ".")
+}
+
+// assignTemplates puts each template in the earliest phase that renders it, and
+// the templates it extends, includes or imports no later than that
+func assignTemplates(p *Project, plan *MigrationPlan, phaseOf map[string]int) {
+	moduleByPath := map[string]string{}
+	for _, m := range p.Modules {
+		moduleByPath[m.Path] = m.Name
+	}
+	todos := map[string]int{}
+	for _, tr := range p.Translations {
+		todos[tr.Template] = len(tr.TODOs)
+	}
+	byName := map[string]*Template{}
+	phase := map[string]int{}
+	for _, t := range p.Templates {
+		byName[t.Name] = t
+		for _, r := range t.RenderedBy {
+			if n, ok := phaseOf[moduleByPath[r.File]]; ok {
+				if cur, seen := phase[t.Name]; !seen || n < cur {
+					phase[t.Name] = n
+				}
+			}
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, t := range p.Templates {
+			n, ok := phase[t.Name]
+			if !ok {
+				continue
+			}
+			for _, dep := range append(append([]string{t.Extends}, t.Includes...), t.Imports...) {
+				if _, known := byName[dep]; !known {
+					continue
+				}
+				if cur, seen := phase[dep]; !seen || n < cur {
+					phase[dep] = n
+					changed = true
+				}
+			}
+		}
+	}
+
+	last := len(plan.Phases) - 1
+	for _, t := range p.Templates {
+		n, ok := phase[t.Name]
+		if !ok {
+			// Not rendered by any legacy route; the last phase decides whether it is still needed
+			n = last
+			plan.Phases[n].Notes = append(plan.Phases[n].Notes, fmt.Sprintf("template %s is not rendered by any legacy handler; confirm it is needed", t.Name))
+		}
+		ph := &plan.Phases[n]
+		ph.Templates = append(ph.Templates, t.Name)
+		ph.Files = append(ph.Files, t.Path)
+		ph.EffortHours += effortTemplate + effortTemplTODO*float64(todos[t.Name])
+	}
+}
+
+// assignTables lists in each module phase the tables its modules query
+func assignTables(p *Project, plan *MigrationPlan) {
+	if p.Schema == nil {
+		return
+	}
+	phaseOfFile := map[string]int{}
+	for _, ph := range plan.Phases[1:] {
+		for _, f := range ph.Files {
+			phaseOfFile[f] = ph.Number
+		}
+	}
+	for _, q := range p.Schema.Queries {
+		if n, ok := phaseOfFile[q.File]; ok {
+			for _, t := range q.Tables {
+				plan.Phases[n].Tables = appendUnique(plan.Phases[n].Tables, t)
+			}
+		}
+	}
+	for i := range plan.Phases[1:] {
+		sort.Strings(plan.Phases[i+1].Tables)
+	}
+}
+
+func phaseTitle(ph *MigrationPhase) string {
+	kind := "Leaf modules"
+	if ph.Level > 0 {
+		kind = fmt.Sprintf("Level %d modules", ph.Level)
+	}
+	names := ph.Modules
+	if len(names) > 3 {
+		names = append(names[:3:3], fmt.Sprintf("%d more", len(ph.Modules)-3))
+	}
+	title := kind + ": " + strings.Join(names, ", ")
+	if len(ph.Routes) > 0 {
+		title += fmt.Sprintf(" (%d routes)", len(ph.Routes))
+	}
+	return title
+}
+
+// phaseAcceptance lists what must hold before the next phase starts
+func phaseAcceptance(p *Project, ph *MigrationPhase) []string {
+	files := map[string]bool{}
+	for _, f := range ph.Files {
+		files[f] = true
+	}
+	criteria := []string{"`go build ./...` and `go vet ./...` pass with the phase merged"}
+	functions, classes := 0, 0
+	for _, m := range p.Modules {
+		if files[m.Path] {
+			functions += len(m.Functions)
+			classes += len(m.Classes)
+		}
+	}
+	criteria = append(criteria, fmt.Sprintf("Every function (%d) and class (%d) of %s has a Go counterpart or a recorded reason to drop it",
+		functions, classes, strings.Join(ph.Modules, ", ")))
+	for _, r := range ph.Routes {
+		criteria = append(criteria, fmt.Sprintf("The router serves %s with the status codes, redirects and templates of the legacy handler", r))
+	}
+	if len(ph.Routes) > 0 {
+		criteria = append(criteria, "route_coverage.md lists none of this phase's routes as missing")
+	}
+	if len(ph.Templates) > 0 {
+		criteria = append(criteria, fmt.Sprintf("`templ generate` compiles the components for %s with no jTODO left", strings.Join(ph.Templates, ", ")))
+	}
+	if p.Schema != nil {
+		dynamic := 0
+		for _, q := range p.Schema.Queries {
+			if files[q.File] && q.Dynamic != "" {
+				dynamic++
+			}
+		}
+		if len(ph.Tables) > 0 {
+			criteria = append(criteria, fmt.Sprintf("Queries on %s go through pgx with bound parameters and return the same rows as the legacy queries", strings.Join(ph.Tables, ", ")))
+		}
+		if dynamic > 0 {
+			criteria = append(criteria, fmt.Sprintf("Queries built with string formatting (%d) are rewritten as parameterized queries", dynamic))
+		}
+	}
+	findings := 0
+	for _, f := range p.Security {
+		if files[f.File] {
+			findings++
+		}
+	}
+	if findings > 0 {
+		criteria = append(criteria, fmt.Sprintf("Findings of security_findings.md in these files (%d) are fixed, not ported", findings))
+	}
+	return criteria
+}
+
+func phaseNotes(ph *MigrationPhase, cycles [][]string) []string {
+	notes := ph.Notes
+	for _, c := range cycles {
+		for _, m := range ph.Modules {
+			if m == c[0] {
+				notes = append(notes, "import cycle "+strings.Join(c, " -> ")+" is migrated as one unit; break it in the Go packages")
+				break
+			}
+		}
+	}
+	return notes
+}
+
+func phaseSize(days float64) string {
+	switch {
+	case days <= 1:
+		return "S"
+	case days <= 3:
+		return "M"
+	case days <= 7:
+		return "L"
+	}
+	return "XL"
+}
+
+// migrationPlanMarkdown renders the phases in order with their effort and criteria
+func migrationPlanMarkdown(plan *MigrationPlan) string {
+	var sb strings.Builder
+	sb.WriteString("# Migration plan\n\n")
+	fmt.Fprintf(&sb, "%d phases, %.1f hours (%.1f days). Modules are ordered by import depth so leaf modules come first; "+
+		"each phase only uses code of the phases it depends on. Effort model: %s.\n\n", len(plan.Phases), plan.TotalHours, plan.TotalDays, plan.EffortModel)
+	sb.WriteString("| Phase | Title | Depends on | Modules | Routes | Templates | Effort (days) | Size |\n|---|---|---|---|---|---|---|---|\n")
+	for _, ph := range plan.Phases {
+		var deps []string
+		for _, d := range ph.DependsOn {
+			deps = append(deps, fmt.Sprint(d))
+		}
+		fmt.Fprintf(&sb, "| %d | %s | %s | %d | %d | %d | %.1f | %s |\n", ph.Number, ph.Title, strings.Join(deps, ", "),
+			len(ph.Modules), len(ph.Routes), len(ph.Templates), ph.EffortDays, ph.Size)
+	}
+	for _, ph := range plan.Phases {
+		sb.WriteString("\n" + ph.Markdown())
+	}
+	return sb.String()
+}
+
+// Markdown describes the phase for the plan and for a prompt that runs it alone
+func (ph MigrationPhase) Markdown() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "## Phase %d: %s\n\n", ph.Number, ph.Title)
+	fmt.Fprintf(&sb, "Effort: %.1f hours, %.1f days (%s).\n", ph.EffortHours, ph.EffortDays, ph.Size)
+	list := func(label string, items []string) {
+		if len(items) > 0 {
+			fmt.Fprintf(&sb, "- %s: %s\n", label, strings.Join(items, ", "))
+		}
+	}
+	sb.WriteString("\n")
+	list("Modules", ph.Modules)
+	list("Routes", ph.Routes)
+	list("Templates", ph.Templates)
+	list("Tables", ph.Tables)
+	sb.WriteString("\nAcceptance criteria:\n")
+	for _, c := range ph.Acceptance {
+		sb.WriteString("- [ ] " + c + "\n")
+	}
+	if len(ph.Notes) > 0 {
+		sb.WriteString("\nNotes:\n")
+		for _, n := range ph.Notes {
+			sb.WriteString("- " + n + "\n")
+		}
+	}
+	return sb.String()
+}
+
+func appendUniqueInt(list []int, n int) []int {
+	for _, v := range list {
+		if v == n {
+			return list
+		}
+	}
+	return append(list, n)
+}
@@ -0,0 +1,271 @@
+package analysis
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Token kinds produced by the Python lexer
+const (
+	tokName = iota
+	tokNumber
+	tokString
+	tokOp
+	tokNewline
+	tokIndent
+	tokDedent
+	tokEOF
+)
+
+// pyToken is a Python token with its position in the source
+type pyToken struct {
+	Kind  int
+	Value string
+	Line  int
+	Pos   int // byte offset of the first character
+	End   int // byte offset just past the token
+}
+
+// pyOperators lists multi-character operators, longest first
+var pyOperators = []string{
+	"**=", "//=", ">>=", "<<=", "...",
+	"->", ":=", "==", "!=", "<=", ">=", "<>", "**", "//", "<<", ">>",
+	"+=", "-=", "*=", "/=", "%=", "&=", "|=", "^=", "@=",
+}
+
+// tokenizePython splits Python source into tokens, emitting NEWLINE, INDENT and
+// DEDENT the way the CPython tokenizer does. It never fails: malformed input is
+// tokenized on a best-effort basis, which is what legacy code usually needs.
+func tokenizePython(src string) []pyToken {
+	var (
+		toks    []pyToken
+		indents = []int{0}
+		depth   int // open brackets; newlines inside brackets are ignored
+		line    = 1
+		i       int
+		bol     = true // at beginning of a logical line
+	)
+
+	emit := func(kind int, start, end int) {
+		toks = append(toks, pyToken{Kind: kind, Value: src[start:end], Line: line, Pos: start, End: end})
+	}
+
+	for i < len(src) {
+		if bol && depth == 0 {
+			// Measure indentation, skipping blank and comment-only lines
+			col, j := 0, i
+			for j < len(src) && (src[j] == ' ' || src[j] == '\t' || src[j] == '\f') {
+				if src[j] == '\t' {
+					col = (col/8 + 1) * 8
+				} else if src[j] == ' ' {
+					col++
+				}
+				j++
+			}
+			if j >= len(src) {
+				i = j
+				break
+			}
+			if src[j] == '\n' || src[j] == '\r' || src[j] == '#' {
+				for j < len(src) && src[j] != '\n' {
+					j++
+				}
+				if j < len(src) {
+					j++
+					line++
+				}
+				i = j
+				continue
+			}
+			if src[j] == '\\' && j+1 < len(src) && src[j+1] == '\n' {
+				i = j + 2
+				line++
+				continue
+			}
+
+			i = j
+			bol = false
+			if col > indents[len(indents)-1] {
+				indents = append(indents, col)
+				toks = append(toks, pyToken{Kind: tokIndent, Line: line, Pos: i, End: i})
+			}
+			for col < indents[len(indents)-1] {
+				indents = indents[:len(indents)-1]
+				toks = append(toks, pyToken{Kind: tokDedent, Line: line, Pos: i, End: i})
+			}
+		}
+
+		c := src[i]
+		switch {
+		case c == '\n':
+			if depth == 0 && !bol {
+				emit(tokNewline, i, i+1)
+				bol = true
+			}
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f':
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '\\' && i+1 < len(src) && (src[i+1] == '\n' || src[i+1] == '\r'):
+			// Explicit line continuation
+			i++
+			if src[i] == '\r' {
+				i++
+			}
+			if i < len(src) && src[i] == '\n' {
+				i++
+			}
+			line++
+		case c == '\'' || c == '"':
+			start, startLine := i, line
+			i = skipPythonStringToken(src, i)
+			toks = append(toks, pyToken{Kind: tokString, Value: src[start:i], Line: startLine, Pos: start, End: i})
+			line += strings.Count(src[start:i], "\n")
+		case isPyIdentStart(src, i):
+			start := i
+			for i < len(src) {
+				r, size := utf8.DecodeRuneInString(src[i:])
+				if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				i += size
+			}
+			// String prefixes such as r"", b'', f"", rb""
+			if i < len(src) && (src[i] == '\'' || src[i] == '"') && i-start <= 2 && isPyStringPrefix(src[start:i]) {
+				startLine := line
+				i = skipPythonStringToken(src, i)
+				toks = append(toks, pyToken{Kind: tokString, Value: src[start:i], Line: startLine, Pos: start, End: i})
+				line += strings.Count(src[start:i], "\n")
+				continue
+			}
+			emit(tokName, start, i)
+		case c >= '0' && c <= '9' || (c == '.' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9'):
+			start := i
+			for i < len(src) && (isPyIdentByte(src[i]) || src[i] == '.' ||
+				((src[i] == '+' || src[i] == '-') && (src[i-1] == 'e' || src[i-1] == 'E') && !strings.ContainsAny(src[start:i], "xX"))) {
+				i++
+			}
+			emit(tokNumber, start, i)
+		default:
+			start := i
+			op := string(c)
+			for _, candidate := range pyOperators {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == string(c) && c >= utf8.RuneSelf {
+				// Stray non-ASCII punctuation: consume the whole rune
+				_, size := utf8.DecodeRuneInString(src[i:])
+				op = src[i : i+size]
+			}
+			i += len(op)
+			switch op {
+			case "(", "[", "{":
+				depth++
+			case ")", "]", "}":
+				if depth > 0 {
+					depth--
+				}
+			}
+			emit(tokOp, start, i)
+		}
+	}
+
+	if !bol {
+		toks = append(toks, pyToken{Kind: tokNewline, Line: line, Pos: len(src), End: len(src)})
+	}
+	for len(indents) > 1 {
+		indents = indents[:len(indents)-1]
+		toks = append(toks, pyToken{Kind: tokDedent, Line: line, Pos: len(src), End: len(src)})
+	}
+	return append(toks, pyToken{Kind: tokEOF, Line: line, Pos: len(src), End: len(src)})
+}
+
+func isPyIdentStart(src string, i int) bool {
+	r, _ := utf8.DecodeRuneInString(src[i:])
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isPyIdentByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func isPyStringPrefix(p string) bool {
+	switch strings.ToLower(p) {
+	case "r", "u", "b", "f", "br", "rb", "fr", "rf":
+		return true
+	}
+	return false
+}
+
+// skipPythonStringToken returns the index just past the string whose opening quote is at src[i]
+func skipPythonStringToken(src string, i int) int {
+	q := src[i]
+	if i+2 < len(src) && src[i+1] == q && src[i+2] == q {
+		i += 3
+		for i < len(src) {
+			switch {
+			case src[i] == '\\':
+				i += 2
+			case i+2 < len(src) && src[i] == q && src[i+1] == q && src[i+2] == q:
+				return i + 3
+			default:
+				i++
+			}
+		}
+		return len(src)
+	}
+
+	i++
+	for i < len(src) && src[i] != '\n' {
+		switch src[i] {
+		case '\\':
+			i += 2
+		case q:
+			return i + 1
+		default:
+			i++
+		}
+	}
+	if i > len(src) {
+		return len(src)
+	}
+	return i
+}
+
+// stringLiteralValue returns the contents of a string token without prefix and
+// quotes. Common escapes are decoded unless the literal is raw.
+func stringLiteralValue(tok string) string {
+	prefixLen := strings.IndexAny(tok, `'"`)
+	if prefixLen < 0 {
+		return tok
+	}
+	raw := strings.ContainsAny(strings.ToLower(tok[:prefixLen]), "r")
+	body := tok[prefixLen:]
+
+	quote := body[:1]
+	if strings.HasPrefix(body, strings.Repeat(quote, 3)) && len(body) >= 6 {
+		quote = strings.Repeat(quote, 3)
+	}
+	body = strings.TrimPrefix(body, quote)
+	body = strings.TrimSuffix(body, quote)
+	if raw {
+		return body
+	}
+	return pyEscapes.Replace(body)
+}
+
+var pyEscapes = strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\r`, "\r", `\\`, `\`, `\'`, `'`, `\"`, `"`, "\\\n", "")
+
+// isFString reports whether a string token is an f-string
+func isFString(tok string) bool {
+	prefixLen := strings.IndexAny(tok, `'"`)
+	return prefixLen > 0 && strings.ContainsAny(strings.ToLower(tok[:prefixLen]), "f")
+}
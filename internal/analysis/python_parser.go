@@ -0,0 +1,580 @@
+package analysis
+
+import (
+	"path"
+	"strings"
+)
+
+// pyStmt is a logical line of Python with the block nested under it, if any
+type pyStmt struct {
+	Tokens  []pyToken // tokens of the logical line, without NEWLINE
+	Line    int
+	EndLine int
+	Body    []*pyStmt
+}
+
+// keyword returns the first token value of the statement
+func (s *pyStmt) keyword() string {
+	if len(s.Tokens) == 0 {
+		return ""
+	}
+	if s.Tokens[0].Value == "async" && len(s.Tokens) > 1 {
+		return s.Tokens[1].Value
+	}
+	return s.Tokens[0].Value
+}
+
+// pyFile is a parsed Python source file
+type pyFile struct {
+	Path   string
+	Src    string
+	Tokens []pyToken
+	Stmts  []*pyStmt
+	Module *PyModule
+}
+
+// PyModule summarizes the definitions and imports of a Python module
+type PyModule struct {
+	Path      string       `json:"path"`
+	Name      string       `json:"name"`
+	Package   bool         `json:"package,omitempty"`
+	Lines     int          `json:"lines"`
+	Docstring string       `json:"docstring,omitempty"`
+	Imports   []PyImport   `json:"imports"`
+	Classes   []PyClass    `json:"classes"`
+	Functions []PyFunction `json:"functions"`
+	Globals   []PyVariable `json:"globals"`
+	Calls     []PyCall     `json:"calls,omitempty"` // module-level calls, e.g. app.register_blueprint
+}
+
+// PyImport is an import or from-import statement. Module is resolved to an
+// absolute name for relative imports.
+type PyImport struct {
+	Module string   `json:"module"`
+	Names  []string `json:"names,omitempty"`
+	Alias  string   `json:"alias,omitempty"`
+	Level  int      `json:"level,omitempty"`
+	Line   int      `json:"line"`
+}
+
+// PyDecorator is a decorator applied to a function or class
+type PyDecorator struct {
+	Name string  `json:"name"`
+	Args []PyArg `json:"args,omitempty"`
+	Line int     `json:"line"`
+}
+
+// PyArg is a call argument; Name is set for keyword arguments
+type PyArg struct {
+	Name  string `json:"name,omitempty"`
+	Value string `json:"value"`
+}
+
+// PyCall is a call expression such as render_template("x.html", a=b)
+type PyCall struct {
+	Name string  `json:"name"`
+	Args []PyArg `json:"args,omitempty"`
+	Line int     `json:"line"`
+}
+
+// PyFunction is a function or method definition
+type PyFunction struct {
+	Name       string        `json:"name"`
+	Qualname   string        `json:"qualname"`
+	Line       int           `json:"line"`
+	EndLine    int           `json:"end_line"`
+	Async      bool          `json:"async,omitempty"`
+	Params     []string      `json:"params"`
+	Decorators []PyDecorator `json:"decorators,omitempty"`
+	Docstring  string        `json:"docstring,omitempty"`
+	Calls      []PyCall      `json:"calls,omitempty"`
+
+	body []*pyStmt
+}
+
+// PyClass is a class definition with its methods
+type PyClass struct {
+	Name       string        `json:"name"`
+	Line       int           `json:"line"`
+	EndLine    int           `json:"end_line"`
+	Bases      []string      `json:"bases,omitempty"`
+	Decorators []PyDecorator `json:"decorators,omitempty"`
+	Docstring  string        `json:"docstring,omitempty"`
+	Methods    []PyFunction  `json:"methods"`
+	Attributes []PyVariable  `json:"attributes,omitempty"`
+}
+
+// PyVariable is a module or class level assignment
+type PyVariable struct {
+	Name string `json:"name"`
+	Line int    `json:"line"`
+}
+
+// parsePython tokenizes and parses a Python file into statements and a module summary
+func parsePython(filePath, src string) *pyFile {
+	toks := tokenizePython(src)
+	i := 0
+	stmts := parseBlock(toks, &i)
+
+	f := &pyFile{Path: filePath, Src: src, Tokens: toks, Stmts: stmts}
+	f.Module = &PyModule{
+		Path:      filePath,
+		Name:      moduleName(filePath),
+		Package:   path.Base(filePath) == "__init__.py",
+		Lines:     strings.Count(src, "\n") + 1,
+		Imports:   []PyImport{},
+		Classes:   []PyClass{},
+		Functions: []PyFunction{},
+		Globals:   []PyVariable{},
+	}
+	f.Module.Docstring = docstring(stmts)
+	extractModule(f, stmts)
+	return f
+}
+
+// moduleName converts a slash separated path to a dotted module name
+func moduleName(filePath string) string {
+	p := strings.TrimSuffix(filePath, path.Ext(filePath))
+	p = strings.TrimSuffix(p, "/__init__")
+	if p == "__init__" {
+		p = ""
+	}
+	return strings.ReplaceAll(p, "/", ".")
+}
+
+// parseBlock reads statements until the matching DEDENT or EOF
+func parseBlock(toks []pyToken, i *int) []*pyStmt {
+	var stmts []*pyStmt
+	for *i < len(toks) {
+		t := toks[*i]
+		switch t.Kind {
+		case tokEOF:
+			return stmts
+		case tokDedent:
+			*i++
+			return stmts
+		case tokIndent, tokNewline:
+			// Unexpected indent (e.g. continuation in broken code): just parse it as part of this block
+			*i++
+			continue
+		}
+
+		st := &pyStmt{Line: t.Line}
+		for *i < len(toks) && toks[*i].Kind != tokNewline && toks[*i].Kind != tokEOF && toks[*i].Kind != tokDedent && toks[*i].Kind != tokIndent {
+			st.Tokens = append(st.Tokens, toks[*i])
+			*i++
+		}
+		if *i < len(toks) && toks[*i].Kind == tokNewline {
+			*i++
+		}
+		st.EndLine = st.Line
+		if n := len(st.Tokens); n > 0 {
+			last := st.Tokens[n-1]
+			st.EndLine = last.Line + strings.Count(last.Value, "\n")
+		}
+
+		if *i < len(toks) && toks[*i].Kind == tokIndent {
+			*i++
+			st.Body = parseBlock(toks, i)
+			if n := len(st.Body); n > 0 {
+				st.EndLine = st.Body[n-1].EndLine
+			}
+		}
+		stmts = append(stmts, st)
+	}
+	return stmts
+}
+
+// docstring returns the leading string literal of a block, if any
+func docstring(body []*pyStmt) string {
+	if len(body) == 0 || len(body[0].Tokens) != 1 || body[0].Tokens[0].Kind != tokString {
+		return ""
+	}
+	return strings.TrimSpace(stringLiteralValue(body[0].Tokens[0].Value))
+}
+
+// extractModule fills the module summary from top-level statements
+func extractModule(f *pyFile, stmts []*pyStmt) {
+	m := f.Module
+	var decorators []PyDecorator
+
+	for _, st := range stmts {
+		switch st.keyword() {
+		case "@":
+			decorators = append(decorators, parseDecorator(f.Src, st))
+			continue
+		case "def":
+			fn := parseFunction(f, st, decorators, "")
+			m.Functions = append(m.Functions, fn)
+		case "class":
+			m.Classes = append(m.Classes, parseClass(f, st, decorators))
+		case "import", "from":
+			m.Imports = append(m.Imports, parseImports(m, st)...)
+		case "if", "try", "with", "for", "while", "else", "elif", "except", "finally":
+			// Definitions and imports guarded by if/try blocks still belong to the module
+			m.Calls = append(m.Calls, collectCalls(f.Src, []*pyStmt{{Tokens: st.Tokens, Line: st.Line}})...)
+			extractModule(f, st.Body)
+		default:
+			if name, ok := assignmentTarget(st); ok {
+				m.Globals = append(m.Globals, PyVariable{Name: name, Line: st.Line})
+			}
+			m.Calls = append(m.Calls, collectCalls(f.Src, []*pyStmt{st})...)
+		}
+		decorators = nil
+	}
+}
+
+// parseFunction builds a function from a def statement. prefix is the enclosing class, if any.
+func parseFunction(f *pyFile, st *pyStmt, decorators []PyDecorator, prefix string) PyFunction {
+	toks := st.Tokens
+	fn := PyFunction{Line: st.Line, EndLine: st.EndLine, Decorators: decorators, Params: []string{}, body: st.Body}
+	if len(decorators) > 0 {
+		fn.Line = decorators[0].Line
+	}
+	k := 0
+	if toks[0].Value == "async" {
+		fn.Async = true
+		k = 1
+	}
+	if k+1 < len(toks) {
+		fn.Name = toks[k+1].Value
+	}
+	fn.Qualname = fn.Name
+	if prefix != "" {
+		fn.Qualname = prefix + "." + fn.Name
+	}
+
+	// Parameters are the top-level names of the argument list
+	if open := indexOp(toks, "(", k); open >= 0 {
+		for _, arg := range splitArgs(f.Src, toks, open) {
+			name := strings.TrimLeft(strings.TrimSpace(arg.Value), "*")
+			if arg.Name != "" {
+				name = arg.Name
+			}
+			if cut := strings.IndexAny(name, ":= "); cut >= 0 {
+				name = name[:cut]
+			}
+			if name != "" && name != "/" {
+				fn.Params = append(fn.Params, name)
+			}
+		}
+	}
+
+	fn.Docstring = docstring(st.Body)
+	body := st.Body
+	if len(body) == 0 {
+		// One-line function: def f(): return x
+		if colon := lastTopLevelColon(toks); colon >= 0 && colon+1 < len(toks) {
+			body = []*pyStmt{{Tokens: toks[colon+1:], Line: st.Line, EndLine: st.EndLine}}
+			fn.body = body
+		}
+	}
+	fn.Calls = collectCalls(f.Src, body)
+	return fn
+}
+
+// parseClass builds a class with its methods and attributes
+func parseClass(f *pyFile, st *pyStmt, decorators []PyDecorator) PyClass {
+	toks := st.Tokens
+	c := PyClass{Line: st.Line, EndLine: st.EndLine, Decorators: decorators, Methods: []PyFunction{}}
+	if len(decorators) > 0 {
+		c.Line = decorators[0].Line
+	}
+	if len(toks) > 1 {
+		c.Name = toks[1].Value
+	}
+	if open := indexOp(toks, "(", 1); open == 2 {
+		for _, arg := range splitArgs(f.Src, toks, open) {
+			if arg.Name == "" {
+				c.Bases = append(c.Bases, strings.TrimSpace(arg.Value))
+			}
+		}
+	}
+	c.Docstring = docstring(st.Body)
+
+	var methodDecorators []PyDecorator
+	for _, b := range st.Body {
+		switch b.keyword() {
+		case "@":
+			methodDecorators = append(methodDecorators, parseDecorator(f.Src, b))
+			continue
+		case "def":
+			c.Methods = append(c.Methods, parseFunction(f, b, methodDecorators, c.Name))
+		default:
+			if name, ok := assignmentTarget(b); ok {
+				c.Attributes = append(c.Attributes, PyVariable{Name: name, Line: b.Line})
+			}
+		}
+		methodDecorators = nil
+	}
+	return c
+}
+
+// parseDecorator parses "@name.attr(args)"
+func parseDecorator(src string, st *pyStmt) PyDecorator {
+	toks := st.Tokens[1:]
+	d := PyDecorator{Line: st.Line}
+	var name []string
+	k := 0
+	for ; k < len(toks); k++ {
+		if toks[k].Kind == tokName || toks[k].Value == "." {
+			name = append(name, toks[k].Value)
+			continue
+		}
+		break
+	}
+	d.Name = strings.Join(name, "")
+	if k < len(toks) && toks[k].Value == "(" {
+		d.Args = splitArgs(src, toks, k)
+	}
+	return d
+}
+
+// parseImports handles "import a.b as c, d" and "from ..x import y as z"
+func parseImports(m *PyModule, st *pyStmt) []PyImport {
+	toks := st.Tokens
+	var imports []PyImport
+
+	if toks[0].Value == "import" {
+		for _, part := range splitTopLevel(toks[1:], ",") {
+			name, alias := dottedName(part), ""
+			if as := indexValue(part, "as"); as >= 0 && as+1 < len(part) {
+				name, alias = dottedName(part[:as]), part[as+1].Value
+			}
+			imports = append(imports, PyImport{Module: name, Alias: alias, Line: st.Line})
+		}
+		return imports
+	}
+
+	// from [.]*module import names
+	imp := PyImport{Line: st.Line}
+	k := 1
+	for ; k < len(toks) && (toks[k].Value == "." || toks[k].Value == "..."); k++ {
+		imp.Level += len(toks[k].Value)
+	}
+	importAt := indexValue(toks, "import")
+	if importAt < 0 {
+		return nil
+	}
+	imp.Module = dottedName(toks[k:importAt])
+	if imp.Level > 0 {
+		imp.Module = resolveRelative(m, imp.Level, imp.Module)
+	}
+	for _, part := range splitTopLevel(toks[importAt+1:], ",") {
+		var names []pyToken
+		for _, t := range part {
+			if t.Value != "(" && t.Value != ")" {
+				names = append(names, t)
+			}
+		}
+		if len(names) == 0 {
+			continue
+		}
+		imp.Names = append(imp.Names, names[0].Value)
+	}
+	return append(imports, imp)
+}
+
+// resolveRelative turns a relative import into an absolute module name
+func resolveRelative(m *PyModule, level int, name string) string {
+	parts := strings.Split(m.Name, ".")
+	if !m.Package {
+		parts = parts[:len(parts)-1]
+	}
+	if level-1 <= len(parts) {
+		parts = parts[:len(parts)-(level-1)]
+	} else {
+		parts = nil
+	}
+	if name != "" {
+		parts = append(parts, name)
+	}
+	return strings.Trim(strings.Join(parts, "."), ".")
+}
+
+// assignmentTarget returns NAME for statements of the form "NAME = ..." or "NAME: T = ..."
+func assignmentTarget(st *pyStmt) (string, bool) {
+	toks := st.Tokens
+	if len(toks) < 2 || toks[0].Kind != tokName || isPyKeyword(toks[0].Value) {
+		return "", false
+	}
+	switch toks[1].Value {
+	case "=", ":", "+=", "|=":
+		return toks[0].Value, true
+	}
+	return "", false
+}
+
+// collectCalls finds call expressions in a block, descending into nested blocks
+func collectCalls(src string, body []*pyStmt) []PyCall {
+	var calls []PyCall
+	for _, st := range body {
+		toks := st.Tokens
+		for k := 0; k < len(toks); k++ {
+			if toks[k].Value != "(" || k == 0 || toks[k].Kind != tokOp {
+				continue
+			}
+			prev := toks[k-1]
+			if prev.Kind != tokName || isPyKeyword(prev.Value) {
+				continue
+			}
+			if k >= 2 && toks[k-2].Value == "def" || k >= 2 && toks[k-2].Value == "class" {
+				continue
+			}
+			start := k - 1
+			for start >= 2 && toks[start-1].Value == "." && toks[start-2].Kind == tokName {
+				start -= 2
+			}
+			name := joinValues(toks[start:k])
+			if start >= 1 && toks[start-1].Value == "." {
+				// Chained call on an expression, e.g. get_db().cursor()
+				name = "." + name
+			}
+			calls = append(calls, PyCall{Name: name, Args: splitArgs(src, toks, k), Line: toks[k].Line})
+		}
+		calls = append(calls, collectCalls(src, st.Body)...)
+	}
+	return calls
+}
+
+// splitArgs splits the bracketed argument list opening at toks[open] into arguments
+func splitArgs(src string, toks []pyToken, open int) []PyArg {
+	closeAt := matchingBracket(toks, open)
+	if closeAt < 0 {
+		closeAt = len(toks)
+	}
+	var args []PyArg
+	for _, part := range splitTopLevel(toks[open+1:closeAt], ",") {
+		if len(part) == 0 {
+			continue
+		}
+		arg := PyArg{}
+		if len(part) > 2 && part[0].Kind == tokName && part[1].Value == "=" {
+			arg.Name = part[0].Value
+			part = part[2:]
+		}
+		arg.Value = src[part[0].Pos:part[len(part)-1].End]
+		args = append(args, arg)
+	}
+	return args
+}
+
+// matchingBracket returns the index of the bracket closing toks[open]
+func matchingBracket(toks []pyToken, open int) int {
+	depth := 0
+	for k := open; k < len(toks); k++ {
+		if toks[k].Kind != tokOp {
+			continue
+		}
+		switch toks[k].Value {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+			if depth == 0 {
+				return k
+			}
+		}
+	}
+	return -1
+}
+
+// splitTopLevel splits tokens on sep outside of brackets
+func splitTopLevel(toks []pyToken, sep string) [][]pyToken {
+	var (
+		parts [][]pyToken
+		cur   []pyToken
+		depth int
+	)
+	for _, t := range toks {
+		if t.Kind == tokOp {
+			switch t.Value {
+			case "(", "[", "{":
+				depth++
+			case ")", "]", "}":
+				depth--
+			}
+			if depth == 0 && t.Value == sep {
+				parts = append(parts, cur)
+				cur = nil
+				continue
+			}
+		}
+		cur = append(cur, t)
+	}
+	if len(cur) > 0 {
+		parts = append(parts, cur)
+	}
+	return parts
+}
+
+// lastTopLevelColon returns the index of the colon ending a compound statement header
+func lastTopLevelColon(toks []pyToken) int {
+	depth := 0
+	for k, t := range toks {
+		if t.Kind != tokOp {
+			continue
+		}
+		switch t.Value {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+		case ":":
+			if depth == 0 {
+				return k
+			}
+		}
+	}
+	return -1
+}
+
+func indexOp(toks []pyToken, op string, from int) int {
+	for k := from; k < len(toks); k++ {
+		if toks[k].Kind == tokOp && toks[k].Value == op {
+			return k
+		}
+	}
+	return -1
+}
+
+func indexValue(toks []pyToken, v string) int {
+	for k, t := range toks {
+		if t.Value == v && t.Kind != tokString {
+			return k
+		}
+	}
+	return -1
+}
+
+// dottedName joins name and dot tokens, ignoring anything else
+func dottedName(toks []pyToken) string {
+	var sb strings.Builder
+	for _, t := range toks {
+		if t.Kind == tokName || t.Value == "." {
+			sb.WriteString(t.Value)
+		}
+	}
+	return sb.String()
+}
+
+func joinValues(toks []pyToken) string {
+	var sb strings.Builder
+	for _, t := range toks {
+		sb.WriteString(t.Value)
+	}
+	return sb.String()
+}
+
+var pyKeywords = map[string]bool{
+	"False": true, "None": true, "True": true, "and": true, "as": true, "assert": true,
+	"async": true, "await": true, "break": true, "class": true, "continue": true,
+	"def": true, "del": true, "elif": true, "else": true, "except": true, "finally": true,
+	"for": true, "from": true, "global": true, "if": true, "import": true, "in": true,
+	"is": true, "lambda": true, "nonlocal": true, "not": true, "or": true, "pass": true,
+	"raise": true, "return": true, "try": true, "while": true, "with": true, "yield": true,
+}
+
+func isPyKeyword(s string) bool {
+	return pyKeywords[s]
+}
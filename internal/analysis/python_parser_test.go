@@ -0,0 +1,84 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePythonFunctions(t *testing.T) {
+	tests := []struct {
+		name       string
+		src        string
+		functions  []string // qualnames of the module functions
+		decorators []string // decorator names of the first function
+		params     []string // params of the first function
+		calls      []string // call names of the first function
+	}{
+		{
+			name:       "decorators with arguments",
+			src:        "@app.route(\"/x\", methods=[\"GET\"])\n@login_required\ndef index(a, b=1, *args, **kw):\n    return render_template(\"i.html\")\n",
+			functions:  []string{"index"},
+			decorators: []string{"app.route", "login_required"},
+			params:     []string{"a", "b", "args", "kw"},
+			calls:      []string{"render_template"},
+		},
+		{
+			name:      "nested def belongs to its outer function",
+			src:       "def outer(x):\n    def inner():\n        return helper(x)\n    return inner()\n\ndef after():\n    pass\n",
+			functions: []string{"outer", "after"},
+			params:    []string{"x"},
+			calls:     []string{"helper", "inner"},
+		},
+		{
+			name:      "f-string with nested quotes and braces",
+			src:       "def show(a):\n    msg = f\"{a['k']} {a!r:>{10}} }}\"\n    return log(msg)\n\nasync def later():\n    pass\n",
+			functions: []string{"show", "later"},
+			params:    []string{"a"},
+			calls:     []string{"log"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := parsePython("pkg/mod.py", tt.src).Module
+			var functions []string
+			for _, fn := range m.Functions {
+				functions = append(functions, fn.Qualname)
+			}
+			if !reflect.DeepEqual(functions, tt.functions) {
+				t.Fatalf("functions = %v, want %v", functions, tt.functions)
+			}
+			fn := m.Functions[0]
+			var decorators, calls []string
+			for _, d := range fn.Decorators {
+				decorators = append(decorators, d.Name)
+			}
+			for _, c := range fn.Calls {
+				calls = append(calls, c.Name)
+			}
+			if !reflect.DeepEqual(decorators, tt.decorators) {
+				t.Errorf("decorators = %v, want %v", decorators, tt.decorators)
+			}
+			if !reflect.DeepEqual(fn.Params, tt.params) {
+				t.Errorf("params = %v, want %v", fn.Params, tt.params)
+			}
+			if !reflect.DeepEqual(calls, tt.calls) {
+				t.Errorf("calls = %v, want %v", calls, tt.calls)
+			}
+		})
+	}
+}
+
+func TestParsePythonClass(t *testing.T) {
+	src := "class C(Base):\n    \"\"\"A class.\"\"\"\n    x = 1\n\n    @staticmethod\n    async def m(self):\n        pass\n"
+	m := parsePython("pkg/mod.py", src).Module
+	if len(m.Classes) != 1 {
+		t.Fatalf("got %d classes, want 1", len(m.Classes))
+	}
+	c := m.Classes[0]
+	if c.Docstring != "A class." || !reflect.DeepEqual(c.Bases, []string{"Base"}) {
+		t.Errorf("class = %+v", c)
+	}
+	if len(c.Methods) != 1 || c.Methods[0].Qualname != "C.m" || !c.Methods[0].Async || c.Methods[0].Decorators[0].Name != "staticmethod" {
+		t.Errorf("methods = %+v", c.Methods)
+	}
+}
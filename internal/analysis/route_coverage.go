@@ -0,0 +1,127 @@
+package analysis
+
+import (
+	"fmt"
+	"lcma/internal/config"
+	"lcma/internal/utils"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// chiRoutePattern matches chi registrations such as r.Get("/users/{id}", h) and
+// r.Method("GET", "/x", h)
+var chiRoutePattern = regexp.MustCompile(`\.(Get|Post|Put|Patch|Delete|Head|Options|Connect|Trace|Handle|HandleFunc|Method|MethodFunc)\(\s*(?:"([A-Z]+)"\s*,\s*)?"([^"]*)"`)
+
+// chiGroupPattern matches r.Route("/prefix", ...) and r.Mount("/prefix", ...)
+var chiGroupPattern = regexp.MustCompile(`\.(?:Route|Mount)\(\s*"([^"]*)"`)
+
+var chiParamPattern = regexp.MustCompile(`\{[^}]*\}`)
+
+// flaskPathParam is a Flask <path:name> parameter, which like chi's * matches the rest of the URL
+var flaskPathParam = regexp.MustCompile(`<path:[A-Za-z_]\w*>`)
+
+// RouteCoverage is the result of checking the generated router against the route inventory
+type RouteCoverage struct {
+	Missing    []Route  `json:"missing"`
+	Registered []string `json:"registered"`
+}
+
+// CheckRouteCoverage compares the routes registered in report_code.md with the
+// legacy route inventory and writes route_coverage.md. chi sub-routers are
+// matched leniently: a registration covers a legacy path when the path ends
+// with it and a Route/Mount prefix in the report accounts for the rest.
+func CheckRouteCoverage(p *Project) (*RouteCoverage, error) {
+	data, err := os.ReadFile(filepath.Join(config.ReportPath, "report_code.md"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read generated code report: %w", err)
+	}
+	code := string(data)
+
+	registered := map[string]bool{}
+	for _, m := range chiRoutePattern.FindAllStringSubmatch(code, -1) {
+		method := strings.ToUpper(m[1])
+		switch m[1] {
+		case "Handle", "HandleFunc":
+			method = "*"
+		case "Method", "MethodFunc":
+			method = m[2]
+		}
+		registered[method+" "+normalizeRoutePath(m[3])] = true
+	}
+	prefixes := map[string]bool{"": true}
+	for _, m := range chiGroupPattern.FindAllStringSubmatch(code, -1) {
+		prefixes[normalizeRoutePath(m[1])] = true
+	}
+
+	cov := &RouteCoverage{Missing: []Route{}, Registered: sortedKeys(registered)}
+	expected := 0
+	for _, r := range p.Routes {
+		// Routes the legacy app never serves are left out on purpose
+		if p.DeadCode.Dropped(r) {
+			continue
+		}
+		expected++
+		if !routeCovered(r, registered, prefixes) {
+			cov.Missing = append(cov.Missing, r)
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("# Route Coverage\n\n")
+	fmt.Fprintf(&sb, "%d of %d legacy routes are registered in the generated router.", expected-len(cov.Missing), expected)
+	if dropped := len(p.Routes) - expected; dropped > 0 {
+		fmt.Fprintf(&sb, " %d routes the legacy app never serves are not expected, see dead_code.md.", dropped)
+	}
+	sb.WriteString("\n")
+	if len(cov.Missing) > 0 {
+		sb.WriteString("\n| Methods | Path | Handler | File |\n|---|---|---|---|\n")
+		for _, r := range cov.Missing {
+			fmt.Fprintf(&sb, "| %s | `%s` | %s | %s:%d |\n", strings.Join(r.Methods, ", "), r.Path, r.Handler, r.File, r.Line)
+		}
+	}
+	if err := utils.WriteReportFile("route_coverage.md", []byte(sb.String())); err != nil {
+		return nil, err
+	}
+	return cov, nil
+}
+
+// routeCovered reports whether every method of a legacy route is registered
+func routeCovered(r Route, registered, prefixes map[string]bool) bool {
+	path := normalizeRoutePath(r.Path)
+	for _, method := range r.Methods {
+		found := false
+		for prefix := range prefixes {
+			if !strings.HasPrefix(path, prefix) {
+				continue
+			}
+			rest := normalizeRoutePath(strings.TrimPrefix(path, prefix))
+			if registered[method+" "+rest] || registered["* "+rest] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeRoutePath turns Flask <conv:name> and chi {name:regex} parameters into {},
+// Flask <path:name> into chi's * wildcard, and drops the trailing slash so
+// equivalent paths compare equal
+func normalizeRoutePath(p string) string {
+	p = flaskPathParam.ReplaceAllString(p, "*")
+	p = urlParamPattern.ReplaceAllString(p, "{}")
+	p = chiParamPattern.ReplaceAllString(p, "{}")
+	p = strings.TrimSuffix(p, "/*")
+	if p != "/" {
+		p = strings.TrimSuffix(p, "/")
+	}
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return p
+}
@@ -0,0 +1,20 @@
+package analysis
+
+import "testing"
+
+func TestNormalizeRoutePath(t *testing.T) {
+	tests := []struct{ flask, chi string }{
+		{"/users/<int:user_id>", "/users/{userID}"},
+		{"/users/<username>/", "/users/{username}"},
+		{"/legacy/<path:p>", "/legacy/*"},
+		{"/static/<path:filename>", "/static/*"},
+		{"/files/<re('[a-z]+'):name>", "/files/{name:[a-z]+}"},
+		{"/", "/"},
+		{"orders", "/orders/"},
+	}
+	for _, tt := range tests {
+		if a, b := normalizeRoutePath(tt.flask), normalizeRoutePath(tt.chi); a != b {
+			t.Errorf("normalizeRoutePath(%q) = %q, normalizeRoutePath(%q) = %q, want equal", tt.flask, a, tt.chi, b)
+		}
+	}
+}
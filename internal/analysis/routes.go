@@ -0,0 +1,483 @@
+package analysis
+
+import (
+	"fmt"
+	"lcma/internal/utils"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Route is an endpoint registered with a Flask app or blueprint
+type Route struct {
+	Path      string     `json:"path"` // full URL rule including blueprint prefixes
+	Rule      string     `json:"rule"` // URL rule as written in the decorator
+	Methods   []string   `json:"methods"`
+	Endpoint  string     `json:"endpoint"`
+	Handler   string     `json:"handler"`
+	Module    string     `json:"module"`
+	File      string     `json:"file"`
+	Line      int        `json:"line"`
+	Blueprint string     `json:"blueprint,omitempty"`
+	Params    []URLParam `json:"params,omitempty"`
+	Templates []string   `json:"templates,omitempty"`
+	Redirects []string   `json:"redirects,omitempty"`
+	URLFor    []string   `json:"url_for,omitempty"`
+}
+
+// URLParam is a variable part of a URL rule such as <int:id>
+type URLParam struct {
+	Name      string `json:"name"`
+	Converter string `json:"converter"`
+}
+
+// RouteInventory is the layout of routes.json
+type RouteInventory struct {
+	Routes []Route `json:"routes"`
+	// UnresolvedURLFor lists url_for targets that match no known endpoint
+	UnresolvedURLFor []string `json:"unresolved_url_for"`
+}
+
+// flaskApp is a Flask() or Blueprint() object assigned to a variable, at module
+// level or inside an app factory
+type flaskApp struct {
+	Var       string
+	Module    string
+	Blueprint string // blueprint name; empty for the application
+	Prefix    string
+}
+
+// routeMethodDecorators are the Flask 2 shortcuts for route(methods=[...])
+var routeMethodDecorators = map[string]string{
+	"get": "GET", "post": "POST", "put": "PUT", "patch": "PATCH", "delete": "DELETE",
+}
+
+var urlParamPattern = regexp.MustCompile(`<(?:([A-Za-z_]\w*)(?:\([^)]*\))?:)?([A-Za-z_]\w*)>`)
+
+// analyzeRoutes builds the route inventory from decorators and add_url_rule calls
+func analyzeRoutes(p *Project) error {
+	apps := findFlaskApps(p)
+	applyBlueprintPrefixes(p, apps)
+
+	var routes []Route
+	for _, m := range p.Modules {
+		// Views defined inside an app factory register on the app it creates
+		var fns []PyFunction
+		for _, fn := range m.Functions {
+			fns = append(fns, fn)
+			fns = append(fns, nestedFunctions(p.py[m.Path], fn.Qualname, fn.body)...)
+		}
+		for _, fn := range fns {
+			for _, d := range fn.Decorators {
+				if r, ok := routeFromDecorator(m, fn, d, apps); ok {
+					routes = append(routes, r)
+				}
+			}
+		}
+		for _, c := range allCalls(m) {
+			if r, ok := routeFromURLRule(p, m, c, apps); ok {
+				routes = append(routes, r)
+			}
+		}
+	}
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return strings.Join(routes[i].Methods, ",") < strings.Join(routes[j].Methods, ",")
+	})
+	if routes == nil {
+		routes = []Route{}
+	}
+	p.Routes = routes
+
+	inv := RouteInventory{Routes: routes, UnresolvedURLFor: unresolvedURLFor(routes)}
+	if err := utils.WriteReportJSON("routes.json", inv); err != nil {
+		return err
+	}
+	return utils.WriteReportFile("routes.md", []byte(routesMarkdown(inv)))
+}
+
+// findFlaskApps collects "x = Flask(...)" and "x = Blueprint(...)" assignments,
+// including those in function bodies such as create_app()
+func findFlaskApps(p *Project) []*flaskApp {
+	var apps []*flaskApp
+	for _, m := range p.Modules {
+		apps = appendFlaskApps(apps, p.py[m.Path], m, p.py[m.Path].Stmts)
+	}
+	return apps
+}
+
+func appendFlaskApps(apps []*flaskApp, f *pyFile, m *PyModule, stmts []*pyStmt) []*flaskApp {
+	for _, st := range stmts {
+		if len(st.Body) > 0 {
+			apps = appendFlaskApps(apps, f, m, st.Body)
+		}
+		name, ok := assignmentTarget(st)
+		if !ok || len(st.Tokens) < 4 || st.Tokens[1].Value != "=" {
+			continue
+		}
+		open := indexOp(st.Tokens, "(", 2)
+		if open < 0 {
+			continue
+		}
+		callee := dottedName(st.Tokens[2:open])
+		args := splitArgs(f.Src, st.Tokens, open)
+		switch callee {
+		case "Flask", "flask.Flask":
+			apps = append(apps, &flaskApp{Var: name, Module: m.Name})
+		case "Blueprint", "flask.Blueprint":
+			bp := &flaskApp{Var: name, Module: m.Name, Blueprint: name}
+			if len(args) > 0 && args[0].Name == "" {
+				if s, ok := literalString(args[0].Value); ok {
+					bp.Blueprint = s
+				}
+			}
+			if s, ok := literalString(keywordArg(args, "url_prefix")); ok {
+				bp.Prefix = s
+			}
+			apps = append(apps, bp)
+		}
+	}
+	return apps
+}
+
+// nestedFunctions returns the functions defined in a function body, at any
+// depth, named like Python's create_app.<locals>.view qualnames
+func nestedFunctions(f *pyFile, qualname string, body []*pyStmt) []PyFunction {
+	var fns []PyFunction
+	var decorators []PyDecorator
+	for _, st := range body {
+		switch st.keyword() {
+		case "@":
+			decorators = append(decorators, parseDecorator(f.Src, st))
+			continue
+		case "def":
+			fn := parseFunction(f, st, decorators, qualname+".<locals>")
+			fns = append(fns, fn)
+			fns = append(fns, nestedFunctions(f, fn.Qualname, st.Body)...)
+		case "if", "try", "with", "for", "while", "else", "elif", "except", "finally":
+			fns = append(fns, nestedFunctions(f, qualname, st.Body)...)
+		}
+		decorators = nil
+	}
+	return fns
+}
+
+// applyBlueprintPrefixes applies url_prefix from app.register_blueprint(bp, url_prefix=...)
+func applyBlueprintPrefixes(p *Project, apps []*flaskApp) {
+	for _, m := range p.Modules {
+		for _, c := range allCalls(m) {
+			if !strings.HasSuffix(c.Name, ".register_blueprint") || len(c.Args) == 0 {
+				continue
+			}
+			bp := lookupApp(apps, m, c.Args[0].Value)
+			if bp == nil || bp.Blueprint == "" {
+				continue
+			}
+			if s, ok := literalString(keywordArg(c.Args, "url_prefix")); ok {
+				bp.Prefix = s
+			}
+		}
+	}
+}
+
+// lookupApp finds the app or blueprint a reference such as "bp" or "views.bp" points to,
+// preferring one defined in the referencing module
+func lookupApp(apps []*flaskApp, from *PyModule, ref string) *flaskApp {
+	parts := strings.Split(ref, ".")
+	name := parts[len(parts)-1]
+	qualifier := ""
+	if len(parts) > 1 {
+		qualifier = parts[len(parts)-2]
+	}
+	// from views import bp makes views the qualifier of a bare reference
+	if qualifier == "" {
+		for _, imp := range from.Imports {
+			if containsString(imp.Names, name) {
+				qualifier = imp.Module
+			}
+		}
+	}
+	var found *flaskApp
+	for _, a := range apps {
+		if a.Var != name {
+			continue
+		}
+		switch {
+		case qualifier == "" && a.Module == from.Name:
+			return a
+		case qualifier != "" && (a.Module == qualifier || strings.HasSuffix(a.Module, "."+qualifier)):
+			return a
+		case found == nil:
+			found = a
+		}
+	}
+	return found
+}
+
+func routeFromDecorator(m *PyModule, fn PyFunction, d PyDecorator, apps []*flaskApp) (Route, bool) {
+	dot := strings.LastIndex(d.Name, ".")
+	if dot < 0 || len(d.Args) == 0 {
+		return Route{}, false
+	}
+	obj, method := d.Name[:dot], d.Name[dot+1:]
+	app := lookupApp(apps, m, obj)
+
+	var methods []string
+	switch {
+	case method == "route":
+		methods = literalStrings(keywordArg(d.Args, "methods"))
+	case routeMethodDecorators[method] != "" && app != nil:
+		methods = []string{routeMethodDecorators[method]}
+	default:
+		return Route{}, false
+	}
+	rule, ok := literalString(positionalArg(d.Args, 0, "rule"))
+	if !ok {
+		return Route{}, false
+	}
+
+	r := newRoute(m, app, rule, methods, keywordArg(d.Args, "endpoint"), fn.Name)
+	r.Handler = fn.Qualname
+	r.Line = d.Line
+	addHandlerTargets(&r, fn.Calls)
+	return r, true
+}
+
+// routeFromURLRule handles app.add_url_rule("/x", "endpoint", view_func)
+func routeFromURLRule(p *Project, m *PyModule, c PyCall, apps []*flaskApp) (Route, bool) {
+	if !strings.HasSuffix(c.Name, ".add_url_rule") {
+		return Route{}, false
+	}
+	rule, ok := literalString(positionalArg(c.Args, 0, "rule"))
+	if !ok {
+		return Route{}, false
+	}
+	view := positionalArg(c.Args, 2, "view_func")
+	app := lookupApp(apps, m, strings.TrimSuffix(c.Name, ".add_url_rule"))
+
+	r := newRoute(m, app, rule, literalStrings(keywordArg(c.Args, "methods")), positionalArg(c.Args, 1, "endpoint"), view)
+	r.Handler = view
+	r.Line = c.Line
+	for _, fn := range p.functions() {
+		if fn.Name == view || strings.HasSuffix(view, "."+fn.Name) {
+			addHandlerTargets(&r, fn.Calls)
+			break
+		}
+	}
+	return r, true
+}
+
+func newRoute(m *PyModule, app *flaskApp, rule string, methods []string, endpointArg, fallback string) Route {
+	if len(methods) == 0 {
+		methods = []string{"GET"}
+	}
+	for i := range methods {
+		methods[i] = strings.ToUpper(methods[i])
+	}
+	sort.Strings(methods)
+
+	r := Route{Rule: rule, Path: rule, Methods: methods, Module: m.Name, File: m.Path}
+	r.Endpoint = fallback
+	if s, ok := literalString(endpointArg); ok {
+		r.Endpoint = s
+	}
+	if app != nil && app.Blueprint != "" {
+		r.Blueprint = app.Blueprint
+		r.Endpoint = app.Blueprint + "." + r.Endpoint
+		r.Path = joinURL(app.Prefix, rule)
+	}
+	for _, match := range urlParamPattern.FindAllStringSubmatch(rule, -1) {
+		conv := match[1]
+		if conv == "" {
+			conv = "string"
+		}
+		r.Params = append(r.Params, URLParam{Name: match[2], Converter: conv})
+	}
+	return r
+}
+
+// addHandlerTargets records the templates, redirects and url_for targets of a view
+func addHandlerTargets(r *Route, calls []PyCall) {
+	for _, c := range calls {
+		switch lastSegment(c.Name) {
+		case "render_template":
+			if s, ok := literalString(positionalArg(c.Args, 0, "template_name_or_list")); ok {
+				r.Templates = appendUnique(r.Templates, s)
+			}
+		case "redirect":
+			target := positionalArg(c.Args, 0, "location")
+			if s, ok := literalString(target); ok {
+				target = s
+			} else if ep, ok := urlForTarget(target); ok {
+				target = "url_for:" + ep
+			}
+			if target != "" {
+				r.Redirects = appendUnique(r.Redirects, target)
+			}
+		case "url_for":
+			if s, ok := literalString(positionalArg(c.Args, 0, "endpoint")); ok {
+				r.URLFor = appendUnique(r.URLFor, s)
+			}
+		}
+	}
+}
+
+// urlForTarget returns the endpoint of an expression such as url_for("main.index", id=1)
+func urlForTarget(expr string) (string, bool) {
+	toks := tokenizePython(expr)
+	open := indexOp(toks, "(", 0)
+	if open < 1 || lastSegment(dottedName(toks[:open])) != "url_for" {
+		return "", false
+	}
+	args := splitArgs(expr, toks, open)
+	return literalString(positionalArg(args, 0, "endpoint"))
+}
+
+// unresolvedURLFor returns url_for targets that match no endpoint. Blueprint-relative
+// targets (".index") are resolved against the blueprint of the calling view.
+func unresolvedURLFor(routes []Route) []string {
+	endpoints := map[string]bool{}
+	for _, r := range routes {
+		endpoints[r.Endpoint] = true
+	}
+	missing := map[string]bool{}
+	for _, r := range routes {
+		for _, target := range r.URLFor {
+			if strings.HasPrefix(target, ".") {
+				target = r.Blueprint + target
+			}
+			if target == "static" || strings.HasSuffix(target, ".static") || endpoints[target] {
+				continue
+			}
+			missing[fmt.Sprintf("%s:%d %s", r.File, r.Line, target)] = true
+		}
+	}
+	return sortedKeys(missing)
+}
+
+func routesMarkdown(inv RouteInventory) string {
+	var sb strings.Builder
+	sb.WriteString("# Route Inventory\n\n")
+	if len(inv.Routes) == 0 {
+		sb.WriteString("No Flask routes were found in the legacy code.\n")
+		return sb.String()
+	}
+	fmt.Fprintf(&sb, "%d routes extracted from `@route` decorators and `add_url_rule` calls.\n\n", len(inv.Routes))
+	sb.WriteString("| Methods | Path | Endpoint | Handler | File | Templates | Redirects |\n")
+	sb.WriteString("|---|---|---|---|---|---|---|\n")
+	for _, r := range inv.Routes {
+		fmt.Fprintf(&sb, "| %s | `%s` | %s | %s | %s:%d | %s | %s |\n",
+			strings.Join(r.Methods, ", "), r.Path, r.Endpoint, r.Handler, r.File, r.Line,
+			strings.Join(r.Templates, ", "), strings.Join(r.Redirects, ", "))
+	}
+	if len(inv.UnresolvedURLFor) > 0 {
+		sb.WriteString("\n## Unresolved url_for targets\n\n")
+		for _, u := range inv.UnresolvedURLFor {
+			fmt.Fprintf(&sb, "- %s\n", u)
+		}
+	}
+	return sb.String()
+}
+
+// allCalls returns the module-level and function-level calls of a module
+func allCalls(m *PyModule) []PyCall {
+	calls := append([]PyCall{}, m.Calls...)
+	for _, fn := range m.Functions {
+		calls = append(calls, fn.Calls...)
+	}
+	return calls
+}
+
+// functions returns every function and method of the project
+func (p *Project) functions() []PyFunction {
+	var fns []PyFunction
+	for _, m := range p.Modules {
+		fns = append(fns, m.Functions...)
+		for _, c := range m.Classes {
+			fns = append(fns, c.Methods...)
+		}
+	}
+	return fns
+}
+
+// positionalArg returns the n-th positional argument or the keyword argument name
+func positionalArg(args []PyArg, n int, name string) string {
+	pos := 0
+	for _, a := range args {
+		if a.Name == "" {
+			if pos == n {
+				return a.Value
+			}
+			pos++
+		}
+	}
+	return keywordArg(args, name)
+}
+
+// keywordArg returns the value of a keyword argument
+func keywordArg(args []PyArg, name string) string {
+	for _, a := range args {
+		if a.Name == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// literalString returns the value of a plain string literal expression, including
+// implicitly concatenated literals. f-strings are not literals.
+func literalString(expr string) (string, bool) {
+	var sb strings.Builder
+	found := false
+	for _, t := range tokenizePython(expr) {
+		switch t.Kind {
+		case tokString:
+			if isFString(t.Value) {
+				return "", false
+			}
+			sb.WriteString(stringLiteralValue(t.Value))
+			found = true
+		case tokNewline, tokEOF:
+		case tokOp:
+			if t.Value != "(" && t.Value != ")" {
+				return "", false
+			}
+		default:
+			return "", false
+		}
+	}
+	return sb.String(), found
+}
+
+// literalStrings returns the string literals of a list or tuple expression
+func literalStrings(expr string) []string {
+	var out []string
+	for _, t := range tokenizePython(expr) {
+		if t.Kind == tokString && !isFString(t.Value) {
+			out = append(out, stringLiteralValue(t.Value))
+		}
+	}
+	return out
+}
+
+func joinURL(prefix, rule string) string {
+	if prefix == "" {
+		return rule
+	}
+	return strings.TrimRight(prefix, "/") + "/" + strings.TrimLeft(rule, "/")
+}
+
+func lastSegment(name string) string {
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
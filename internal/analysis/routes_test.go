@@ -0,0 +1,54 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFactoryRoutes(t *testing.T) {
+	src := `from flask import Flask
+
+
+def create_app():
+    app = Flask(__name__)
+    if True:
+        bp = Blueprint("admin", __name__, url_prefix="/admin")
+
+    @app.route("/health")
+    def health():
+        return "ok"
+
+    @bp.get("/users")
+    def users():
+        return "users"
+
+    app.add_url_rule("/about", "about", about)
+    app.register_blueprint(bp)
+    return app
+`
+	f := parsePython("app/__init__.py", src)
+	p := &Project{Modules: []*PyModule{f.Module}, py: map[string]*pyFile{f.Path: f}}
+
+	apps := findFlaskApps(p)
+	var vars []string
+	for _, a := range apps {
+		vars = append(vars, a.Var+"@"+a.Module+":"+a.Prefix)
+	}
+	if want := []string{"app@app:", "bp@app:/admin"}; !reflect.DeepEqual(vars, want) {
+		t.Errorf("apps = %v, want %v", vars, want)
+	}
+
+	fns := nestedFunctions(f, "create_app", f.Module.Functions[0].body)
+	var names []string
+	for _, fn := range fns {
+		names = append(names, fn.Qualname)
+	}
+	if want := []string{"create_app.<locals>.health", "create_app.<locals>.users"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("nested functions = %v, want %v", names, want)
+	}
+
+	r, ok := routeFromDecorator(f.Module, fns[1], fns[1].Decorators[0], apps)
+	if !ok || r.Path != "/admin/users" || r.Endpoint != "admin.users" || !reflect.DeepEqual(r.Methods, []string{"GET"}) {
+		t.Errorf("route = %+v, %v", r, ok)
+	}
+}
@@ -0,0 +1,90 @@
+package analysis
+
+import (
+	"fmt"
+	"lcma/internal/config"
+	"lcma/internal/utils"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	ruleIDPattern = regexp.MustCompile(`\bBR-\d{3,}\b`)
+	// goFileMarker matches the lines naming a Go file in report_code.md: headings,
+	// bold paths and path comments at the top of a code block
+	goFileMarker = regexp.MustCompile("^(?:#+\\s*|\\*\\*|//\\s*(?:[Ff]ile:\\s*)?)`?([\\w./-]+\\.go)`?")
+	goFuncDecl   = regexp.MustCompile(`^func\s+(?:\([^)]*\)\s*)?(\w+)`)
+)
+
+// RuleTrace links the business rules to the Go code citing their IDs
+type RuleTrace struct {
+	Implemented map[string][]string `json:"implemented"` // rule ID to file:function locations
+	Missing     []BusinessRule      `json:"missing"`
+}
+
+// CheckRuleTraceability finds the `// BR-001` markers in report_code.md and
+// writes business_rules_trace.md with the Go code implementing each business
+// rule and the rules nothing cites
+func CheckRuleTraceability(p *Project) (*RuleTrace, error) {
+	data, err := os.ReadFile(filepath.Join(config.ReportPath, "report_code.md"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read generated code report: %w", err)
+	}
+	lines := strings.Split(string(data), "\n")
+
+	trace := &RuleTrace{Implemented: map[string][]string{}, Missing: []BusinessRule{}}
+	file, fn := "", ""
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if m := goFileMarker.FindStringSubmatch(trimmed); m != nil {
+			file, fn = m[1], ""
+		}
+		if m := goFuncDecl.FindStringSubmatch(trimmed); m != nil {
+			fn = m[1]
+		}
+		ids := ruleIDPattern.FindAllString(line, -1)
+		if len(ids) == 0 || !strings.Contains(line, "//") {
+			continue
+		}
+		// A marker above a function belongs to it; one inside a body to the enclosing function
+		owner := fn
+		for j := i + 1; j < len(lines) && j <= i+3; j++ {
+			if m := goFuncDecl.FindStringSubmatch(strings.TrimSpace(lines[j])); m != nil {
+				owner = m[1]
+				break
+			}
+		}
+		location := file
+		if owner != "" {
+			location = strings.TrimPrefix(location+":"+owner, ":")
+		}
+		for _, id := range ids {
+			trace.Implemented[id] = appendUnique(trace.Implemented[id], location)
+		}
+	}
+	for _, r := range p.Rules {
+		if len(trace.Implemented[r.ID]) == 0 {
+			trace.Missing = append(trace.Missing, r)
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("# Business rule traceability\n\n")
+	fmt.Fprintf(&sb, "%d of %d business rules are cited by a `// BR-...` comment in the generated code.\n", len(p.Rules)-len(trace.Missing), len(p.Rules))
+	if len(p.Rules) > 0 {
+		sb.WriteString("\n| ID | Kind | Rule | Legacy | Go |\n|---|---|---|---|---|\n")
+		for _, r := range p.Rules {
+			goCode := "not implemented"
+			if locs := trace.Implemented[r.ID]; len(locs) > 0 {
+				goCode = strings.Join(locs, ", ")
+			}
+			fmt.Fprintf(&sb, "| %s | %s | %s | %s:%d | %s |\n", r.ID, r.Kind, markdownCell(r.Description), r.File, r.Line, goCode)
+		}
+	}
+	if err := utils.WriteReportFile("business_rules_trace.md", []byte(sb.String())); err != nil {
+		return nil, err
+	}
+	return trace, nil
+}
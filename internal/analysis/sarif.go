@@ -0,0 +1,131 @@
+package analysis
+
+import "strings"
+
+// sarifLog is a SARIF 2.1.0 log, the format code scanning tools import
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string            `json:"id"`
+	Name                 string            `json:"name"`
+	ShortDescription     sarifMessage      `json:"shortDescription"`
+	Help                 sarifMessage      `json:"help"`
+	DefaultConfiguration sarifRuleConfig   `json:"defaultConfiguration"`
+	Properties           sarifRuleProperty `json:"properties"`
+}
+
+type sarifRuleConfig struct {
+	Level string `json:"level"`
+}
+
+type sarifRuleProperty struct {
+	Tags             []string `json:"tags"`
+	SecuritySeverity string   `json:"security-severity"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifact `json:"artifactLocation"`
+	Region           sarifRegion   `json:"region"`
+}
+
+type sarifArtifact struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId"`
+}
+
+type sarifRegion struct {
+	StartLine int           `json:"startLine"`
+	Snippet   *sarifMessage `json:"snippet,omitempty"`
+}
+
+// newSARIFLog converts findings to SARIF with paths relative to the legacy source root
+func newSARIFLog(findings []SecurityFinding) sarifLog {
+	run := sarifRun{Tool: sarifTool{Driver: sarifDriver{Name: "lcma"}}, Results: []sarifResult{}}
+	index := map[string]int{}
+	for i, r := range securityRules {
+		index[r.ID] = i
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+			ID:                   r.ID,
+			Name:                 r.Title,
+			ShortDescription:     sarifMessage{Text: r.Title},
+			Help:                 sarifMessage{Text: r.Help},
+			DefaultConfiguration: sarifRuleConfig{Level: sarifLevel(r.Severity)},
+			Properties: sarifRuleProperty{
+				Tags:             []string{"security", "external/cwe/" + strings.ToLower(r.CWE)},
+				SecuritySeverity: securitySeverityScore(r.Severity),
+			},
+		})
+	}
+	for _, f := range findings {
+		result := sarifResult{
+			RuleID:    f.Rule,
+			RuleIndex: index[f.Rule],
+			Level:     sarifLevel(f.Severity),
+			Message:   sarifMessage{Text: f.Message},
+			Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifact{URI: f.File, URIBaseID: "SRCROOT"},
+				Region:           sarifRegion{StartLine: f.Line},
+			}}},
+		}
+		if f.Snippet != "" {
+			result.Locations[0].PhysicalLocation.Region.Snippet = &sarifMessage{Text: f.Snippet}
+		}
+		run.Results = append(run.Results, result)
+	}
+	return sarifLog{Schema: "https://json.schemastore.org/sarif-2.1.0.json", Version: "2.1.0", Runs: []sarifRun{run}}
+}
+
+func sarifLevel(severity string) string {
+	switch severity {
+	case "high":
+		return "error"
+	case "medium":
+		return "warning"
+	}
+	return "note"
+}
+
+// securitySeverityScore is the numeric severity code scanning uses to rank rules
+func securitySeverityScore(severity string) string {
+	switch severity {
+	case "high":
+		return "8.0"
+	case "medium":
+		return "5.0"
+	}
+	return "2.0"
+}
@@ -0,0 +1,455 @@
+package analysis
+
+import (
+	"fmt"
+	"lcma/internal/utils"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Relationship kinds
+const (
+	RelationshipForeignKey = "foreign_key" // declared with REFERENCES / FOREIGN KEY
+	RelationshipJoin       = "join"        // inferred from a join condition in a query
+)
+
+// Schema is the database model recovered from DDL and the queries in the code
+type Schema struct {
+	Tables        []*Table       `json:"tables"`
+	Relationships []Relationship `json:"relationships"`
+	Indexes       []Index        `json:"indexes"`
+	Queries       []Query        `json:"queries"`
+}
+
+// Table is a database table. Inferred tables have no DDL in the legacy code and
+// only list the columns seen in queries.
+type Table struct {
+	Name       string   `json:"name"`
+	Columns    []Column `json:"columns"`
+	PrimaryKey []string `json:"primary_key,omitempty"`
+	// Unique are the UNIQUE constraints over more than one column
+	Unique   [][]string `json:"unique,omitempty"`
+	Checks   []string   `json:"checks,omitempty"` // table CHECK expressions
+	Inferred bool       `json:"inferred,omitempty"`
+	Sources  []string   `json:"sources"`
+}
+
+// Column is a table column. Type is empty for columns of inferred tables.
+type Column struct {
+	Name       string `json:"name"`
+	Type       string `json:"type,omitempty"`
+	Nullable   bool   `json:"nullable"`
+	PrimaryKey bool   `json:"primary_key,omitempty"`
+	Unique     bool   `json:"unique,omitempty"`
+	Default    string `json:"default,omitempty"`
+	References string `json:"references,omitempty"` // table.column
+	OnDelete   string `json:"on_delete,omitempty"`  // referential action such as CASCADE
+	OnUpdate   string `json:"on_update,omitempty"`
+	Check      string `json:"check,omitempty"` // column CHECK expression
+	// AutoIncrement is set for serial, identity and AUTO_INCREMENT columns
+	AutoIncrement bool `json:"auto_increment,omitempty"`
+}
+
+// Index is a CREATE INDEX statement
+type Index struct {
+	Name    string   `json:"name,omitempty"`
+	Table   string   `json:"table"`
+	Columns []string `json:"columns"`
+	Unique  bool     `json:"unique,omitempty"`
+}
+
+// Relationship links columns of one table to another
+type Relationship struct {
+	From        string   `json:"from"`
+	FromColumns []string `json:"from_columns"`
+	To          string   `json:"to"`
+	ToColumns   []string `json:"to_columns,omitempty"`
+	Kind        string   `json:"kind"`
+	OnDelete    string   `json:"on_delete,omitempty"`
+	OnUpdate    string   `json:"on_update,omitempty"`
+	Source      string   `json:"source,omitempty"`
+}
+
+// Query is a SQL statement found in a Python string literal
+type Query struct {
+	File      string   `json:"file"`
+	Line      int      `json:"line"`
+	Function  string   `json:"function,omitempty"`
+	Handlers  []string `json:"handlers,omitempty"` // endpoints of the routes that run the query
+	Operation string   `json:"operation"`
+	Tables    []string `json:"tables"`
+	Columns   []string `json:"columns,omitempty"`
+	// Dynamic is how the SQL text is built at runtime (f-string, %-format, format,
+	// concatenation); empty for constant SQL
+	Dynamic string `json:"dynamic,omitempty"`
+	SQL     string `json:"sql"`
+}
+
+// handlerCallDepth bounds how far queries are traced through helper functions
+const handlerCallDepth = 4
+
+// sqlStartPattern recognizes string literals that are SQL rather than prose
+var sqlStartPattern = regexp.MustCompile(`(?is)^\s*(?:` +
+	`select\s.+\sfrom\s|select\s+\S+\s*$|with\s+(?:recursive\s+)?\w+\s*(?:\([^)]*\))?\s*as\s*\(|` +
+	`insert\s+(?:or\s+\w+\s+)?into\s|replace\s+into\s|update\s+\S+\s+set\s|delete\s+from\s|` +
+	`create\s+(?:or\s+replace\s+)?(?:(?:temp|temporary|unique|unlogged)\s+)?(?:table|index|view|sequence)\s|` +
+	`alter\s+table\s|drop\s+(?:table|index|view)\s)`)
+
+// sqlSignalPattern tells "SELECT name FROM users" from prose such as "Select a
+// department from the list": SQL has uppercase keywords, operators or clauses
+var sqlSignalPattern = regexp.MustCompile(`^\s*[A-Z]{4,}\s|[*=(,]|\w\.\w|%s|%\(|\?|(?i)\b(?:where|join|values|set|group\s+by|order\s+by|limit|returning)\b`)
+
+// looksLikeSQL reports whether a string literal holds a SQL statement
+func looksLikeSQL(s string) bool {
+	return sqlStartPattern.MatchString(s) && sqlSignalPattern.MatchString(s)
+}
+
+var fstringHolePattern = regexp.MustCompile(`\{[^{}]*\}`)
+
+// sqlText is SQL text with where it was found
+type sqlText struct {
+	File    string
+	Line    int
+	SQL     string
+	Dynamic string
+	Python  bool
+}
+
+// analyzeSchema builds the schema model from .sql files and SQL string literals
+func analyzeSchema(p *Project) error {
+	var texts []sqlText
+	for _, f := range p.Corpus.Files {
+		if f.Kind == utils.KindSchema {
+			texts = append(texts, sqlText{File: f.Path, Line: 1, SQL: f.Content})
+		}
+	}
+	for _, m := range p.Modules {
+		texts = append(texts, pythonSQLStrings(p.py[m.Path])...)
+	}
+
+	b := newSchemaBuilder()
+	for _, t := range texts {
+		for _, toks := range splitSQLStatements(tokenizeSQL(t.SQL)) {
+			st := parseSQL(toks)
+			source := fmt.Sprintf("%s:%d", t.File, t.Line+st.Line)
+			b.apply(st, source)
+			if t.Python && st.isDML() {
+				b.queries = append(b.queries, Query{
+					File: t.File, Line: t.Line + st.Line, Operation: st.Operation,
+					Tables: nonNil(st.Tables), Columns: st.Columns, Dynamic: t.Dynamic, SQL: tokenText(toks),
+				})
+				b.joins = append(b.joins, withSource(st.Joins, source)...)
+			}
+		}
+	}
+	p.Schema = b.build()
+	attributeQueries(p)
+
+	if err := utils.WriteReportJSON("schema.json", p.Schema); err != nil {
+		return err
+	}
+	return utils.WriteReportFile("erd.md", []byte(schemaMarkdown(p.Schema)))
+}
+
+// pythonSQLStrings returns the string literals of a Python file that hold SQL.
+// Adjacent literals are joined the way Python concatenates them.
+func pythonSQLStrings(f *pyFile) []sqlText {
+	var out []sqlText
+	toks := f.Tokens
+	for i := 0; i < len(toks); i++ {
+		if toks[i].Kind != tokString {
+			continue
+		}
+		start := i
+		var sb strings.Builder
+		dynamic := ""
+		for ; i < len(toks) && toks[i].Kind == tokString; i++ {
+			value := stringLiteralValue(toks[i].Value)
+			if isFString(toks[i].Value) {
+				value = fstringHolePattern.ReplaceAllString(value, "?")
+				dynamic = "f-string"
+			}
+			sb.WriteString(value)
+		}
+		sql := sb.String()
+		if !looksLikeSQL(sql) {
+			i--
+			continue
+		}
+
+		if dynamic == "" && i < len(toks) {
+			switch {
+			case toks[i].Value == "%" && toks[i].Kind == tokOp:
+				dynamic = "%-format"
+			case toks[i].Value == "." && i+1 < len(toks) && toks[i+1].Value == "format":
+				dynamic = "format"
+			case toks[i].Value == "+":
+				dynamic = "concatenation"
+			}
+		}
+		if dynamic == "" && start > 0 && (toks[start-1].Value == "+" || toks[start-1].Value == "+=") {
+			dynamic = "concatenation"
+		}
+		out = append(out, sqlText{File: f.Path, Line: toks[start].Line, SQL: sql, Dynamic: dynamic, Python: true})
+		i--
+	}
+	return out
+}
+
+// schemaBuilder accumulates tables across statements in corpus order
+type schemaBuilder struct {
+	tables  map[string]*Table
+	indexes []Index
+	queries []Query
+	joins   []Relationship
+}
+
+func newSchemaBuilder() *schemaBuilder {
+	return &schemaBuilder{tables: map[string]*Table{}}
+}
+
+func (b *schemaBuilder) table(name, source string) *Table {
+	key := strings.ToLower(name)
+	t, ok := b.tables[key]
+	if !ok {
+		t = &Table{Name: name, Columns: []Column{}}
+		b.tables[key] = t
+	}
+	t.Sources = appendUnique(t.Sources, source)
+	return t
+}
+
+func (b *schemaBuilder) apply(st *sqlStatement, source string) {
+	switch st.Operation {
+	case "CREATE TABLE":
+		if st.Table == nil {
+			return
+		}
+		t := b.table(st.Table.Name, source)
+		for _, c := range st.Table.Columns {
+			if t.column(c.Name) == nil {
+				t.Columns = append(t.Columns, c)
+			}
+		}
+		if len(st.Table.PrimaryKey) > 0 {
+			t.PrimaryKey = st.Table.PrimaryKey
+		}
+		t.Unique = append(t.Unique, st.Table.Unique...)
+		for _, check := range st.Table.Checks {
+			t.Checks = appendUnique(t.Checks, check)
+		}
+	case "ALTER TABLE":
+		if st.Table == nil {
+			return
+		}
+		t := b.table(st.Table.Name, source)
+		for _, a := range st.Alter {
+			switch {
+			case a.Column != nil:
+				if t.column(a.Column.Name) == nil {
+					t.Columns = append(t.Columns, *a.Column)
+				}
+			case a.Constraint != nil:
+				applyConstraint(t, a.Constraint)
+			case a.DropColumn != "":
+				for i, c := range t.Columns {
+					if strings.EqualFold(c.Name, a.DropColumn) {
+						t.Columns = append(t.Columns[:i], t.Columns[i+1:]...)
+						break
+					}
+				}
+			case a.SetDefault[0] != "":
+				if c := t.column(a.SetDefault[0]); c != nil {
+					c.Default = a.SetDefault[1]
+				}
+			}
+		}
+	case "CREATE INDEX":
+		if st.Index != nil {
+			b.indexes = append(b.indexes, *st.Index)
+		}
+	}
+}
+
+// build adds tables only known from queries and collects relationships
+func (b *schemaBuilder) build() *Schema {
+	for _, q := range b.queries {
+		for _, name := range q.Tables {
+			if _, ok := b.tables[strings.ToLower(name)]; !ok {
+				b.tables[strings.ToLower(name)] = &Table{Name: name, Columns: []Column{}, Inferred: true}
+			}
+			t := b.tables[strings.ToLower(name)]
+			if t.Inferred {
+				t.Sources = appendUnique(t.Sources, fmt.Sprintf("%s:%d", q.File, q.Line))
+			}
+		}
+		for _, qc := range q.Columns {
+			table, col, _ := strings.Cut(qc, ".")
+			t := b.tables[strings.ToLower(table)]
+			if t != nil && t.Inferred && t.column(col) == nil {
+				t.Columns = append(t.Columns, Column{Name: col, Nullable: true})
+			}
+		}
+	}
+
+	s := &Schema{Tables: []*Table{}, Relationships: []Relationship{}, Indexes: nonNil(b.indexes), Queries: nonNil(b.queries)}
+	for _, key := range sortedKeys(b.tables) {
+		s.Tables = append(s.Tables, b.tables[key])
+	}
+
+	seen := map[string]bool{}
+	relKey := func(from string, fromCols []string, to string, toCols []string) string {
+		return strings.ToLower(from + "(" + strings.Join(fromCols, ",") + ")" + to + "(" + strings.Join(toCols, ",") + ")")
+	}
+	for _, t := range s.Tables {
+		for _, c := range t.Columns {
+			if c.References == "" {
+				continue
+			}
+			to, toCol, _ := strings.Cut(c.References, ".")
+			rel := Relationship{From: t.Name, FromColumns: []string{c.Name}, To: to, Kind: RelationshipForeignKey, OnDelete: c.OnDelete, OnUpdate: c.OnUpdate}
+			if toCol != "" {
+				rel.ToColumns = []string{toCol}
+			}
+			seen[relKey(rel.From, rel.FromColumns, rel.To, rel.ToColumns)] = true
+			s.Relationships = append(s.Relationships, rel)
+		}
+	}
+	for _, j := range b.joins {
+		if seen[relKey(j.From, j.FromColumns, j.To, j.ToColumns)] || seen[relKey(j.To, j.ToColumns, j.From, j.FromColumns)] {
+			continue
+		}
+		seen[relKey(j.From, j.FromColumns, j.To, j.ToColumns)] = true
+		s.Relationships = append(s.Relationships, j)
+	}
+	return s
+}
+
+func (t *Table) column(name string) *Column {
+	for i := range t.Columns {
+		if strings.EqualFold(t.Columns[i].Name, name) {
+			return &t.Columns[i]
+		}
+	}
+	return nil
+}
+
+// attributeQueries records the enclosing function of each query and the routes
+// whose handlers reach it
+func attributeQueries(p *Project) {
+	g := p.callGraph()
+	handlersOf := map[funcRef][]string{}
+	for _, r := range p.Routes {
+		ref := funcRef{Module: r.Module, Qualname: r.Handler}
+		if _, ok := g.funcs[ref]; !ok {
+			continue
+		}
+		for _, f := range g.reachable(ref, handlerCallDepth) {
+			handlersOf[f] = appendUnique(handlersOf[f], r.Endpoint)
+		}
+	}
+
+	for i := range p.Schema.Queries {
+		q := &p.Schema.Queries[i]
+		m := p.module(q.File)
+		if m == nil {
+			continue
+		}
+		if fn := enclosingFunction(m, q.Line); fn != nil {
+			q.Function = fn.Qualname
+			q.Handlers = handlersOf[funcRef{Module: m.Name, Qualname: fn.Qualname}]
+			sort.Strings(q.Handlers)
+		}
+	}
+}
+
+func schemaMarkdown(s *Schema) string {
+	var sb strings.Builder
+	sb.WriteString("# Database Schema\n\n")
+	if len(s.Tables) == 0 {
+		sb.WriteString("No SQL schema or queries were found in the legacy code.\n")
+		return sb.String()
+	}
+	inferred := 0
+	for _, t := range s.Tables {
+		if t.Inferred {
+			inferred++
+		}
+	}
+	fmt.Fprintf(&sb, "%d tables (%d inferred from queries only), %d relationships, %d queries.\n\n",
+		len(s.Tables), inferred, len(s.Relationships), len(s.Queries))
+	sb.WriteString("```mermaid\n" + erdMermaid(s) + "```\n\n")
+
+	sb.WriteString("## Tables\n")
+	for _, t := range s.Tables {
+		fmt.Fprintf(&sb, "\n### %s\n\n", t.Name)
+		if t.Inferred {
+			sb.WriteString("No DDL found; columns are inferred from queries.\n\n")
+		}
+		sb.WriteString("| Column | Type | Constraints |\n|---|---|---|\n")
+		for _, c := range t.Columns {
+			fmt.Fprintf(&sb, "| %s | %s | %s |\n", c.Name, c.Type, markdownCell(strings.Join(c.constraints(), ", ")))
+		}
+		for _, cols := range t.Unique {
+			fmt.Fprintf(&sb, "\nUNIQUE (%s)\n", strings.Join(cols, ", "))
+		}
+		for _, check := range t.Checks {
+			fmt.Fprintf(&sb, "\nCHECK (%s)\n", check)
+		}
+	}
+
+	if len(s.Queries) > 0 {
+		sb.WriteString("\n## Queries\n\n| Handler | Function | Operation | Tables | Location | Dynamic |\n|---|---|---|---|---|---|\n")
+		for _, q := range s.Queries {
+			fmt.Fprintf(&sb, "| %s | %s | %s | %s | %s:%d | %s |\n", strings.Join(q.Handlers, ", "), q.Function,
+				q.Operation, strings.Join(q.Tables, ", "), q.File, q.Line, q.Dynamic)
+		}
+	}
+	return sb.String()
+}
+
+func (c Column) constraints() []string {
+	var out []string
+	if c.PrimaryKey {
+		out = append(out, "PK")
+	}
+	if !c.Nullable && !c.PrimaryKey {
+		out = append(out, "NOT NULL")
+	}
+	if c.Unique {
+		out = append(out, "UNIQUE")
+	}
+	if c.References != "" {
+		fk := "FK → " + c.References
+		if c.OnDelete != "" {
+			fk += " ON DELETE " + c.OnDelete
+		}
+		if c.OnUpdate != "" {
+			fk += " ON UPDATE " + c.OnUpdate
+		}
+		out = append(out, fk)
+	}
+	if c.Default != "" {
+		out = append(out, "DEFAULT "+c.Default)
+	}
+	if c.Check != "" {
+		out = append(out, "CHECK ("+c.Check+")")
+	}
+	return out
+}
+
+func withSource(rels []Relationship, source string) []Relationship {
+	for i := range rels {
+		rels[i].Source = source
+	}
+	return rels
+}
+
+// nonNil returns an empty slice instead of nil so JSON output has [] rather than null
+func nonNil[T any](list []T) []T {
+	if list == nil {
+		return []T{}
+	}
+	return list
+}
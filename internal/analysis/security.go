@@ -0,0 +1,457 @@
+package analysis
+
+import (
+	"fmt"
+	"lcma/internal/utils"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SecurityFinding is a problem found by the static security checks
+type SecurityFinding struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"` // high, medium or low
+	CWE      string `json:"cwe"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Message  string `json:"message"`
+	Snippet  string `json:"snippet,omitempty"` // source line, after redaction
+}
+
+// securityRule describes a check for the reports and SARIF rule metadata
+type securityRule struct {
+	ID       string
+	Title    string
+	CWE      string
+	Severity string // default severity
+	Help     string
+}
+
+var securityRules = []securityRule{
+	{ID: "sql-injection", Title: "SQL built with string formatting", CWE: "CWE-89", Severity: "high",
+		Help: "Pass values as query parameters instead of formatting them into the SQL text."},
+	{ID: "template-injection", Title: "render_template_string with a dynamic template", CWE: "CWE-1336", Severity: "high",
+		Help: "Render a template file and pass user input as context variables, never as template source."},
+	{ID: "missing-csrf", Title: "State-changing request without CSRF protection", CWE: "CWE-352", Severity: "medium",
+		Help: "Enable CSRF protection (Flask-WTF CSRFProtect) and include csrf_token() in every POST form."},
+	{ID: "debug-mode", Title: "Debug mode enabled", CWE: "CWE-489", Severity: "high",
+		Help: "The Werkzeug debugger executes arbitrary code; read debug settings from the environment and keep them off in production."},
+	{ID: "unsafe-deserialization", Title: "Deserialization of untrusted data", CWE: "CWE-502", Severity: "high",
+		Help: "Use JSON or yaml.safe_load; never unpickle data that crosses a trust boundary."},
+	{ID: "code-eval", Title: "eval or exec of dynamic code", CWE: "CWE-95", Severity: "high",
+		Help: "Replace eval/exec with explicit parsing such as ast.literal_eval or a lookup table."},
+	{ID: "hardcoded-credentials", Title: "Hardcoded credential", CWE: "CWE-798", Severity: "high",
+		Help: "Load secrets from the environment or a secret manager and rotate the exposed value."},
+}
+
+// securityReport is the layout of security_findings.json
+type securityReport struct {
+	Findings []SecurityFinding `json:"findings"`
+	// CSRFProtection names how the app enables CSRF protection, if it does
+	CSRFProtection string `json:"csrf_protection,omitempty"`
+}
+
+var (
+	credentialName    = regexp.MustCompile(`(?i)(password|passwd|pwd|secret|api_?key|access_?key|auth_?token|access_?token|credentials?)`)
+	debugTarget       = regexp.MustCompile(`(?i)(^|\.)debug$|\[\s*['"](flask_)?debug['"]\s*\]$`)
+	configDebug       = regexp.MustCompile(`(?im)^[ \t]*(?:export[ \t]+)?(?:FLASK_)?DEBUG[ \t]*[=:][ \t]*['"]?(?:true|1|on|yes)['"]?[ \t]*$`)
+	postFormPattern   = regexp.MustCompile(`(?is)<form\b[^>]*\bmethod\s*=\s*['"]?post\b[^>]*>`)
+	formEndPattern    = regexp.MustCompile(`(?i)</form\s*>`)
+	csrfTokenMarker   = regexp.MustCompile(`csrf_token|hidden_tag|csrf`)
+	identifierPattern = regexp.MustCompile(`^[A-Za-z_]+$`)
+	assignedLiteral   = regexp.MustCompile(`([=:]\s*)[rRbBuUfF]{0,2}(?:"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*')`)
+)
+
+// deserializers are calls that execute code or construct arbitrary objects from their input
+var deserializers = map[string]bool{
+	"pickle.load": true, "pickle.loads": true, "cPickle.load": true, "cPickle.loads": true,
+	"_pickle.load": true, "_pickle.loads": true, "pickle.Unpickler": true,
+	"dill.load": true, "dill.loads": true, "marshal.load": true, "marshal.loads": true,
+	"shelve.open": true, "jsonpickle.decode": true, "yaml.unsafe_load": true, "yaml.load": true,
+	"pandas.read_pickle": true,
+}
+
+// secretRedactions are the redaction rules that indicate a credential in the source
+var secretRedactions = map[string]bool{
+	"PRIVATE_KEY": true, "AWS_ACCESS_KEY": true, "AWS_SECRET_KEY": true, "GCP_API_KEY": true,
+	"GCP_PRIVATE_KEY_ID": true, "CONNECTION_PASSWORD": true, "HARDCODED_SECRET": true, "CONFIG_SECRET": true,
+}
+
+// analyzeSecurity runs the static security checks and writes the findings as
+// JSON, SARIF and Markdown
+func analyzeSecurity(p *Project) error {
+	s := &securityScan{p: p, seen: map[string]bool{}, lines: map[string][]string{}}
+	for _, m := range p.Modules {
+		f := p.py[m.Path]
+		s.sqlInjection(f)
+		s.pythonStatements(m, f.Stmts)
+		for _, c := range moduleCalls(m) {
+			s.call(m, c)
+		}
+	}
+	s.csrf()
+	s.configFiles()
+	s.redactedSecrets()
+
+	sort.SliceStable(s.findings, func(i, j int) bool {
+		a, b := s.findings[i], s.findings[j]
+		if severityRank(a.Severity) != severityRank(b.Severity) {
+			return severityRank(a.Severity) < severityRank(b.Severity)
+		}
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+	p.Security = s.findings
+
+	report := securityReport{Findings: nonNil(s.findings), CSRFProtection: s.csrfProtection}
+	if err := utils.WriteReportJSON("security_findings.json", report); err != nil {
+		return err
+	}
+	if err := utils.WriteReportJSON("security_findings.sarif", newSARIFLog(s.findings)); err != nil {
+		return err
+	}
+	return utils.WriteReportFile("security_findings.md", []byte(securityMarkdown(report)))
+}
+
+// securityScan collects findings, dropping repeats of a rule on the same line
+type securityScan struct {
+	p              *Project
+	findings       []SecurityFinding
+	seen           map[string]bool
+	lines          map[string][]string
+	csrfProtection string
+}
+
+func (s *securityScan) add(rule, severity, file string, line int, message string) {
+	key := fmt.Sprintf("%s:%s:%d", rule, file, line)
+	if s.seen[key] {
+		return
+	}
+	s.seen[key] = true
+	snippet := s.snippet(file, line)
+	if rule == "hardcoded-credentials" {
+		// The reports are fed to the prompts, so the credential itself is left out
+		snippet = maskAssignedLiterals(snippet)
+	}
+	s.findings = append(s.findings, SecurityFinding{
+		Rule: rule, Severity: severity, CWE: ruleByID(rule).CWE, File: file, Line: line,
+		Message: message, Snippet: snippet,
+	})
+}
+
+// snippet returns the trimmed source line of a corpus file
+func (s *securityScan) snippet(file string, line int) string {
+	lines, ok := s.lines[file]
+	if !ok {
+		for _, f := range s.p.Corpus.Files {
+			if f.Path == file {
+				lines = strings.Split(f.Content, "\n")
+				break
+			}
+		}
+		s.lines[file] = lines
+	}
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	text := strings.TrimSpace(lines[line-1])
+	if len(text) > 200 {
+		text = text[:200] + "..."
+	}
+	return text
+}
+
+// maskAssignedLiterals replaces the string literals assigned or passed in a
+// line with "<redacted>", keeping subscript keys such as config["SECRET_KEY"]
+func maskAssignedLiterals(line string) string {
+	return assignedLiteral.ReplaceAllString(line, `${1}"<redacted>"`)
+}
+
+// sqlInjection reports SQL string literals completed at runtime by formatting
+func (s *securityScan) sqlInjection(f *pyFile) {
+	for _, t := range pythonSQLStrings(f) {
+		if t.Dynamic != "" {
+			s.add("sql-injection", "high", t.File, t.Line, "SQL statement built with "+t.Dynamic+"; values reach the query text unescaped")
+		}
+	}
+}
+
+// pythonStatements checks assignments for debug flags and credentials
+func (s *securityScan) pythonStatements(m *PyModule, stmts []*pyStmt) {
+	src := s.p.py[m.Path].Src
+	for _, st := range stmts {
+		s.pythonStatements(m, st.Body)
+		eq := indexOp(st.Tokens, "=", 0)
+		// Keyword arguments inside calls are checked by call
+		if eq <= 0 || eq+1 >= len(st.Tokens) || indexOp(st.Tokens[:eq], "(", 0) >= 0 || st.keyword() == "def" || st.keyword() == "class" {
+			continue
+		}
+		target := src[st.Tokens[0].Pos:st.Tokens[eq-1].End]
+		value := src[st.Tokens[eq+1].Pos:st.Tokens[len(st.Tokens)-1].End]
+		switch {
+		case debugTarget.MatchString(target) && (value == "True" || value == "1"):
+			s.add("debug-mode", "high", m.Path, st.Line, target+" is set to "+value)
+		case credentialName.MatchString(target):
+			if v, ok := literalString(value); ok && credentialValue(v) {
+				s.add("hardcoded-credentials", "high", m.Path, st.Line, target+" is assigned a string literal")
+			}
+		}
+	}
+}
+
+// call checks a single call expression
+func (s *securityScan) call(m *PyModule, c PyCall) {
+	name := importedName(m, c.Name)
+	switch {
+	case name == "render_template_string" || strings.HasSuffix(name, ".render_template_string"):
+		tmpl := positionalArg(c.Args, 0, "source")
+		if _, ok := literalString(tmpl); ok || tmpl == "" {
+			return
+		}
+		severity, message := "medium", "render_template_string renders a template built at runtime"
+		if usesRequest(s.p.py[m.Path], m, c.Line, tmpl) {
+			severity, message = "high", "render_template_string renders a template built from request data"
+		}
+		s.add("template-injection", severity, m.Path, c.Line, message)
+
+	case strings.HasSuffix(name, "run") && keywordArg(c.Args, "debug") == "True":
+		s.add("debug-mode", "high", m.Path, c.Line, c.Name+" is called with debug=True")
+
+	case name == "config.update" || strings.HasSuffix(name, ".config.update"):
+		if v := keywordArg(c.Args, "DEBUG"); v == "True" {
+			s.add("debug-mode", "high", m.Path, c.Line, "DEBUG is set to True")
+		}
+
+	case deserializers[name]:
+		if name == "yaml.load" && s.safeYAMLLoader(m, positionalArg(c.Args, 1, "Loader")) {
+			return
+		}
+		s.add("unsafe-deserialization", "high", m.Path, c.Line, name+" can execute code embedded in its input")
+
+	case name == "eval" || name == "exec":
+		arg := positionalArg(c.Args, 0, "")
+		if _, ok := literalString(arg); ok {
+			s.add("code-eval", "low", m.Path, c.Line, name+" of a constant string")
+			return
+		}
+		severity := "medium"
+		if usesRequest(s.p.py[m.Path], m, c.Line, arg) {
+			severity = "high"
+		}
+		s.add("code-eval", severity, m.Path, c.Line, name+" of a dynamic expression")
+	}
+
+	// Keyword arguments such as connect(password="...")
+	for _, a := range c.Args {
+		if a.Name == "" || !credentialName.MatchString(a.Name) {
+			continue
+		}
+		if v, ok := literalString(a.Value); ok && credentialValue(v) {
+			s.add("hardcoded-credentials", "high", m.Path, c.Line, a.Name+" is passed as a string literal to "+c.Name)
+		}
+	}
+}
+
+// csrf reports POST forms without a CSRF token and, when the app has no CSRF
+// protection at all, every state-changing route
+func (s *securityScan) csrf() {
+	for _, m := range s.p.Modules {
+		for _, imp := range m.Imports {
+			if strings.HasPrefix(imp.Module, "flask_wtf") || strings.HasPrefix(imp.Module, "flask_seasurf") {
+				s.csrfProtection = imp.Module
+			}
+		}
+		for _, c := range moduleCalls(m) {
+			if n := lastSegment(c.Name); n == "CSRFProtect" || n == "SeaSurf" {
+				s.csrfProtection = n
+			}
+		}
+	}
+
+	for _, f := range s.p.Corpus.Files {
+		if !isTemplateFile(f.Path) {
+			continue
+		}
+		for _, loc := range postFormPattern.FindAllStringIndex(f.Content, -1) {
+			body := f.Content[loc[1]:]
+			if end := formEndPattern.FindStringIndex(body); end != nil {
+				body = body[:end[0]]
+			}
+			if csrfTokenMarker.MatchString(body) {
+				continue
+			}
+			line := strings.Count(f.Content[:loc[0]], "\n") + 1
+			if s.csrfProtection != "" {
+				s.add("missing-csrf", "low", f.Path, line, "POST form has no csrf_token(); "+s.csrfProtection+" will reject its submissions")
+			} else {
+				s.add("missing-csrf", "medium", f.Path, line, "POST form has no CSRF token")
+			}
+		}
+	}
+
+	if s.csrfProtection != "" {
+		return
+	}
+	for _, r := range s.p.Routes {
+		for _, method := range r.Methods {
+			if method == "POST" || method == "PUT" || method == "PATCH" || method == "DELETE" {
+				s.add("missing-csrf", "medium", r.File, r.Line, r.Path+" accepts "+method+" but the app has no CSRF protection")
+				break
+			}
+		}
+	}
+}
+
+// configFiles reports debug flags in .env, ini and cfg files
+func (s *securityScan) configFiles() {
+	for _, f := range s.p.Corpus.Files {
+		if f.Kind != utils.KindConfig {
+			continue
+		}
+		for _, loc := range configDebug.FindAllStringIndex(f.Content, -1) {
+			line := strings.Count(f.Content[:loc[0]], "\n") + 1
+			s.add("debug-mode", "high", f.Path, line, "debug mode is enabled in configuration")
+		}
+	}
+}
+
+// redactedSecrets turns credentials replaced during ingestion into findings
+func (s *securityScan) redactedSecrets() {
+	for _, r := range s.p.Corpus.Redactions {
+		if secretRedactions[r.Rule] {
+			s.add("hardcoded-credentials", "high", r.File, r.Line, "hardcoded "+strings.ToLower(strings.ReplaceAll(r.Rule, "_", " "))+", redacted as "+r.Placeholder)
+		}
+	}
+}
+
+// credentialValue reports whether a literal assigned to a credential-like name
+// holds a value rather than a field name or message such as "password"
+func credentialValue(v string) bool {
+	return v != "" && !(identifierPattern.MatchString(v) && credentialName.MatchString(v)) && !strings.Contains(v, " ")
+}
+
+// moduleCalls returns the calls of a module, its functions and its methods
+func moduleCalls(m *PyModule) []PyCall {
+	calls := allCalls(m)
+	for _, c := range m.Classes {
+		for _, fn := range c.Methods {
+			calls = append(calls, fn.Calls...)
+		}
+	}
+	return calls
+}
+
+// safeYAMLLoaders construct only plain Python objects
+var safeYAMLLoaders = map[string]bool{"SafeLoader": true, "CSafeLoader": true, "BaseLoader": true, "CBaseLoader": true}
+
+// safeYAMLLoader reports whether the Loader argument of yaml.load is a safe
+// loader, directly or through "from yaml import CSafeLoader as Loader"
+func (s *securityScan) safeYAMLLoader(m *PyModule, loader string) bool {
+	name := loader[strings.LastIndex(loader, ".")+1:]
+	if safeYAMLLoaders[name] {
+		return true
+	}
+	if f := s.p.py[m.Path]; f != nil && name == loader && name != "" {
+		_, original := importedAs(f.Src, name)
+		return safeYAMLLoaders[original]
+	}
+	return false
+}
+
+// importedName resolves the first segment of a call name through the module
+// imports, so "from pickle import loads" makes loads(...) pickle.loads
+func importedName(m *PyModule, name string) string {
+	head, rest, _ := strings.Cut(name, ".")
+	for _, imp := range m.Imports {
+		switch {
+		case len(imp.Names) == 0 && (imp.Alias == head || imp.Alias == "" && imp.Module == head):
+			head = imp.Module
+		case containsString(imp.Names, head):
+			head = imp.Module + "." + head
+		default:
+			continue
+		}
+		break
+	}
+	if rest == "" {
+		return head
+	}
+	return head + "." + rest
+}
+
+// usesRequest reports whether expr or the function around line reads the Flask request
+func usesRequest(f *pyFile, m *PyModule, line int, expr string) bool {
+	if strings.Contains(expr, "request.") {
+		return true
+	}
+	fn := enclosingFunction(m, line)
+	if fn == nil {
+		return false
+	}
+	for _, t := range f.Tokens {
+		if t.Line >= fn.Line && t.Line <= fn.EndLine && t.Value == "request" {
+			return true
+		}
+	}
+	return false
+}
+
+func ruleByID(id string) securityRule {
+	for _, r := range securityRules {
+		if r.ID == id {
+			return r
+		}
+	}
+	return securityRule{ID: id}
+}
+
+func severityRank(severity string) int {
+	switch severity {
+	case "high":
+		return 0
+	case "medium":
+		return 1
+	}
+	return 2
+}
+
+// securityMarkdown renders the findings for the report prompt and readers
+func securityMarkdown(report securityReport) string {
+	var sb strings.Builder
+	sb.WriteString("# Security findings\n\n")
+	counts := map[string]int{}
+	for _, f := range report.Findings {
+		counts[f.Severity]++
+	}
+	fmt.Fprintf(&sb, "%d findings: %d high, %d medium, %d low. Found by static checks; each one points at the exact line.\n",
+		len(report.Findings), counts["high"], counts["medium"], counts["low"])
+	if report.CSRFProtection != "" {
+		fmt.Fprintf(&sb, "\nCSRF protection: %s.\n", report.CSRFProtection)
+	}
+	if len(report.Findings) == 0 {
+		return sb.String()
+	}
+
+	sb.WriteString("\n| Severity | Rule | CWE | Location | Finding | Code |\n|---|---|---|---|---|---|\n")
+	for _, f := range report.Findings {
+		code := ""
+		if f.Snippet != "" {
+			code = "`" + strings.ReplaceAll(markdownCell(f.Snippet), "`", "'") + "`"
+		}
+		fmt.Fprintf(&sb, "| %s | %s | %s | %s:%d | %s | %s |\n", f.Severity, f.Rule, f.CWE, f.File, f.Line, markdownCell(f.Message), code)
+	}
+
+	sb.WriteString("\n## Remediation\n\n")
+	for _, r := range securityRules {
+		for _, f := range report.Findings {
+			if f.Rule == r.ID {
+				fmt.Fprintf(&sb, "- **%s** (%s): %s\n", r.Title, r.CWE, r.Help)
+				break
+			}
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,19 @@
+package analysis
+
+import "testing"
+
+func TestMaskAssignedLiterals(t *testing.T) {
+	tests := []struct{ line, want string }{
+		{`SECRET_KEY = "s3cr3tK3yV@lue99"`, `SECRET_KEY = "<redacted>"`},
+		{`app.config["SECRET_KEY"] = 's3cr3t'`, `app.config["SECRET_KEY"] = "<redacted>"`},
+		{`conn = connect(host="db", password="hunter2")`, `conn = connect(host="<redacted>", password="<redacted>")`},
+		{`CREDS = {"api_key": "abc\"def", "user": u}`, `CREDS = {"api_key": "<redacted>", "user": u}`},
+		{`token = b'raw'`, `token = "<redacted>"`},
+		{`password = os.environ["DB_PASSWORD"]`, `password = os.environ["DB_PASSWORD"]`},
+	}
+	for _, tt := range tests {
+		if got := maskAssignedLiterals(tt.line); got != tt.want {
+			t.Errorf("maskAssignedLiterals(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
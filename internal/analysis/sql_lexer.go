@@ -0,0 +1,242 @@
+package analysis
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Token kinds produced by the SQL lexer
+const (
+	sqlIdent = iota
+	sqlQuotedIdent
+	sqlString
+	sqlNumber
+	sqlParam
+	sqlOp
+)
+
+// sqlToken is a SQL token. Value of a quoted identifier has the quotes removed.
+type sqlToken struct {
+	Kind  int
+	Value string
+	Line  int // line within the SQL text, starting at 0
+}
+
+// is reports whether the token is one of the given keywords, ignoring case
+func (t sqlToken) is(keywords ...string) bool {
+	if t.Kind != sqlIdent {
+		return false
+	}
+	for _, kw := range keywords {
+		if strings.EqualFold(t.Value, kw) {
+			return true
+		}
+	}
+	return false
+}
+
+// copyDataPattern matches the data block of COPY ... FROM stdin in pg_dump output
+var copyDataPattern = regexp.MustCompile(`(?ms)^(COPY [^;]*FROM stdin;)\n.*?^\\\.$`)
+
+// tokenizeSQL splits SQL text into tokens, dropping comments and psql meta-commands.
+// It understands the quoting of PostgreSQL, MySQL and SQLite.
+func tokenizeSQL(src string) []sqlToken {
+	src = copyDataPattern.ReplaceAllString(src, "$1")
+
+	var toks []sqlToken
+	line := 0
+	bol := true
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			bol = true
+			i++
+			continue
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f':
+			i++
+			continue
+		case c == '\\' && bol:
+			// psql meta-command such as \connect
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			continue
+		}
+		bol = false
+
+		start := i
+		switch {
+		case c == '-' && strings.HasPrefix(src[i:], "--"), c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '/' && strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				end = len(src) - i - 4
+			}
+			line += strings.Count(src[i:i+end+4], "\n")
+			i += end + 4
+		case c == '\'':
+			i = skipSQLQuoted(src, i, '\'')
+			toks = append(toks, sqlToken{Kind: sqlString, Value: src[start:i], Line: line})
+		case (c == 'E' || c == 'e' || c == 'N' || c == 'n') && i+1 < len(src) && src[i+1] == '\'':
+			i = skipSQLQuoted(src, i+1, '\'')
+			toks = append(toks, sqlToken{Kind: sqlString, Value: src[start:i], Line: line})
+		case c == '"' || c == '`':
+			i = skipSQLQuoted(src, i, c)
+			toks = append(toks, sqlToken{Kind: sqlQuotedIdent, Value: unquoteSQLIdent(src[start:i], c), Line: line})
+		case c == '[':
+			end := strings.IndexAny(src[i:], "]\n")
+			if end <= 1 || src[i+end] != ']' {
+				i++
+				toks = append(toks, sqlToken{Kind: sqlOp, Value: "[", Line: line})
+				break
+			}
+			i += end + 1
+			toks = append(toks, sqlToken{Kind: sqlQuotedIdent, Value: src[start+1 : i-1], Line: line})
+		case c == '$' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9':
+			i++
+			for i < len(src) && src[i] >= '0' && src[i] <= '9' {
+				i++
+			}
+			toks = append(toks, sqlToken{Kind: sqlParam, Value: src[start:i], Line: line})
+		case c == '$':
+			// Dollar quoted string: $$...$$ or $tag$...$tag$
+			tagEnd := strings.IndexByte(src[i+1:], '$')
+			if tagEnd < 0 || !isSQLWord(src[i+1:i+1+tagEnd]) {
+				i++
+				toks = append(toks, sqlToken{Kind: sqlOp, Value: "$", Line: line})
+				break
+			}
+			tag := src[i : i+tagEnd+2]
+			end := strings.Index(src[i+len(tag):], tag)
+			if end < 0 {
+				i = len(src)
+			} else {
+				i += len(tag) + end + len(tag)
+			}
+			line += strings.Count(src[start:i], "\n")
+			toks = append(toks, sqlToken{Kind: sqlString, Value: src[start:i], Line: line})
+		case c == '%' && i+1 < len(src) && (src[i+1] == 's' || src[i+1] == 'd' || src[i+1] == '('):
+			// psycopg and MySQLdb placeholders: %s, %(name)s
+			if src[i+1] == '(' {
+				if end := strings.IndexByte(src[i:], ')'); end > 0 && end+1 < len(src)-i {
+					i += end + 2
+				} else {
+					i += 2
+				}
+			} else {
+				i += 2
+			}
+			toks = append(toks, sqlToken{Kind: sqlParam, Value: src[start:i], Line: line})
+		case c == '?':
+			i++
+			toks = append(toks, sqlToken{Kind: sqlParam, Value: "?", Line: line})
+		case c == ':' && i+1 < len(src) && isSQLWordStart(src[i+1]) && (i == 0 || src[i-1] != ':'):
+			i++
+			for i < len(src) && isSQLWordByte(src[i]) {
+				i++
+			}
+			toks = append(toks, sqlToken{Kind: sqlParam, Value: src[start:i], Line: line})
+		case c >= '0' && c <= '9':
+			for i < len(src) && (isSQLWordByte(src[i]) || src[i] == '.') {
+				i++
+			}
+			toks = append(toks, sqlToken{Kind: sqlNumber, Value: src[start:i], Line: line})
+		case isSQLWordStart(c):
+			for i < len(src) && isSQLWordByte(src[i]) {
+				i++
+			}
+			toks = append(toks, sqlToken{Kind: sqlIdent, Value: src[start:i], Line: line})
+		default:
+			op := string(c)
+			for _, candidate := range []string{"::", "<>", "!=", "<=", ">=", "||", "->>", "->"} {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			i += len(op)
+			toks = append(toks, sqlToken{Kind: sqlOp, Value: op, Line: line})
+		}
+	}
+	return toks
+}
+
+// skipSQLQuoted returns the index just past the quoted text starting at src[i].
+// A doubled quote is an escaped quote; backslash escapes are accepted too.
+func skipSQLQuoted(src string, i int, q byte) int {
+	for i++; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			if q == '\'' {
+				i++
+			}
+		case q:
+			if i+1 < len(src) && src[i+1] == q {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(src)
+}
+
+// unquoteSQLIdent removes the quotes of a quoted identifier and unescapes the
+// doubled quotes inside it: "a""b" is the name a"b
+func unquoteSQLIdent(quoted string, q byte) string {
+	inner := quoted[1:]
+	if len(inner) > 0 && inner[len(inner)-1] == q {
+		inner = inner[:len(inner)-1]
+	}
+	return strings.ReplaceAll(inner, string(q)+string(q), string(q))
+}
+
+// splitSQLStatements splits tokens into statements at top-level semicolons
+func splitSQLStatements(toks []sqlToken) [][]sqlToken {
+	var stmts [][]sqlToken
+	start, depth := 0, 0
+	for i, t := range toks {
+		if t.Kind != sqlOp {
+			continue
+		}
+		switch t.Value {
+		case "(":
+			depth++
+		case ")":
+			if depth > 0 {
+				depth--
+			}
+		case ";":
+			if i > start {
+				stmts = append(stmts, toks[start:i])
+			}
+			start, depth = i+1, 0
+		}
+	}
+	if start < len(toks) {
+		stmts = append(stmts, toks[start:])
+	}
+	return stmts
+}
+
+func isSQLWordStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isSQLWordByte(c byte) bool {
+	return isSQLWordStart(c) || (c >= '0' && c <= '9') || c == '$'
+}
+
+func isSQLWord(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isSQLWordByte(s[i]) || s[i] == '$' {
+			return false
+		}
+	}
+	return true
+}
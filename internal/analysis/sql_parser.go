@@ -0,0 +1,725 @@
+package analysis
+
+import (
+	"strings"
+)
+
+// sqlStatement is the part of a parsed SQL statement the schema model needs
+type sqlStatement struct {
+	Operation string // SELECT, INSERT, UPDATE, DELETE, CREATE TABLE, ALTER TABLE, CREATE INDEX, ...
+	Line      int
+
+	// DDL
+	Table   *Table
+	Alter   []sqlAlteration
+	Index   *Index
+	Dropped string
+
+	// DML
+	Tables  []string
+	Columns []string // table.column
+	Joins   []Relationship
+}
+
+// isDML reports whether the statement reads or writes rows
+func (st *sqlStatement) isDML() bool {
+	switch st.Operation {
+	case "SELECT", "INSERT", "UPDATE", "DELETE":
+		return true
+	}
+	return false
+}
+
+// sqlAlteration is an ALTER TABLE action that affects the schema model
+type sqlAlteration struct {
+	Column     *Column
+	Constraint *sqlConstraint
+	DropColumn string
+	SetDefault [2]string // column, default
+}
+
+// sqlConstraint is a table constraint from CREATE TABLE or ALTER TABLE
+type sqlConstraint struct {
+	Kind       string // PRIMARY KEY, UNIQUE, FOREIGN KEY, CHECK
+	Columns    []string
+	RefTable   string
+	RefColumns []string
+	OnDelete   string
+	OnUpdate   string
+	Check      string // expression of a CHECK constraint
+}
+
+// columnConstraintKeywords end the type of a column definition
+var columnConstraintKeywords = []string{
+	"CONSTRAINT", "NOT", "NULL", "PRIMARY", "UNIQUE", "DEFAULT", "REFERENCES", "CHECK",
+	"COLLATE", "GENERATED", "AUTOINCREMENT", "AUTO_INCREMENT", "IDENTITY", "COMMENT", "ON",
+}
+
+// sqlParser is a cursor over the tokens of one statement
+type sqlParser struct {
+	toks []sqlToken
+	i    int
+}
+
+func (p *sqlParser) done() bool { return p.i >= len(p.toks) }
+
+func (p *sqlParser) peek() sqlToken {
+	if p.done() {
+		return sqlToken{Kind: -1}
+	}
+	return p.toks[p.i]
+}
+
+func (p *sqlParser) next() sqlToken {
+	t := p.peek()
+	p.i++
+	return t
+}
+
+// accept consumes the keyword sequence if it is next
+func (p *sqlParser) accept(keywords ...string) bool {
+	for k, kw := range keywords {
+		if p.i+k >= len(p.toks) || !p.toks[p.i+k].is(kw) {
+			return false
+		}
+	}
+	p.i += len(keywords)
+	return true
+}
+
+func (p *sqlParser) acceptOp(op string) bool {
+	if t := p.peek(); t.Kind == sqlOp && t.Value == op {
+		p.i++
+		return true
+	}
+	return false
+}
+
+// name parses a possibly schema qualified name and returns its last part
+func (p *sqlParser) name() string {
+	t := p.peek()
+	if t.Kind != sqlIdent && t.Kind != sqlQuotedIdent {
+		return ""
+	}
+	p.i++
+	name := t.Value
+	for p.peek().Kind == sqlOp && p.peek().Value == "." && p.i+1 < len(p.toks) {
+		p.i++
+		name = p.next().Value
+	}
+	return name
+}
+
+// nameList parses "(a, b, c)"
+func (p *sqlParser) nameList() []string {
+	if !p.acceptOp("(") {
+		return nil
+	}
+	var names []string
+	for !p.done() && !p.acceptOp(")") {
+		t := p.next()
+		if t.Kind == sqlIdent || t.Kind == sqlQuotedIdent {
+			names = append(names, t.Value)
+			// Skip ASC/DESC, opclasses and expressions up to the next item
+			p.skipUntil(",", ")")
+		}
+		p.acceptOp(",")
+	}
+	return names
+}
+
+// skipUntil advances to the next top-level token with one of the given values
+func (p *sqlParser) skipUntil(ops ...string) {
+	depth := 0
+	for !p.done() {
+		t := p.peek()
+		if t.Kind == sqlOp {
+			if depth == 0 {
+				for _, op := range ops {
+					if t.Value == op {
+						return
+					}
+				}
+			}
+			switch t.Value {
+			case "(":
+				depth++
+			case ")":
+				depth--
+			}
+		}
+		p.i++
+	}
+}
+
+// parseSQL parses a single statement. Unknown statements yield an empty Operation.
+func parseSQL(toks []sqlToken) *sqlStatement {
+	p := &sqlParser{toks: toks}
+	st := &sqlStatement{Line: toks[0].Line}
+	switch {
+	case p.peek().is("CREATE"):
+		p.next()
+		p.accept("OR", "REPLACE")
+		for p.accept("GLOBAL") || p.accept("LOCAL") || p.accept("TEMP") || p.accept("TEMPORARY") || p.accept("UNLOGGED") {
+		}
+		switch {
+		case p.accept("TABLE"):
+			st.Operation = "CREATE TABLE"
+			p.parseCreateTable(st)
+		case p.accept("UNIQUE", "INDEX"):
+			st.Operation = "CREATE INDEX"
+			p.parseCreateIndex(st, true)
+		case p.accept("INDEX"):
+			st.Operation = "CREATE INDEX"
+			p.parseCreateIndex(st, false)
+		}
+	case p.peek().is("ALTER") && p.i+1 < len(toks) && toks[1].is("TABLE"):
+		p.i += 2
+		st.Operation = "ALTER TABLE"
+		p.parseAlterTable(st)
+	case p.peek().is("DROP") && p.i+1 < len(toks) && toks[1].is("TABLE"):
+		p.i += 2
+		p.accept("IF", "EXISTS")
+		st.Operation = "DROP TABLE"
+		st.Dropped = p.name()
+	case p.peek().is("SELECT", "WITH", "INSERT", "UPDATE", "DELETE", "REPLACE"):
+		parseDML(toks, st)
+	}
+	return st
+}
+
+func (p *sqlParser) parseCreateTable(st *sqlStatement) {
+	p.accept("IF", "NOT", "EXISTS")
+	table := &Table{Name: p.name(), Columns: []Column{}}
+	if table.Name == "" || !p.acceptOp("(") {
+		return
+	}
+	st.Table = table
+
+	for !p.done() {
+		start := p.i
+		p.skipUntil(",", ")")
+		elem := &sqlParser{toks: p.toks[start:p.i]}
+		if !elem.done() {
+			if c := elem.tableConstraint(); c != nil {
+				applyConstraint(table, c)
+			} else if !elem.peek().is("LIKE", "EXCLUDE", "PERIOD") {
+				if col := elem.columnDef(); col != nil {
+					table.Columns = append(table.Columns, *col)
+					if col.PrimaryKey {
+						table.PrimaryKey = append(table.PrimaryKey, col.Name)
+					}
+				}
+			}
+		}
+		if p.acceptOp(")") {
+			break
+		}
+		p.acceptOp(",")
+	}
+}
+
+// columnDef parses "name type [constraints]"
+func (p *sqlParser) columnDef() *Column {
+	t := p.next()
+	if t.Kind != sqlIdent && t.Kind != sqlQuotedIdent {
+		return nil
+	}
+	col := &Column{Name: t.Value, Nullable: true}
+
+	var typ []string
+	for !p.done() && !p.peek().is(columnConstraintKeywords...) {
+		t := p.next()
+		if t.Kind == sqlOp && t.Value == "(" {
+			// Type arguments: varchar(255), numeric(10, 2)
+			start := p.i - 1
+			p.i--
+			p.skipParens()
+			typ = append(typ, tokenText(p.toks[start:p.i]))
+			continue
+		}
+		if t.Kind == sqlOp && t.Value == "[" {
+			typ = append(typ, "[]")
+			p.skipUntil("]")
+			p.acceptOp("]")
+			continue
+		}
+		typ = append(typ, t.Value)
+	}
+	col.Type = strings.ReplaceAll(strings.ToLower(strings.Join(typ, " ")), " (", "(")
+	col.Type = strings.ReplaceAll(col.Type, " []", "[]")
+	if strings.Contains(col.Type, "serial") {
+		col.Nullable, col.AutoIncrement = false, true
+	}
+
+	for !p.done() {
+		switch {
+		case p.accept("CONSTRAINT"):
+			p.name()
+		case p.accept("NOT", "NULL"):
+			col.Nullable = false
+		case p.accept("NULL"):
+		case p.accept("PRIMARY", "KEY"):
+			col.PrimaryKey, col.Nullable = true, false
+			p.accept("ASC")
+			p.accept("DESC")
+		case p.accept("UNIQUE"):
+			col.Unique = true
+		case p.accept("DEFAULT"):
+			start := p.i
+			p.skipExpression()
+			col.Default = tokenText(p.toks[start:p.i])
+		case p.accept("REFERENCES"):
+			ref := p.name()
+			refCols := p.nameList()
+			col.References = ref
+			if len(refCols) > 0 {
+				col.References += "." + refCols[0]
+			}
+			col.OnDelete, col.OnUpdate = p.referentialActions()
+		case p.accept("AUTOINCREMENT"), p.accept("AUTO_INCREMENT"), p.accept("IDENTITY"):
+			// GENERATED ... AS IDENTITY stops before IDENTITY, which may have sequence options
+			col.AutoIncrement = true
+			p.skipParens()
+		case p.accept("CHECK"):
+			col.Check = p.parenthesized()
+		case p.accept("GENERATED"), p.accept("COLLATE"), p.accept("COMMENT"):
+			p.skipExpression()
+		default:
+			p.next()
+		}
+	}
+	return col
+}
+
+// tableConstraint parses PRIMARY KEY, UNIQUE and FOREIGN KEY table constraints.
+// It returns nil when the element is a column definition.
+func (p *sqlParser) tableConstraint() *sqlConstraint {
+	if p.accept("CONSTRAINT") {
+		p.name()
+	}
+	c := &sqlConstraint{}
+	switch {
+	case p.accept("PRIMARY", "KEY"):
+		c.Kind = "PRIMARY KEY"
+	case p.accept("UNIQUE"):
+		p.accept("KEY")
+		p.accept("INDEX")
+		c.Kind = "UNIQUE"
+	case p.accept("FOREIGN", "KEY"):
+		c.Kind = "FOREIGN KEY"
+	case p.accept("CHECK"):
+		return &sqlConstraint{Kind: "CHECK", Check: p.parenthesized()}
+	case p.peek().is("KEY", "INDEX", "FULLTEXT", "SPATIAL") && p.inlineIndex():
+		// MySQL inline index: KEY idx_name (col)
+		return &sqlConstraint{Kind: "INDEX"}
+	default:
+		return nil
+	}
+	if p.peek().Kind == sqlIdent || p.peek().Kind == sqlQuotedIdent {
+		p.name() // MySQL index name
+	}
+	c.Columns = p.nameList()
+	if c.Kind == "FOREIGN KEY" && p.accept("REFERENCES") {
+		c.RefTable = p.name()
+		c.RefColumns = p.nameList()
+		c.OnDelete, c.OnUpdate = p.referentialActions()
+	}
+	return c
+}
+
+// inlineIndex tells a MySQL "KEY name (col)" index from a column named key: index
+// parentheses hold column names, type arguments such as varchar(50) hold numbers
+func (p *sqlParser) inlineIndex() bool {
+	for k := p.i + 1; k < len(p.toks) && k <= p.i+3; k++ {
+		if p.toks[k].Kind == sqlOp && p.toks[k].Value == "(" {
+			return k+1 < len(p.toks) && (p.toks[k+1].Kind == sqlIdent || p.toks[k+1].Kind == sqlQuotedIdent)
+		}
+	}
+	return false
+}
+
+func (p *sqlParser) parseCreateIndex(st *sqlStatement, unique bool) {
+	p.accept("CONCURRENTLY")
+	p.accept("IF", "NOT", "EXISTS")
+	idx := &Index{Unique: unique}
+	if !p.peek().is("ON") {
+		idx.Name = p.name()
+	}
+	if !p.accept("ON") {
+		return
+	}
+	p.accept("ONLY")
+	idx.Table = p.name()
+	if p.accept("USING") {
+		p.next()
+	}
+	idx.Columns = p.nameList()
+	st.Index = idx
+}
+
+func (p *sqlParser) parseAlterTable(st *sqlStatement) {
+	p.accept("IF", "EXISTS")
+	p.accept("ONLY")
+	name := p.name()
+	if name == "" {
+		return
+	}
+	st.Table = &Table{Name: name}
+
+	for !p.done() {
+		start := p.i
+		p.skipUntil(",")
+		action := &sqlParser{toks: p.toks[start:p.i]}
+		p.acceptOp(",")
+
+		switch {
+		case action.accept("ADD"):
+			action.accept("COLUMN")
+			action.accept("IF", "NOT", "EXISTS")
+			if c := action.tableConstraint(); c != nil {
+				st.Alter = append(st.Alter, sqlAlteration{Constraint: c})
+			} else if col := action.columnDef(); col != nil {
+				st.Alter = append(st.Alter, sqlAlteration{Column: col})
+			}
+		case action.accept("DROP"):
+			if action.accept("CONSTRAINT") {
+				continue
+			}
+			action.accept("COLUMN")
+			action.accept("IF", "EXISTS")
+			st.Alter = append(st.Alter, sqlAlteration{DropColumn: action.name()})
+		case action.accept("ALTER"):
+			action.accept("COLUMN")
+			col := action.name()
+			if action.accept("SET", "DEFAULT") {
+				st.Alter = append(st.Alter, sqlAlteration{SetDefault: [2]string{col, tokenText(action.toks[action.i:])}})
+			}
+		}
+	}
+}
+
+// skipParens skips a balanced parenthesized group starting at the current token
+func (p *sqlParser) skipParens() {
+	if !p.acceptOp("(") {
+		return
+	}
+	depth := 1
+	for !p.done() && depth > 0 {
+		t := p.next()
+		if t.Kind == sqlOp {
+			switch t.Value {
+			case "(":
+				depth++
+			case ")":
+				depth--
+			}
+		}
+	}
+}
+
+// skipExpression skips tokens up to the next column constraint keyword
+func (p *sqlParser) skipExpression() {
+	for !p.done() {
+		t := p.peek()
+		if t.Kind == sqlOp && t.Value == "(" {
+			p.skipParens()
+			continue
+		}
+		if t.is(columnConstraintKeywords...) && !t.is("NULL", "ON") {
+			return
+		}
+		p.i++
+	}
+}
+
+// referentialActions parses the ON DELETE/UPDATE actions of a foreign key,
+// such as CASCADE or SET NULL, and skips MATCH/DEFERRABLE clauses
+func (p *sqlParser) referentialActions() (onDelete, onUpdate string) {
+	for !p.done() {
+		switch {
+		case p.accept("ON", "DELETE"):
+			onDelete = p.referentialAction()
+		case p.accept("ON", "UPDATE"):
+			onUpdate = p.referentialAction()
+		case p.accept("MATCH"), p.accept("NOT", "DEFERRABLE"), p.accept("DEFERRABLE"), p.accept("INITIALLY"):
+			if p.peek().is("FULL", "PARTIAL", "SIMPLE", "DEFERRED", "IMMEDIATE") {
+				p.next()
+			}
+		default:
+			return onDelete, onUpdate
+		}
+	}
+	return onDelete, onUpdate
+}
+
+func (p *sqlParser) referentialAction() string {
+	switch {
+	case p.accept("SET", "NULL"):
+		return "SET NULL"
+	case p.accept("SET", "DEFAULT"):
+		return "SET DEFAULT"
+	case p.accept("NO", "ACTION"):
+		return "NO ACTION"
+	}
+	return strings.ToUpper(p.next().Value)
+}
+
+// parenthesized returns the text inside a parenthesized group such as the
+// expression of a CHECK constraint, and moves past the group
+func (p *sqlParser) parenthesized() string {
+	start := p.i
+	p.skipParens()
+	if p.i-start < 2 {
+		return ""
+	}
+	return tokenText(p.toks[start+1 : p.i-1])
+}
+
+func applyConstraint(t *Table, c *sqlConstraint) {
+	switch c.Kind {
+	case "PRIMARY KEY":
+		t.PrimaryKey = c.Columns
+		for i := range t.Columns {
+			if containsFold(c.Columns, t.Columns[i].Name) {
+				t.Columns[i].PrimaryKey, t.Columns[i].Nullable = true, false
+			}
+		}
+	case "UNIQUE":
+		if len(c.Columns) > 1 {
+			t.Unique = append(t.Unique, c.Columns)
+			return
+		}
+		for i := range t.Columns {
+			if len(c.Columns) == 1 && strings.EqualFold(t.Columns[i].Name, c.Columns[0]) {
+				t.Columns[i].Unique = true
+			}
+		}
+	case "CHECK":
+		if c.Check != "" {
+			t.Checks = appendUnique(t.Checks, c.Check)
+		}
+	case "FOREIGN KEY":
+		for k, name := range c.Columns {
+			for i := range t.Columns {
+				if strings.EqualFold(t.Columns[i].Name, name) {
+					t.Columns[i].References = c.RefTable
+					if k < len(c.RefColumns) {
+						t.Columns[i].References += "." + c.RefColumns[k]
+					}
+					t.Columns[i].OnDelete, t.Columns[i].OnUpdate = c.OnDelete, c.OnUpdate
+				}
+			}
+		}
+	}
+}
+
+// sqlKeywords are words never taken as column names in DML
+var sqlKeywords = map[string]bool{}
+
+func init() {
+	for _, kw := range strings.Fields(`ALL AND ANY AS ASC BETWEEN BY CASE CAST COALESCE CROSS CURRENT_DATE
+		CURRENT_TIMESTAMP DEFAULT DELETE DESC DISTINCT ELSE END EXCEPT EXISTS FALSE FETCH FIRST FOR FROM
+		FULL GROUP HAVING ILIKE IN INNER INSERT INTERSECT INTO IS JOIN LEFT LIKE LIMIT NATURAL NOT NOW NULL
+		NULLS OFFSET ON OR ORDER OUTER OVER PARTITION RECURSIVE REPLACE RETURNING RIGHT ROW ROWS SELECT SET
+		SOME THEN TRUE UNION UPDATE USING VALUES WHEN WHERE WITH CONFLICT DO NOTHING IGNORE LATERAL ONLY
+		INTERVAL DATE TIME TIMESTAMP EXCLUDED ASYMMETRIC SYMMETRIC ESCAPE COLLATE FILTER WITHIN`) {
+		sqlKeywords[kw] = true
+	}
+}
+
+func isSQLKeyword(t sqlToken) bool {
+	return t.Kind == sqlIdent && sqlKeywords[strings.ToUpper(t.Value)]
+}
+
+// parseDML extracts the operation, tables, columns and join conditions of a query
+func parseDML(toks []sqlToken, st *sqlStatement) {
+	ctes := map[string]bool{}
+	aliases := map[string]string{}
+	var tables []string
+	addTable := func(name, alias string) {
+		if name == "" || ctes[strings.ToLower(name)] {
+			return
+		}
+		tables = appendUnique(tables, name)
+		aliases[strings.ToLower(name)] = name
+		if alias != "" {
+			aliases[strings.ToLower(alias)] = name
+		}
+	}
+
+	// Operation: the first top-level DML keyword after any CTEs
+	depth := 0
+	for i, t := range toks {
+		if t.Kind == sqlOp {
+			switch t.Value {
+			case "(":
+				depth++
+			case ")":
+				depth--
+			}
+			continue
+		}
+		if t.is("WITH") && i+1 < len(toks) {
+			// CTE names: WITH [RECURSIVE] name [(cols)] AS (...)
+			for k := i + 1; k+1 < len(toks); k++ {
+				if toks[k+1].is("AS") || (toks[k+1].Kind == sqlOp && toks[k+1].Value == "(" && k+2 < len(toks)) {
+					if toks[k].Kind == sqlIdent && !toks[k].is("RECURSIVE") {
+						ctes[strings.ToLower(toks[k].Value)] = true
+					}
+				}
+				if toks[k].is("SELECT", "INSERT", "UPDATE", "DELETE") && depth == 0 {
+					break
+				}
+			}
+		}
+		if depth == 0 && st.Operation == "" && t.is("SELECT", "INSERT", "UPDATE", "DELETE", "REPLACE") {
+			st.Operation = strings.ToUpper(t.Value)
+			if st.Operation == "REPLACE" {
+				st.Operation = "INSERT"
+			}
+		}
+	}
+
+	// Table references
+	p := &sqlParser{toks: toks}
+	for !p.done() {
+		t := p.next()
+		switch {
+		case t.is("FROM", "JOIN", "INTO", "USING") || (t.is("UPDATE") && !p.peek().is("SET")):
+			if t.is("FROM") && p.i >= 2 && toks[p.i-2].is("DISTINCT", "IS") {
+				continue // IS DISTINCT FROM
+			}
+			if t.is("UPDATE") && p.i >= 2 && toks[p.i-2].is("KEY", "DO", "FOR") {
+				continue // ON DUPLICATE KEY UPDATE, DO UPDATE, FOR UPDATE
+			}
+			if insideFunctionCall(toks, p.i-1) {
+				continue // EXTRACT(YEAR FROM x), TRIM(BOTH FROM x)
+			}
+			for {
+				p.accept("ONLY")
+				p.accept("LATERAL")
+				if p.peek().Kind != sqlIdent && p.peek().Kind != sqlQuotedIdent || isSQLKeyword(p.peek()) {
+					break
+				}
+				name := p.name()
+				if p.peek().Kind == sqlOp && p.peek().Value == "(" {
+					if t.is("INTO") {
+						// INSERT INTO t (cols)
+						addTable(name, "")
+						for _, c := range p.nameList() {
+							st.Columns = appendUnique(st.Columns, name+"."+c)
+						}
+					}
+					// Otherwise a table function such as generate_series(...)
+					break
+				}
+				alias := ""
+				p.accept("AS")
+				if a := p.peek(); (a.Kind == sqlIdent || a.Kind == sqlQuotedIdent) && !isSQLKeyword(a) && !a.is("SET", "WHERE", "ON") {
+					alias = p.next().Value
+				}
+				addTable(name, alias)
+				if !t.is("FROM") || !p.acceptOp(",") {
+					break
+				}
+			}
+		}
+	}
+	st.Tables = tables
+
+	// Columns: qualified references, UPDATE ... SET col = and single-table references
+	var unqualified []string
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		if t.Kind != sqlIdent && t.Kind != sqlQuotedIdent {
+			continue
+		}
+		if i+2 < len(toks) && toks[i+1].Kind == sqlOp && toks[i+1].Value == "." && toks[i+2].Kind != sqlOp {
+			if table, ok := aliases[strings.ToLower(t.Value)]; ok {
+				col := toks[i+2].Value
+				st.Columns = appendUnique(st.Columns, table+"."+col)
+				// Join condition a.x = b.y
+				if i+6 < len(toks) && toks[i+3].Value == "=" && toks[i+5].Value == "." {
+					if other, ok := aliases[strings.ToLower(toks[i+4].Value)]; ok && other != table {
+						st.Joins = append(st.Joins, Relationship{
+							From: table, FromColumns: []string{col}, To: other, ToColumns: []string{toks[i+6].Value}, Kind: RelationshipJoin,
+						})
+					}
+				}
+			}
+			i += 2
+			continue
+		}
+		if isSQLKeyword(t) || aliases[strings.ToLower(t.Value)] != "" || ctes[strings.ToLower(t.Value)] {
+			continue
+		}
+		if i+1 < len(toks) && toks[i+1].Kind == sqlOp && (toks[i+1].Value == "(" || toks[i+1].Value == ".") {
+			continue // function call or schema qualifier
+		}
+		if i > 0 && (toks[i-1].is("AS") || (toks[i-1].Kind == sqlOp && toks[i-1].Value == "::")) {
+			continue // output alias or cast type
+		}
+		if i+1 < len(toks) && toks[i+1].is("FROM") && insideFunctionCall(toks, i) {
+			continue // EXTRACT(YEAR FROM x)
+		}
+		unqualified = appendUnique(unqualified, t.Value)
+	}
+	if len(tables) == 1 {
+		for _, c := range unqualified {
+			st.Columns = appendUnique(st.Columns, tables[0]+"."+c)
+		}
+	}
+}
+
+// insideFunctionCall reports whether toks[idx] is within the parentheses of a call
+// such as EXTRACT(...) rather than a subquery
+func insideFunctionCall(toks []sqlToken, idx int) bool {
+	depth := 0
+	for k := idx - 1; k >= 0; k-- {
+		if toks[k].Kind != sqlOp {
+			continue
+		}
+		switch toks[k].Value {
+		case ")":
+			depth++
+		case "(":
+			if depth > 0 {
+				depth--
+				continue
+			}
+			return k > 0 && toks[k-1].Kind == sqlIdent && !isSQLKeyword(toks[k-1])
+		}
+	}
+	return false
+}
+
+var (
+	noSpaceBefore = map[string]bool{"(": true, ")": true, ",": true, ".": true, "::": true, "[": true, "]": true}
+	noSpaceAfter  = map[string]bool{"(": true, ".": true, "::": true, "[": true}
+)
+
+// tokenText joins tokens back into compact SQL text
+func tokenText(toks []sqlToken) string {
+	var sb strings.Builder
+	for i, t := range toks {
+		if i > 0 && !(t.Kind == sqlOp && noSpaceBefore[t.Value]) && !(toks[i-1].Kind == sqlOp && noSpaceAfter[toks[i-1].Value]) {
+			sb.WriteByte(' ')
+		}
+		if t.Kind == sqlQuotedIdent {
+			sb.WriteString(`"` + strings.ReplaceAll(t.Value, `"`, `""`) + `"`)
+			continue
+		}
+		sb.WriteString(t.Value)
+	}
+	return sb.String()
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
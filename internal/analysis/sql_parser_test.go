@@ -0,0 +1,85 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSQLCreateTable(t *testing.T) {
+	tests := []struct {
+		name   string
+		sql    string
+		table  string
+		column string // column checked against want
+		want   Column
+		unique [][]string
+		checks []string
+	}{
+		{
+			name:   "column foreign key with referential actions",
+			sql:    "CREATE TABLE notes (order_id INTEGER REFERENCES orders(id) ON UPDATE CASCADE ON DELETE SET NULL, body TEXT)",
+			table:  "notes",
+			column: "order_id",
+			want:   Column{Name: "order_id", Type: "integer", Nullable: true, References: "orders.id", OnDelete: "SET NULL", OnUpdate: "CASCADE"},
+		},
+		{
+			name:   "table foreign key with ON DELETE",
+			sql:    "CREATE TABLE orders (id INTEGER PRIMARY KEY, product_id INTEGER NOT NULL, FOREIGN KEY (product_id) REFERENCES products (id) ON DELETE CASCADE)",
+			table:  "orders",
+			column: "product_id",
+			want:   Column{Name: "product_id", Type: "integer", References: "products.id", OnDelete: "CASCADE"},
+		},
+		{
+			name:   "column and named table CHECK",
+			sql:    "CREATE TABLE items (price NUMERIC(10,2) NOT NULL CHECK (price >= 0), qty INTEGER, CONSTRAINT qty_positive CHECK (qty > 0))",
+			table:  "items",
+			column: "price",
+			want:   Column{Name: "price", Type: "numeric(10, 2)", Check: "price >= 0"},
+			checks: []string{"qty > 0"},
+		},
+		{
+			name:   "composite UNIQUE",
+			sql:    "CREATE TABLE products (sku VARCHAR(20) UNIQUE, name TEXT, UNIQUE (sku, name))",
+			table:  "products",
+			column: "sku",
+			want:   Column{Name: "sku", Type: "varchar(20)", Nullable: true, Unique: true},
+			unique: [][]string{{"sku", "name"}},
+		},
+		{
+			name:   "quoted identifiers with escaped quotes",
+			sql:    `CREATE TABLE "quoted""table" ("we""ird" INTEGER PRIMARY KEY, "select" TEXT)`,
+			table:  `quoted"table`,
+			column: `we"ird`,
+			want:   Column{Name: `we"ird`, Type: "integer", PrimaryKey: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := parseSQL(tokenizeSQL(tt.sql))
+			if st.Table == nil {
+				t.Fatalf("no table parsed from %s", tt.sql)
+			}
+			if st.Table.Name != tt.table {
+				t.Errorf("table = %q, want %q", st.Table.Name, tt.table)
+			}
+			var got *Column
+			for i := range st.Table.Columns {
+				if st.Table.Columns[i].Name == tt.column {
+					got = &st.Table.Columns[i]
+				}
+			}
+			if got == nil {
+				t.Fatalf("column %q not found in %+v", tt.column, st.Table.Columns)
+			}
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("column = %+v, want %+v", *got, tt.want)
+			}
+			if !reflect.DeepEqual(st.Table.Unique, tt.unique) {
+				t.Errorf("unique = %v, want %v", st.Table.Unique, tt.unique)
+			}
+			if !reflect.DeepEqual(st.Table.Checks, tt.checks) {
+				t.Errorf("checks = %v, want %v", st.Table.Checks, tt.checks)
+			}
+		})
+	}
+}
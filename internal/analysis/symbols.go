@@ -0,0 +1,216 @@
+package analysis
+
+import (
+	"lcma/internal/utils"
+	"sort"
+	"strings"
+)
+
+// Symbol kinds in the symbol index
+const (
+	SymbolFunction = "function"
+	SymbolMethod   = "method"
+	SymbolClass    = "class"
+	SymbolVariable = "variable"
+)
+
+// Symbol is an entry of the symbol index
+type Symbol struct {
+	Name     string `json:"name"`
+	Qualname string `json:"qualname"`
+	Kind     string `json:"kind"`
+	Module   string `json:"module"`
+	Path     string `json:"path"`
+	Line     int    `json:"line"`
+	EndLine  int    `json:"end_line,omitempty"`
+}
+
+// ImportGraph is the dependency graph between legacy modules
+type ImportGraph struct {
+	Nodes    []GraphNode      `json:"nodes"`
+	Edges    []GraphEdge      `json:"edges"`
+	External []ExternalImport `json:"external"`
+}
+
+// GraphNode is a legacy module in the import graph
+type GraphNode struct {
+	Module string `json:"module"`
+	Path   string `json:"path"`
+	FanIn  int    `json:"fan_in"`
+	FanOut int    `json:"fan_out"`
+}
+
+// GraphEdge is an import of one legacy module by another
+type GraphEdge struct {
+	From  string   `json:"from"`
+	To    string   `json:"to"`
+	Line  int      `json:"line"`
+	Names []string `json:"names,omitempty"`
+}
+
+// ExternalImport is a third-party or standard library package and its importers
+type ExternalImport struct {
+	Package    string   `json:"package"`
+	ImportedBy []string `json:"imported_by"`
+}
+
+// symbolIndex is the layout of symbols.json
+type symbolIndex struct {
+	Modules []*PyModule `json:"modules"`
+	Symbols []Symbol    `json:"symbols"`
+}
+
+// analyzePython parses every Python file and builds the symbol index and import graph
+func analyzePython(p *Project) error {
+	for _, f := range p.pythonFiles() {
+		pf := parsePython(f.Path, f.Content)
+		p.py[f.Path] = pf
+		p.Modules = append(p.Modules, pf.Module)
+	}
+	sort.Slice(p.Modules, func(i, j int) bool { return p.Modules[i].Path < p.Modules[j].Path })
+
+	p.Symbols = buildSymbols(p.Modules)
+	p.Graph = buildImportGraph(p.Modules)
+
+	if err := utils.WriteReportJSON("symbols.json", symbolIndex{Modules: p.Modules, Symbols: p.Symbols}); err != nil {
+		return err
+	}
+	return utils.WriteReportJSON("import_graph.json", p.Graph)
+}
+
+func buildSymbols(modules []*PyModule) []Symbol {
+	symbols := []Symbol{}
+	for _, m := range modules {
+		add := func(name, qualname, kind string, line, end int) {
+			symbols = append(symbols, Symbol{Name: name, Qualname: qualname, Kind: kind, Module: m.Name, Path: m.Path, Line: line, EndLine: end})
+		}
+		for _, v := range m.Globals {
+			add(v.Name, v.Name, SymbolVariable, v.Line, 0)
+		}
+		for _, fn := range m.Functions {
+			add(fn.Name, fn.Qualname, SymbolFunction, fn.Line, fn.EndLine)
+		}
+		for _, c := range m.Classes {
+			add(c.Name, c.Name, SymbolClass, c.Line, c.EndLine)
+			for _, fn := range c.Methods {
+				add(fn.Name, fn.Qualname, SymbolMethod, fn.Line, fn.EndLine)
+			}
+		}
+	}
+	return symbols
+}
+
+// moduleResolver maps imported names to legacy modules
+type moduleResolver struct {
+	byName map[string]*PyModule
+	names  []string
+}
+
+func newModuleResolver(modules []*PyModule) *moduleResolver {
+	r := &moduleResolver{byName: map[string]*PyModule{}}
+	for _, m := range modules {
+		r.byName[m.Name] = m
+		r.names = append(r.names, m.Name)
+	}
+	sort.Strings(r.names)
+	return r
+}
+
+// resolve finds the legacy module for an imported name. Archives often wrap the app in
+// a top-level directory, so "models" also matches "app.models" when that is unambiguous.
+func (r *moduleResolver) resolve(name string) *PyModule {
+	if name == "" {
+		return nil
+	}
+	if m, ok := r.byName[name]; ok {
+		return m
+	}
+	var found *PyModule
+	for _, n := range r.names {
+		if strings.HasSuffix(n, "."+name) {
+			if found != nil && len(found.Name) <= len(n) {
+				continue
+			}
+			found = r.byName[n]
+		}
+	}
+	return found
+}
+
+// targets returns the legacy modules an import refers to. For "from pkg import x"
+// the submodule pkg.x wins over the package itself.
+func (r *moduleResolver) targets(imp PyImport) []*PyModule {
+	var out []*PyModule
+	for _, n := range imp.Names {
+		if imp.Module == "" {
+			if m := r.resolve(n); m != nil {
+				out = append(out, m)
+			}
+			continue
+		}
+		if m := r.resolve(imp.Module + "." + n); m != nil {
+			out = append(out, m)
+		}
+	}
+	if len(out) == 0 {
+		if m := r.resolve(imp.Module); m != nil {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+func buildImportGraph(modules []*PyModule) *ImportGraph {
+	r := newModuleResolver(modules)
+	g := &ImportGraph{Nodes: []GraphNode{}, Edges: []GraphEdge{}, External: []ExternalImport{}}
+	fanIn := map[string]int{}
+	fanOut := map[string]int{}
+	external := map[string]map[string]bool{}
+	seen := map[[2]string]bool{}
+
+	for _, m := range modules {
+		for _, imp := range m.Imports {
+			targets := r.targets(imp)
+			if len(targets) == 0 {
+				pkg := strings.Split(imp.Module, ".")[0]
+				if pkg == "" || imp.Level > 0 {
+					continue
+				}
+				if external[pkg] == nil {
+					external[pkg] = map[string]bool{}
+				}
+				external[pkg][m.Name] = true
+				continue
+			}
+			for _, t := range targets {
+				key := [2]string{m.Name, t.Name}
+				if t == m || seen[key] {
+					continue
+				}
+				seen[key] = true
+				g.Edges = append(g.Edges, GraphEdge{From: m.Name, To: t.Name, Line: imp.Line, Names: imp.Names})
+				fanOut[m.Name]++
+				fanIn[t.Name]++
+			}
+		}
+	}
+
+	for _, m := range modules {
+		g.Nodes = append(g.Nodes, GraphNode{Module: m.Name, Path: m.Path, FanIn: fanIn[m.Name], FanOut: fanOut[m.Name]})
+	}
+	for _, pkg := range sortedKeys(external) {
+		g.External = append(g.External, ExternalImport{Package: pkg, ImportedBy: sortedKeys(external[pkg])})
+	}
+	return g
+}
+
+// dependencies returns the legacy modules imported by module
+func (g *ImportGraph) dependencies(module string) []string {
+	var deps []string
+	for _, e := range g.Edges {
+		if e.From == module {
+			deps = append(deps, e.To)
+		}
+	}
+	return deps
+}
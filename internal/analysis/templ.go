@@ -0,0 +1,1136 @@
+package analysis
+
+import (
+	"fmt"
+	"go/format"
+	"lcma/internal/utils"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// templOutputDir is where the generated views package is written, relative to REPORT_PATH
+const templOutputDir = "templ/views"
+
+// TemplTranslation is the outcome of translating one Jinja template to Templ
+type TemplTranslation struct {
+	Template  string `json:"template"`
+	Component string `json:"component"`
+	File      string `json:"file"` // relative to REPORT_PATH
+	// TODOs are the constructs left for the LLM; each is marked with jTODO in the file
+	TODOs []TemplTODO `json:"todos"`
+}
+
+// TemplTODO is a Jinja construct the translator could not convert
+type TemplTODO struct {
+	Line   int    `json:"line"`
+	Jinja  string `json:"jinja"`
+	Reason string `json:"reason"`
+}
+
+// templTranslationReport is the layout of templ_translation.json
+type templTranslationReport struct {
+	Package      string             `json:"package"`
+	Runtime      string             `json:"runtime"`
+	URLHelpers   string             `json:"url_helpers"`
+	Translations []TemplTranslation `json:"translations"`
+}
+
+// templTranslator converts the parsed templates into one Templ file each
+type templTranslator struct {
+	p        *Project
+	byName   map[string]*Template
+	extended map[string]bool // templates some other template extends
+	routes   map[string]Route
+	files    map[string]*templFile
+}
+
+// templFile is the translation of one template
+type templFile struct {
+	t      *Template
+	comp   string
+	fields map[string]bool // context variables read through data
+	embeds []string        // templates whose data struct is embedded
+	macros map[string]*jinjaNode
+	// aliases maps {% import ... as m %} names to templates, imports maps names
+	// from {% from ... import a as b %} to template and macro
+	aliases map[string]string
+	imports map[string][2]string
+	todos   []TemplTODO
+	body    strings.Builder
+}
+
+// templContext is the scope a component body is translated in
+type templContext struct {
+	tr    *templTranslator
+	f     *templFile
+	scope map[string]string // Jinja name to Go expression
+	used  map[string]bool   // Go locals that were read
+	loops []*templLoop
+	macro bool   // inside a macro, which does not see the template context
+	block string // block being rendered, for super()
+	// blocks is set when the component receives the blocks of child templates
+	blocks bool
+}
+
+// templLoop is an enclosing {% for %}, for translating loop.index and friends
+type templLoop struct {
+	index     string
+	list      string
+	indexUsed bool
+}
+
+// analyzeTemplTranslation translates every template into a Templ component and
+// writes the views package next to the reports
+func analyzeTemplTranslation(p *Project) error {
+	tr := &templTranslator{p: p, byName: map[string]*Template{}, extended: map[string]bool{}, routes: map[string]Route{}, files: map[string]*templFile{}}
+	for _, t := range p.Templates {
+		tr.byName[t.Name] = t
+		if t.Extends != "" {
+			tr.extended[t.Extends] = true
+		}
+	}
+	for _, r := range p.Routes {
+		if _, ok := tr.routes[r.Endpoint]; !ok {
+			tr.routes[r.Endpoint] = r
+		}
+	}
+
+	report := templTranslationReport{
+		Package:      templOutputDir,
+		Runtime:      path.Join(templOutputDir, "jinja.go"),
+		URLHelpers:   path.Join(templOutputDir, "urls.go"),
+		Translations: []TemplTranslation{},
+	}
+	for _, t := range p.Templates {
+		f := tr.translate(t)
+		file := path.Join(templOutputDir, templFileName(t.Name))
+		if err := utils.WriteReportFile(file, []byte(tr.render(f))); err != nil {
+			return err
+		}
+		report.Translations = append(report.Translations, TemplTranslation{Template: t.Name, Component: f.comp, File: file, TODOs: nonNil(f.todos)})
+	}
+
+	p.Translations = report.Translations
+
+	if err := utils.WriteReportFile(report.Runtime, []byte(templRuntime)); err != nil {
+		return err
+	}
+	urls, err := format.Source([]byte(templURLHelpers(p.Routes)))
+	if err != nil {
+		return fmt.Errorf("failed to format url helpers: %w", err)
+	}
+	if err := utils.WriteReportFile(report.URLHelpers, urls); err != nil {
+		return err
+	}
+	if err := utils.WriteReportJSON("templ_translation.json", report); err != nil {
+		return err
+	}
+	return utils.WriteReportFile("templ_translation.md", []byte(templTranslationMarkdown(report)))
+}
+
+// translate translates t once, after the templates whose data it embeds
+func (tr *templTranslator) translate(t *Template) *templFile {
+	if f := tr.files[t.Name]; f != nil {
+		return f
+	}
+	f := &templFile{t: t, comp: templComponentName(t.Name), fields: map[string]bool{}, macros: map[string]*jinjaNode{}, aliases: map[string]string{}, imports: map[string][2]string{}}
+	tr.files[t.Name] = f
+	f.collectDefinitions()
+
+	for _, n := range t.nodes {
+		if n.Kind == jinjaTag && n.Tag == "macro" {
+			tr.macroComponent(f, n)
+		}
+	}
+	layout := t.Extends != "" || tr.extended[t.Name]
+	if layout {
+		walkJinja(t.nodes, func(n *jinjaNode) {
+			if n.Kind == jinjaTag && n.Tag == "block" && len(strings.Fields(n.Expr)) > 0 {
+				tr.blockComponent(f, n)
+			}
+		})
+	}
+	tr.mainComponent(f)
+
+	for _, name := range f.embeds {
+		if other := tr.byName[name]; other != nil && tr.files[name] == nil {
+			tr.translate(other)
+		}
+	}
+	return f
+}
+
+// collectDefinitions records the macros and imports of a template
+func (f *templFile) collectDefinitions() {
+	walkJinja(f.t.nodes, func(n *jinjaNode) {
+		if n.Kind != jinjaTag {
+			return
+		}
+		switch n.Tag {
+		case "macro":
+			name, _ := macroSignature(n.Expr)
+			f.macros[name] = n
+		case "import":
+			if src, alias, ok := strings.Cut(n.Expr, " as "); ok {
+				if s, ok := literalString(strings.TrimSpace(src)); ok {
+					f.aliases[strings.Fields(alias + " ")[0]] = s
+				}
+			}
+		case "from":
+			src, rest, ok := strings.Cut(n.Expr, " import ")
+			s, literal := literalString(strings.TrimSpace(src))
+			if !ok || !literal {
+				return
+			}
+			rest = strings.TrimSuffix(strings.TrimSuffix(strings.TrimSpace(rest), " with context"), " without context")
+			for _, part := range strings.Split(rest, ",") {
+				fields := strings.Fields(part)
+				if len(fields) > 0 {
+					f.imports[fields[len(fields)-1]] = [2]string{s, fields[0]}
+				}
+			}
+		}
+	})
+}
+
+// params returns the Go parameters of the template's components
+func (tr *templTranslator) params(f *templFile) string {
+	if tr.extended[f.t.Name] {
+		return fmt.Sprintf("data %sData, blocks %sBlocks", f.comp, f.comp)
+	}
+	return fmt.Sprintf("data %sData", f.comp)
+}
+
+func (tr *templTranslator) context(f *templFile) *templContext {
+	return &templContext{tr: tr, f: f, scope: map[string]string{}, used: map[string]bool{}, blocks: tr.extended[f.t.Name]}
+}
+
+// mainComponent writes the component rendering the whole template
+func (tr *templTranslator) mainComponent(f *templFile) {
+	c := tr.context(f)
+	w := &templWriter{}
+	t := f.t
+	parent := tr.byName[t.Extends]
+	switch {
+	case t.Extends != "" && parent == nil:
+		c.todo(w, &jinjaNode{Kind: jinjaTag, Tag: "extends", Expr: strconv.Quote(t.Extends), Line: 1}, "parent template %s is not in the corpus", t.Extends)
+	case parent != nil:
+		// The child only supplies blocks: render the parent with them
+		f.embeds = appendUnique(f.embeds, parent.Name)
+		pf := templComponentName(parent.Name)
+		own := map[string]bool{}
+		for _, b := range t.Blocks {
+			own[b.Name] = true
+		}
+		var fields []string
+		for _, name := range tr.blockNames(parent, map[string]bool{}) {
+			var value string
+			switch {
+			case own[name] && c.blocks:
+				value = fmt.Sprintf("jBlock(blocks.%s, %sBlock%s(data, blocks))", goName(name), f.comp, goName(name))
+			case own[name]:
+				value = fmt.Sprintf("%sBlock%s(data)", f.comp, goName(name))
+			case c.blocks:
+				value = "blocks." + goName(name)
+			default:
+				continue
+			}
+			fields = append(fields, fmt.Sprintf("\t\t%s: %s,\n", goName(name), value))
+		}
+		w.line(fmt.Sprintf("@%s(data.%sData, %sBlocks{\n%s\t})", pf, pf, pf, strings.Join(fields, "")))
+	case !templRenders(t.nodes):
+		// A macro library: only its macros are used
+		return
+	default:
+		c.nodes(w, t.nodes)
+	}
+	if w.state != htmlContent || w.depth != 0 {
+		f.addTODO(1, "", "the template does not produce balanced HTML; check the generated markup")
+	}
+	fmt.Fprintf(&f.body, "templ %s(%s) {\n%s}\n\n", f.comp, tr.params(f), indentTempl(w.sb.String()))
+}
+
+// blockComponent writes a {% block %} of a layout or child template as its own
+// component so it can be passed to, or overridden in, the parent
+func (tr *templTranslator) blockComponent(f *templFile, n *jinjaNode) {
+	name := strings.Fields(n.Expr)[0]
+	c := tr.context(f)
+	c.block = name
+	w := &templWriter{}
+	c.nodes(w, n.Body)
+	fmt.Fprintf(&f.body, "templ %sBlock%s(%s) {\n%s}\n\n", f.comp, goName(name), tr.params(f), indentTempl(w.sb.String()))
+}
+
+// macroComponent writes a {% macro %} as a component taking its parameters
+func (tr *templTranslator) macroComponent(f *templFile, n *jinjaNode) {
+	name, _ := macroSignature(n.Expr)
+	c := tr.context(f)
+	c.macro = true
+	var params []string
+	for _, p := range macroParams(n.Expr) {
+		local := goLocal(p[0])
+		c.scope[p[0]] = local
+		params = append(params, local+" any")
+	}
+	w := &templWriter{}
+	c.nodes(w, n.Body)
+	fmt.Fprintf(&f.body, "templ %s%s(%s) {\n%s}\n\n", f.comp, goName(name), strings.Join(params, ", "), indentTempl(w.sb.String()))
+}
+
+// blockNames returns the blocks defined by t and its ancestors
+func (tr *templTranslator) blockNames(t *Template, seen map[string]bool) []string {
+	if seen[t.Name] {
+		return nil
+	}
+	seen[t.Name] = true
+	var names []string
+	if parent := tr.byName[t.Extends]; parent != nil {
+		names = tr.blockNames(parent, seen)
+	}
+	for _, b := range t.Blocks {
+		names = appendUnique(names, b.Name)
+	}
+	return names
+}
+
+// fieldsOf returns the context fields reachable through the data struct of t
+func (tr *templTranslator) fieldsOf(name string, seen map[string]bool) map[string]bool {
+	fields := map[string]bool{}
+	f := tr.files[name]
+	if f == nil || seen[name] {
+		return fields
+	}
+	seen[name] = true
+	for k := range f.fields {
+		fields[k] = true
+	}
+	for _, e := range f.embeds {
+		for k := range tr.fieldsOf(e, seen) {
+			fields[k] = true
+		}
+	}
+	return fields
+}
+
+// render assembles the .templ file: data and blocks types, then the components
+func (tr *templTranslator) render(f *templFile) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "// Code generated by lcma from %s. Calls of jTODO mark Jinja the translator\n// could not convert; replace them before building.\n\npackage views\n\n", f.t.Path)
+
+	if f.t.Extends == "" && !templRenders(f.t.nodes) {
+		sb.WriteString(f.body.String())
+		return strings.TrimRight(sb.String(), "\n") + "\n"
+	}
+	inherited := map[string]bool{}
+	fmt.Fprintf(&sb, "// %sData is the context render_template passed to %s\ntype %sData struct {\n", f.comp, f.t.Name, f.comp)
+	for _, e := range f.embeds {
+		if tr.byName[e] == nil {
+			continue
+		}
+		fmt.Fprintf(&sb, "\t%sData\n", templComponentName(e))
+		for k := range tr.fieldsOf(e, map[string]bool{}) {
+			inherited[k] = true
+		}
+	}
+	for _, name := range sortedKeys(f.fields) {
+		if !inherited[name] {
+			fmt.Fprintf(&sb, "\t%s any `json:%q`\n", goName(name), name)
+		}
+	}
+	sb.WriteString("}\n\n")
+
+	if tr.extended[f.t.Name] {
+		fmt.Fprintf(&sb, "// %sBlocks holds the blocks a child template overrides; nil keeps the default\ntype %sBlocks struct {\n", f.comp, f.comp)
+		for _, name := range tr.blockNames(f.t, map[string]bool{}) {
+			fmt.Fprintf(&sb, "\t%s templ.Component\n", goName(name))
+		}
+		sb.WriteString("}\n\n")
+	}
+	sb.WriteString(f.body.String())
+	return strings.TrimRight(sb.String(), "\n") + "\n"
+}
+
+func (f *templFile) addTODO(line int, jinja, format string, args ...any) {
+	f.todos = append(f.todos, TemplTODO{Line: line, Jinja: jinja, Reason: fmt.Sprintf(format, args...)})
+}
+
+// child returns a context for a nested scope
+func (c *templContext) child(names map[string]string) *templContext {
+	scope := make(map[string]string, len(c.scope)+len(names))
+	for k, v := range c.scope {
+		scope[k] = v
+	}
+	for k, v := range names {
+		scope[k] = v
+	}
+	child := *c
+	child.scope = scope
+	child.loops = append([]*templLoop(nil), c.loops...)
+	return &child
+}
+
+func (c *templContext) loop() *templLoop {
+	if len(c.loops) == 0 {
+		return nil
+	}
+	return c.loops[len(c.loops)-1]
+}
+
+func (c *templContext) importAlias(name string) string {
+	if _, shadowed := c.scope[name]; shadowed {
+		return ""
+	}
+	return c.f.aliases[name]
+}
+
+// resolve translates a variable name
+func (c *templContext) resolve(name string) (string, error) {
+	if local, ok := c.scope[name]; ok {
+		c.used[local] = true
+		return local, nil
+	}
+	if _, ok := c.f.macros[name]; ok {
+		return "", cannot("macro %s used as a value", name)
+	}
+	if c.macro {
+		return "", cannot("macro body reads %s from the template context", name)
+	}
+	if jinjaGlobals[name] && name != "current_user" {
+		return "", cannot("Flask template global %s", name)
+	}
+	c.f.fields[name] = true
+	return "data." + goName(name), nil
+}
+
+// urlFor translates url_for to the generated route helpers
+func (c *templContext) urlFor(args []string, kwargs [][2]string) (goExpr, error) {
+	if len(args) != 1 {
+		return goExpr{}, cannot("url_for without a single endpoint argument")
+	}
+	endpoint, err := strconv.Unquote(args[0])
+	if err != nil {
+		return goExpr{}, cannot("url_for with a computed endpoint")
+	}
+	if endpoint == "static" {
+		for _, kw := range kwargs {
+			if kw[0] == "filename" && len(kwargs) == 1 {
+				return goExpr{Code: fmt.Sprintf(`jConcat("/static/", %s)`, kw[1])}, nil
+			}
+		}
+		return goExpr{}, cannot("url_for('static') without filename")
+	}
+	r, ok := c.tr.route(endpoint)
+	if !ok {
+		return goExpr{}, cannot("url_for target %s matches no route", endpoint)
+	}
+	values := map[string]string{}
+	var query []string
+	for _, kw := range kwargs {
+		if strings.HasPrefix(kw[0], "_") {
+			return goExpr{}, cannot("url_for option %s", kw[0])
+		}
+		values[kw[0]] = kw[1]
+	}
+	var params []string
+	for _, p := range r.Params {
+		v, ok := values[p.Name]
+		if !ok {
+			return goExpr{}, cannot("url_for(%q) does not pass %s", endpoint, p.Name)
+		}
+		params = append(params, v)
+		delete(values, p.Name)
+	}
+	for _, k := range sortedKeys(values) {
+		query = append(query, strconv.Quote(k), values[k])
+	}
+	return goExpr{Code: urlHelperName(r.Endpoint) + "(" + strings.Join(append(params, query...), ", ") + ")"}, nil
+}
+
+// route finds the route of an endpoint; ".name" matches a blueprint endpoint
+func (tr *templTranslator) route(endpoint string) (Route, bool) {
+	if r, ok := tr.routes[endpoint]; ok {
+		return r, true
+	}
+	var found []Route
+	suffix := "." + strings.TrimPrefix(endpoint, ".")
+	for name, r := range tr.routes {
+		if strings.HasSuffix(name, suffix) {
+			found = append(found, r)
+		}
+	}
+	if len(found) == 1 {
+		return found[0], true
+	}
+	return Route{}, false
+}
+
+// superBlock renders the parent's version of the current block
+func (c *templContext) superBlock() (goExpr, error) {
+	if c.block == "" {
+		return goExpr{}, cannot("super() outside a block")
+	}
+	for t := c.tr.byName[c.f.t.Extends]; t != nil; t = c.tr.byName[t.Extends] {
+		for _, b := range t.Blocks {
+			if b.Name != c.block {
+				continue
+			}
+			comp := templComponentName(t.Name)
+			args := fmt.Sprintf("data.%sData", comp)
+			if c.tr.extended[t.Name] {
+				args += fmt.Sprintf(", %sBlocks{}", comp)
+			}
+			return goExpr{Code: fmt.Sprintf("%sBlock%s(%s)", comp, goName(c.block), args), Component: true}, nil
+		}
+	}
+	return goExpr{}, cannot("super() without a parent block %s", c.block)
+}
+
+// macroCall translates a call of a macro defined in or imported into the template
+func (c *templContext) macroCall(name, alias string, args []string, kwargs [][2]string) (goExpr, error) {
+	target, macro := "", name
+	switch {
+	case alias != "":
+		target = c.f.aliases[alias]
+	case c.f.macros[name] != nil:
+		target = c.f.t.Name
+	case c.f.imports[name] != [2]string{}:
+		target, macro = c.f.imports[name][0], c.f.imports[name][1]
+	case name == "caller":
+		return goExpr{}, cannot("caller() of a call block")
+	default:
+		return goExpr{}, cannot("call of %s()", name)
+	}
+	t := c.tr.byName[target]
+	if t == nil {
+		return goExpr{}, cannot("macro %s is imported from %s, which is not in the corpus", macro, target)
+	}
+	var def *jinjaNode
+	walkJinja(t.nodes, func(n *jinjaNode) {
+		if n.Kind == jinjaTag && n.Tag == "macro" {
+			if m, _ := macroSignature(n.Expr); m == macro {
+				def = n
+			}
+		}
+	})
+	if def == nil {
+		return goExpr{}, cannot("macro %s is not defined in %s", macro, target)
+	}
+
+	params := macroParams(def.Expr)
+	if len(args) > len(params) {
+		return goExpr{}, cannot("macro %s called with extra arguments", macro)
+	}
+	values := append([]string(nil), args...)
+	for _, p := range params[len(args):] {
+		value := ""
+		for _, kw := range kwargs {
+			if kw[0] == p[0] {
+				value = kw[1]
+			}
+		}
+		if value == "" && p[1] != "" {
+			var err error
+			if value, err = (&templContext{tr: c.tr, f: c.f, macro: true}).value(p[1]); err != nil {
+				return goExpr{}, err
+			}
+		}
+		if value == "" {
+			value = "nil"
+		}
+		values = append(values, value)
+	}
+	return goExpr{Code: templComponentName(t.Name) + goName(macro) + "(" + strings.Join(values, ", ") + ")", Component: true}, nil
+}
+
+// todo marks a node the translator cannot convert, in the output and the report
+func (c *templContext) todo(w *templWriter, n *jinjaNode, format string, args ...any) {
+	jinja := jinjaSource(n)
+	c.f.addTODO(n.Line, jinja, format, args...)
+	w.todo(jinja)
+}
+
+// nodes translates a list of nodes into w
+func (c *templContext) nodes(w *templWriter, nodes []*jinjaNode) {
+	for _, n := range nodes {
+		switch n.Kind {
+		case jinjaText:
+			w.text(n.Expr)
+		case jinjaOutput:
+			c.output(w, n)
+		case jinjaTag:
+			c.tag(w, n)
+		}
+	}
+}
+
+// output translates {{ expr }}
+func (c *templContext) output(w *templWriter, n *jinjaNode) {
+	e, err := c.translateExpr(n.Expr)
+	if err != nil {
+		c.todo(w, n, "%v", err)
+		return
+	}
+	switch w.state {
+	case htmlContent:
+		switch {
+		case w.raw != "":
+			c.todo(w, n, "expression inside a <%s> element", w.raw)
+		case e.Component:
+			w.line("@" + e.Code)
+		case e.Raw:
+			w.line("@templ.Raw(jStr(" + e.Code + "))")
+		default:
+			w.sb.WriteString("{ jStr(" + e.Code + ") }")
+		}
+	case htmlAttrValue:
+		if e.Component {
+			c.todo(w, n, "macro call inside an attribute value")
+			return
+		}
+		w.attrValue("jStr(" + e.Code + ")")
+	case htmlTag:
+		c.todo(w, n, "expression producing attributes")
+	}
+}
+
+// tag translates a statement tag
+func (c *templContext) tag(w *templWriter, n *jinjaNode) {
+	switch n.Tag {
+	case "extends", "import", "from", "macro":
+		// Handled when the components are assembled
+	case "if":
+		c.ifTag(w, n)
+	case "for":
+		c.forTag(w, n)
+	case "block":
+		c.blockSite(w, n)
+	case "include":
+		c.include(w, n)
+	case "set":
+		c.set(w, n)
+	case "with":
+		c.with(w, n)
+	case "autoescape":
+		c.nodes(w, n.Body)
+	default:
+		c.todo(w, n, "{%% %s %%} has no Templ equivalent", n.Tag)
+	}
+}
+
+// ifTag translates if/elif/else into Templ control flow, or into conditional
+// attributes and values inside tags
+func (c *templContext) ifTag(w *templWriter, n *jinjaNode) {
+	type branch struct{ cond, body string }
+	conds := []string{n.Expr}
+	bodies := [][]*jinjaNode{n.Body}
+	for _, b := range n.Branches {
+		if b.Tag == "else" {
+			conds = append(conds, "")
+		} else {
+			conds = append(conds, b.Expr)
+		}
+		bodies = append(bodies, b.Body)
+	}
+
+	if w.state == htmlAttrValue {
+		code, err := c.attrIf(conds, bodies)
+		if err != nil {
+			c.todo(w, n, "%v", err)
+			return
+		}
+		w.attrValue(code)
+		return
+	}
+
+	var branches []branch
+	for i, cond := range conds {
+		code := ""
+		if cond != "" {
+			v, err := c.value(cond)
+			if err != nil {
+				c.todo(w, n, "%v", err)
+				return
+			}
+			code = "jTruthy(" + v + ")"
+		}
+		sub := w.sub()
+		c.nodes(sub, bodies[i])
+		if !sub.balanced(w) {
+			c.todo(w, n, "branches open and close HTML elements differently")
+			return
+		}
+		branches = append(branches, branch{cond: code, body: sub.sb.String()})
+	}
+	for i, b := range branches {
+		switch {
+		case i == 0:
+			w.line("if " + b.cond + " {")
+		case b.cond == "":
+			w.line("} else {")
+		default:
+			w.line("} else if " + b.cond + " {")
+		}
+		w.sb.WriteString(b.body)
+	}
+	w.line("}")
+}
+
+// attrIf turns an if tag inside an attribute value into a jChoose expression
+func (c *templContext) attrIf(conds []string, bodies [][]*jinjaNode) (string, error) {
+	if len(conds) == 0 {
+		return `""`, nil
+	}
+	var parts []string
+	for _, n := range bodies[0] {
+		switch {
+		case n.Kind == jinjaText:
+			parts = append(parts, strconv.Quote(n.Expr))
+		case n.Kind == jinjaOutput:
+			v, err := c.value(n.Expr)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, "jStr("+v+")")
+		case n.Kind == jinjaTag && n.Tag == "if":
+			nested := []string{n.Expr}
+			nestedBodies := [][]*jinjaNode{n.Body}
+			for _, b := range n.Branches {
+				nested = append(nested, map[bool]string{true: "", false: b.Expr}[b.Tag == "else"])
+				nestedBodies = append(nestedBodies, b.Body)
+			}
+			v, err := c.attrIf(nested, nestedBodies)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, v)
+		case n.Kind != jinjaComment:
+			return "", cannot("{%% %s %%} inside an attribute value", n.Tag)
+		}
+	}
+	value := strings.Join(parts, " + ")
+	if value == "" {
+		value = `""`
+	}
+	if conds[0] == "" {
+		return value, nil
+	}
+	cond, err := c.value(conds[0])
+	if err != nil {
+		return "", err
+	}
+	rest, err := c.attrIf(conds[1:], bodies[1:])
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("jStr(jChoose(jTruthy(%s), %s, %s))", cond, value, rest), nil
+}
+
+// forTag translates a for loop, including its else branch and loop filter
+func (c *templContext) forTag(w *templWriter, n *jinjaNode) {
+	if w.state != htmlContent {
+		c.todo(w, n, "for loop inside an HTML tag")
+		return
+	}
+	targets, _ := splitForTag(n.Expr)
+	_, rest, _ := strings.Cut(n.Expr, " in ")
+	iter, filter := splitLoopFilter(rest)
+	if strings.HasSuffix(strings.TrimSpace(rest), " recursive") {
+		c.todo(w, n, "recursive loops")
+		return
+	}
+	helper := "jList"
+	if len(targets) == 2 && strings.HasSuffix(iter, ".items()") {
+		helper, iter = "jItems", strings.TrimSuffix(iter, ".items()")
+	} else if len(targets) != 1 {
+		c.todo(w, n, "loops unpacking %d targets", len(targets))
+		return
+	}
+	list, err := c.value(iter)
+	if err != nil {
+		c.todo(w, n, "%v", err)
+		return
+	}
+	list = helper + "(" + list + ")"
+
+	depth := len(c.loops) + 1
+	l := &templLoop{index: fmt.Sprintf("loopIndex%d", depth), list: list}
+	names := map[string]string{}
+	for _, t := range targets {
+		names[t] = goLocal(t)
+	}
+	inner := c.child(names)
+	inner.loops = append(inner.loops, l)
+
+	sub := w.sub()
+	var cond string
+	if filter != "" {
+		v, err := inner.value(filter)
+		if err != nil {
+			c.todo(w, n, "%v", err)
+			return
+		}
+		cond = "jTruthy(" + v + ")"
+	}
+	inner.nodes(sub, n.Body)
+	if !sub.balanced(w) {
+		c.todo(w, n, "loop body does not produce balanced HTML")
+		return
+	}
+
+	index, item := "_", "_"
+	if l.indexUsed {
+		index = l.index
+	}
+	var unpack string
+	if helper == "jItems" {
+		item = fmt.Sprintf("pair%d", depth)
+		k, v := goLocal(targets[0]), goLocal(targets[1])
+		unpack = fmt.Sprintf("{{ %s, %s := %s[0], %s[1] }}\n{{ _, _ = %s, %s }}", k, v, item, item, k, v)
+	} else if inner.used[goLocal(targets[0])] || cond != "" {
+		item = goLocal(targets[0])
+	}
+
+	w.line(fmt.Sprintf("for %s, %s := range %s {", index, item, list))
+	if unpack != "" {
+		w.line(unpack)
+	}
+	if cond != "" {
+		w.line("if " + cond + " {")
+	}
+	w.sb.WriteString(sub.sb.String())
+	if cond != "" {
+		w.line("}")
+	}
+	w.line("}")
+
+	for _, b := range n.Branches {
+		if b.Tag != "else" {
+			continue
+		}
+		sub := w.sub()
+		c.nodes(sub, b.Body)
+		w.line(fmt.Sprintf("if jLen(%s) == 0 {", list))
+		w.sb.WriteString(sub.sb.String())
+		w.line("}")
+	}
+}
+
+// blockSite renders a block where it appears in its template
+func (c *templContext) blockSite(w *templWriter, n *jinjaNode) {
+	fields := strings.Fields(n.Expr)
+	if len(fields) == 0 {
+		c.todo(w, n, "block without a name")
+		return
+	}
+	name := fields[0]
+	t := c.f.t
+	switch {
+	case w.state != htmlContent:
+		c.todo(w, n, "block inside an HTML tag")
+	case t.Extends == "" && !c.tr.extended[t.Name]:
+		// Nothing can override the block: render it in place
+		inner := c.child(nil)
+		inner.block = name
+		inner.nodes(w, n.Body)
+	case c.blocks && !c.macro:
+		w.line(fmt.Sprintf("if blocks.%s != nil {", goName(name)))
+		w.line("@blocks." + goName(name))
+		w.line("} else {")
+		w.line(fmt.Sprintf("@%sBlock%s(data, blocks)", c.f.comp, goName(name)))
+		w.line("}")
+	case !c.macro:
+		w.line(fmt.Sprintf("@%sBlock%s(data)", c.f.comp, goName(name)))
+	default:
+		c.todo(w, n, "block inside a macro")
+	}
+}
+
+// include renders an included template with the data embedded for it
+func (c *templContext) include(w *templWriter, n *jinjaNode) {
+	expr := strings.TrimSpace(strings.NewReplacer(" ignore missing", "", " with context", "", " without context", "").Replace(n.Expr))
+	name, ok := literalString(expr)
+	inc := c.tr.byName[name]
+	switch {
+	case !ok:
+		c.todo(w, n, "include of a computed template name")
+	case inc == nil:
+		c.todo(w, n, "included template %s is not in the corpus", name)
+	case c.macro:
+		c.todo(w, n, "include inside a macro")
+	case w.state != htmlContent:
+		c.todo(w, n, "include inside an HTML tag")
+	default:
+		comp := templComponentName(inc.Name)
+		c.f.embeds = appendUnique(c.f.embeds, inc.Name)
+		args := fmt.Sprintf("data.%sData", comp)
+		if c.tr.extended[inc.Name] {
+			args += fmt.Sprintf(", %sBlocks{}", comp)
+		}
+		w.line(fmt.Sprintf("@%s(%s)", comp, args))
+	}
+}
+
+// set translates {% set x = expr %} into a Go variable
+func (c *templContext) set(w *templWriter, n *jinjaNode) {
+	name, value, ok := strings.Cut(n.Expr, "=")
+	name = strings.TrimSpace(name)
+	if !ok || !isIdentifier(name) {
+		c.todo(w, n, "set blocks and multiple or attribute targets")
+		return
+	}
+	if w.state != htmlContent {
+		c.todo(w, n, "set inside an HTML tag")
+		return
+	}
+	v, err := c.value(value)
+	if err != nil {
+		c.todo(w, n, "%v", err)
+		return
+	}
+	local := goLocal(name)
+	if _, declared := c.scope[name]; declared {
+		w.line(fmt.Sprintf("{{ %s = %s }}", local, v))
+		return
+	}
+	c.scope[name] = local
+	w.line(fmt.Sprintf("{{ %s := %s }}", local, v))
+	w.line(fmt.Sprintf("{{ _ = %s }}", local))
+}
+
+// with translates {% with a = x %} into a scoped block
+func (c *templContext) with(w *templWriter, n *jinjaNode) {
+	if w.state != htmlContent {
+		c.todo(w, n, "with inside an HTML tag")
+		return
+	}
+	names := map[string]string{}
+	var decls []string
+	for _, assign := range splitTopLevelString(n.Expr, ",") {
+		name, value, ok := strings.Cut(assign, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !isIdentifier(name) {
+			c.todo(w, n, "with without simple assignments")
+			return
+		}
+		v, err := c.value(value)
+		if err != nil {
+			c.todo(w, n, "%v", err)
+			return
+		}
+		names[name] = goLocal(name)
+		decls = append(decls, fmt.Sprintf("{{ %s := %s }}\n{{ _ = %s }}", goLocal(name), v, goLocal(name)))
+	}
+	w.line("if true {")
+	for _, d := range decls {
+		w.line(d)
+	}
+	c.child(names).nodes(w, n.Body)
+	w.line("}")
+}
+
+// templRenders reports whether a template produces output besides definitions
+func templRenders(nodes []*jinjaNode) bool {
+	for _, n := range nodes {
+		switch {
+		case n.Kind == jinjaText && strings.TrimSpace(n.Expr) != "", n.Kind == jinjaOutput:
+			return true
+		case n.Kind == jinjaTag && n.Tag != "macro" && n.Tag != "import" && n.Tag != "from" && n.Tag != "set":
+			return true
+		}
+	}
+	return false
+}
+
+// splitLoopFilter splits "items if cond" into the iterable and the filter
+func splitLoopFilter(rest string) (string, string) {
+	rest = strings.TrimSuffix(strings.TrimSpace(rest), " recursive")
+	depth := 0
+	for _, t := range tokenizePython(rest) {
+		switch t.Value {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+		case "if":
+			if depth == 0 && t.Kind == tokName {
+				return strings.TrimSpace(rest[:t.Pos]), strings.TrimSpace(rest[t.End:])
+			}
+		}
+	}
+	return rest, ""
+}
+
+// macroParams parses "name(a, b='x')" into parameter names and default expressions
+func macroParams(expr string) [][2]string {
+	open, end := strings.Index(expr, "("), strings.LastIndex(expr, ")")
+	if open < 0 || end < open {
+		return nil
+	}
+	var params [][2]string
+	for _, part := range splitTopLevelString(expr[open+1:end], ",") {
+		name, def, _ := strings.Cut(part, "=")
+		if name = strings.TrimSpace(name); name != "" {
+			params = append(params, [2]string{name, strings.TrimSpace(def)})
+		}
+	}
+	return params
+}
+
+// jinjaSource reconstructs the opening Jinja of a node for reports and markers
+func jinjaSource(n *jinjaNode) string {
+	switch n.Kind {
+	case jinjaOutput:
+		return "{{ " + n.Expr + " }}"
+	case jinjaTag:
+		s := "{% " + strings.TrimSpace(n.Tag+" "+n.Expr) + " %}"
+		if n.Closed {
+			s += "...{% end" + n.Tag + " %}"
+		}
+		return s
+	}
+	return n.Expr
+}
+
+var goNameSeparator = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// goName turns a Jinja or file name into an exported Go identifier
+func goName(name string) string {
+	var sb strings.Builder
+	for _, part := range goNameSeparator.Split(name, -1) {
+		if part != "" {
+			sb.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+	s := sb.String()
+	if s == "" || (s[0] >= '0' && s[0] <= '9') {
+		s = "X" + s
+	}
+	return s
+}
+
+// goReserved are names a local variable cannot take in generated code
+var goReserved = map[string]bool{
+	"break": true, "case": true, "chan": true, "const": true, "continue": true, "default": true,
+	"defer": true, "else": true, "fallthrough": true, "for": true, "func": true, "go": true, "goto": true,
+	"if": true, "import": true, "interface": true, "map": true, "package": true, "range": true,
+	"return": true, "select": true, "struct": true, "switch": true, "type": true, "var": true,
+	"data": true, "blocks": true, "templ": true, "ctx": true, "len": true, "string": true, "any": true,
+}
+
+// goLocal turns a Jinja variable into a Go local variable name
+func goLocal(name string) string {
+	s := goName(name)
+	s = strings.ToLower(s[:1]) + s[1:]
+	if goReserved[s] || strings.HasPrefix(s, "loopIndex") || strings.HasPrefix(s, "pair") {
+		s += "Var"
+	}
+	return s
+}
+
+// templComponentName is the component rendering a template: "users/list.html" is UsersList
+func templComponentName(name string) string {
+	return goName(strings.TrimSuffix(name, path.Ext(name)))
+}
+
+// templFileName is the generated file of a template: "users/list.html" is users_list.templ
+func templFileName(name string) string {
+	base := strings.TrimSuffix(name, path.Ext(name))
+	return strings.ToLower(strings.Trim(goNameSeparator.ReplaceAllString(base, "_"), "_")) + ".templ"
+}
+
+func isIdentifier(s string) bool {
+	if s == "" || (s[0] >= '0' && s[0] <= '9') {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !(isHTMLNameByte(s[i]) || s[i] == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// indentTempl indents component bodies by one tab
+func indentTempl(body string) string {
+	var sb strings.Builder
+	for _, line := range strings.Split(strings.TrimRight(body, "\n"), "\n") {
+		if strings.TrimSpace(line) != "" {
+			sb.WriteString("\t" + line)
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// urlHelperName is the route helper of an endpoint: "users.detail" is URLUsersDetail
+func urlHelperName(endpoint string) string {
+	return "URL" + goName(endpoint)
+}
+
+// templURLHelpers generates a function per endpoint building its URL, the Go
+// counterpart of url_for
+func templURLHelpers(routes []Route) string {
+	var sb strings.Builder
+	sb.WriteString("// Code generated by lcma from the Flask routes. DO NOT EDIT.\n\npackage views\n\n")
+	seen := map[string]bool{}
+	for _, r := range routes {
+		name := urlHelperName(r.Endpoint)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		var params []string
+		var parts []string
+		last := 0
+		for _, m := range urlParamPattern.FindAllStringSubmatchIndex(r.Path, -1) {
+			if m[0] > last {
+				parts = append(parts, strconv.Quote(r.Path[last:m[0]]))
+			}
+			param := goLocal(r.Path[m[4]:m[5]])
+			params = append(params, param+" any")
+			if m[2] >= 0 && r.Path[m[2]:m[3]] == "path" {
+				parts = append(parts, "jStr("+param+")")
+			} else {
+				parts = append(parts, "jPathParam("+param+")")
+			}
+			last = m[1]
+		}
+		if last < len(r.Path) || len(parts) == 0 {
+			parts = append(parts, strconv.Quote(r.Path[last:]))
+		}
+		params = append(params, "query ...any")
+		fmt.Fprintf(&sb, "// %s builds the URL of %s (%s %s); query holds key, value pairs\n", name, r.Endpoint, strings.Join(r.Methods, ","), r.Path)
+		fmt.Fprintf(&sb, "func %s(%s) string {\n\treturn jURL(%s, query)\n}\n\n", name, strings.Join(params, ", "), strings.Join(parts, " + "))
+	}
+	return sb.String()
+}
+
+// templTranslationMarkdown summarizes the translation and lists what is left to do
+func templTranslationMarkdown(r templTranslationReport) string {
+	var sb strings.Builder
+	sb.WriteString("# Templ translation\n\n")
+	fmt.Fprintf(&sb, "The Jinja templates were translated to Templ components in package `views` (`%s`). ", r.Package)
+	fmt.Fprintf(&sb, "`%s` implements the Jinja semantics they rely on and `%s` replaces url_for. ", path.Base(r.Runtime), path.Base(r.URLHelpers))
+	sb.WriteString("Context values are typed `any` in the Data structs; each jTODO call marks Jinja that still has to be translated. Run `templ fmt` on the package after editing.\n\n")
+
+	total := 0
+	sb.WriteString("| Template | Component | File | TODOs |\n|---|---|---|---|\n")
+	for _, t := range r.Translations {
+		fmt.Fprintf(&sb, "| %s | %s | %s | %d |\n", t.Template, t.Component, t.File, len(t.TODOs))
+		total += len(t.TODOs)
+	}
+	if total == 0 {
+		sb.WriteString("\nEvery construct was translated.\n")
+		return sb.String()
+	}
+	sb.WriteString("\n## Left for the LLM\n\n")
+	for _, t := range r.Translations {
+		for _, todo := range t.TODOs {
+			fmt.Fprintf(&sb, "- %s:%d in %s: %s. `%s`\n", t.Template, todo.Line, t.Component, todo.Reason, strings.ReplaceAll(todo.Jinja, "`", "'"))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,484 @@
+package analysis
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// untranslatable is returned when a Jinja construct has no mechanical Templ equivalent
+type untranslatable struct {
+	reason string
+}
+
+func (e *untranslatable) Error() string { return e.reason }
+
+func cannot(format string, args ...any) error {
+	return &untranslatable{reason: fmt.Sprintf(format, args...)}
+}
+
+// goExpr is a translated expression. Component is set for macro calls and
+// super(), which can only be rendered with @ in content.
+type goExpr struct {
+	Code      string
+	Component bool
+	Raw       bool // |safe: render without escaping
+}
+
+// templFilters maps Jinja filters to runtime helpers taking the value first
+var templFilters = map[string]string{
+	"length": "jLen", "count": "jLen", "upper": "jUpper", "lower": "jLower", "title": "jTitle",
+	"capitalize": "jCapitalize", "trim": "jTrim", "default": "jDefault", "d": "jDefault",
+	"join": "jJoin", "string": "jStr", "int": "jInt", "float": "jFloat", "first": "jFirst",
+	"last": "jLast", "replace": "jReplace", "truncate": "jTruncate", "round": "jRound",
+	"abs": "jAbs", "sum": "jSum", "reverse": "jReverse", "sort": "jSort", "list": "jList",
+	"e": "", "escape": "", "striptags": "jStripTags", "urlencode": "jURLEncode", "wordcount": "jWordCount",
+}
+
+// exprTranslator translates one Jinja expression into Go code
+type exprTranslator struct {
+	toks []pyToken
+	i    int
+	c    *templContext
+}
+
+// translateExpr translates a Jinja expression in the given context
+func (c *templContext) translateExpr(expr string) (goExpr, error) {
+	var toks []pyToken
+	for _, t := range tokenizePython(expr) {
+		if t.Kind != tokNewline && t.Kind != tokEOF && t.Kind != tokIndent && t.Kind != tokDedent {
+			toks = append(toks, t)
+		}
+	}
+	if len(toks) == 0 {
+		return goExpr{}, cannot("empty expression")
+	}
+	x := &exprTranslator{toks: toks, c: c}
+	e, err := x.ternary()
+	if err != nil {
+		return goExpr{}, err
+	}
+	if x.i < len(x.toks) {
+		return goExpr{}, cannot("unsupported syntax near %q", x.toks[x.i].Value)
+	}
+	return e, nil
+}
+
+// value translates an expression that must produce a value
+func (c *templContext) value(expr string) (string, error) {
+	e, err := c.translateExpr(expr)
+	if err != nil {
+		return "", err
+	}
+	if e.Component {
+		return "", cannot("macro call used as a value")
+	}
+	return e.Code, nil
+}
+
+func (x *exprTranslator) peek() string {
+	if x.i < len(x.toks) {
+		return x.toks[x.i].Value
+	}
+	return ""
+}
+
+func (x *exprTranslator) accept(v string) bool {
+	if x.peek() == v {
+		x.i++
+		return true
+	}
+	return false
+}
+
+func (x *exprTranslator) expect(v string) error {
+	if !x.accept(v) {
+		return cannot("expected %q", v)
+	}
+	return nil
+}
+
+// ternary: a if cond else b
+func (x *exprTranslator) ternary() (goExpr, error) {
+	a, err := x.or()
+	if err != nil || !x.accept("if") {
+		return a, err
+	}
+	cond, err := x.or()
+	if err != nil {
+		return a, err
+	}
+	b := goExpr{Code: `""`}
+	if x.accept("else") {
+		if b, err = x.ternary(); err != nil {
+			return a, err
+		}
+	}
+	if a.Component || b.Component {
+		return a, cannot("macro call in a conditional expression")
+	}
+	return goExpr{Code: fmt.Sprintf("jChoose(jTruthy(%s), %s, %s)", cond.Code, a.Code, b.Code)}, nil
+}
+
+func (x *exprTranslator) or() (goExpr, error) {
+	return x.binary(x.and, map[string]string{"or": "jOr(%s, %s)"})
+}
+
+func (x *exprTranslator) and() (goExpr, error) {
+	return x.binary(x.not, map[string]string{"and": "jAnd(%s, %s)"})
+}
+
+func (x *exprTranslator) not() (goExpr, error) {
+	if x.accept("not") {
+		e, err := x.not()
+		return goExpr{Code: fmt.Sprintf("!jTruthy(%s)", e.Code)}, err
+	}
+	return x.compare()
+}
+
+// compare handles comparisons, membership and tests
+func (x *exprTranslator) compare() (goExpr, error) {
+	a, err := x.concat()
+	if err != nil {
+		return a, err
+	}
+	ops := map[string]string{"==": "jEq(%s, %s)", "!=": "!jEq(%s, %s)", "<": "jLt(%s, %s)", ">": "jLt(%[2]s, %[1]s)", "<=": "!jLt(%[2]s, %[1]s)", ">=": "!jLt(%s, %s)"}
+	for {
+		op := x.peek()
+		switch {
+		case ops[op] != "":
+			x.i++
+			b, err := x.concat()
+			if err != nil {
+				return a, err
+			}
+			a = goExpr{Code: fmt.Sprintf(ops[op], a.Code, b.Code)}
+		case op == "in" || (op == "not" && x.i+1 < len(x.toks) && x.toks[x.i+1].Value == "in"):
+			negate := x.accept("not")
+			x.i++
+			b, err := x.concat()
+			if err != nil {
+				return a, err
+			}
+			a = goExpr{Code: fmt.Sprintf("jContains(%s, %s)", b.Code, a.Code)}
+			if negate {
+				a.Code = "!" + a.Code
+			}
+		case op == "is":
+			x.i++
+			negate := x.accept("not")
+			test := x.peek()
+			x.i++
+			var code string
+			switch test {
+			case "defined":
+				code = fmt.Sprintf("!jIsNil(%s)", a.Code)
+			case "undefined", "none", "None":
+				code = fmt.Sprintf("jIsNil(%s)", a.Code)
+			case "true", "True":
+				code = fmt.Sprintf("jEq(%s, true)", a.Code)
+			case "false", "False":
+				code = fmt.Sprintf("jEq(%s, false)", a.Code)
+			case "even", "odd":
+				code = fmt.Sprintf("(jInt(%s)%%2 == %d)", a.Code, map[string]int{"even": 0, "odd": 1}[test])
+			case "string":
+				code = fmt.Sprintf("jIsString(%s)", a.Code)
+			case "number":
+				code = fmt.Sprintf("jIsNumber(%s)", a.Code)
+			default:
+				return a, cannot("unsupported test %q", test)
+			}
+			if negate {
+				code = "!(" + code + ")"
+			}
+			a = goExpr{Code: code}
+		default:
+			return a, nil
+		}
+	}
+}
+
+func (x *exprTranslator) concat() (goExpr, error) {
+	return x.binary(x.additive, map[string]string{"~": "jConcat(%s, %s)"})
+}
+
+func (x *exprTranslator) additive() (goExpr, error) {
+	return x.binary(x.multiplicative, map[string]string{"+": "jAdd(%s, %s)", "-": "jSub(%s, %s)"})
+}
+
+func (x *exprTranslator) multiplicative() (goExpr, error) {
+	return x.binary(x.unary, map[string]string{"*": "jMul(%s, %s)", "/": "jDiv(%s, %s)", "//": "jFloorDiv(%s, %s)", "%": "jMod(%s, %s)"})
+}
+
+// binary parses left-associative operators with the given Go templates
+func (x *exprTranslator) binary(next func() (goExpr, error), ops map[string]string) (goExpr, error) {
+	a, err := next()
+	if err != nil {
+		return a, err
+	}
+	for ops[x.peek()] != "" {
+		format := ops[x.peek()]
+		x.i++
+		b, err := next()
+		if err != nil {
+			return a, err
+		}
+		if a.Component || b.Component {
+			return a, cannot("macro call used in an expression")
+		}
+		a = goExpr{Code: fmt.Sprintf(format, a.Code, b.Code)}
+	}
+	return a, nil
+}
+
+func (x *exprTranslator) unary() (goExpr, error) {
+	if x.accept("-") {
+		e, err := x.unary()
+		return goExpr{Code: fmt.Sprintf("jSub(0, %s)", e.Code)}, err
+	}
+	x.accept("+")
+	return x.filtered()
+}
+
+// filtered parses value|filter(args)|filter
+func (x *exprTranslator) filtered() (goExpr, error) {
+	e, err := x.postfix()
+	if err != nil {
+		return e, err
+	}
+	for x.accept("|") {
+		if x.i >= len(x.toks) {
+			return e, cannot("missing filter name")
+		}
+		name := x.toks[x.i].Value
+		x.i++
+		var args []string
+		if x.peek() == "(" {
+			if args, err = x.callArgs(nil); err != nil {
+				return e, err
+			}
+		}
+		if name == "safe" {
+			e.Raw = true
+			continue
+		}
+		helper, ok := templFilters[name]
+		if !ok {
+			return e, cannot("unsupported filter %q", name)
+		}
+		if e.Component {
+			return e, cannot("filter applied to a macro call")
+		}
+		if helper != "" {
+			e = goExpr{Code: helper + "(" + strings.Join(append([]string{e.Code}, args...), ", ") + ")", Raw: e.Raw}
+		}
+	}
+	return e, nil
+}
+
+// postfix parses attribute access, subscripts and calls
+func (x *exprTranslator) postfix() (goExpr, error) {
+	if x.i >= len(x.toks) {
+		return goExpr{}, cannot("unexpected end of expression")
+	}
+	t := x.toks[x.i]
+
+	// Names that are only meaningful with what follows them
+	if t.Kind == tokName {
+		switch {
+		case t.Value == "loop" && x.c.loop() != nil:
+			return x.loopAttribute()
+		case x.i+1 < len(x.toks) && x.toks[x.i+1].Value == "(":
+			x.i++
+			return x.call(t.Value, "")
+		case x.i+3 < len(x.toks) && x.toks[x.i+1].Value == "." && x.toks[x.i+3].Value == "(" && x.c.importAlias(t.Value) != "":
+			x.i += 3
+			return x.call(x.toks[x.i-1].Value, t.Value)
+		}
+	}
+
+	e, err := x.primary()
+	if err != nil {
+		return e, err
+	}
+	for {
+		switch {
+		case x.accept("."):
+			if x.i >= len(x.toks) || x.toks[x.i].Kind != tokName {
+				return e, cannot("invalid attribute access")
+			}
+			name := x.toks[x.i].Value
+			x.i++
+			if x.peek() == "(" {
+				return e, cannot("method call .%s()", name)
+			}
+			e = goExpr{Code: fmt.Sprintf("jAttr(%s, %s)", e.Code, strconv.Quote(name))}
+		case x.accept("["):
+			key, err := x.ternary()
+			if err != nil {
+				return e, err
+			}
+			if x.peek() == ":" {
+				return e, cannot("slices")
+			}
+			if err := x.expect("]"); err != nil {
+				return e, err
+			}
+			e = goExpr{Code: fmt.Sprintf("jItem(%s, %s)", e.Code, key.Code)}
+		case x.peek() == "(":
+			return e, cannot("call of an expression")
+		default:
+			return e, nil
+		}
+	}
+}
+
+func (x *exprTranslator) primary() (goExpr, error) {
+	t := x.toks[x.i]
+	x.i++
+	switch t.Kind {
+	case tokString:
+		if isFString(t.Value) {
+			return goExpr{}, cannot("f-string")
+		}
+		s := stringLiteralValue(t.Value)
+		for x.i < len(x.toks) && x.toks[x.i].Kind == tokString {
+			s += stringLiteralValue(x.toks[x.i].Value)
+			x.i++
+		}
+		return goExpr{Code: strconv.Quote(s)}, nil
+	case tokNumber:
+		return goExpr{Code: strings.ReplaceAll(t.Value, "_", "")}, nil
+	case tokName:
+		switch t.Value {
+		case "true", "True":
+			return goExpr{Code: "true"}, nil
+		case "false", "False":
+			return goExpr{Code: "false"}, nil
+		case "none", "None":
+			return goExpr{Code: "nil"}, nil
+		}
+		code, err := x.c.resolve(t.Value)
+		return goExpr{Code: code}, err
+	}
+	switch t.Value {
+	case "(":
+		e, err := x.ternary()
+		if err != nil {
+			return e, err
+		}
+		if x.peek() == "," {
+			return e, cannot("tuples")
+		}
+		return goExpr{Code: "(" + e.Code + ")"}, x.expect(")")
+	case "[":
+		var items []string
+		for !x.accept("]") {
+			e, err := x.ternary()
+			if err != nil {
+				return e, err
+			}
+			items = append(items, e.Code)
+			if !x.accept(",") && x.peek() != "]" {
+				return e, cannot("invalid list literal")
+			}
+		}
+		return goExpr{Code: "[]any{" + strings.Join(items, ", ") + "}"}, nil
+	}
+	return goExpr{}, cannot("unsupported syntax %q", t.Value)
+}
+
+// loopAttribute translates loop.index, loop.first, loop.cycle(...) and friends
+func (x *exprTranslator) loopAttribute() (goExpr, error) {
+	l := x.c.loop()
+	x.i++
+	if !x.accept(".") || x.i >= len(x.toks) {
+		return goExpr{}, cannot("loop used as a value")
+	}
+	attr := x.toks[x.i].Value
+	x.i++
+	l.indexUsed = true
+	switch attr {
+	case "index":
+		return goExpr{Code: fmt.Sprintf("(%s + 1)", l.index)}, nil
+	case "index0":
+		return goExpr{Code: l.index}, nil
+	case "revindex":
+		return goExpr{Code: fmt.Sprintf("(jLen(%s) - %s)", l.list, l.index)}, nil
+	case "revindex0":
+		return goExpr{Code: fmt.Sprintf("(jLen(%s) - %s - 1)", l.list, l.index)}, nil
+	case "first":
+		return goExpr{Code: fmt.Sprintf("(%s == 0)", l.index)}, nil
+	case "last":
+		return goExpr{Code: fmt.Sprintf("(%s == jLen(%s)-1)", l.index, l.list)}, nil
+	case "length":
+		return goExpr{Code: fmt.Sprintf("jLen(%s)", l.list)}, nil
+	case "cycle":
+		args, err := x.callArgs(nil)
+		if err != nil {
+			return goExpr{}, err
+		}
+		return goExpr{Code: fmt.Sprintf("jCycle(%s, %s)", l.index, strings.Join(args, ", "))}, nil
+	}
+	return goExpr{}, cannot("loop.%s", attr)
+}
+
+// callArgs parses "(a, b, k=v)". Keyword arguments are only accepted when
+// kwargs is not nil and are stored there in order.
+func (x *exprTranslator) callArgs(kwargs *[][2]string) ([]string, error) {
+	if err := x.expect("("); err != nil {
+		return nil, err
+	}
+	var args []string
+	for !x.accept(")") {
+		if x.i+1 < len(x.toks) && x.toks[x.i].Kind == tokName && x.toks[x.i+1].Value == "=" {
+			if kwargs == nil {
+				return nil, cannot("keyword arguments")
+			}
+			name := x.toks[x.i].Value
+			x.i += 2
+			e, err := x.ternary()
+			if err != nil {
+				return nil, err
+			}
+			*kwargs = append(*kwargs, [2]string{name, e.Code})
+		} else {
+			e, err := x.ternary()
+			if err != nil {
+				return nil, err
+			}
+			if e.Component {
+				return nil, cannot("macro call used as an argument")
+			}
+			args = append(args, e.Code)
+		}
+		if !x.accept(",") && x.peek() != ")" {
+			return nil, cannot("invalid argument list")
+		}
+	}
+	return args, nil
+}
+
+// call translates calls of url_for, range, super and macros. alias is set for
+// macros called through an import alias (m.render_field(...)).
+func (x *exprTranslator) call(name, alias string) (goExpr, error) {
+	var kwargs [][2]string
+	args, err := x.callArgs(&kwargs)
+	if err != nil {
+		return goExpr{}, err
+	}
+	if alias == "" {
+		switch name {
+		case "url_for":
+			return x.c.urlFor(args, kwargs)
+		case "range":
+			if len(kwargs) > 0 {
+				return goExpr{}, cannot("range with keyword arguments")
+			}
+			return goExpr{Code: "jRange(" + strings.Join(args, ", ") + ")"}, nil
+		case "super":
+			return x.c.superBlock()
+		}
+	}
+	return x.c.macroCall(name, alias, args, kwargs)
+}
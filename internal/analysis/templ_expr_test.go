@@ -0,0 +1,51 @@
+package analysis
+
+import (
+	"go/parser"
+	"testing"
+)
+
+func TestTranslateExpr(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+		raw  bool
+		err  string // reason the expression is untranslatable
+	}{
+		{expr: "user.name", want: `jAttr(data.User, "name")`},
+		{expr: "items|length", want: "jLen(data.Items)"},
+		{expr: "name|default('anon')|upper", want: `jUpper(jDefault(data.Name, "anon"))`},
+		{expr: "user.name|safe", want: `jAttr(data.User, "name")`, raw: true},
+		{expr: "a if b else c", want: "jChoose(jTruthy(data.B), data.A, data.C)"},
+		{expr: "x == 1 and not y", want: "jAnd(jEq(data.X, 1), !jTruthy(data.Y))"},
+		{expr: "'a' ~ name", want: `jConcat("a", data.Name)`},
+		{expr: "item.price * 2", want: `jMul(jAttr(item, "price"), 2)`},
+		{expr: "items[0]", want: "jItem(data.Items, 0)"},
+		{expr: "f'{x}'", err: "f-string"},
+		{expr: "(1, 2)", err: "tuples"},
+	}
+	tr := &templTranslator{p: &Project{}, byName: map[string]*Template{}, extended: map[string]bool{}, routes: map[string]Route{}, files: map[string]*templFile{}}
+	f := &templFile{t: &Template{Name: "page.html"}, comp: "Page", fields: map[string]bool{}}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			c := tr.context(f)
+			c.scope["item"] = "item"
+			got, err := c.translateExpr(tt.expr)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.Code != tt.want || got.Raw != tt.raw {
+				t.Errorf("got %q (raw %v), want %q (raw %v)", got.Code, got.Raw, tt.want, tt.raw)
+			}
+			if _, err := parser.ParseExpr(got.Code); err != nil {
+				t.Errorf("%q is not a Go expression: %v", got.Code, err)
+			}
+		})
+	}
+}
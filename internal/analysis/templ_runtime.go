@@ -0,0 +1,586 @@
+package analysis
+
+// templRuntime is written next to the translated components. It gives the
+// loosely typed Jinja values the semantics the templates were written against.
+const templRuntime = `// Code generated by lcma. DO NOT EDIT.
+
+package views
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/a-h/templ"
+)
+
+// jTODO marks Jinja the translator could not convert
+func jTODO(jinja string) templ.Component {
+	return templ.ComponentFunc(func(ctx context.Context, w io.Writer) error {
+		_, err := io.WriteString(w, "<!-- LLM-TODO: "+html.EscapeString(jinja)+" -->")
+		return err
+	})
+}
+
+// jTODOValue marks an attribute value the translator could not convert
+func jTODOValue(jinja string) string {
+	return ""
+}
+
+// jBlock returns the block a child template overrides, or the default
+func jBlock(override, fallback templ.Component) templ.Component {
+	if override != nil {
+		return override
+	}
+	return fallback
+}
+
+func jDeref(v any) reflect.Value {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return reflect.Value{}
+		}
+		rv = rv.Elem()
+	}
+	return rv
+}
+
+func jNumber(v any) (float64, bool) {
+	rv := jDeref(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+func jIsInt(v any) bool {
+	switch jDeref(v).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+func jIsNil(v any) bool { return !jDeref(v).IsValid() }
+
+func jIsString(v any) bool { return jDeref(v).Kind() == reflect.String }
+
+func jIsNumber(v any) bool {
+	_, ok := jNumber(v)
+	return ok
+}
+
+// jTruthy follows Python truthiness
+func jTruthy(v any) bool {
+	rv := jDeref(v)
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return false
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return rv.Len() > 0
+	case reflect.Struct:
+		return true
+	}
+	return !rv.IsZero()
+}
+
+// jStr renders a value like Jinja does; nil renders as an empty string
+func jStr(v any) string {
+	rv := jDeref(v)
+	if !rv.IsValid() {
+		return ""
+	}
+	switch x := rv.Interface().(type) {
+	case string:
+		return x
+	case fmt.Stringer:
+		return x.String()
+	case bool:
+		if x {
+			return "True"
+		}
+		return "False"
+	}
+	return fmt.Sprint(rv.Interface())
+}
+
+// jAttr reads a map key or struct field; user_name matches UserName
+func jAttr(v any, name string) any {
+	rv := jDeref(v)
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() == reflect.String {
+			if x := rv.MapIndex(reflect.ValueOf(name).Convert(rv.Type().Key())); x.IsValid() {
+				return x.Interface()
+			}
+		}
+	case reflect.Struct:
+		want := strings.ReplaceAll(name, "_", "")
+		f := rv.FieldByNameFunc(func(field string) bool { return strings.EqualFold(field, want) })
+		if f.IsValid() && f.CanInterface() {
+			return f.Interface()
+		}
+	}
+	return nil
+}
+
+// jItem reads x[key] from maps, slices and strings
+func jItem(v, key any) any {
+	rv := jDeref(v)
+	switch rv.Kind() {
+	case reflect.Map:
+		k := reflect.ValueOf(key)
+		if k.IsValid() && k.Type().ConvertibleTo(rv.Type().Key()) {
+			if x := rv.MapIndex(k.Convert(rv.Type().Key())); x.IsValid() {
+				return x.Interface()
+			}
+		}
+		return nil
+	case reflect.Slice, reflect.Array, reflect.String:
+		i, ok := jNumber(key)
+		if !ok {
+			return nil
+		}
+		n := int(i)
+		if n < 0 {
+			n += rv.Len()
+		}
+		if n < 0 || n >= rv.Len() {
+			return nil
+		}
+		return rv.Index(n).Interface()
+	case reflect.Struct:
+		return jAttr(v, jStr(key))
+	}
+	return nil
+}
+
+// jList iterates slices, map keys in sorted order and the characters of strings
+func jList(v any) []any {
+	rv := jDeref(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		out := make([]any, rv.Len())
+		for i := range out {
+			out[i] = rv.Index(i).Interface()
+		}
+		return out
+	case reflect.Map:
+		keys := rv.MapKeys()
+		out := make([]any, len(keys))
+		for i, k := range keys {
+			out[i] = k.Interface()
+		}
+		sort.Slice(out, func(i, j int) bool { return jLt(out[i], out[j]) })
+		return out
+	case reflect.String:
+		var out []any
+		for _, r := range rv.String() {
+			out = append(out, string(r))
+		}
+		return out
+	}
+	return nil
+}
+
+// jItems is dict.items(): key, value pairs of a map, or the pairs of a list
+func jItems(v any) [][2]any {
+	rv := jDeref(v)
+	var out [][2]any
+	if rv.Kind() == reflect.Map {
+		for _, k := range jList(v) {
+			out = append(out, [2]any{k, rv.MapIndex(reflect.ValueOf(k)).Interface()})
+		}
+		return out
+	}
+	for _, pair := range jList(v) {
+		out = append(out, [2]any{jItem(pair, 0), jItem(pair, 1)})
+	}
+	return out
+}
+
+func jLen(v any) int {
+	rv := jDeref(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.String:
+		if rv.Kind() == reflect.String {
+			return len([]rune(rv.String()))
+		}
+		return rv.Len()
+	}
+	return 0
+}
+
+func jEq(a, b any) bool {
+	x, okA := jNumber(a)
+	y, okB := jNumber(b)
+	if okA && okB {
+		return x == y
+	}
+	ra, rb := jDeref(a), jDeref(b)
+	if !ra.IsValid() || !rb.IsValid() {
+		return ra.IsValid() == rb.IsValid()
+	}
+	return reflect.DeepEqual(ra.Interface(), rb.Interface())
+}
+
+func jLt(a, b any) bool {
+	x, okA := jNumber(a)
+	y, okB := jNumber(b)
+	if okA && okB {
+		return x < y
+	}
+	return jStr(a) < jStr(b)
+}
+
+// jContains is the in operator: substring, map key or list element
+func jContains(container, v any) bool {
+	rv := jDeref(container)
+	switch rv.Kind() {
+	case reflect.String:
+		return strings.Contains(rv.String(), jStr(v))
+	case reflect.Map:
+		return jItem(container, v) != nil
+	}
+	for _, x := range jList(container) {
+		if jEq(x, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func jChoose(cond bool, a, b any) any {
+	if cond {
+		return a
+	}
+	return b
+}
+
+func jOr(a, b any) any {
+	if jTruthy(a) {
+		return a
+	}
+	return b
+}
+
+func jAnd(a, b any) any {
+	if !jTruthy(a) {
+		return a
+	}
+	return b
+}
+
+func jConcat(a, b any) string { return jStr(a) + jStr(b) }
+
+func jArith(a, b any, op func(x, y float64) float64) any {
+	x, _ := jNumber(a)
+	y, _ := jNumber(b)
+	r := op(x, y)
+	if jIsInt(a) && jIsInt(b) {
+		return int(r)
+	}
+	return r
+}
+
+func jAdd(a, b any) any {
+	if jIsString(a) && jIsString(b) {
+		return jStr(a) + jStr(b)
+	}
+	return jArith(a, b, func(x, y float64) float64 { return x + y })
+}
+
+func jSub(a, b any) any { return jArith(a, b, func(x, y float64) float64 { return x - y }) }
+
+func jMul(a, b any) any { return jArith(a, b, func(x, y float64) float64 { return x * y }) }
+
+func jDiv(a, b any) any {
+	x, _ := jNumber(a)
+	y, _ := jNumber(b)
+	return x / y
+}
+
+func jFloorDiv(a, b any) any {
+	return jArith(a, b, func(x, y float64) float64 { return math.Floor(x / y) })
+}
+
+func jMod(a, b any) any {
+	return jArith(a, b, func(x, y float64) float64 { return x - y*math.Floor(x/y) })
+}
+
+func jInt(v any, args ...any) int {
+	if x, ok := jNumber(v); ok {
+		return int(x)
+	}
+	if x, err := strconv.ParseFloat(strings.TrimSpace(jStr(v)), 64); err == nil {
+		return int(x)
+	}
+	if len(args) > 0 {
+		return jInt(args[0])
+	}
+	return 0
+}
+
+func jFloat(v any, args ...any) float64 {
+	if x, ok := jNumber(v); ok {
+		return x
+	}
+	if x, err := strconv.ParseFloat(strings.TrimSpace(jStr(v)), 64); err == nil {
+		return x
+	}
+	if len(args) > 0 {
+		return jFloat(args[0])
+	}
+	return 0
+}
+
+func jUpper(v any) string { return strings.ToUpper(jStr(v)) }
+
+func jLower(v any) string { return strings.ToLower(jStr(v)) }
+
+func jTrim(v any, args ...any) string {
+	if len(args) > 0 {
+		return strings.Trim(jStr(v), jStr(args[0]))
+	}
+	return strings.TrimSpace(jStr(v))
+}
+
+func jTitle(v any) string {
+	out := []rune(strings.ToLower(jStr(v)))
+	start := true
+	for i, r := range out {
+		if start && unicode.IsLetter(r) {
+			out[i] = unicode.ToUpper(r)
+		}
+		start = !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	}
+	return string(out)
+}
+
+func jCapitalize(v any) string {
+	s := []rune(strings.ToLower(jStr(v)))
+	if len(s) > 0 {
+		s[0] = unicode.ToUpper(s[0])
+	}
+	return string(s)
+}
+
+// jDefault is the default filter: default(value, boolean=false)
+func jDefault(v any, args ...any) any {
+	if jIsNil(v) || (len(args) > 1 && jTruthy(args[1]) && !jTruthy(v)) {
+		if len(args) > 0 {
+			return args[0]
+		}
+		return ""
+	}
+	return v
+}
+
+// jJoin is the join filter: join(value, separator, attribute)
+func jJoin(v any, args ...any) string {
+	var parts []string
+	for _, x := range jList(v) {
+		if len(args) > 1 {
+			x = jAttr(x, jStr(args[1]))
+		}
+		parts = append(parts, jStr(x))
+	}
+	sep := ""
+	if len(args) > 0 {
+		sep = jStr(args[0])
+	}
+	return strings.Join(parts, sep)
+}
+
+func jFirst(v any) any {
+	if l := jList(v); len(l) > 0 {
+		return l[0]
+	}
+	return nil
+}
+
+func jLast(v any) any {
+	if l := jList(v); len(l) > 0 {
+		return l[len(l)-1]
+	}
+	return nil
+}
+
+func jReplace(v, old, repl any, args ...any) string {
+	n := -1
+	if len(args) > 0 {
+		n = jInt(args[0])
+	}
+	return strings.Replace(jStr(v), jStr(old), jStr(repl), n)
+}
+
+// jTruncate is the truncate filter: truncate(value, length=255, killwords=false, end="...")
+func jTruncate(v any, args ...any) string {
+	s := []rune(jStr(v))
+	length, end := 255, "..."
+	if len(args) > 0 {
+		length = jInt(args[0])
+	}
+	if len(args) > 2 {
+		end = jStr(args[2])
+	}
+	if len(s) <= length {
+		return string(s)
+	}
+	cut := length - len([]rune(end))
+	if cut < 0 {
+		cut = 0
+	}
+	out := string(s[:cut])
+	if len(args) < 2 || !jTruthy(args[1]) {
+		if i := strings.LastIndex(out, " "); i > 0 {
+			out = out[:i]
+		}
+	}
+	return out + end
+}
+
+// jRound is the round filter: round(value, precision=0, method="common")
+func jRound(v any, args ...any) float64 {
+	x := jFloat(v)
+	precision := 0
+	if len(args) > 0 {
+		precision = jInt(args[0])
+	}
+	scale := math.Pow(10, float64(precision))
+	switch {
+	case len(args) > 1 && jStr(args[1]) == "ceil":
+		return math.Ceil(x*scale) / scale
+	case len(args) > 1 && jStr(args[1]) == "floor":
+		return math.Floor(x*scale) / scale
+	}
+	return math.Round(x*scale) / scale
+}
+
+func jAbs(v any) any {
+	if x, ok := jNumber(v); ok && x < 0 {
+		return jSub(0, v)
+	}
+	return v
+}
+
+// jSum is the sum filter: sum(value, attribute, start=0)
+func jSum(v any, args ...any) any {
+	var total any = 0
+	if len(args) > 1 {
+		total = args[1]
+	}
+	for _, x := range jList(v) {
+		if len(args) > 0 && !jIsNil(args[0]) {
+			x = jAttr(x, jStr(args[0]))
+		}
+		total = jAdd(total, x)
+	}
+	return total
+}
+
+func jReverse(v any) any {
+	if jIsString(v) {
+		r := []rune(jStr(v))
+		for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+			r[i], r[j] = r[j], r[i]
+		}
+		return string(r)
+	}
+	l := jList(v)
+	out := make([]any, len(l))
+	for i, x := range l {
+		out[len(l)-1-i] = x
+	}
+	return out
+}
+
+// jSort is the sort filter: sort(value, reverse=false, case_sensitive=false, attribute)
+func jSort(v any, args ...any) []any {
+	l := jList(v)
+	key := func(x any) any {
+		if len(args) > 2 {
+			x = jAttr(x, jStr(args[2]))
+		}
+		if jIsString(x) && (len(args) < 2 || !jTruthy(args[1])) {
+			return strings.ToLower(jStr(x))
+		}
+		return x
+	}
+	sort.SliceStable(l, func(i, j int) bool { return jLt(key(l[i]), key(l[j])) })
+	if len(args) > 0 && jTruthy(args[0]) {
+		return jReverse(l).([]any)
+	}
+	return l
+}
+
+var jTags = regexp.MustCompile("<[^>]*>")
+
+func jStripTags(v any) string {
+	return strings.Join(strings.Fields(html.UnescapeString(jTags.ReplaceAllString(jStr(v), ""))), " ")
+}
+
+func jURLEncode(v any) string { return url.QueryEscape(jStr(v)) }
+
+func jWordCount(v any) int { return len(strings.Fields(jStr(v))) }
+
+// jCycle is loop.cycle
+func jCycle(index int, values ...any) any {
+	if len(values) == 0 {
+		return nil
+	}
+	return values[index%len(values)]
+}
+
+// jRange is range(stop) or range(start, stop, step)
+func jRange(args ...any) []any {
+	start, stop, step := 0, 0, 1
+	switch len(args) {
+	case 1:
+		stop = jInt(args[0])
+	case 2:
+		start, stop = jInt(args[0]), jInt(args[1])
+	case 3:
+		start, stop, step = jInt(args[0]), jInt(args[1]), jInt(args[2])
+	}
+	var out []any
+	for i := start; step != 0 && (step > 0 && i < stop || step < 0 && i > stop); i += step {
+		out = append(out, i)
+	}
+	return out
+}
+
+// jPathParam escapes a URL path parameter
+func jPathParam(v any) string { return url.PathEscape(jStr(v)) }
+
+// jURL appends key, value pairs as the query string, like url_for does with
+// arguments that are not part of the rule
+func jURL(path string, query []any) string {
+	values := url.Values{}
+	for i := 0; i+1 < len(query); i += 2 {
+		values.Add(jStr(query[i]), jStr(query[i+1]))
+	}
+	if len(values) == 0 {
+		return path
+	}
+	return path + "?" + values.Encode()
+}
+`
@@ -0,0 +1,234 @@
+package analysis
+
+import (
+	"html"
+	"strconv"
+	"strings"
+)
+
+// Positions of the HTML scanner in templWriter
+const (
+	htmlContent = iota
+	htmlTag
+	htmlAttrValue
+	htmlComment
+)
+
+// htmlVoidElements never have a closing tag
+var htmlVoidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "source": true, "track": true, "wbr": true,
+}
+
+// templURLAttributes need a templ.SafeURL when their value is computed
+var templURLAttributes = map[string]bool{"href": true, "src": true, "action": true, "formaction": true}
+
+// templWriter builds Templ markup from template text and translated expressions.
+// It follows the HTML around the Jinja tags because Templ needs to know whether
+// an expression is element content, part of an attribute value or inside a tag.
+type templWriter struct {
+	sb    strings.Builder
+	state int
+	quote byte   // quote of the attribute value being written
+	tag   string // element being opened or closed, with a leading / for closing tags
+	raw   string // script or style element whose content is written verbatim
+	// depth counts open elements; it must match at the start and end of a branch
+	depth    int
+	minDepth int
+
+	attrStart int      // offset of the opening quote of the attribute value
+	attrName  string   // name of the attribute being written
+	attrParts []string // Go operands of a computed attribute value, nil while it is literal
+	attrLit   strings.Builder
+}
+
+// sub returns a writer continuing from the current HTML position, for branches
+// that are written separately and appended later
+func (w *templWriter) sub() *templWriter {
+	return &templWriter{state: w.state, quote: w.quote, tag: w.tag, raw: w.raw, attrName: w.attrName, attrParts: w.attrParts}
+}
+
+// balanced reports whether a sub writer ended where it started and did not
+// close elements it did not open
+func (w *templWriter) balanced(from *templWriter) bool {
+	return w.state == from.state && w.depth == 0 && w.minDepth == 0 && w.raw == from.raw
+}
+
+// text writes template text, escaping braces that Templ would read as expressions
+func (w *templWriter) text(s string) {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch w.state {
+		case htmlContent:
+			switch {
+			case w.raw != "":
+				if c == '<' && strings.HasPrefix(strings.ToLower(s[i:]), "</"+w.raw) {
+					w.raw = ""
+					w.openTag(s[i+1:])
+				}
+				w.sb.WriteByte(c)
+			case strings.HasPrefix(s[i:], "<!--"):
+				w.state = htmlComment
+				w.sb.WriteString("<!--")
+				i += 3
+			case c == '<' && i+1 < len(s) && (isHTMLNameByte(s[i+1]) || s[i+1] == '/'):
+				w.openTag(s[i+1:])
+				w.sb.WriteByte(c)
+			case c == '{' || c == '}':
+				w.sb.WriteString(`{ "` + string(c) + `" }`)
+			default:
+				w.sb.WriteByte(c)
+			}
+		case htmlComment:
+			if strings.HasPrefix(s[i:], "-->") {
+				w.state = htmlContent
+				w.sb.WriteString("-->")
+				i += 2
+				continue
+			}
+			w.sb.WriteByte(c)
+		case htmlTag:
+			switch {
+			case c == '"' || c == '\'':
+				if before := strings.TrimRight(w.sb.String(), " \t\r\n"); strings.HasSuffix(before, "=") {
+					w.state, w.quote = htmlAttrValue, c
+					w.attrStart = w.sb.Len()
+					w.attrName = strings.ToLower(trailingHTMLName(strings.TrimRight(strings.TrimSuffix(before, "="), " \t\r\n")))
+					w.attrParts = nil
+				}
+				w.sb.WriteByte(c)
+			case c == '>':
+				w.closeTag(strings.HasSuffix(w.sb.String(), "/"))
+				w.sb.WriteByte(c)
+			default:
+				w.sb.WriteByte(c)
+			}
+		case htmlAttrValue:
+			switch {
+			case c == w.quote:
+				w.endAttr()
+			case w.attrParts != nil:
+				w.attrLit.WriteByte(c)
+			default:
+				w.sb.WriteByte(c)
+			}
+		}
+	}
+}
+
+// openTag starts an element tag; s follows the "<"
+func (w *templWriter) openTag(s string) {
+	w.state = htmlTag
+	closing := strings.HasPrefix(s, "/")
+	s = strings.TrimPrefix(s, "/")
+	end := 0
+	for end < len(s) && isHTMLNameByte(s[end]) {
+		end++
+	}
+	w.tag = strings.ToLower(s[:end])
+	if closing {
+		w.tag = "/" + w.tag
+	}
+}
+
+// closeTag ends the current tag at ">"
+func (w *templWriter) closeTag(selfClosing bool) {
+	w.state = htmlContent
+	switch {
+	case strings.HasPrefix(w.tag, "/"):
+		w.depth--
+		if w.depth < w.minDepth {
+			w.minDepth = w.depth
+		}
+	case selfClosing || htmlVoidElements[w.tag] || w.tag == "":
+	default:
+		w.depth++
+		if w.tag == "script" || w.tag == "style" {
+			w.raw = w.tag
+		}
+	}
+}
+
+// endAttr finishes an attribute value at its closing quote
+func (w *templWriter) endAttr() {
+	w.state = htmlTag
+	if w.attrParts == nil {
+		w.sb.WriteByte(w.quote)
+		return
+	}
+	w.flushAttrLiteral()
+	value := strings.Join(w.attrParts, " + ")
+	if value == "" {
+		value = `""`
+	}
+	if templURLAttributes[w.attrName] {
+		value = "templ.URL(" + value + ")"
+	}
+	w.sb.WriteString("{ " + value + " }")
+	w.attrParts = nil
+}
+
+func (w *templWriter) flushAttrLiteral() {
+	if w.attrLit.Len() > 0 {
+		w.attrParts = append(w.attrParts, strconv.Quote(w.attrLit.String()))
+		w.attrLit.Reset()
+	}
+}
+
+// attrValue adds a Go string expression to the attribute value being written,
+// turning it into a computed attribute
+func (w *templWriter) attrValue(code string) {
+	if w.attrParts == nil {
+		literal := w.sb.String()[w.attrStart+1:]
+		rest := w.sb.String()[:w.attrStart]
+		w.sb.Reset()
+		w.sb.WriteString(rest)
+		w.attrParts = []string{}
+		w.attrLit.WriteString(literal)
+	}
+	w.flushAttrLiteral()
+	w.attrParts = append(w.attrParts, code)
+}
+
+// line writes Templ code such as "if x {" on a line of its own
+func (w *templWriter) line(code string) {
+	if s := w.sb.String(); s != "" && !strings.HasSuffix(s, "\n") {
+		w.sb.WriteByte('\n')
+	}
+	w.sb.WriteString(code)
+	w.sb.WriteByte('\n')
+}
+
+// append adds the output of a sub writer and takes over its HTML position
+func (w *templWriter) append(sub *templWriter) {
+	w.sb.WriteString(sub.sb.String())
+	w.state, w.quote, w.tag, w.raw = sub.state, sub.quote, sub.tag, sub.raw
+	w.depth += sub.depth
+	w.attrParts = sub.attrParts
+	w.attrLit.WriteString(sub.attrLit.String())
+}
+
+// todo marks Jinja that needs to be finished by hand where it appeared
+func (w *templWriter) todo(jinja string) {
+	switch w.state {
+	case htmlContent:
+		w.line("@jTODO(" + strconv.Quote(jinja) + ")")
+	case htmlAttrValue:
+		w.attrValue("jTODOValue(" + strconv.Quote(jinja) + ")")
+	case htmlTag:
+		w.sb.WriteString(` data-llm-todo="` + html.EscapeString(jinja) + `" `)
+	}
+}
+
+// trailingHTMLName returns the attribute name at the end of s
+func trailingHTMLName(s string) string {
+	i := len(s)
+	for i > 0 && (isHTMLNameByte(s[i-1]) || s[i-1] == '-' || s[i-1] == ':' || s[i-1] == '@') {
+		i--
+	}
+	return s[i:]
+}
+
+func isHTMLNameByte(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
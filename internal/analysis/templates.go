@@ -0,0 +1,586 @@
+package analysis
+
+import (
+	"fmt"
+	"lcma/internal/utils"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Template is a Jinja template with what it inherits, defines and needs
+type Template struct {
+	Name     string          `json:"name"` // name used in render_template, relative to templates/
+	Path     string          `json:"path"`
+	Extends  string          `json:"extends,omitempty"`
+	Includes []string        `json:"includes,omitempty"`
+	Imports  []string        `json:"imports,omitempty"`
+	Blocks   []TemplateBlock `json:"blocks,omitempty"`
+	Macros   []TemplateMacro `json:"macros,omitempty"`
+	Loops    []TemplateLoop  `json:"loops,omitempty"`
+	Filters  []string        `json:"filters,omitempty"`
+	URLFor   []string        `json:"url_for,omitempty"`
+	// Variables are the free variables the template itself references
+	Variables []string `json:"variables"`
+	// Context is every variable the rendered page needs, including the ones used
+	// by parent templates and includes
+	Context    []string         `json:"context"`
+	RenderedBy []TemplateRender `json:"rendered_by,omitempty"`
+	// Missing lists context variables that some render_template call does not pass
+	Missing []string `json:"missing,omitempty"`
+
+	nodes []*jinjaNode
+}
+
+// TemplateBlock is a {% block %}; Overrides is set when a parent defines it too
+type TemplateBlock struct {
+	Name      string `json:"name"`
+	Line      int    `json:"line"`
+	Overrides bool   `json:"overrides,omitempty"`
+}
+
+// TemplateMacro is a {% macro %} definition
+type TemplateMacro struct {
+	Name   string   `json:"name"`
+	Params []string `json:"params"`
+	Line   int      `json:"line"`
+}
+
+// TemplateLoop is a {% for %} loop
+type TemplateLoop struct {
+	Targets  []string `json:"targets"`
+	Iterable string   `json:"iterable"`
+	Line     int      `json:"line"`
+}
+
+// TemplateRender is a render_template call for a template
+type TemplateRender struct {
+	File      string   `json:"file"`
+	Line      int      `json:"line"`
+	Function  string   `json:"function,omitempty"`
+	Endpoints []string `json:"endpoints,omitempty"`
+	Variables []string `json:"variables"`
+	// Dynamic is set when the call passes **kwargs or locals() so the variables are not known
+	Dynamic bool `json:"dynamic,omitempty"`
+}
+
+// TemplateEdge is an extends, include or import between templates
+type TemplateEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Kind string `json:"kind"`
+}
+
+// templateInventory is the layout of templates.json
+type templateInventory struct {
+	Templates []*Template    `json:"templates"`
+	Edges     []TemplateEdge `json:"edges"`
+}
+
+// jinjaGlobals are names available in every Flask template, including the ones
+// injected by Flask-Login and Flask-WTF
+var jinjaGlobals = map[string]bool{
+	"current_user": true, "url_for": true, "get_flashed_messages": true, "request": true, "session": true, "g": true,
+	"config": true, "range": true, "dict": true, "lipsum": true, "cycler": true, "joiner": true,
+	"namespace": true, "loop": true, "self": true, "super": true, "caller": true, "varargs": true,
+	"kwargs": true, "csrf_token": true, "true": true, "false": true, "none": true, "True": true,
+	"False": true, "None": true,
+}
+
+var jinjaOperators = map[string]bool{"and": true, "or": true, "not": true, "in": true, "is": true, "if": true, "else": true}
+
+// analyzeTemplates parses the Jinja templates and links them to render_template calls
+func analyzeTemplates(p *Project) error {
+	byName := map[string]*Template{}
+	for _, f := range p.Corpus.Files {
+		if !isTemplateFile(f.Path) {
+			continue
+		}
+		t := parseTemplate(f.Path, f.Content)
+		byName[t.Name] = t
+		p.Templates = append(p.Templates, t)
+	}
+
+	renders := templateRenders(p)
+	var edges []TemplateEdge
+	for _, t := range p.Templates {
+		if t.Extends != "" {
+			edges = append(edges, TemplateEdge{From: t.Name, To: t.Extends, Kind: "extends"})
+			if parent := byName[t.Extends]; parent != nil {
+				for i := range t.Blocks {
+					t.Blocks[i].Overrides = inheritedBlock(parent, t.Blocks[i].Name, byName, map[string]bool{})
+				}
+			}
+		}
+		for _, inc := range t.Includes {
+			edges = append(edges, TemplateEdge{From: t.Name, To: inc, Kind: "include"})
+		}
+		for _, imp := range t.Imports {
+			edges = append(edges, TemplateEdge{From: t.Name, To: imp, Kind: "import"})
+		}
+
+		t.Context = templateContext(t, byName, map[string]bool{})
+		t.RenderedBy = renders[t.Name]
+		t.Missing = missingContext(t)
+	}
+
+	if err := utils.WriteReportJSON("templates.json", templateInventory{Templates: nonNil(p.Templates), Edges: nonNil(edges)}); err != nil {
+		return err
+	}
+	return utils.WriteReportFile("templates.md", []byte(templatesMarkdown(p.Templates, edges)))
+}
+
+func isTemplateFile(filePath string) bool {
+	switch strings.ToLower(path.Ext(filePath)) {
+	case ".html", ".htm", ".jinja", ".jinja2", ".j2":
+		return true
+	}
+	return false
+}
+
+// templateName returns the name render_template uses for a file: the path below
+// the last templates/ directory
+func templateName(filePath string) string {
+	if i := strings.LastIndex(filePath, "templates/"); i >= 0 {
+		return filePath[i+len("templates/"):]
+	}
+	return filePath
+}
+
+// parseTemplate extracts the structure and free variables of a template
+func parseTemplate(filePath, src string) *Template {
+	t := &Template{Name: templateName(filePath), Path: filePath, Variables: []string{}, Context: []string{}}
+	t.nodes = parseJinja(src)
+
+	free := map[string]bool{}
+	filters := map[string]bool{}
+	var walk func(nodes []*jinjaNode, scope map[string]bool)
+	use := func(expr string, scope map[string]bool) {
+		names, fs, targets := jinjaExprNames(expr)
+		for _, n := range names {
+			if !scope[n] && !jinjaGlobals[n] {
+				free[n] = true
+			}
+		}
+		for _, f := range fs {
+			filters[f] = true
+		}
+		for _, target := range targets {
+			t.URLFor = appendUnique(t.URLFor, target)
+		}
+	}
+	// Names bound by {% set %}, {% import %} and macros are visible to the rest of the template
+	top := map[string]bool{}
+
+	walk = func(nodes []*jinjaNode, scope map[string]bool) {
+		for _, n := range nodes {
+			switch n.Kind {
+			case jinjaOutput:
+				use(n.Expr, scope)
+				continue
+			case jinjaTag:
+			default:
+				continue
+			}
+
+			inner := scope
+			switch n.Tag {
+			case "extends":
+				if s, ok := literalString(n.Expr); ok {
+					t.Extends = s
+				} else {
+					use(n.Expr, scope)
+				}
+			case "include":
+				expr := strings.TrimSpace(strings.NewReplacer(" ignore missing", "", " with context", "", " without context", "").Replace(n.Expr))
+				if names := literalStrings(expr); len(names) > 0 {
+					for _, name := range names {
+						t.Includes = appendUnique(t.Includes, name)
+					}
+				} else {
+					use(expr, scope)
+				}
+			case "import", "from":
+				src, rest := n.Expr, ""
+				if k := strings.Index(n.Expr, " import "); n.Tag == "from" && k >= 0 {
+					src, rest = n.Expr[:k], n.Expr[k+len(" import "):]
+				} else if k := strings.Index(n.Expr, " as "); k >= 0 {
+					src, rest = n.Expr[:k], n.Expr[k:]
+				}
+				if s, ok := literalString(src); ok {
+					t.Imports = appendUnique(t.Imports, s)
+				}
+				for _, name := range importedNames(rest) {
+					top[name] = true
+				}
+			case "block":
+				fields := strings.Fields(n.Expr)
+				if len(fields) > 0 {
+					t.Blocks = append(t.Blocks, TemplateBlock{Name: fields[0], Line: n.Line})
+				}
+			case "macro":
+				name, params := macroSignature(n.Expr)
+				inner = extendScope(scope, params...)
+				t.Macros = append(t.Macros, TemplateMacro{Name: name, Params: params, Line: n.Line})
+				top[name] = true
+			case "call":
+				// {% call(item) render_list(items) %} passes item to the caller body
+				expr := n.Expr
+				if strings.HasPrefix(expr, "(") {
+					end := strings.Index(expr, ")")
+					if end < 0 {
+						end = len(expr) - 1
+					}
+					_, params := macroSignature("caller" + expr[:end+1])
+					inner = extendScope(scope, params...)
+					expr = expr[end+1:]
+				}
+				use(expr, scope)
+			case "for":
+				targets, iter := splitForTag(n.Expr)
+				t.Loops = append(t.Loops, TemplateLoop{Targets: targets, Iterable: iter, Line: n.Line})
+				use(iter, scope)
+				inner = extendScope(scope, targets...)
+				if k := strings.Index(n.Expr, " if "); k >= 0 {
+					use(n.Expr[k+4:], inner)
+				}
+			case "set", "with":
+				for _, assign := range splitTopLevelString(n.Expr, ",") {
+					name, value, found := strings.Cut(assign, "=")
+					for _, target := range strings.Split(name, ",") {
+						if target = strings.TrimSpace(target); target != "" {
+							if n.Tag == "set" {
+								top[target] = true
+							}
+							inner = extendScope(inner, target)
+						}
+					}
+					if found {
+						use(value, scope)
+					}
+				}
+			case "if", "filter", "autoescape":
+				use(n.Expr, scope)
+				if n.Tag == "filter" {
+					filters[strings.Fields(n.Expr + " ")[0]] = true
+				}
+			}
+
+			walk(n.Body, inner)
+			for _, b := range n.Branches {
+				use(b.Expr, scope)
+				walk(b.Body, scope)
+			}
+		}
+	}
+	// Names bound at the top level count wherever they are used, even before the binding
+	walk(t.nodes, top)
+	for name := range top {
+		delete(free, name)
+	}
+
+	t.Variables = sortedKeys(free)
+	t.Filters = sortedKeys(filters)
+	return t
+}
+
+// jinjaExprNames returns the root variable names, filters and url_for targets of an expression
+func jinjaExprNames(expr string) (names, filters, urlFor []string) {
+	toks := tokenizePython(expr)
+	depth := 0
+	for k, tok := range toks {
+		switch tok.Kind {
+		case tokOp:
+			switch tok.Value {
+			case "(", "[", "{":
+				depth++
+			case ")", "]", "}":
+				depth--
+			}
+			continue
+		case tokName:
+		default:
+			continue
+		}
+		var prev, next pyToken
+		if k > 0 {
+			prev = toks[k-1]
+		}
+		if k+1 < len(toks) {
+			next = toks[k+1]
+		}
+		switch {
+		case prev.Value == "." && prev.Kind == tokOp:
+		case prev.Value == "|" && prev.Kind == tokOp:
+			filters = appendUnique(filters, tok.Value)
+		case prev.Value == "is" || (prev.Value == "not" && k > 1 && toks[k-2].Value == "is"):
+			// test such as "is defined"
+		case next.Value == "=" && depth > 0:
+			// keyword argument
+		case jinjaOperators[tok.Value]:
+		default:
+			names = appendUnique(names, tok.Value)
+			if tok.Value == "url_for" && next.Value == "(" {
+				if end := matchingBracket(toks, k+1); end > k+2 {
+					if s, ok := literalString(joinValues(toks[k+2 : end])); ok {
+						urlFor = append(urlFor, s)
+					} else if args := splitTopLevel(toks[k+2:end], ","); len(args) > 0 {
+						if s, ok := literalString(joinValues(args[0])); ok {
+							urlFor = append(urlFor, s)
+						}
+					}
+				}
+			}
+		}
+	}
+	return names, filters, urlFor
+}
+
+// splitForTag splits "k, v in items.items() if x recursive" into targets and iterable
+func splitForTag(expr string) ([]string, string) {
+	before, after, found := strings.Cut(expr, " in ")
+	if !found {
+		return nil, expr
+	}
+	var targets []string
+	for _, t := range strings.Split(strings.Trim(before, "() "), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			targets = append(targets, t)
+		}
+	}
+	after = strings.TrimSuffix(strings.TrimSpace(after), " recursive")
+	if k := strings.Index(after, " if "); k >= 0 {
+		after = after[:k]
+	}
+	return targets, strings.TrimSpace(after)
+}
+
+// macroSignature parses "name(a, b=1)" into the name and parameter names
+func macroSignature(expr string) (string, []string) {
+	open := strings.Index(expr, "(")
+	if open < 0 {
+		return strings.TrimSpace(expr), nil
+	}
+	end := strings.Index(expr, ")")
+	if end < open {
+		end = len(expr)
+	}
+	params := []string{}
+	for _, part := range strings.Split(expr[open+1:end], ",") {
+		name, _, _ := strings.Cut(part, "=")
+		if name = strings.TrimSpace(name); name != "" {
+			params = append(params, name)
+		}
+	}
+	return strings.TrimSpace(expr[:open]), params
+}
+
+// importedNames returns the names bound by "as x" or "a as b, c"
+func importedNames(rest string) []string {
+	rest = strings.TrimSuffix(strings.TrimSpace(rest), " with context")
+	rest = strings.TrimSuffix(rest, " without context")
+	var names []string
+	for _, part := range strings.Split(rest, ",") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 {
+			continue
+		}
+		names = append(names, fields[len(fields)-1])
+	}
+	return names
+}
+
+// splitTopLevelString splits s at sep outside brackets and strings
+func splitTopLevelString(s, sep string) []string {
+	toks := tokenizePython(s)
+	var parts []string
+	for _, group := range splitTopLevel(toks, sep) {
+		if len(group) == 0 {
+			continue
+		}
+		parts = append(parts, s[group[0].Pos:group[len(group)-1].End])
+	}
+	return parts
+}
+
+func extendScope(scope map[string]bool, names ...string) map[string]bool {
+	out := make(map[string]bool, len(scope)+len(names))
+	for k := range scope {
+		out[k] = true
+	}
+	for _, n := range names {
+		out[n] = true
+	}
+	return out
+}
+
+// inheritedBlock reports whether t or one of its ancestors defines block name
+func inheritedBlock(t *Template, name string, byName map[string]*Template, seen map[string]bool) bool {
+	if seen[t.Name] {
+		return false
+	}
+	seen[t.Name] = true
+	for _, b := range t.Blocks {
+		if b.Name == name {
+			return true
+		}
+	}
+	if parent := byName[t.Extends]; parent != nil {
+		return inheritedBlock(parent, name, byName, seen)
+	}
+	return false
+}
+
+// templateContext returns the variables of t, its ancestors and its includes
+func templateContext(t *Template, byName map[string]*Template, seen map[string]bool) []string {
+	if seen[t.Name] {
+		return nil
+	}
+	seen[t.Name] = true
+	vars := map[string]bool{}
+	for _, v := range t.Variables {
+		vars[v] = true
+	}
+	related := append([]string{t.Extends}, t.Includes...)
+	for _, name := range related {
+		if other := byName[name]; other != nil {
+			for _, v := range templateContext(other, byName, seen) {
+				vars[v] = true
+			}
+		}
+	}
+	return sortedKeys(vars)
+}
+
+// templateRenders finds render_template calls with a literal template name
+func templateRenders(p *Project) map[string][]TemplateRender {
+	endpoints := map[string][]string{}
+	for _, r := range p.Routes {
+		key := r.Module + ":" + r.Handler
+		endpoints[key] = appendUnique(endpoints[key], r.Endpoint)
+	}
+
+	renders := map[string][]TemplateRender{}
+	for _, m := range p.Modules {
+		for _, fn := range moduleFunctions(m) {
+			for _, c := range fn.Calls {
+				if lastSegment(c.Name) != "render_template" {
+					continue
+				}
+				name, ok := literalString(positionalArg(c.Args, 0, "template_name_or_list"))
+				if !ok {
+					continue
+				}
+				r := TemplateRender{File: m.Path, Line: c.Line, Function: fn.Qualname, Endpoints: endpoints[m.Name+":"+fn.Qualname], Variables: []string{}}
+				for _, a := range c.Args {
+					switch {
+					case strings.HasPrefix(a.Value, "**"):
+						r.Dynamic = true
+					case a.Name != "":
+						r.Variables = appendUnique(r.Variables, a.Name)
+					}
+				}
+				sort.Strings(r.Variables)
+				renders[name] = append(renders[name], r)
+			}
+		}
+	}
+	return renders
+}
+
+// missingContext returns context variables that some render_template call does not pass
+func missingContext(t *Template) []string {
+	missing := map[string]bool{}
+	for _, r := range t.RenderedBy {
+		if r.Dynamic {
+			continue
+		}
+		for _, v := range t.Context {
+			if !containsString(r.Variables, v) {
+				missing[v] = true
+			}
+		}
+	}
+	return sortedKeys(missing)
+}
+
+// moduleFunctions returns the functions and methods of a module
+func moduleFunctions(m *PyModule) []*PyFunction {
+	var fns []*PyFunction
+	for i := range m.Functions {
+		fns = append(fns, &m.Functions[i])
+	}
+	for c := range m.Classes {
+		for i := range m.Classes[c].Methods {
+			fns = append(fns, &m.Classes[c].Methods[i])
+		}
+	}
+	return fns
+}
+
+func templatesMarkdown(templates []*Template, edges []TemplateEdge) string {
+	var sb strings.Builder
+	sb.WriteString("# Template Inventory\n\n")
+	if len(templates) == 0 {
+		sb.WriteString("No Jinja templates were found in the legacy code.\n")
+		return sb.String()
+	}
+	if len(edges) > 0 {
+		sb.WriteString("```mermaid\n" + templateGraphMermaid(templates, edges) + "```\n\n")
+	}
+	sb.WriteString("| Template | Extends | Blocks | Includes / imports | Macros | Context variables | Rendered by |\n")
+	sb.WriteString("|---|---|---|---|---|---|---|\n")
+	for _, t := range templates {
+		var blocks, macros, renders []string
+		for _, b := range t.Blocks {
+			blocks = append(blocks, b.Name)
+		}
+		for _, m := range t.Macros {
+			macros = append(macros, fmt.Sprintf("%s(%s)", m.Name, strings.Join(m.Params, ", ")))
+		}
+		for _, r := range t.RenderedBy {
+			renders = append(renders, fmt.Sprintf("%s:%d", r.File, r.Line))
+		}
+		fmt.Fprintf(&sb, "| %s | %s | %s | %s | %s | %s | %s |\n", t.Name, t.Extends, strings.Join(blocks, ", "),
+			strings.Join(append(append([]string{}, t.Includes...), t.Imports...), ", "), strings.Join(macros, ", "),
+			strings.Join(t.Context, ", "), strings.Join(renders, ", "))
+	}
+
+	var missing []string
+	for _, t := range templates {
+		if len(t.Missing) > 0 {
+			missing = append(missing, fmt.Sprintf("- %s: %s", t.Name, strings.Join(t.Missing, ", ")))
+		}
+	}
+	if len(missing) > 0 {
+		sb.WriteString("\n## Context variables not passed by every render_template call\n\n")
+		sb.WriteString(strings.Join(missing, "\n") + "\n")
+	}
+	return sb.String()
+}
+
+// templateGraphMermaid renders the template inheritance graph as a flowchart
+func templateGraphMermaid(templates []*Template, edges []TemplateEdge) string {
+	var sb strings.Builder
+	sb.WriteString("flowchart BT\n")
+	for _, t := range templates {
+		fmt.Fprintf(&sb, "    %s[\"%s\"]\n", mermaidID(t.Name), mermaidLabel(t.Name))
+	}
+	for _, e := range edges {
+		arrow := "-->"
+		if e.Kind != "extends" {
+			arrow = "-.->"
+		}
+		fmt.Fprintf(&sb, "    %s %s|%s| %s\n", mermaidID(e.From), arrow, e.Kind, mermaidID(e.To))
+	}
+	return sb.String()
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package analysis
+
+import (
+	"strings"
+)
+
+// tomlEntry is a key = value line of a TOML file. Value is the raw value text,
+// which may span lines for arrays and inline tables.
+type tomlEntry struct {
+	Table string // dotted name of the enclosing [table], without quotes
+	Key   string
+	Value string
+	Line  int
+}
+
+// parseTOMLEntries reads the key/value pairs of a TOML file. It understands
+// tables, dotted and quoted keys and multi-line arrays, which is all that
+// Pipfile and pyproject.toml need; values are interpreted by the caller.
+func parseTOMLEntries(src string) []tomlEntry {
+	var entries []tomlEntry
+	table := ""
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(stripTOMLComment(lines[i]))
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "["):
+			table = tomlKey(strings.Trim(line, "[] "))
+			continue
+		}
+		key, value, ok := cutTOMLKey(line)
+		if !ok {
+			continue
+		}
+		start := i
+		// Arrays, inline tables and multi-line strings continue until balanced
+		for !tomlValueComplete(value) && i+1 < len(lines) {
+			i++
+			value += "\n" + stripTOMLComment(lines[i])
+		}
+		entries = append(entries, tomlEntry{Table: table, Key: tomlKey(key), Value: strings.TrimSpace(value), Line: start + 1})
+	}
+	return entries
+}
+
+// cutTOMLKey splits "key = value" at the first = outside quotes
+func cutTOMLKey(line string) (string, string, bool) {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '=':
+			return strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// tomlKey normalizes a possibly quoted, dotted key: tool."poetry".dependencies
+func tomlKey(key string) string {
+	parts := strings.Split(key, ".")
+	for i, p := range parts {
+		parts[i] = strings.Trim(strings.TrimSpace(p), `"'`)
+	}
+	return strings.Join(parts, ".")
+}
+
+// stripTOMLComment removes a # comment outside strings
+func stripTOMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// tomlValueComplete reports whether brackets and triple quotes in value are closed
+func tomlValueComplete(value string) bool {
+	if strings.Count(value, `"""`)%2 == 1 || strings.Count(value, "'''")%2 == 1 {
+		return false
+	}
+	depth := 0
+	var quote byte
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		}
+	}
+	return depth <= 0
+}
+
+// tomlInlineTable parses the top-level keys of an inline table such as
+// {version = ">=1.0", extras = ["a"]} into raw values
+func tomlInlineTable(value string) map[string]string {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "{") {
+		return nil
+	}
+	out := map[string]string{}
+	for _, part := range splitTopLevelString(strings.TrimSuffix(strings.TrimPrefix(value, "{"), "}"), ",") {
+		if k, v, ok := cutTOMLKey(part); ok {
+			out[tomlKey(k)] = v
+		}
+	}
+	return out
+}
@@ -3,6 +3,11 @@ package config
 import (
 	"fmt"
 	"os"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -17,6 +22,22 @@ var (
 	OutputFilePath     string
 	ReportPath         string
 	ModernCodePath     string
+
+	// Optional settings
+	EncodingOverrides  string
+	IngestWorkers      int
+	MaxFileSize        int64
+	MaxCorpusSize      int64
+	Incremental        bool
+	Redaction          bool
+	RedactionRulesFile string
+	CompactReport      string
+	CompactCode        string
+	LibraryMapPath     string
+	OSVDatabasePath    string
+	LicenseDBPath      string
+	PackageEOLPath     string
+	EOLDate            string
 )
 
 // Init loads the environment variables and initializes the configuration
@@ -72,5 +93,137 @@ func Init() error {
 		return fmt.Errorf("MODERN_CODE_PATH not set in .env file")
 	}
 
+	// Optional: comma separated <glob>=<encoding> rules, e.g. "templates/*.html=cp1252"
+	EncodingOverrides = os.Getenv("ENCODING_OVERRIDES")
+	if err := validateEncodingOverrides(EncodingOverrides); err != nil {
+		return err
+	}
+
+	IngestWorkers = runtime.NumCPU()
+	if v := os.Getenv("INGEST_WORKERS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return fmt.Errorf("INGEST_WORKERS must be a positive integer, got %q", v)
+		}
+		IngestWorkers = n
+	}
+
+	var err error
+	if MaxFileSize, err = parseByteSize("MAX_FILE_SIZE", 1<<20); err != nil {
+		return err
+	}
+	if MaxCorpusSize, err = parseByteSize("MAX_CORPUS_SIZE", 0); err != nil {
+		return err
+	}
+
+	// Optional: set INCREMENTAL=false to ignore the ingestion manifest and re-process every file
+	Incremental = true
+	if v := os.Getenv("INCREMENTAL"); v != "" {
+		if Incremental, err = strconv.ParseBool(v); err != nil {
+			return fmt.Errorf("INCREMENTAL must be true or false, got %q", v)
+		}
+	}
+
+	// Optional: secrets and PII are redacted before anything leaves the machine unless REDACTION=false
+	Redaction = true
+	if v := os.Getenv("REDACTION"); v != "" {
+		if Redaction, err = strconv.ParseBool(v); err != nil {
+			return fmt.Errorf("REDACTION must be true or false, got %q", v)
+		}
+	}
+	RedactionRulesFile = os.Getenv("REDACTION_RULES_FILE")
+
+	// Optional: comma separated compaction transforms for the corpus sent with prompt.txt and prompt_code.txt
+	CompactReport = os.Getenv("COMPACT_REPORT")
+	CompactCode = os.Getenv("COMPACT_CODE")
+
+	// Optional: curated Python package to Go library map used by the dependency inventory
+	LibraryMapPath = os.Getenv("GO_LIBRARY_MAP")
+	if LibraryMapPath == "" {
+		LibraryMapPath = "knowledge/go_library_map.json"
+	}
+
+	// Optional: offline OSV advisories (directory, JSON file or zip dump) and package licenses for the dependency audit
+	OSVDatabasePath = os.Getenv("OSV_DATABASE")
+	LicenseDBPath = os.Getenv("LICENSE_DATABASE")
+	PackageEOLPath = os.Getenv("PACKAGE_EOL_DATABASE")
+	if PackageEOLPath == "" {
+		PackageEOLPath = "knowledge/package_eol.json"
+	}
+	// Optional: the YYYY-MM-DD date release cycles are checked against, today when unset
+	EOLDate = os.Getenv("EOL_DATE")
+	if EOLDate == "" {
+		EOLDate = time.Now().Format(time.DateOnly)
+	} else if _, err := time.Parse(time.DateOnly, EOLDate); err != nil {
+		return fmt.Errorf("EOL_DATE must be a YYYY-MM-DD date, got %q", EOLDate)
+	}
+
 	return nil
 }
+
+// EncodingAliases maps the names accepted in ENCODING_OVERRIDES to canonical
+// encodings. utf-16 follows the byte order mark and defaults to little endian.
+var EncodingAliases = map[string]string{
+	"utf-8":        "utf-8",
+	"utf8":         "utf-8",
+	"utf-16":       "utf-16",
+	"utf16":        "utf-16",
+	"utf-16le":     "utf-16le",
+	"utf-16be":     "utf-16be",
+	"latin-1":      "latin-1",
+	"latin1":       "latin-1",
+	"iso-8859-1":   "latin-1",
+	"windows-1252": "windows-1252",
+	"cp1252":       "windows-1252",
+	"ebcdic":       "ebcdic-cp037",
+	"cp037":        "ebcdic-cp037",
+	"ebcdic-cp037": "ebcdic-cp037",
+}
+
+// validateEncodingOverrides checks every <glob>=<encoding> rule of ENCODING_OVERRIDES
+func validateEncodingOverrides(overrides string) error {
+	for _, rule := range strings.Split(overrides, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		pattern, name, ok := strings.Cut(rule, "=")
+		if !ok || strings.TrimSpace(pattern) == "" {
+			return fmt.Errorf("invalid ENCODING_OVERRIDES rule %q, expected <glob>=<encoding>", rule)
+		}
+		if _, err := path.Match(strings.TrimSpace(pattern), ""); err != nil {
+			return fmt.Errorf("invalid glob %q in ENCODING_OVERRIDES: %w", pattern, err)
+		}
+		if _, ok := EncodingAliases[strings.ToLower(strings.TrimSpace(name))]; !ok {
+			return fmt.Errorf("unsupported encoding %q in ENCODING_OVERRIDES", name)
+		}
+	}
+	return nil
+}
+
+// parseByteSize reads a size such as "512KB" or "2MB" from env, returning def when unset.
+// A value of 0 disables the limit.
+func parseByteSize(env string, def int64) (int64, error) {
+	v := strings.ToUpper(strings.TrimSpace(os.Getenv(env)))
+	if v == "" {
+		return def, nil
+	}
+
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(v, unit.suffix) {
+			v = strings.TrimSpace(strings.TrimSuffix(v, unit.suffix))
+			multiplier = unit.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a size such as 512KB or 2MB, got %q", env, os.Getenv(env))
+	}
+	return n * multiplier, nil
+}
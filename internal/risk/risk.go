@@ -0,0 +1,284 @@
+// Package risk produces the risk register: one structured Risk per legacy
+// module and planned change, judged by the LLM and scored deterministically
+// against the static analysis metrics.
+package risk
+
+import (
+	"encoding/json"
+	"fmt"
+	"lcma/internal/analysis"
+	"lcma/internal/config"
+	"lcma/internal/utils"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Risk is the assessment of one module or planned change
+type Risk struct {
+	ID         string   `json:"id"`
+	Subject    string   `json:"subject"` // module name or planned change id
+	Kind       string   `json:"kind"`    // module or change
+	Title      string   `json:"title,omitempty"`
+	Category   string   `json:"category"`
+	Likelihood int      `json:"likelihood"` // 1-5, LLM judgment
+	Impact     int      `json:"impact"`     // 1-5, LLM judgment
+	Evidence   []string `json:"evidence"`
+	Mitigation string   `json:"mitigation"`
+
+	// Signals are the static metrics for the subject; nil for changes the LLM proposed
+	Signals *Signals `json:"signals,omitempty"`
+	Score   float64  `json:"score"` // 1-25, see scoreFormula
+	Level   string   `json:"level"`
+}
+
+// Signals are static likelihood and impact indicators normalized to 0..1
+type Signals struct {
+	Likelihood float64 `json:"likelihood"`
+	Impact     float64 `json:"impact"`
+}
+
+// Register is the layout of risk_register.json
+type Register struct {
+	Formula string `json:"formula"`
+	Risks   []Risk `json:"risks"`
+}
+
+// Categories a risk may have
+var Categories = []string{"data", "security", "functional", "performance", "integration", "operational"}
+
+const (
+	promptFile   = "prompt_risk.txt"
+	registerFile = "risk_register.json"
+	reportFile   = "report.md"
+	maxAttempts  = 2
+
+	scoreFormula = "likelihood and impact are each averaged with their static signal mapped onto 1-5 (1 + 4 x signal); " +
+		"score = likelihood x impact (1-25). Changes without static signals use the LLM values alone. " +
+		"Levels: critical >= 15, high >= 10, medium >= 5, low below."
+
+	// tableEvidence caps the evidence per row of the Markdown table; the JSON has all of it
+	tableEvidence = 6
+
+	registerStart = "<!-- risk-register:start -->"
+	registerEnd   = "<!-- risk-register:end -->"
+)
+
+// Exists reports whether a previous run wrote the risk register
+func Exists() bool {
+	_, err := os.Stat(filepath.Join(config.ReportPath, registerFile))
+	return err == nil
+}
+
+// Assess asks the LLM for a risk per module and planned change, validates the
+// answer, scores it and writes risk_register.json/md and the report section
+func Assess(p *analysis.Project) (*Register, error) {
+	subjects := Subjects(p)
+	subjectJSON, err := json.MarshalIndent(subjects, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal risk subjects: %w", err)
+	}
+	prompt, err := utils.BuildReportPrompt(promptFile, map[string]string{
+		"risk_subjects":   string(subjectJSON),
+		"risk_categories": strings.Join(Categories, ", "),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var risks []Risk
+	var problems []string
+	request := prompt
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		response, err := utils.CallLLM(request)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get LLM response for %s: %w", promptFile, err)
+		}
+		risks, problems = parse(response, subjects)
+		if len(problems) == 0 {
+			break
+		}
+		fmt.Printf("Risk assessment attempt %d rejected: %d problems\n", attempt, len(problems))
+		request = prompt + "\n\nA previous answer was rejected for these problems:\n- " + strings.Join(problems, "\n- ") +
+			"\nReturn the complete corrected JSON array only."
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("risk assessment is not valid after %d attempts: %s", maxAttempts, strings.Join(problems, "; "))
+	}
+
+	register := &Register{Formula: scoreFormula, Risks: score(risks, subjects)}
+	if err := utils.WriteReportJSON(registerFile, register); err != nil {
+		return nil, err
+	}
+	table := Markdown(register)
+	if err := utils.WriteReportFile("risk_register.md", []byte("# Risk register\n\n"+table)); err != nil {
+		return nil, err
+	}
+	return register, appendToReport(table)
+}
+
+// parse decodes the LLM answer and checks it against the subjects
+func parse(response string, subjects []Subject) ([]Risk, []string) {
+	var risks []Risk
+	if err := json.Unmarshal([]byte(extractJSON(response)), &risks); err != nil {
+		var wrapped struct {
+			Risks []Risk `json:"risks"`
+		}
+		if err2 := json.Unmarshal([]byte(extractJSON(response)), &wrapped); err2 != nil || wrapped.Risks == nil {
+			return nil, []string{"the answer is not a JSON array of risks: " + err.Error()}
+		}
+		risks = wrapped.Risks
+	}
+
+	known := map[string]Subject{}
+	for _, s := range subjects {
+		known[s.ID] = s
+	}
+	covered := map[string]bool{}
+	var problems []string
+	for i, r := range risks {
+		where := fmt.Sprintf("risk %d (%s)", i+1, r.Subject)
+		s, ok := known[r.Subject]
+		switch {
+		case r.Subject == "":
+			problems = append(problems, fmt.Sprintf("risk %d has no subject", i+1))
+		case ok && r.Kind != s.Kind:
+			problems = append(problems, fmt.Sprintf("%s must have kind %q", where, s.Kind))
+		case !ok && r.Kind != "change":
+			problems = append(problems, fmt.Sprintf("%s is not a listed subject; only new planned changes with kind \"change\" may be added", where))
+		}
+		if !containsString(Categories, r.Category) {
+			problems = append(problems, fmt.Sprintf("%s has category %q, expected one of %s", where, r.Category, strings.Join(Categories, ", ")))
+		}
+		if r.Likelihood < 1 || r.Likelihood > 5 {
+			problems = append(problems, fmt.Sprintf("%s likelihood must be 1-5", where))
+		}
+		if r.Impact < 1 || r.Impact > 5 {
+			problems = append(problems, fmt.Sprintf("%s impact must be 1-5", where))
+		}
+		if len(r.Evidence) == 0 {
+			problems = append(problems, fmt.Sprintf("%s has no evidence", where))
+		}
+		if strings.TrimSpace(r.Mitigation) == "" {
+			problems = append(problems, fmt.Sprintf("%s has no mitigation", where))
+		}
+		covered[r.Subject] = true
+	}
+	for _, s := range subjects {
+		if !covered[s.ID] {
+			problems = append(problems, fmt.Sprintf("subject %s has no risk", s.ID))
+		}
+	}
+	return risks, problems
+}
+
+// extractJSON strips Markdown code fences and text around the JSON value
+func extractJSON(response string) string {
+	start := strings.IndexAny(response, "[{")
+	end := strings.LastIndexAny(response, "]}")
+	if start < 0 || end < start {
+		return response
+	}
+	return response[start : end+1]
+}
+
+// score applies the deterministic formula, adds the static evidence and
+// numbers the risks from the highest score down
+func score(risks []Risk, subjects []Subject) []Risk {
+	bySubject := map[string]Subject{}
+	for _, s := range subjects {
+		bySubject[s.ID] = s
+	}
+	for i := range risks {
+		r := &risks[i]
+		likelihood, impact := float64(r.Likelihood), float64(r.Impact)
+		if s, ok := bySubject[r.Subject]; ok {
+			signals := s.Signals
+			r.Signals = &signals
+			r.Title = s.Title
+			likelihood = (likelihood + 1 + 4*signals.Likelihood) / 2
+			impact = (impact + 1 + 4*signals.Impact) / 2
+			for _, e := range s.Evidence {
+				if !containsString(r.Evidence, e) {
+					r.Evidence = append(r.Evidence, e)
+				}
+			}
+		}
+		r.Score = math.Round(likelihood*impact*10) / 10
+		r.Level = level(r.Score)
+	}
+	sort.SliceStable(risks, func(i, j int) bool { return risks[i].Score > risks[j].Score })
+	for i := range risks {
+		risks[i].ID = fmt.Sprintf("R%d", i+1)
+	}
+	return risks
+}
+
+func level(score float64) string {
+	switch {
+	case score >= 15:
+		return "critical"
+	case score >= 10:
+		return "high"
+	case score >= 5:
+		return "medium"
+	}
+	return "low"
+}
+
+// Markdown renders the risk register table
+func Markdown(register *Register) string {
+	var sb strings.Builder
+	counts := map[string]int{}
+	for _, r := range register.Risks {
+		counts[r.Level]++
+	}
+	fmt.Fprintf(&sb, "%d risks: %d critical, %d high, %d medium, %d low. Scoring: %s\n\n",
+		len(register.Risks), counts["critical"], counts["high"], counts["medium"], counts["low"], register.Formula)
+	sb.WriteString("| ID | Subject | Kind | Category | Likelihood | Impact | Score | Level | Evidence | Mitigation |\n|---|---|---|---|---|---|---|---|---|---|\n")
+	for _, r := range register.Risks {
+		subject := r.Subject
+		if r.Title != "" {
+			subject += ": " + r.Title
+		}
+		evidence := r.Evidence
+		if len(evidence) > tableEvidence {
+			evidence = append(evidence[:tableEvidence:tableEvidence], fmt.Sprintf("%d more in %s", len(r.Evidence)-tableEvidence, registerFile))
+		}
+		fmt.Fprintf(&sb, "| %s | %s | %s | %s | %d | %d | %.1f | %s | %s | %s |\n", r.ID, cell(subject), r.Kind, r.Category,
+			r.Likelihood, r.Impact, r.Score, r.Level, cell(strings.Join(evidence, "; ")), cell(r.Mitigation))
+	}
+	return sb.String()
+}
+
+// appendToReport replaces the risk register section of report.md, so reruns
+// do not stack copies
+func appendToReport(table string) error {
+	data, err := os.ReadFile(filepath.Join(config.ReportPath, reportFile))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", reportFile, err)
+	}
+	report := string(data)
+	if start := strings.Index(report, registerStart); start >= 0 {
+		if end := strings.Index(report, registerEnd); end > start {
+			report = report[:start] + report[end+len(registerEnd):]
+		}
+	}
+	report = strings.TrimRight(report, "\n") + "\n\n" + registerStart + "\n## Risk register\n\n" + table + registerEnd + "\n"
+	return utils.WriteReportFile(reportFile, []byte(report))
+}
+
+func cell(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "|", `\|`), "\n", " ")
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
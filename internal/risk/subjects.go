@@ -0,0 +1,220 @@
+package risk
+
+import (
+	"fmt"
+	"lcma/internal/analysis"
+	"math"
+	"strings"
+)
+
+// Subject is a module or planned change the LLM must assess, with the static
+// signals and evidence the scoring adds to its judgment
+type Subject struct {
+	ID       string   `json:"id"`
+	Kind     string   `json:"kind"` // module or change
+	Title    string   `json:"title"`
+	Signals  Signals  `json:"signals"`
+	Evidence []string `json:"evidence"`
+}
+
+// severityWeight converts security findings into a likelihood contribution
+var severityWeight = map[string]float64{"high": 1, "medium": 0.5, "low": 0.2}
+
+// Subjects lists every legacy module and the planned changes the analysis
+// implies: dependency replacements, unfinished Templ translations and the
+// data access rewrite
+func Subjects(p *analysis.Project) []Subject {
+	subjects := moduleSubjects(p)
+	subjects = append(subjects, dependencySubjects(p)...)
+	subjects = append(subjects, templateSubjects(p)...)
+	if s, ok := dataAccessSubject(p); ok {
+		subjects = append(subjects, s)
+	}
+	return subjects
+}
+
+// moduleSubjects derive likelihood from hotspot score, complexity and security
+// findings, and impact from how many modules, routes and tables depend on it
+func moduleSubjects(p *analysis.Project) []Subject {
+	metrics := map[string]analysis.ModuleMetrics{}
+	if p.Metrics != nil {
+		for _, m := range p.Metrics.Modules {
+			metrics[m.Module] = m
+		}
+	}
+	routes := map[string]int{}
+	for _, r := range p.Routes {
+		routes[r.Module]++
+	}
+	tables := map[string][]string{}
+	if p.Schema != nil {
+		for _, q := range p.Schema.Queries {
+			for _, t := range q.Tables {
+				tables[q.File] = appendUnique(tables[q.File], t)
+			}
+		}
+	}
+	findings := map[string][]analysis.SecurityFinding{}
+	for _, f := range p.Security {
+		findings[f.File] = append(findings[f.File], f)
+	}
+
+	maxFanIn, maxRoutes, maxTables := 0, 0, 0
+	for _, m := range p.Modules {
+		maxFanIn = max(maxFanIn, metrics[m.Name].FanIn)
+		maxRoutes = max(maxRoutes, routes[m.Name])
+		maxTables = max(maxTables, len(tables[m.Path]))
+	}
+
+	var subjects []Subject
+	for _, m := range p.Modules {
+		mm := metrics[m.Name]
+		security := 0.0
+		var evidence []string
+		if mm.Functions > 0 {
+			evidence = append(evidence, fmt.Sprintf("metrics: total complexity %d, max per function %d, nesting %d, hotspot %.2f", mm.Complexity, mm.MaxComplexity, mm.MaxNesting, mm.Hotspot))
+		}
+		for _, f := range findings[m.Path] {
+			security += severityWeight[f.Severity]
+			evidence = append(evidence, fmt.Sprintf("%s %s at %s:%d", f.Severity, f.Rule, f.File, f.Line))
+		}
+		if mm.FanIn > 0 {
+			evidence = append(evidence, fmt.Sprintf("imported by %d legacy modules", mm.FanIn))
+		}
+		if routes[m.Name] > 0 {
+			evidence = append(evidence, fmt.Sprintf("handles %d routes", routes[m.Name]))
+		}
+		if len(tables[m.Path]) > 0 {
+			evidence = append(evidence, "queries tables "+strings.Join(tables[m.Path], ", "))
+		}
+		subjects = append(subjects, Subject{
+			ID: m.Name, Kind: "module", Title: "migrate " + m.Path,
+			Signals: Signals{
+				Likelihood: round(0.4*mm.Hotspot + 0.3*ratio(mm.MaxComplexity, 20) + 0.3*math.Min(security/3, 1)),
+				Impact:     round(0.4*ratio(mm.FanIn, maxFanIn) + 0.3*ratio(routes[m.Name], maxRoutes) + 0.3*ratio(len(tables[m.Path]), maxTables)),
+			},
+			Evidence: evidence,
+		})
+	}
+	return subjects
+}
+
+// dependencySubjects are the replacements of declared Python packages: unmapped
+// packages and vulnerable or end-of-life versions are likelier to go wrong, and
+// widely imported ones have more impact
+func dependencySubjects(p *analysis.Project) []Subject {
+	if p.Dependencies == nil {
+		return nil
+	}
+	advisories := map[string][]string{}
+	eol := map[string]bool{}
+	if p.Audit != nil {
+		for _, v := range p.Audit.Vulnerabilities {
+			advisories[v.Package] = appendUnique(advisories[v.Package], v.ID)
+		}
+		for _, e := range p.Audit.EOL {
+			eol[e.Package] = true
+		}
+	}
+
+	seen := map[string]bool{}
+	var subjects []Subject
+	for _, d := range p.Dependencies.Dependencies {
+		if seen[d.Package] || d.Group != "main" {
+			continue
+		}
+		seen[d.Package] = true
+		likelihood, target := 0.4, d.Go
+		switch {
+		case !d.Mapped:
+			likelihood, target = 0.8, "an unmapped Go library"
+		case d.Go == "":
+			likelihood, target = 0.2, "no library"
+		}
+		evidence := []string{fmt.Sprintf("declared in %s:%d", d.Source, d.Line)}
+		if len(advisories[d.Package]) > 0 {
+			likelihood += 0.2
+			evidence = append(evidence, "advisories "+strings.Join(advisories[d.Package], ", "))
+		}
+		if eol[d.Package] {
+			likelihood += 0.1
+			evidence = append(evidence, "end-of-life version "+d.Version)
+		}
+		if len(d.ImportedBy) > 0 {
+			evidence = append(evidence, "imported by "+strings.Join(d.ImportedBy, ", "))
+		}
+		subjects = append(subjects, Subject{
+			ID: "dependency:" + d.Package, Kind: "change", Title: "replace " + d.Name + " with " + target,
+			Signals:  Signals{Likelihood: round(math.Min(likelihood, 1)), Impact: round(ratio(len(d.ImportedBy), len(p.Modules)))},
+			Evidence: evidence,
+		})
+	}
+	return subjects
+}
+
+// templateSubjects are the Templ components with constructs left to the LLM
+func templateSubjects(p *analysis.Project) []Subject {
+	pages := map[string]int{}
+	maxPages := 0
+	for _, t := range p.Templates {
+		pages[t.Name] = len(t.RenderedBy)
+		maxPages = max(maxPages, pages[t.Name])
+	}
+	var subjects []Subject
+	for _, tr := range p.Translations {
+		if len(tr.TODOs) == 0 {
+			continue
+		}
+		var evidence []string
+		for _, todo := range tr.TODOs {
+			evidence = append(evidence, fmt.Sprintf("line %d: %s", todo.Line, todo.Reason))
+		}
+		subjects = append(subjects, Subject{
+			ID: "template:" + tr.Template, Kind: "change", Title: fmt.Sprintf("finish %s (%d TODOs)", tr.Component, len(tr.TODOs)),
+			Signals:  Signals{Likelihood: round(ratio(len(tr.TODOs), 5)), Impact: round(ratio(pages[tr.Template], maxPages))},
+			Evidence: evidence,
+		})
+	}
+	return subjects
+}
+
+// dataAccessSubject is the rewrite of the queries against the schema; dynamic
+// SQL makes it likelier to break and data loss gives it full impact
+func dataAccessSubject(p *analysis.Project) (Subject, bool) {
+	if p.Schema == nil || len(p.Schema.Tables) == 0 {
+		return Subject{}, false
+	}
+	dynamic := 0
+	for _, q := range p.Schema.Queries {
+		if q.Dynamic != "" {
+			dynamic++
+		}
+	}
+	evidence := []string{fmt.Sprintf("%d tables, %d queries, %d built dynamically", len(p.Schema.Tables), len(p.Schema.Queries), dynamic)}
+	return Subject{
+		ID: "data-access", Kind: "change", Title: "rewrite data access for the Go stack",
+		Signals:  Signals{Likelihood: round(0.3 + 0.7*ratio(dynamic, len(p.Schema.Queries))), Impact: 1},
+		Evidence: evidence,
+	}, true
+}
+
+// ratio is n/limit capped at 1, or 0 without a limit
+func ratio(n, limit int) float64 {
+	if limit <= 0 {
+		return 0
+	}
+	return math.Min(float64(n)/float64(limit), 1)
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
@@ -6,6 +6,7 @@ import (
 	"lcma/internal/config"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 func CallLLM(prompt string) (string, error) {
@@ -28,39 +29,44 @@ func CallLLM(prompt string) (string, error) {
 	return response.Choices[0].Message.Content, nil
 }
 
-func CallLLMWithContextAndSaveReport() error {
-	// Define file pairs for processing
-	filePairs := []struct {
-		promptFile string
-		reportFile string
-	}{
-		{
-			promptFile: "prompt.txt",
-			reportFile: "report.md",
-		},
-		{
-			promptFile: "prompt_code.txt",
-			reportFile: "report_code.md",
-		},
-	}
+// filePairs maps each prompt template to the report generated from it
+var filePairs = []struct {
+	stage      string
+	promptFile string
+	reportFile string
+}{
+	{
+		stage:      stageReport,
+		promptFile: "prompt.txt",
+		reportFile: "report.md",
+	},
+	{
+		stage:      stageCode,
+		promptFile: "prompt_code.txt",
+		reportFile: "report_code.md",
+	},
+}
 
-	outputFile, err := os.ReadFile(config.OutputFilePath)
-	if err != nil {
-		return fmt.Errorf("failed to read output file: %w", err)
+// ReportsExist reports whether every LLM report from a previous run is present
+func ReportsExist() bool {
+	for _, pair := range filePairs {
+		if _, err := os.Stat(filepath.Join(config.ReportPath, pair.reportFile)); err != nil {
+			return false
+		}
 	}
+	return true
+}
 
+func CallLLMWithContextAndSaveReport() error {
 	// Process each file pair
 	for _, pair := range filePairs {
 		fmt.Println("Processing file pair:", pair)
-		promptPath := filepath.Join(config.PromptTemplatePath, pair.promptFile)
 
-		// Build prompt using the current pair of files
-		prompt, err := buildPromptWithContext(promptPath)
+		prompt, err := buildStagePrompt(pair.stage, pair.promptFile, nil)
 		if err != nil {
-			return fmt.Errorf("failed to build prompt for %s: %w", promptPath, err)
+			return err
 		}
-
-		prompt = "\nLegacy Code:\n<legacy_code>\n" + string(outputFile) + "\n</legacy_code>\n\n" + prompt
+		promptPath := filepath.Join(config.PromptTemplatePath, pair.promptFile)
 
 		// Call LLM with the constructed prompt
 		response, err := CallLLM(prompt)
@@ -68,17 +74,84 @@ func CallLLMWithContextAndSaveReport() error {
 			return fmt.Errorf("failed to get LLM response for %s: %w", promptPath, err)
 		}
 
-		reportPath := filepath.Join(config.ReportPath, pair.reportFile)
-		// Create report directory if it doesn't exist
-		if err := os.MkdirAll(filepath.Dir(reportPath), 0755); err != nil {
-			return fmt.Errorf("failed to create report directory for %s: %w", pair.reportFile, err)
-		}
-
 		// Save response to corresponding report file
-		if err := os.WriteFile(reportPath, []byte(response), 0644); err != nil {
-			return fmt.Errorf("failed to write report %s: %w", pair.reportFile, err)
+		if err := WriteReportFile(pair.reportFile, []byte(response)); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
+
+// BuildReportPrompt builds promptFile with the legacy corpus of the report stage
+// and the given extra tags filled in, for LLM stages outside filePairs
+func BuildReportPrompt(promptFile string, tags map[string]string) (string, error) {
+	return buildStagePrompt(stageReport, promptFile, tags)
+}
+
+// CallLLMForPhase runs the code prompt for one migration plan phase, sending only
+// the phase's files as legacy code, and saves the answer as report_code_phase_<n>.md
+func CallLLMForPhase(corpus *Corpus, phase int, files []string, description string) error {
+	selected := map[string]bool{}
+	for _, f := range files {
+		selected[f] = true
+	}
+	var phaseFiles []CorpusFile
+	for _, f := range corpus.Files {
+		if selected[f.Path] {
+			phaseFiles = append(phaseFiles, f)
+		}
+	}
+	if len(phaseFiles) == 0 {
+		return fmt.Errorf("phase %d has no legacy files in the corpus", phase)
+	}
+
+	opts, err := compactOptions(stageCode)
+	if err != nil {
+		return err
+	}
+	if len(opts) > 0 {
+		phaseFiles = compactCorpus(phaseFiles, opts)
+	}
+	ext := filepath.Ext(config.OutputFilePath)
+	corpusPath := fmt.Sprintf("%s.phase%d%s", strings.TrimSuffix(config.OutputFilePath, ext), phase, ext)
+	if err := writeCorpusFile(corpusPath, phaseFiles); err != nil {
+		return err
+	}
+
+	promptFile := "prompt_code.txt"
+	prompt, err := buildCorpusPrompt(corpusPath, promptFile, map[string]string{"migration_phase": description})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Processing migration phase %d: %d legacy files\n", phase, len(phaseFiles))
+	response, err := CallLLM(prompt)
+	if err != nil {
+		return fmt.Errorf("failed to get LLM response for phase %d: %w", phase, err)
+	}
+	return WriteReportFile(fmt.Sprintf("report_code_phase_%d.md", phase), []byte(response))
+}
+
+// buildStagePrompt fills a prompt template and prepends the legacy corpus of stage
+func buildStagePrompt(stage, promptFile string, tags map[string]string) (string, error) {
+	// Each stage may use its own compacted copy of the corpus
+	return buildCorpusPrompt(StageOutputPath(stage), promptFile, tags)
+}
+
+// buildCorpusPrompt fills a prompt template and prepends the corpus file at corpusPath
+func buildCorpusPrompt(corpusPath, promptFile string, tags map[string]string) (string, error) {
+	outputFile, err := os.ReadFile(corpusPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read output file: %w", err)
+	}
+
+	promptPath := filepath.Join(config.PromptTemplatePath, promptFile)
+
+	// Build prompt using the current pair of files
+	prompt, err := buildPromptWithContext(promptPath, tags)
+	if err != nil {
+		return "", fmt.Errorf("failed to build prompt for %s: %w", promptPath, err)
+	}
+
+	return "\nLegacy Code:\n<legacy_code>\n" + string(outputFile) + "\n</legacy_code>\n\n" + prompt, nil
+}
@@ -0,0 +1,429 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"lcma/internal/config"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Compaction transforms that can be enabled per LLM stage
+const (
+	compactStripComments  = "strip_comments"      // drop comments and docstrings
+	compactDocstringsOnly = "docstrings_only"     // drop comments but keep docstrings
+	compactWhitespace     = "collapse_whitespace" // trailing spaces, blank runs, HTML indentation
+	compactDedupe         = "dedupe"              // replace identical files with a reference
+	compactSummarizeData  = "summarize_data"      // replace data files, fixtures and minified assets with a summary
+)
+
+// Stages whose corpus can be compacted independently
+const (
+	stageReport = "report"
+	stageCode   = "code"
+)
+
+// summarizeThreshold is the size above which data-like files are summarized
+const summarizeThreshold = 8 << 10
+
+// configSectionHeader separates config files from code in output.txt
+const configSectionHeader = "# ==== Configuration files (settings, feature flags, connection settings) ====\n\n"
+
+var (
+	htmlCommentRe   = regexp.MustCompile(`(?s)<!--.*?-->`)
+	jinjaCommentRe  = regexp.MustCompile(`(?s)\{#.*?#\}`)
+	blankRunRe      = regexp.MustCompile(`\n{3,}`)
+	configCommentRe = regexp.MustCompile(`(?m)^[ \t]*[#;].*$`)
+	dataDirRe       = regexp.MustCompile(`(^|/)(fixtures?|vendor|vendored|third_party|node_modules|data|seed|seeds)/`)
+	notebookCellRe  = regexp.MustCompile(`(?m)^# %% \[(code|markdown)\] cell \d+\n`)
+)
+
+// dataKinds are the ingested non-code kinds summarized when they sit in a data directory
+var dataKinds = map[string]bool{KindSchema: true, KindConfig: true}
+
+// docstringOwners are the statements whose body may open with a docstring
+var docstringOwners = map[string]bool{"def": true, "class": true, "async": true}
+
+// compactOptions returns the transforms configured for stage via COMPACT_REPORT or COMPACT_CODE
+func compactOptions(stage string) (map[string]bool, error) {
+	var raw string
+	switch stage {
+	case stageReport:
+		raw = config.CompactReport
+	case stageCode:
+		raw = config.CompactCode
+	}
+
+	opts := map[string]bool{}
+	for _, opt := range strings.Split(raw, ",") {
+		opt = strings.ToLower(strings.TrimSpace(opt))
+		switch opt {
+		case "":
+		case compactStripComments, compactDocstringsOnly, compactWhitespace, compactDedupe, compactSummarizeData:
+			opts[opt] = true
+		default:
+			return nil, fmt.Errorf("unknown compaction option %q for %s stage", opt, stage)
+		}
+	}
+	if opts[compactStripComments] && opts[compactDocstringsOnly] {
+		return nil, fmt.Errorf("%s and %s cannot both be enabled for %s stage", compactStripComments, compactDocstringsOnly, stage)
+	}
+	return opts, nil
+}
+
+// StageOutputPath returns the corpus file sent to the LLM for stage.
+// Stages without compaction share OUTPUT_FILE_PATH.
+func StageOutputPath(stage string) string {
+	opts, err := compactOptions(stage)
+	if err != nil || len(opts) == 0 {
+		return config.OutputFilePath
+	}
+	ext := filepath.Ext(config.OutputFilePath)
+	return strings.TrimSuffix(config.OutputFilePath, ext) + "." + stage + ext
+}
+
+// writeStageCorpora writes a compacted copy of the corpus for every stage that has transforms enabled
+func writeStageCorpora(corpus *Corpus) error {
+	for _, stage := range []string{stageReport, stageCode} {
+		opts, err := compactOptions(stage)
+		if err != nil {
+			return err
+		}
+		if len(opts) == 0 {
+			continue
+		}
+
+		files := compactCorpus(corpus.Files, opts)
+		if err := writeCorpusFile(StageOutputPath(stage), files); err != nil {
+			return err
+		}
+
+		var before, after int
+		for i := range corpus.Files {
+			before += len(corpus.Files[i].Content)
+		}
+		for i := range files {
+			after += len(files[i].Content)
+		}
+		fmt.Printf("Compacted %s corpus from %d to %d bytes\n", stage, before, after)
+	}
+	return nil
+}
+
+// writeCorpusFile writes files in the output.txt format. Config files follow the
+// code under their own section so feature flags and connection settings stand out.
+func writeCorpusFile(outputPath string, files []CorpusFile) error {
+	out, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("error creating output file: %w", err)
+	}
+	defer out.Close()
+
+	w := bufio.NewWriter(out)
+	var configs []CorpusFile
+	for _, f := range files {
+		if f.Kind == KindConfig {
+			configs = append(configs, f)
+			continue
+		}
+		if err := writeCorpusEntry(w, f); err != nil {
+			return err
+		}
+	}
+	if len(configs) > 0 {
+		if _, err := w.WriteString(configSectionHeader); err != nil {
+			return fmt.Errorf("error writing output file %s: %w", outputPath, err)
+		}
+		for _, f := range configs {
+			if err := writeCorpusEntry(w, f); err != nil {
+				return err
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("error writing output file %s: %w", outputPath, err)
+	}
+	return nil
+}
+
+// writeCorpusEntry writes the filename header and contents, with a blank line between files
+func writeCorpusEntry(w *bufio.Writer, f CorpusFile) error {
+	if _, err := fmt.Fprintf(w, "# %s\n%s\n\n", path.Base(f.Path), f.Content); err != nil {
+		return fmt.Errorf("error writing %s to output file: %w", f.Path, err)
+	}
+	return nil
+}
+
+// compactCorpus applies the enabled transforms to a copy of files
+func compactCorpus(files []CorpusFile, opts map[string]bool) []CorpusFile {
+	out := make([]CorpusFile, 0, len(files))
+	seen := map[string]string{}
+
+	for _, f := range files {
+		content := f.Content
+		ext := strings.ToLower(path.Ext(f.Path))
+
+		if opts[compactSummarizeData] && isDataLike(f.Path, f.Kind, content) {
+			content = summarizeData(content)
+		} else {
+			switch {
+			case opts[compactStripComments]:
+				content = stripComments(ext, content, false)
+			case opts[compactDocstringsOnly]:
+				content = stripComments(ext, content, true)
+			}
+			if opts[compactWhitespace] {
+				content = collapseWhitespace(ext, content)
+			}
+		}
+
+		if opts[compactDedupe] {
+			if first, ok := seen[content]; ok {
+				content = fmt.Sprintf("(identical to %s)", first)
+			} else {
+				seen[content] = f.Path
+			}
+		}
+
+		f.Content = content
+		out = append(out, f)
+	}
+	return out
+}
+
+// stripComments removes comments for the file type. For Python, docstrings are
+// removed as well unless keepDocstrings is set.
+func stripComments(ext, content string, keepDocstrings bool) string {
+	switch ext {
+	case ".py":
+		return stripPythonComments(content, keepDocstrings)
+	case ".ipynb":
+		return stripNotebookComments(content, keepDocstrings)
+	case ".html":
+		content = htmlCommentRe.ReplaceAllString(content, "")
+		return jinjaCommentRe.ReplaceAllString(content, "")
+	case ".ini", ".cfg", ".yaml", ".yml", ".toml":
+		return configCommentRe.ReplaceAllString(content, "")
+	}
+	return content
+}
+
+// stripNotebookComments strips the code cells of a flattened notebook and keeps
+// the cell markers and the markdown cells, which notebookToSource wrote as comments
+func stripNotebookComments(src string, keepDocstrings bool) string {
+	var sb strings.Builder
+	cells := notebookCellRe.FindAllStringSubmatchIndex(src, -1)
+	start := 0
+	if len(cells) > 0 {
+		start = cells[0][0]
+	}
+	sb.WriteString(stripPythonComments(src[:start], keepDocstrings))
+	for i, c := range cells {
+		end := len(src)
+		if i+1 < len(cells) {
+			end = cells[i+1][0]
+		}
+		sb.WriteString(src[c[0]:c[1]])
+		if src[c[2]:c[3]] == "markdown" {
+			sb.WriteString(src[c[1]:end])
+		} else {
+			sb.WriteString(stripPythonComments(src[c[1]:end], keepDocstrings))
+		}
+	}
+	return sb.String()
+}
+
+// stripPythonComments walks the source with a small lexer so that '#' inside
+// strings is left alone. A docstring is a string that starts the first statement
+// of a def or class body, or of the module.
+func stripPythonComments(src string, keepDocstrings bool) string {
+	var (
+		sb            strings.Builder
+		atLineStart   = true // only whitespace seen on the current line
+		afterBlockHdr = true // previous logical line was a def or class header (or start of file)
+		lastCode      byte
+		depth         int    // open brackets, which continue the logical line
+		stmtWord      string // first word of the current logical line
+	)
+
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '\'' || c == '"' || ((c == 'r' || c == 'b' || c == 'u' || c == 'f' || c == 'R' || c == 'B' || c == 'U' || c == 'F') && isStringPrefix(src, i)):
+			start := i
+			for src[i] != '\'' && src[i] != '"' {
+				i++
+			}
+			i = skipPythonString(src, i)
+			isDoc := atLineStart && afterBlockHdr && depth == 0
+			if !isDoc || keepDocstrings {
+				sb.WriteString(src[start:i])
+			}
+			lastCode = src[i-1]
+			// Keep line numbers stable when a multi-line docstring is dropped
+			if isDoc && !keepDocstrings {
+				sb.WriteString(strings.Repeat("\n", strings.Count(src[start:i], "\n")))
+			}
+			atLineStart = false
+		case c == '\n':
+			sb.WriteByte(c)
+			i++
+			if !atLineStart {
+				afterBlockHdr = depth == 0 && lastCode == ':' && docstringOwners[stmtWord]
+			}
+			if depth == 0 {
+				stmtWord = ""
+			}
+			atLineStart = true
+		case c == ' ' || c == '\t' || c == '\r':
+			sb.WriteByte(c)
+			i++
+		default:
+			if atLineStart && depth == 0 && stmtWord == "" {
+				j := i
+				for j < len(src) && isIdentByte(src[j]) {
+					j++
+				}
+				stmtWord = src[i:j]
+			}
+			switch c {
+			case '(', '[', '{':
+				depth++
+			case ')', ']', '}':
+				if depth > 0 {
+					depth--
+				}
+			}
+			sb.WriteByte(c)
+			lastCode = c
+			atLineStart = false
+			i++
+		}
+	}
+	return sb.String()
+}
+
+// isStringPrefix reports whether src[i:] is a prefixed string literal such as r"..." or rb'...'
+func isStringPrefix(src string, i int) bool {
+	if i > 0 && (isIdentByte(src[i-1])) {
+		return false
+	}
+	for j := i; j < len(src) && j < i+3; j++ {
+		switch src[j] {
+		case '\'', '"':
+			return j > i
+		case 'r', 'b', 'u', 'f', 'R', 'B', 'U', 'F':
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// skipPythonString returns the index just past the string literal whose opening quote is at src[i]
+func skipPythonString(src string, i int) int {
+	q := src[i]
+	triple := i+2 < len(src) && src[i+1] == q && src[i+2] == q
+	if triple {
+		i += 3
+		for i < len(src) {
+			if src[i] == '\\' {
+				i += 2
+				continue
+			}
+			if i+2 < len(src) && src[i] == q && src[i+1] == q && src[i+2] == q {
+				return i + 3
+			}
+			i++
+		}
+		return len(src)
+	}
+
+	i++
+	for i < len(src) && src[i] != '\n' {
+		if src[i] == '\\' {
+			i += 2
+			continue
+		}
+		if src[i] == q {
+			return i + 1
+		}
+		i++
+	}
+	if i > len(src) {
+		return len(src)
+	}
+	return i
+}
+
+// collapseWhitespace trims trailing whitespace and blank line runs. Indentation
+// is significant in Python, so it is only removed from markup.
+func collapseWhitespace(ext, content string) string {
+	lines := strings.Split(content, "\n")
+	markup := ext == ".html"
+	for i, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if markup {
+			line = strings.TrimLeft(line, " \t")
+		}
+		lines[i] = line
+	}
+	content = strings.Join(lines, "\n")
+	return strings.TrimSpace(blankRunRe.ReplaceAllString(content, "\n\n"))
+}
+
+// isDataLike reports whether a file is static data, a fixture or a minified asset
+func isDataLike(p, kind, content string) bool {
+	if dataKinds[kind] && dataDirRe.MatchString(strings.ToLower(p)) && len(content) > summarizeThreshold/4 {
+		return true
+	}
+	if len(content) < summarizeThreshold {
+		return false
+	}
+
+	// Minified: very long lines
+	lines := strings.Split(content, "\n")
+	if len(content)/len(lines) > 500 {
+		return true
+	}
+
+	// Data modules: mostly literal lines such as rows of a list or dict
+	var literal int
+	for _, line := range lines {
+		t := strings.TrimSpace(line)
+		if t == "" {
+			continue
+		}
+		if strings.ContainsAny(t[:1], `'"[{(0123456789-`) || strings.HasSuffix(t, ",") {
+			literal++
+		}
+	}
+	return literal*10 > len(lines)*8
+}
+
+// summarizeData replaces a data-like file with its size and first few lines
+func summarizeData(content string) string {
+	lines := strings.Split(content, "\n")
+	head := lines
+	if len(head) > 5 {
+		head = head[:5]
+	}
+	for i, line := range head {
+		if len(line) > 200 {
+			head[i] = line[:200] + "..."
+		}
+	}
+	return fmt.Sprintf("[summarized data file: %d lines, %d bytes; first lines:]\n%s\n[...]",
+		len(lines), len(content), strings.Join(head, "\n"))
+}
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStripComments(t *testing.T) {
+	tests := []struct {
+		name, ext, src, want string
+		keepDocstrings       bool
+	}{
+		{
+			name: "python comments and docstrings",
+			ext:  ".py",
+			src:  "def f():\n    \"\"\"Doc.\"\"\"\n    x = '#1'  # note\n    return x\n",
+			want: "def f():\n    \n    x = '#1'  \n    return x\n",
+		},
+		{
+			name:           "python docstrings kept",
+			ext:            ".py",
+			src:            "# header\ndef f():\n    \"\"\"Doc.\"\"\"\n",
+			want:           "\ndef f():\n    \"\"\"Doc.\"\"\"\n",
+			keepDocstrings: true,
+		},
+		{
+			name: "notebook keeps markdown cells",
+			ext:  ".ipynb",
+			src:  "# %% [markdown] cell 1\n# # Sales report\n# Loads the CSV\n\n# %% [code] cell 2\nimport pandas as pd  # data\n# TODO remove\ndf = pd.read_csv('s.csv')\n",
+			want: "# %% [markdown] cell 1\n# # Sales report\n# Loads the CSV\n\n# %% [code] cell 2\nimport pandas as pd  \n\ndf = pd.read_csv('s.csv')\n",
+		},
+		{
+			name: "html and jinja comments",
+			ext:  ".html",
+			src:  "<p>{# hidden #}a<!-- b --></p>",
+			want: "<p>a</p>",
+		},
+		{
+			name: "config comments",
+			ext:  ".cfg",
+			src:  "[app]\n; old\nkey = 1\n",
+			want: "[app]\n\nkey = 1\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stripComments(tt.ext, tt.src, tt.keepDocstrings); got != tt.want {
+				t.Errorf("stripComments = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsDataLike(t *testing.T) {
+	dump := strings.Repeat("INSERT INTO t VALUES (1, 'a');\n", 100)
+	rows := "ROWS = [\n" + strings.Repeat("    (1, 'alpha', 'beta'),\n", 400) + "]\n"
+	tests := []struct {
+		name, path, kind, content string
+		want                      bool
+	}{
+		{"seed dump", "db/seed/users.sql", KindSchema, dump, true},
+		{"schema outside data dirs", "db/schema.sql", KindSchema, dump, false},
+		{"small seed", "db/seed/users.sql", KindSchema, "INSERT INTO t VALUES (1);\n", false},
+		{"data module", "app/constants.py", KindCode, rows, true},
+		{"code in a data dir", "app/data/loader.py", KindCode, "def load():\n    return 1\n", false},
+		{"minified markup", "templates/base.html", KindCode, strings.Repeat("<div>", 2000), true},
+	}
+	for _, tt := range tests {
+		if got := isDataLike(tt.path, tt.kind, tt.content); got != tt.want {
+			t.Errorf("%s: isDataLike = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
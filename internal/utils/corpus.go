@@ -0,0 +1,246 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"lcma/internal/config"
+	"strings"
+	"sync"
+)
+
+// Reasons a legacy file is left out of the corpus
+const (
+	skipBinary     = "binary file"
+	skipFileSize   = "exceeds MAX_FILE_SIZE"
+	skipCorpusSize = "exceeds MAX_CORPUS_SIZE"
+	skipNotebook   = "invalid notebook"
+)
+
+// Kinds of files in the corpus
+const (
+	KindCode     = "code"
+	KindNotebook = "notebook"
+	KindConfig   = "config"
+	KindSchema   = "schema"
+)
+
+// CorpusFile is a legacy file after reading, transcoding and pre-processing
+type CorpusFile struct {
+	Path     string `json:"path"`
+	Kind     string `json:"kind"`
+	Encoding string `json:"encoding"`
+	Content  string `json:"-"`
+}
+
+// SkippedFile records a legacy file that was left out of the corpus
+type SkippedFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Reason string `json:"reason"`
+}
+
+// Corpus is the ingested legacy code base in sorted path order
+type Corpus struct {
+	Source     string
+	Revision   string
+	Files      []CorpusFile
+	Skipped    []SkippedFile
+	Changes    CorpusChanges
+	Redactions []Redaction
+
+	// store and manifest are saved by SaveManifest after a successful run
+	store    *manifestStore
+	manifest *ingestManifest
+}
+
+type fileResult struct {
+	file    CorpusFile
+	skipped *SkippedFile
+	entry   manifestEntry
+	err     error
+}
+
+// buildCorpus reads and pre-processes the files of src with a pool of workers.
+// Results are collected strictly in sorted path order, so the output is
+// byte-for-byte reproducible regardless of how the workers are scheduled.
+// Files unchanged since the manifest in store are served from the processed-content cache.
+func buildCorpus(src *legacySource, store *manifestStore, red *redactor) (*Corpus, *ingestManifest, error) {
+	corpus := &Corpus{Source: src.Location, Revision: src.Revision}
+	manifest := &ingestManifest{
+		Pipeline: pipelineFingerprint(red),
+		Source:   src.Location,
+		Revision: src.Revision,
+		Files:    make(map[string]manifestEntry, len(src.Files)),
+	}
+	n := len(src.Files)
+	if n == 0 {
+		return corpus, manifest, nil
+	}
+
+	workers := config.IngestWorkers
+	if workers < 1 {
+		workers = 1
+	}
+
+	// Each file gets its own buffered result slot; the window bounds how far the
+	// workers can run ahead of the writer
+	results := make([]chan fileResult, n)
+	for i := range results {
+		results[i] = make(chan fileResult, 1)
+	}
+	window := make(chan struct{}, workers*4)
+	jobs := make(chan int)
+	done := make(chan struct{})
+	// On an early return, stop handing out files and let in-flight ones finish
+	// so no worker outlives the call
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer close(done)
+
+	go func() {
+		defer close(jobs)
+		for i := range src.Files {
+			select {
+			case window <- struct{}{}:
+			case <-done:
+				return
+			}
+			select {
+			case jobs <- i:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] <- processSourceFile(src.Files[i], store, red)
+			}
+		}()
+	}
+
+	var total int64
+	for i := range results {
+		res := <-results[i]
+		<-window
+		if res.err != nil {
+			return nil, nil, res.err
+		}
+		manifest.Files[src.Files[i].Path] = res.entry
+		if res.skipped != nil {
+			corpus.Skipped = append(corpus.Skipped, *res.skipped)
+			continue
+		}
+
+		size := int64(len(res.file.Content))
+		if config.MaxCorpusSize > 0 && total+size > config.MaxCorpusSize {
+			corpus.Skipped = append(corpus.Skipped, SkippedFile{Path: res.file.Path, Size: size, Reason: skipCorpusSize})
+			continue
+		}
+		total += size
+
+		corpus.Files = append(corpus.Files, res.file)
+		corpus.Redactions = append(corpus.Redactions, res.entry.Redactions...)
+	}
+	return corpus, manifest, nil
+}
+
+// processSourceFile reads a single legacy file, transcodes it to UTF-8 and redacts
+// secrets, reusing the cached result when the file is unchanged since the last run
+func processSourceFile(f sourceFile, store *manifestStore, red *redactor) fileResult {
+	entry := manifestEntry{Version: f.Version, Size: f.Size}
+	if config.MaxFileSize > 0 && f.Size > config.MaxFileSize {
+		entry.Skipped = skipFileSize
+		return fileResult{entry: entry, skipped: &SkippedFile{Path: f.Path, Size: f.Size, Reason: skipFileSize}}
+	}
+
+	prev, known := store.lookup(f.Path)
+	if known && f.Version != "" && prev.Version == f.Version {
+		if res, ok := cachedResult(f, prev, store); ok {
+			return res
+		}
+	}
+
+	// Read file contents
+	raw, err := f.read()
+	if err != nil {
+		return fileResult{err: fmt.Errorf("error reading file %s: %w", f.Path, err)}
+	}
+	sum := sha256.Sum256(raw)
+	entry.Hash = hex.EncodeToString(sum[:])
+	entry.Size = int64(len(raw))
+
+	// Same content under a new mtime or archive, nothing to re-process
+	if known && prev.Hash == entry.Hash {
+		prev.Version = f.Version
+		if res, ok := cachedResult(f, prev, store); ok {
+			return res
+		}
+	}
+
+	// Transcode legacy encodings to UTF-8 and skip binary files
+	content, enc, err := decodeToUTF8(f.Path, raw)
+	if errors.Is(err, errBinaryFile) {
+		entry.Skipped = skipBinary
+		return fileResult{entry: entry, skipped: &SkippedFile{Path: f.Path, Size: entry.Size, Reason: skipBinary}}
+	}
+	if err != nil {
+		return fileResult{err: fmt.Errorf("error decoding file %s: %w", f.Path, err)}
+	}
+	entry.Encoding = enc
+
+	// Notebooks are flattened to their code and markdown cells, without outputs
+	kind := fileKind(f.Path)
+	if kind == KindNotebook {
+		if content, err = notebookToSource(content); err != nil {
+			entry.Skipped = skipNotebook
+			return fileResult{entry: entry, skipped: &SkippedFile{Path: f.Path, Size: entry.Size, Reason: skipNotebook}}
+		}
+	}
+
+	// Replace secrets and PII before the content is cached or written anywhere
+	content, entry.Redactions = red.Redact(f.Path, content)
+
+	if err := store.writeCache(f.Path, entry.Hash, content); err != nil {
+		return fileResult{err: err}
+	}
+	return fileResult{entry: entry, file: CorpusFile{Path: f.Path, Kind: kind, Encoding: enc, Content: content}}
+}
+
+// cachedResult rebuilds a file result from the previous manifest entry and the cache
+func cachedResult(f sourceFile, prev manifestEntry, store *manifestStore) (fileResult, bool) {
+	if prev.Skipped != "" {
+		return fileResult{entry: prev, skipped: &SkippedFile{Path: f.Path, Size: prev.Size, Reason: prev.Skipped}}, true
+	}
+	content, ok := store.readCache(f.Path, prev.Hash)
+	if !ok {
+		return fileResult{}, false
+	}
+	return fileResult{entry: prev, file: CorpusFile{Path: f.Path, Kind: fileKind(f.Path), Encoding: prev.Encoding, Content: content}}, true
+}
+
+// writeSkippedReport lists every file left out of the corpus in ingestion_report.md
+func writeSkippedReport(corpus *Corpus) error {
+	var sb strings.Builder
+	sb.WriteString("# Ingestion Report\n\n")
+	fmt.Fprintf(&sb, "Source: %s\n", corpus.Source)
+	if corpus.Revision != "" {
+		fmt.Fprintf(&sb, "Revision: %s\n", corpus.Revision)
+	}
+	fmt.Fprintf(&sb, "\nIncluded files: %d\nSkipped files: %d\n", len(corpus.Files), len(corpus.Skipped))
+
+	if len(corpus.Skipped) > 0 {
+		sb.WriteString("\n| File | Size (bytes) | Reason |\n|------|-------------:|--------|\n")
+		for _, s := range corpus.Skipped {
+			fmt.Fprintf(&sb, "| %s | %d | %s |\n", s.Path, s.Size, s.Reason)
+		}
+	}
+
+	return WriteReportFile("ingestion_report.md", []byte(sb.String()))
+}
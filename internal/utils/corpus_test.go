@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"lcma/internal/config"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// slowSource lists n files whose reads finish in reverse order, so workers
+// complete the last files first
+func slowSource(n int) *legacySource {
+	src := &legacySource{Kind: sourceDir, Location: "legacy"}
+	for i := 0; i < n; i++ {
+		content := fmt.Sprintf("x = %d\n", i)
+		delay := time.Duration(n-i) * 200 * time.Microsecond
+		src.Files = append(src.Files, sourceFile{
+			Path:    fmt.Sprintf("pkg/mod_%03d.py", i),
+			Size:    int64(len(content)),
+			Version: fmt.Sprint(i),
+			read: func() ([]byte, error) {
+				time.Sleep(delay)
+				return []byte(content), nil
+			},
+		})
+	}
+	return src
+}
+
+func TestBuildCorpusOrder(t *testing.T) {
+	defer func(w int, max int64) { config.IngestWorkers, config.MaxCorpusSize = w, max }(config.IngestWorkers, config.MaxCorpusSize)
+
+	tests := []struct {
+		name    string
+		workers int
+		maxSize int64
+		files   int // expected corpus files; the rest are skipped by MAX_CORPUS_SIZE
+	}{
+		{"one worker", 1, 0, 40},
+		{"four workers", 4, 0, 40},
+		{"more workers than files", 64, 0, 40},
+		{"corpus limit", 8, 10*6 + 15*7, 25}, // x = 0 to x = 24
+	}
+	var first []CorpusFile
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.IngestWorkers, config.MaxCorpusSize = tt.workers, tt.maxSize
+			corpus, manifest, err := buildCorpus(slowSource(40), &manifestStore{dir: t.TempDir()}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(corpus.Files) != tt.files || len(corpus.Files)+len(corpus.Skipped) != 40 || len(manifest.Files) != 40 {
+				t.Fatalf("%d files, %d skipped, %d in manifest", len(corpus.Files), len(corpus.Skipped), len(manifest.Files))
+			}
+			for i, f := range corpus.Files {
+				want := fmt.Sprintf("pkg/mod_%03d.py", i)
+				if f.Path != want || f.Content != fmt.Sprintf("x = %d\n", i) || f.Kind != KindCode {
+					t.Errorf("file %d = %s %q, want %s", i, f.Path, f.Content, want)
+				}
+			}
+			for _, s := range corpus.Skipped {
+				if s.Reason != skipCorpusSize || s.Path < corpus.Files[len(corpus.Files)-1].Path {
+					t.Errorf("skipped %+v out of order", s)
+				}
+			}
+			if tt.maxSize == 0 {
+				if first != nil && !reflect.DeepEqual(corpus.Files, first) {
+					t.Error("corpus differs between worker counts")
+				}
+				first = corpus.Files
+			}
+		})
+	}
+}
+
+func TestBuildCorpusReadError(t *testing.T) {
+	defer func(w int) { config.IngestWorkers = w }(config.IngestWorkers)
+	config.IngestWorkers = 4
+
+	src := slowSource(20)
+	errBroken := errors.New("broken archive entry")
+	src.Files[7].read = func() ([]byte, error) { return nil, errBroken }
+	_, _, err := buildCorpus(src, &manifestStore{dir: t.TempDir()}, nil)
+	if !errors.Is(err, errBroken) || !strings.Contains(err.Error(), src.Files[7].Path) {
+		t.Errorf("err = %v, want the read error of %s", err, src.Files[7].Path)
+	}
+}
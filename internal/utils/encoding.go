@@ -0,0 +1,257 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"lcma/internal/config"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// errBinaryFile is returned by decodeToUTF8 when the content does not look like text
+var errBinaryFile = errors.New("binary file")
+
+const (
+	encUTF8     = "utf-8"
+	encUTF16    = "utf-16" // byte order from the BOM, little endian without one
+	encUTF16LE  = "utf-16le"
+	encUTF16BE  = "utf-16be"
+	encLatin1   = "latin-1"
+	encWin1252  = "windows-1252"
+	encEBCDIC   = "ebcdic-cp037"
+	encUnknown  = ""
+	binaryRatio = 0.10
+)
+
+// decodeToUTF8 detects the encoding of a legacy file and transcodes it to UTF-8.
+// relPath is matched against ENCODING_OVERRIDES before any detection is attempted.
+func decodeToUTF8(relPath string, content []byte) (string, string, error) {
+	enc, err := encodingOverride(relPath)
+	if err != nil {
+		return "", "", err
+	}
+	if enc == encUnknown {
+		enc = detectEncoding(content)
+	}
+	if enc == encUnknown {
+		return "", "", errBinaryFile
+	}
+
+	text := transcode(enc, content)
+	if looksBinary(text) {
+		return "", enc, errBinaryFile
+	}
+	return text, enc, nil
+}
+
+// encodingOverride returns the configured encoding for relPath, if any
+func encodingOverride(relPath string) (string, error) {
+	if config.EncodingOverrides == "" {
+		return encUnknown, nil
+	}
+	relPath = filepath.ToSlash(relPath)
+
+	for _, rule := range strings.Split(config.EncodingOverrides, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		pattern, name, ok := strings.Cut(rule, "=")
+		if !ok {
+			return "", fmt.Errorf("invalid ENCODING_OVERRIDES rule %q, expected <glob>=<encoding>", rule)
+		}
+		enc, ok := config.EncodingAliases[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return "", fmt.Errorf("unsupported encoding %q in ENCODING_OVERRIDES", name)
+		}
+		pattern = strings.TrimSpace(pattern)
+		if matched, _ := path.Match(pattern, relPath); matched {
+			return enc, nil
+		}
+		if matched, _ := path.Match(pattern, path.Base(relPath)); matched {
+			return enc, nil
+		}
+	}
+	return encUnknown, nil
+}
+
+// detectEncoding guesses the encoding of content, returning encUnknown for binary data
+func detectEncoding(content []byte) string {
+	switch {
+	case bytes.HasPrefix(content, []byte{0xEF, 0xBB, 0xBF}):
+		return encUTF8
+	case bytes.HasPrefix(content, []byte{0xFF, 0xFE}):
+		return encUTF16LE
+	case bytes.HasPrefix(content, []byte{0xFE, 0xFF}):
+		return encUTF16BE
+	}
+
+	// UTF-16 without a BOM shows up as ASCII text with every other byte zero
+	if len(content) >= 4 && len(content)%2 == 0 {
+		var evenZeros, oddZeros int
+		for i := 0; i < len(content); i += 2 {
+			if content[i] == 0 {
+				evenZeros++
+			}
+			if content[i+1] == 0 {
+				oddZeros++
+			}
+		}
+		half := len(content) / 2
+		if oddZeros > half*4/10 && evenZeros <= half/20 {
+			return encUTF16LE
+		}
+		if evenZeros > half*4/10 && oddZeros <= half/20 {
+			return encUTF16BE
+		}
+	}
+
+	if bytes.IndexByte(content, 0) >= 0 {
+		return encUnknown
+	}
+	if utf8.Valid(content) {
+		return encUTF8
+	}
+	if looksEBCDIC(content) {
+		return encEBCDIC
+	}
+
+	// Bytes 0x80-0x9F are C1 controls in Latin-1 but printable in Windows-1252
+	for _, b := range content {
+		if b >= 0x80 && b <= 0x9F {
+			return encWin1252
+		}
+	}
+	return encLatin1
+}
+
+// looksEBCDIC reports whether content is dominated by EBCDIC spaces, letters and digits
+func looksEBCDIC(content []byte) bool {
+	var spaces, letters, high int
+	for _, b := range content {
+		switch {
+		case b == 0x40:
+			spaces++
+		case (b >= 0x81 && b <= 0xA9) || (b >= 0xC1 && b <= 0xE9) || (b >= 0xF0 && b <= 0xF9):
+			letters++
+		}
+		if b >= 0x80 {
+			high++
+		}
+	}
+	n := len(content)
+	return n > 0 && high > n/2 && spaces > bytes.Count(content, []byte{' '}) && spaces+letters > n*6/10
+}
+
+// transcode converts content from enc to a UTF-8 string
+func transcode(enc string, content []byte) string {
+	switch enc {
+	case encUTF16, encUTF16LE, encUTF16BE:
+		return decodeUTF16(enc, content)
+	case encLatin1:
+		runes := make([]rune, len(content))
+		for i, b := range content {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	case encWin1252:
+		runes := make([]rune, len(content))
+		for i, b := range content {
+			if b >= 0x80 && b <= 0x9F {
+				runes[i] = win1252C1[b-0x80]
+			} else {
+				runes[i] = rune(b)
+			}
+		}
+		return string(runes)
+	case encEBCDIC:
+		runes := make([]rune, len(content))
+		for i, b := range content {
+			runes[i] = ebcdicCP037[b]
+		}
+		// EBCDIC line ends are usually NEL (0x15), which Python and Go tooling do not treat as a newline
+		return strings.ReplaceAll(string(runes), "\u0085", "\n")
+	default:
+		content = bytes.TrimPrefix(content, []byte{0xEF, 0xBB, 0xBF})
+		return strings.ToValidUTF8(string(content), "�")
+	}
+}
+
+// decodeUTF16 decodes UTF-16 in the byte order of its BOM, or of enc when there is none
+func decodeUTF16(enc string, content []byte) string {
+	switch {
+	case bytes.HasPrefix(content, []byte{0xFF, 0xFE}):
+		enc, content = encUTF16LE, content[2:]
+	case bytes.HasPrefix(content, []byte{0xFE, 0xFF}):
+		enc, content = encUTF16BE, content[2:]
+	}
+	units := make([]uint16, len(content)/2)
+	for i := range units {
+		if enc != encUTF16BE {
+			units[i] = uint16(content[2*i]) | uint16(content[2*i+1])<<8
+		} else {
+			units[i] = uint16(content[2*i])<<8 | uint16(content[2*i+1])
+		}
+	}
+	return string(utf16.Decode(units))
+}
+
+// looksBinary reports whether decoded text contains too many control characters to be source code
+func looksBinary(text string) bool {
+	var total, control int
+	for _, r := range text {
+		total++
+		if r == 0 || (r < 0x20 && r != '\t' && r != '\n' && r != '\r' && r != '\f') || (r >= 0x80 && r < 0xA0) {
+			control++
+		}
+	}
+	return total > 0 && float64(control)/float64(total) > binaryRatio
+}
+
+// win1252C1 holds the Windows-1252 code points for bytes 0x80-0x9F
+var win1252C1 = [32]rune{
+	0x20AC, 0x0081, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008D, 0x017D, 0x008F,
+	0x0090, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0x009D, 0x017E, 0x0178,
+}
+
+// ebcdicCP037 maps EBCDIC code page 037 (US/Canada) bytes to Unicode
+var ebcdicCP037 = [256]rune{
+	0x0000, 0x0001, 0x0002, 0x0003, 0x009C, 0x0009, 0x0086, 0x007F,
+	0x0097, 0x008D, 0x008E, 0x000B, 0x000C, 0x000D, 0x000E, 0x000F,
+	0x0010, 0x0011, 0x0012, 0x0013, 0x009D, 0x0085, 0x0008, 0x0087,
+	0x0018, 0x0019, 0x0092, 0x008F, 0x001C, 0x001D, 0x001E, 0x001F,
+	0x0080, 0x0081, 0x0082, 0x0083, 0x0084, 0x000A, 0x0017, 0x001B,
+	0x0088, 0x0089, 0x008A, 0x008B, 0x008C, 0x0005, 0x0006, 0x0007,
+	0x0090, 0x0091, 0x0016, 0x0093, 0x0094, 0x0095, 0x0096, 0x0004,
+	0x0098, 0x0099, 0x009A, 0x009B, 0x0014, 0x0015, 0x009E, 0x001A,
+	0x0020, 0x00A0, 0x00E2, 0x00E4, 0x00E0, 0x00E1, 0x00E3, 0x00E5,
+	0x00E7, 0x00F1, 0x00A2, 0x002E, 0x003C, 0x0028, 0x002B, 0x007C,
+	0x0026, 0x00E9, 0x00EA, 0x00EB, 0x00E8, 0x00ED, 0x00EE, 0x00EF,
+	0x00EC, 0x00DF, 0x0021, 0x0024, 0x002A, 0x0029, 0x003B, 0x00AC,
+	0x002D, 0x002F, 0x00C2, 0x00C4, 0x00C0, 0x00C1, 0x00C3, 0x00C5,
+	0x00C7, 0x00D1, 0x00A6, 0x002C, 0x0025, 0x005F, 0x003E, 0x003F,
+	0x00F8, 0x00C9, 0x00CA, 0x00CB, 0x00C8, 0x00CD, 0x00CE, 0x00CF,
+	0x00CC, 0x0060, 0x003A, 0x0023, 0x0040, 0x0027, 0x003D, 0x0022,
+	0x00D8, 0x0061, 0x0062, 0x0063, 0x0064, 0x0065, 0x0066, 0x0067,
+	0x0068, 0x0069, 0x00AB, 0x00BB, 0x00F0, 0x00FD, 0x00FE, 0x00B1,
+	0x00B0, 0x006A, 0x006B, 0x006C, 0x006D, 0x006E, 0x006F, 0x0070,
+	0x0071, 0x0072, 0x00AA, 0x00BA, 0x00E6, 0x00B8, 0x00C6, 0x00A4,
+	0x00B5, 0x007E, 0x0073, 0x0074, 0x0075, 0x0076, 0x0077, 0x0078,
+	0x0079, 0x007A, 0x00A1, 0x00BF, 0x00D0, 0x00DD, 0x00DE, 0x00AE,
+	0x005E, 0x00A3, 0x00A5, 0x00B7, 0x00A9, 0x00A7, 0x00B6, 0x00BC,
+	0x00BD, 0x00BE, 0x005B, 0x005D, 0x00AF, 0x00A8, 0x00B4, 0x00D7,
+	0x007B, 0x0041, 0x0042, 0x0043, 0x0044, 0x0045, 0x0046, 0x0047,
+	0x0048, 0x0049, 0x00AD, 0x00F4, 0x00F6, 0x00F2, 0x00F3, 0x00F5,
+	0x007D, 0x004A, 0x004B, 0x004C, 0x004D, 0x004E, 0x004F, 0x0050,
+	0x0051, 0x0052, 0x00B9, 0x00FB, 0x00FC, 0x00F9, 0x00FA, 0x00FF,
+	0x005C, 0x00F7, 0x0053, 0x0054, 0x0055, 0x0056, 0x0057, 0x0058,
+	0x0059, 0x005A, 0x00B2, 0x00D4, 0x00D6, 0x00D2, 0x00D3, 0x00D5,
+	0x0030, 0x0031, 0x0032, 0x0033, 0x0034, 0x0035, 0x0036, 0x0037,
+	0x0038, 0x0039, 0x00B3, 0x00DB, 0x00DC, 0x00D9, 0x00DA, 0x009F,
+}
@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"errors"
+	"lcma/internal/config"
+	"testing"
+	"unicode/utf16"
+)
+
+func utf16Bytes(s string, bigEndian bool) []byte {
+	var out []byte
+	for _, u := range utf16.Encode([]rune(s)) {
+		if bigEndian {
+			out = append(out, byte(u>>8), byte(u))
+		} else {
+			out = append(out, byte(u), byte(u>>8))
+		}
+	}
+	return out
+}
+
+func ebcdicBytes(s string) []byte {
+	table := map[rune]byte{}
+	for b, r := range ebcdicCP037 {
+		if _, ok := table[r]; !ok {
+			table[r] = byte(b)
+		}
+	}
+	table['\n'] = 0x15
+	var out []byte
+	for _, r := range s {
+		out = append(out, table[r])
+	}
+	return out
+}
+
+func TestDecodeToUTF8(t *testing.T) {
+	const src = "name = 'Zoë'\nprint(name)\n"
+	tests := []struct {
+		name      string
+		path      string
+		overrides string
+		content   []byte
+		want      string
+		enc       string
+	}{
+		{"utf-8", "a.py", "", []byte(src), src, encUTF8},
+		{"utf-8 bom", "a.py", "", append([]byte{0xEF, 0xBB, 0xBF}, src...), src, encUTF8},
+		{"utf-16le bom", "a.py", "", append([]byte{0xFF, 0xFE}, utf16Bytes(src, false)...), src, encUTF16LE},
+		{"utf-16be bom", "a.py", "", append([]byte{0xFE, 0xFF}, utf16Bytes(src, true)...), src, encUTF16BE},
+		{"utf-16le without bom", "a.py", "", utf16Bytes(src, false), src, encUTF16LE},
+		{"utf-16be without bom", "a.py", "", utf16Bytes(src, true), src, encUTF16BE},
+		{"utf-16 override follows a big endian bom", "a.py", "*.py=utf-16", append([]byte{0xFE, 0xFF}, utf16Bytes(src, true)...), src, encUTF16},
+		{"utf-16 override defaults to little endian", "a.py", "*.py=utf16", utf16Bytes(src, false), src, encUTF16},
+		{"latin-1", "a.py", "", []byte("name = 'Zo\xeb'\nprint(name)\n"), src, encLatin1},
+		{"windows-1252 smart quotes", "a.html", "", []byte("<p>\x93quoted\x94 \x80 5</p>\n"), "<p>“quoted” € 5</p>\n", encWin1252},
+		{"latin-1 override keeps C1 bytes", "a.html", "*.html=latin-1", []byte("<p>caf\xe9</p>\n"), "<p>café</p>\n", encLatin1},
+		{"ebcdic", "legacy/job.py", "", ebcdicBytes("PRINT 'HELLO WORLD'\nX = 1\n"), "PRINT 'HELLO WORLD'\nX = 1\n", encEBCDIC},
+		{"override by directory glob", "mainframe/job.py", "mainframe/*.py=cp037", ebcdicBytes("x = 1\n"), "x = 1\n", encEBCDIC},
+	}
+	defer func(v string) { config.EncodingOverrides = v }(config.EncodingOverrides)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.EncodingOverrides = tt.overrides
+			got, enc, err := decodeToUTF8(tt.path, tt.content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want || enc != tt.enc {
+				t.Errorf("decodeToUTF8 = %q (%s), want %q (%s)", got, enc, tt.want, tt.enc)
+			}
+		})
+	}
+}
+
+func TestDecodeToUTF8Binary(t *testing.T) {
+	config.EncodingOverrides = ""
+	for name, content := range map[string][]byte{
+		"png header": {0x89, 'P', 'N', 'G', 0x0D, 0x0A, 0x1A, 0x0A, 0x00, 0x00, 0x00, 0x0D, 'I', 'H', 'D', 'R'},
+		"controls":   []byte("\x01\x02\x03\x04\x05abc\x06\x07\x08"),
+	} {
+		if _, _, err := decodeToUTF8("x.py", content); !errors.Is(err, errBinaryFile) {
+			t.Errorf("%s: err = %v, want errBinaryFile", name, err)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"lcma/internal/config"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// manifestVersion is bumped whenever the processed content format changes
+const manifestVersion = "2"
+
+// manifestEntry records how a legacy file was ingested on the previous run
+type manifestEntry struct {
+	Version    string      `json:"version"`        // cheap identity from the source, e.g. blob id or mtime
+	Hash       string      `json:"hash,omitempty"` // sha256 of the raw bytes
+	Size       int64       `json:"size"`
+	Encoding   string      `json:"encoding,omitempty"`
+	Skipped    string      `json:"skipped,omitempty"`
+	Redactions []Redaction `json:"redactions,omitempty"`
+}
+
+// ingestManifest is the content-hash manifest saved next to OUTPUT_FILE_PATH
+type ingestManifest struct {
+	Pipeline string                   `json:"pipeline"`
+	Source   string                   `json:"source"`
+	Revision string                   `json:"revision,omitempty"`
+	Files    map[string]manifestEntry `json:"files"`
+}
+
+// CorpusChanges lists the legacy files that changed since the last run
+type CorpusChanges struct {
+	Full    bool     `json:"full"` // no usable manifest, every file was re-processed
+	Added   []string `json:"added"`
+	Changed []string `json:"changed"`
+	Removed []string `json:"removed"`
+}
+
+// Empty reports whether nothing changed since the last run
+func (c CorpusChanges) Empty() bool {
+	return !c.Full && len(c.Added) == 0 && len(c.Changed) == 0 && len(c.Removed) == 0
+}
+
+// manifestStore gives workers access to the previous manifest and the processed-content cache
+type manifestStore struct {
+	dir      string
+	previous *ingestManifest
+	reusable bool
+}
+
+func outputDir() string {
+	return filepath.Dir(config.OutputFilePath)
+}
+
+func manifestPath() string {
+	return filepath.Join(outputDir(), "manifest.json")
+}
+
+// pipelineFingerprint identifies the settings that affect the corpus and the
+// reports generated from it: ingestion settings, the model and the prompt templates.
+// Cached content and reports are only reused when the fingerprint is unchanged.
+func pipelineFingerprint(red *redactor) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "v%s|enc=%s|maxfile=%d|redact=%s", manifestVersion, config.EncodingOverrides, config.MaxFileSize, red.fingerprint())
+	fmt.Fprintf(h, "|compact=%s;%s|model=%s", config.CompactReport, config.CompactCode, config.Model)
+	entries, err := os.ReadDir(config.PromptTemplatePath)
+	if err != nil {
+		fmt.Fprintf(h, "|prompts=%v", err)
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(config.PromptTemplatePath, e.Name()))
+		if err != nil {
+			fmt.Fprintf(h, "|prompt=%s:%v", e.Name(), err)
+			continue
+		}
+		fmt.Fprintf(h, "|prompt=%s:%x", e.Name(), sha256.Sum256(data))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// loadManifestStore reads the previous manifest, if any.
+// When INCREMENTAL is disabled or the pipeline settings changed, nothing is reused.
+func loadManifestStore(src *legacySource, red *redactor) (*manifestStore, error) {
+	store := &manifestStore{dir: filepath.Join(outputDir(), ".lcma_cache")}
+
+	data, err := os.ReadFile(manifestPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading ingestion manifest: %w", err)
+	}
+
+	var m ingestManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		// A corrupt manifest only costs a full rebuild
+		fmt.Println("Ignoring unreadable ingestion manifest:", err)
+		return store, nil
+	}
+	store.previous = &m
+	store.reusable = config.Incremental && m.Pipeline == pipelineFingerprint(red) && m.Source == src.Location
+	return store, nil
+}
+
+// lookup returns the previous entry for path when cached content may be reused
+func (s *manifestStore) lookup(path string) (manifestEntry, bool) {
+	if !s.reusable {
+		return manifestEntry{}, false
+	}
+	e, ok := s.previous.Files[path]
+	return e, ok
+}
+
+// cacheName names the cached content of a file. The processed text depends on
+// the path as well as the raw bytes (encoding overrides, file kind and config-only
+// redaction rules), so identical bytes under two paths are cached separately.
+func cacheName(path, hash string) string {
+	sum := sha256.Sum256([]byte(hash + "\x00" + path))
+	return hex.EncodeToString(sum[:]) + ".txt"
+}
+
+func (s *manifestStore) readCache(path, hash string) (string, bool) {
+	data, err := os.ReadFile(filepath.Join(s.dir, cacheName(path, hash)))
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+func (s *manifestStore) writeCache(path, hash, content string) error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("error creating ingestion cache: %w", err)
+	}
+	// Write through a temp file so a concurrent reader never sees partial content
+	name := cacheName(path, hash)
+	tmp, err := os.CreateTemp(s.dir, name+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error writing ingestion cache: %w", err)
+	}
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("error writing ingestion cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("error writing ingestion cache: %w", err)
+	}
+	return os.Rename(tmp.Name(), filepath.Join(s.dir, name))
+}
+
+// SaveManifest records the ingested corpus as processed. Call it only after every
+// report of the run is written, so a failed run leaves the previous manifest and
+// the next run re-processes the same changes.
+func SaveManifest(corpus *Corpus) error {
+	if corpus.store == nil || corpus.manifest == nil {
+		return nil
+	}
+	return corpus.store.save(corpus.manifest, corpus.Changes)
+}
+
+// save writes the new manifest and changes.json, and prunes cache entries no longer referenced
+func (s *manifestStore) save(m *ingestManifest, changes CorpusChanges) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding ingestion manifest: %w", err)
+	}
+	if err := os.WriteFile(manifestPath(), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing ingestion manifest: %w", err)
+	}
+
+	data, err = json.MarshalIndent(changes, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding change list: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(outputDir(), "changes.json"), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing change list: %w", err)
+	}
+
+	live := make(map[string]bool, len(m.Files))
+	for path, e := range m.Files {
+		if e.Hash != "" {
+			live[cacheName(path, e.Hash)] = true
+		}
+	}
+	entries, _ := os.ReadDir(s.dir)
+	for _, e := range entries {
+		if !live[e.Name()] {
+			os.Remove(filepath.Join(s.dir, e.Name()))
+		}
+	}
+	return nil
+}
+
+// diff compares the new manifest with the previous one by content hash
+func (s *manifestStore) diff(m *ingestManifest) CorpusChanges {
+	changes := CorpusChanges{Added: []string{}, Changed: []string{}, Removed: []string{}}
+	if s.previous == nil || !s.reusable {
+		changes.Full = true
+	}
+
+	var prevFiles map[string]manifestEntry
+	if s.previous != nil {
+		prevFiles = s.previous.Files
+	}
+	for path, e := range m.Files {
+		prev, ok := prevFiles[path]
+		switch {
+		case !ok:
+			changes.Added = append(changes.Added, path)
+		case e.Hash != prev.Hash || (e.Hash == "" && e.Version != prev.Version):
+			changes.Changed = append(changes.Changed, path)
+		}
+	}
+	for path := range prevFiles {
+		if _, ok := m.Files[path]; !ok {
+			changes.Removed = append(changes.Removed, path)
+		}
+	}
+
+	sort.Strings(changes.Added)
+	sort.Strings(changes.Changed)
+	sort.Strings(changes.Removed)
+	return changes
+}
+
+// changeSummary describes changes in one line for console output
+func changeSummary(c CorpusChanges) string {
+	if c.Full {
+		return "full rebuild"
+	}
+	parts := []string{
+		fmt.Sprintf("%d added", len(c.Added)),
+		fmt.Sprintf("%d changed", len(c.Changed)),
+		fmt.Sprintf("%d removed", len(c.Removed)),
+	}
+	return strings.Join(parts, ", ")
+}
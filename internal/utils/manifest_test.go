@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestManifestDiff(t *testing.T) {
+	previous := &ingestManifest{Files: map[string]manifestEntry{
+		"app.py":      {Version: "1", Hash: "aaa"},
+		"models.py":   {Version: "1", Hash: "bbb"},
+		"old.py":      {Version: "1", Hash: "ccc"},
+		"logo.png":    {Version: "1", Skipped: skipBinary},
+		"touched.py":  {Version: "1", Hash: "ddd"},
+		"huge.sql":    {Version: "1", Skipped: skipFileSize},
+		"renamed.cfg": {Version: "1", Hash: "eee"},
+	}}
+	current := &ingestManifest{Files: map[string]manifestEntry{
+		"app.py":       {Version: "1", Hash: "aaa"},
+		"models.py":    {Version: "2", Hash: "fff"},
+		"new.py":       {Version: "1", Hash: "ggg"},
+		"logo.png":     {Version: "1", Skipped: skipBinary},
+		"touched.py":   {Version: "2", Hash: "ddd"},
+		"huge.sql":     {Version: "2", Skipped: skipFileSize},
+		"settings.cfg": {Version: "1", Hash: "eee"},
+	}}
+
+	tests := []struct {
+		name  string
+		store *manifestStore
+		want  CorpusChanges
+	}{
+		{
+			name:  "incremental",
+			store: &manifestStore{previous: previous, reusable: true},
+			want: CorpusChanges{
+				Added:   []string{"new.py", "settings.cfg"},
+				Changed: []string{"huge.sql", "models.py"},
+				Removed: []string{"old.py", "renamed.cfg"},
+			},
+		},
+		{
+			name:  "settings changed",
+			store: &manifestStore{previous: previous},
+			want: CorpusChanges{
+				Full:    true,
+				Added:   []string{"new.py", "settings.cfg"},
+				Changed: []string{"huge.sql", "models.py"},
+				Removed: []string{"old.py", "renamed.cfg"},
+			},
+		},
+		{
+			name:  "first run",
+			store: &manifestStore{},
+			want: CorpusChanges{
+				Full:    true,
+				Added:   []string{"app.py", "huge.sql", "logo.png", "models.py", "new.py", "settings.cfg", "touched.py"},
+				Changed: []string{},
+				Removed: []string{},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.store.diff(current)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diff = %+v, want %+v", got, tt.want)
+			}
+			if got.Empty() {
+				t.Errorf("Empty() = true for %+v", got)
+			}
+		})
+	}
+
+	if got := (&manifestStore{previous: current, reusable: true}).diff(current); !got.Empty() {
+		t.Errorf("diff of an unchanged manifest = %+v, want empty", got)
+	}
+}
+
+func TestCacheName(t *testing.T) {
+	// The same bytes are processed differently by path, so they must not share a cache entry
+	if cacheName("settings.cfg", "aaa") == cacheName("settings.py", "aaa") {
+		t.Error("cache entries for the same hash under two paths collide")
+	}
+	if cacheName("app.py", "aaa") == cacheName("app.py", "bbb") {
+		t.Error("cache entries for two hashes of one path collide")
+	}
+	if cacheName("app.py", "aaa") != cacheName("app.py", "aaa") {
+		t.Error("cache name is not stable")
+	}
+}
+
+func TestCacheRoundTrip(t *testing.T) {
+	store := &manifestStore{dir: t.TempDir()}
+	if err := store.writeCache("a.py", "aaa", "print('a')\n"); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := store.readCache("a.py", "aaa"); !ok || got != "print('a')\n" {
+		t.Errorf("readCache = %q, %v", got, ok)
+	}
+	if _, ok := store.readCache("b.py", "aaa"); ok {
+		t.Error("cache entry of a.py served for b.py")
+	}
+}
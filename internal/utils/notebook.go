@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// notebookCell is a Jupyter cell. Source is a string or a list of lines depending on
+// the writer; nbformat 3 stores code in Input instead of Source.
+type notebookCell struct {
+	CellType string          `json:"cell_type"`
+	Source   json.RawMessage `json:"source"`
+	Input    json.RawMessage `json:"input"`
+}
+
+type notebook struct {
+	Cells      []notebookCell `json:"cells"`
+	Worksheets []struct {
+		Cells []notebookCell `json:"cells"`
+	} `json:"worksheets"`
+}
+
+// notebookToSource flattens an .ipynb file into a script with its code and
+// markdown cells in order. Outputs are dropped, markdown becomes comments.
+func notebookToSource(content string) (string, error) {
+	var nb notebook
+	if err := json.Unmarshal([]byte(content), &nb); err != nil {
+		return "", fmt.Errorf("invalid notebook: %w", err)
+	}
+
+	cells := nb.Cells
+	for _, ws := range nb.Worksheets {
+		cells = append(cells, ws.Cells...)
+	}
+
+	var sb strings.Builder
+	for i, cell := range cells {
+		raw := cell.Source
+		if len(raw) == 0 {
+			raw = cell.Input
+		}
+		text, err := cellText(raw)
+		if err != nil {
+			return "", fmt.Errorf("invalid source in cell %d: %w", i+1, err)
+		}
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		switch cell.CellType {
+		case "code":
+			fmt.Fprintf(&sb, "# %%%% [code] cell %d\n%s\n\n", i+1, strings.TrimRight(text, "\n"))
+		case "markdown", "heading":
+			fmt.Fprintf(&sb, "# %%%% [markdown] cell %d\n", i+1)
+			for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+				sb.WriteString(strings.TrimRight("# "+line, " ") + "\n")
+			}
+			sb.WriteString("\n")
+		}
+	}
+	return strings.TrimRight(sb.String(), "\n") + "\n", nil
+}
+
+// cellText joins a cell source given either as a string or a list of lines
+func cellText(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 {
+		return "", nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, nil
+	}
+	var lines []string
+	if err := json.Unmarshal(raw, &lines); err != nil {
+		return "", err
+	}
+	return strings.Join(lines, ""), nil
+}
@@ -4,10 +4,33 @@ import (
 	"fmt"
 	"lcma/internal/config"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
-func buildPromptWithContext(templatePath string) (string, error) {
+// artifactPlaceholders maps prompt tags to analysis artifacts in REPORT_PATH whose
+// content is injected into the prompt, so the LLM works from extracted facts
+var artifactPlaceholders = map[string]string{
+	"route_inventory":    "routes.md",
+	"api_contract":       "openapi.md",
+	"database_schema":    "erd.md",
+	"data_layer":         "data_layer.md",
+	"template_inventory": "templates.md",
+	"templ_translation":  "templ_translation.md",
+	"dependency_map":     "dependencies.md",
+	"dependency_audit":   "dependency_audit.md",
+	"security_findings":  "security_findings.md",
+	"code_clones":        "clones.md",
+	"code_metrics":       "metrics.md",
+	"migration_plan":     "migration_plan.md",
+	"bounded_contexts":   "bounded_contexts.md",
+	"business_rules":     "business_rules.md",
+	"dead_code":          "dead_code.md",
+}
+
+// buildPromptWithContext fills the placeholder tags of a prompt template; tags
+// holds extra tag contents for prompts that need more than the artifacts
+func buildPromptWithContext(templatePath string, tags map[string]string) (string, error) {
 	// Read the template file
 	prompt, err := os.ReadFile(templatePath)
 	if err != nil {
@@ -23,6 +46,18 @@ func buildPromptWithContext(templatePath string) (string, error) {
 		"<moderntech_stack></moderntech_stack>": "<moderntech_stack>\n" + config.ModernTechStack + "\n</moderntech_stack>",
 	}
 
+	for tag, artifact := range artifactPlaceholders {
+		content, err := os.ReadFile(filepath.Join(config.ReportPath, artifact))
+		if err != nil && !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to read %s: %w", artifact, err)
+		}
+		replacements["<"+tag+"></"+tag+">"] = "<" + tag + ">\n" + strings.TrimSpace(string(content)) + "\n</" + tag + ">"
+	}
+
+	for tag, content := range tags {
+		replacements["<"+tag+"></"+tag+">"] = "<" + tag + ">\n" + strings.TrimSpace(content) + "\n</" + tag + ">"
+	}
+
 	for placeholder, replacement := range replacements {
 		promptWithContext = strings.Replace(promptWithContext, placeholder, replacement, 1)
 	}
@@ -3,73 +3,62 @@ package utils
 import (
 	"fmt"
 	"lcma/internal/config"
-	"os"
-	"path/filepath"
-	"strings"
 )
 
-// ReadDirectoryFiles reads all .py and .html files from the given directory
-// and its subdirectories, combining their contents into a single output file
-func ReadLegacyCodeGenerateOutput(dirPath string) error {
+// ReadLegacyCodeGenerateOutput reads all .py, .html, notebook and config files from the given
+// directory, archive or git revision and combines their contents into a single output file.
+// Only files changed since the previous run are re-processed; the returned corpus
+// lists what changed. The manifest is saved by SaveManifest once the run succeeds.
+func ReadLegacyCodeGenerateOutput(dirPath string) (*Corpus, error) {
 	// If dirPath is empty, read from env
 	if dirPath == "" {
 		dirPath = config.LegacyCodePath
 	}
 
-	// Create/truncate output file
-	outputFile, err := os.Create(config.OutputFilePath)
+	src, err := openLegacySource(dirPath)
 	if err != nil {
-		return fmt.Errorf("error creating output file: %w", err)
+		return nil, err
+	}
+	defer src.Close()
+	if src.Kind == sourceGit {
+		fmt.Printf("Reading legacy code from %s at commit %s\n", src.Location, src.Revision)
 	}
-	defer outputFile.Close()
-
-	// Walk through directory
-	err = filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return fmt.Errorf("error accessing path %s: %w", path, err)
-		}
-
-		// Skip directories, including .venv directories
-		if info.IsDir() {
-			if filepath.Base(path) == ".venv" {
-				return filepath.SkipDir // Skip this directory and all its contents
-			}
-			return nil
-		}
-
-		// Check if file extension is .py or .html
-		ext := strings.ToLower(filepath.Ext(path))
-		if ext != ".py" && ext != ".html" {
-			return nil
-		}
-
-		// Read file contents
-		content, err := os.ReadFile(path)
-		if err != nil {
-			return fmt.Errorf("error reading file %s: %w", path, err)
-		}
-
-		// Write filename header and contents to output file
-		header := fmt.Sprintf("# %s\n", filepath.Base(path))
-		if _, err := outputFile.WriteString(header); err != nil {
-			return fmt.Errorf("error writing header to output file: %w", err)
-		}
-
-		if _, err := outputFile.Write(content); err != nil {
-			return fmt.Errorf("error writing content to output file: %w", err)
-		}
-
-		// Add newline between files
-		if _, err := outputFile.WriteString("\n\n"); err != nil {
-			return fmt.Errorf("error writing newline to output file: %w", err)
-		}
 
-		return nil
-	})
+	red, err := newRedactor()
+	if err != nil {
+		return nil, err
+	}
+	store, err := loadManifestStore(src, red)
+	if err != nil {
+		return nil, err
+	}
 
+	corpus, manifest, err := buildCorpus(src, store, red)
 	if err != nil {
-		return fmt.Errorf("error walking directory: %w", err)
+		return nil, err
+	}
+	if err := writeCorpusFile(config.OutputFilePath, corpus.Files); err != nil {
+		return nil, err
 	}
 
-	return nil
+	corpus.Changes = store.diff(manifest)
+	corpus.store, corpus.manifest = store, manifest
+	fmt.Printf("Ingested %d legacy files (%s)\n", len(corpus.Files), changeSummary(corpus.Changes))
+
+	if len(corpus.Skipped) > 0 {
+		fmt.Printf("Skipped %d legacy files, see ingestion_report.md\n", len(corpus.Skipped))
+	}
+	if err := writeStageCorpora(corpus); err != nil {
+		return nil, err
+	}
+	if err := writeSkippedReport(corpus); err != nil {
+		return nil, err
+	}
+	if len(corpus.Redactions) > 0 {
+		fmt.Printf("Redacted %d secrets and PII values, see redaction_report.md\n", len(corpus.Redactions))
+	}
+	if err := writeRedactionReport(corpus); err != nil {
+		return nil, err
+	}
+	return corpus, nil
 }
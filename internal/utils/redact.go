@@ -0,0 +1,332 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"lcma/internal/config"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Redaction records a single value replaced before the corpus leaves the machine.
+// The original value is never stored.
+type Redaction struct {
+	File        string `json:"file"`
+	Line        int    `json:"line"`
+	Rule        string `json:"rule"`
+	Placeholder string `json:"placeholder"`
+}
+
+// redactionRule detects one kind of secret or PII. When the pattern has a capture
+// group only the first group is replaced, so surrounding context stays readable.
+type redactionRule struct {
+	Name       string
+	Pattern    *regexp.Regexp
+	Check      func(value string) bool
+	ConfigOnly bool // unquoted key = value lines are only secrets in config files
+}
+
+// customRedactionRule is an entry of the REDACTION_RULES_FILE JSON array
+type customRedactionRule struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+}
+
+// builtinRedactionRules are always applied when redaction is enabled
+var builtinRedactionRules = []redactionRule{
+	{Name: "PRIVATE_KEY", Pattern: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	{Name: "AWS_ACCESS_KEY", Pattern: regexp.MustCompile(`\b((?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[0-9A-Z]{16})\b`)},
+	{Name: "AWS_SECRET_KEY", Pattern: regexp.MustCompile(`(?i)aws.{0,20}(?:secret|key).{0,20}?['"]([A-Za-z0-9/+=]{40})['"]`)},
+	{Name: "GCP_API_KEY", Pattern: regexp.MustCompile(`\b(AIza[0-9A-Za-z_\-]{35})`)},
+	{Name: "GCP_PRIVATE_KEY_ID", Pattern: regexp.MustCompile(`"private_key_id"\s*:\s*"([0-9a-f]{40})"`)},
+	{Name: "CONNECTION_PASSWORD", Pattern: regexp.MustCompile(`(?i)\b[a-z][a-z0-9+.\-]*://[^\s:/'"@]+:([^@\s'"/]+)@`)},
+	{Name: "CONNECTION_PASSWORD", Pattern: regexp.MustCompile(`(?i)\b(?:dbname|host|user|server|data source)\s*=[^'"\n]*?\b(?:password|pwd)\s*=\s*([^\s;'"]+)`)},
+	{Name: "HARDCODED_SECRET", Pattern: regexp.MustCompile(`(?i)\b\w*(?:password|passwd|pwd|secret|api_?key|access_?token|auth_?token)\w*['"]?\]?\s*[:=]\s*['"]([^'"\s]{4,})['"]`), Check: notPlaceholderValue},
+	{Name: "CONFIG_SECRET", Pattern: regexp.MustCompile(`(?im)^[ \t]*[\w.\-]*(?:password|passwd|pwd|secret|api_?key|token)[\w.\-]*[ \t]*[:=][ \t]*([^\s'"#;][^\n#;]*?)[ \t]*$`), Check: notPlaceholderValue, ConfigOnly: true},
+	{Name: "EMAIL", Pattern: regexp.MustCompile(`\b[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}\b`)},
+	{Name: "SSN", Pattern: regexp.MustCompile(`\b(\d{3}-\d{2}-\d{4})\b`), Check: validSSN},
+	{Name: "HIGH_ENTROPY_STRING", Pattern: regexp.MustCompile(`['"]([A-Za-z0-9+/=_\-]{20,})['"]`), Check: highEntropy},
+}
+
+// redactor replaces secrets and PII with stable placeholders
+type redactor struct {
+	rules []redactionRule
+	key   []byte
+}
+
+// newRedactor compiles the built-in and custom rules. It returns nil when REDACTION is disabled.
+func newRedactor() (*redactor, error) {
+	if !config.Redaction {
+		return nil, nil
+	}
+
+	rules := append([]redactionRule{}, builtinRedactionRules...)
+	if config.RedactionRulesFile != "" {
+		data, err := os.ReadFile(config.RedactionRulesFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading redaction rules: %w", err)
+		}
+		var custom []customRedactionRule
+		if err := json.Unmarshal(data, &custom); err != nil {
+			return nil, fmt.Errorf("error parsing redaction rules %s: %w", config.RedactionRulesFile, err)
+		}
+		for _, c := range custom {
+			re, err := regexp.Compile(c.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid redaction rule %s: %w", c.Name, err)
+			}
+			name := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(c.Name), " ", "_"))
+			rules = append(rules, redactionRule{Name: name, Pattern: re})
+		}
+	}
+
+	key, err := loadRedactionKey()
+	if err != nil {
+		return nil, err
+	}
+	return &redactor{rules: rules, key: key}, nil
+}
+
+// loadRedactionKey returns the local key used to derive placeholders, creating it on first use.
+// Keeping the key on disk makes placeholders stable across runs, while a keyed hash
+// cannot be brute-forced back to short values such as SSNs.
+func loadRedactionKey() ([]byte, error) {
+	keyPath := filepath.Join(outputDir(), ".lcma_redaction_key")
+	key, err := os.ReadFile(keyPath)
+	if err == nil && len(key) == 32 {
+		return key, nil
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("error reading redaction key: %w", err)
+	}
+
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("error generating redaction key: %w", err)
+	}
+	if err := os.MkdirAll(outputDir(), 0755); err != nil {
+		return nil, fmt.Errorf("error creating output directory: %w", err)
+	}
+	if err := os.WriteFile(keyPath, key, 0600); err != nil {
+		return nil, fmt.Errorf("error writing redaction key: %w", err)
+	}
+	return key, nil
+}
+
+// fingerprint identifies the rule set and key, so cached content is re-redacted when either changes
+func (r *redactor) fingerprint() string {
+	if r == nil {
+		return "off"
+	}
+	h := sha256.New()
+	for _, rule := range r.rules {
+		fmt.Fprintf(h, "%s=%s\n", rule.Name, rule.Pattern.String())
+	}
+	h.Write(r.key)
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+func (r *redactor) placeholder(rule, value string) string {
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(value))
+	return fmt.Sprintf("[REDACTED:%s:%s]", rule, hex.EncodeToString(mac.Sum(nil))[:8])
+}
+
+type redactionMatch struct {
+	start, end int
+	rule       string
+	// group is set when only a capture group is replaced, so the text around
+	// it is context the LLM needs
+	group bool
+}
+
+// Redact replaces every detected value in content. Line numbers are preserved
+// by keeping the newlines of multi-line values after the placeholder.
+func (r *redactor) Redact(file, content string) (string, []Redaction) {
+	if r == nil {
+		return content, nil
+	}
+
+	isConfig := fileKind(file) == KindConfig
+	var matches []redactionMatch
+	for _, rule := range r.rules {
+		if rule.ConfigOnly && !isConfig {
+			continue
+		}
+		for _, loc := range rule.Pattern.FindAllStringSubmatchIndex(content, -1) {
+			m := redactionMatch{start: loc[0], end: loc[1], rule: rule.Name}
+			if len(loc) >= 4 && loc[2] >= 0 {
+				m.start, m.end, m.group = loc[2], loc[3], true
+			}
+			if m.start == m.end || (rule.Check != nil && !rule.Check(content[m.start:m.end])) {
+				continue
+			}
+			matches = append(matches, m)
+		}
+	}
+	if len(matches) == 0 {
+		return content, nil
+	}
+	merged := mergeRedactionMatches(matches)
+
+	var (
+		sb         strings.Builder
+		redactions []Redaction
+		last       int
+		line       = 1
+	)
+	for _, m := range merged {
+		line += strings.Count(content[last:m.start], "\n")
+		value := content[m.start:m.end]
+		ph := r.placeholder(m.rule, value)
+
+		sb.WriteString(content[last:m.start])
+		sb.WriteString(ph)
+		sb.WriteString(strings.Repeat("\n", strings.Count(value, "\n")))
+		redactions = append(redactions, Redaction{File: file, Line: line, Rule: m.rule, Placeholder: ph})
+
+		line += strings.Count(value, "\n")
+		last = m.end
+	}
+	sb.WriteString(content[last:])
+	return sb.String(), redactions
+}
+
+// mergeRedactionMatches resolves overlaps between matches given in rule
+// priority order. A later match that overlaps a whole-pattern match extends
+// it, so no tail of a longer secret is left behind. A later match that overlaps
+// a capture group is dropped instead: the text around the group, such as the
+// host after a connection password, stays readable.
+func mergeRedactionMatches(matches []redactionMatch) []redactionMatch {
+	var kept []redactionMatch
+next:
+	for _, m := range matches {
+		for i := range kept {
+			k := &kept[i]
+			if m.start >= k.end || m.end <= k.start {
+				continue
+			}
+			if k.group {
+				continue next
+			}
+			k.start, k.end = min(k.start, m.start), max(k.end, m.end)
+			continue next
+		}
+		kept = append(kept, m)
+	}
+
+	// Extended spans may now overlap each other; the earlier one absorbs the later
+	sort.SliceStable(kept, func(i, j int) bool { return kept[i].start < kept[j].start })
+	merged := kept[:1]
+	for _, m := range kept[1:] {
+		cur := &merged[len(merged)-1]
+		if m.start < cur.end {
+			cur.end = max(cur.end, m.end)
+			continue
+		}
+		merged = append(merged, m)
+	}
+	return merged
+}
+
+// validSSN filters out numbers that cannot be US social security numbers
+func validSSN(v string) bool {
+	parts := strings.Split(v, "-")
+	area := parts[0]
+	return area != "000" && area != "666" && area[0] != '9' && parts[1] != "00" && parts[2] != "0000"
+}
+
+// highEntropy reports whether v looks like a random key rather than a word or identifier
+func highEntropy(v string) bool {
+	hasDigit, hasLetter, isHex := false, false, true
+	freq := map[rune]float64{}
+	for _, r := range v {
+		freq[r]++
+		switch {
+		case r >= '0' && r <= '9':
+			hasDigit = true
+		case (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z'):
+			hasLetter = true
+			if !strings.ContainsRune("abcdefABCDEF", r) {
+				isHex = false
+			}
+		default:
+			isHex = false
+		}
+	}
+	if !hasDigit || !hasLetter {
+		return false
+	}
+
+	var entropy float64
+	n := float64(len(v))
+	for _, c := range freq {
+		p := c / n
+		entropy -= p * math.Log2(p)
+	}
+	// Hex digests carry at most 4 bits per character, so they get a lower threshold
+	if isHex {
+		return len(v) >= 32 && entropy > 3.0
+	}
+	return entropy > 4.0
+}
+
+// notPlaceholderValue skips obvious dummy values such as "changeme" or "xxxx"
+func notPlaceholderValue(v string) bool {
+	lower := strings.ToLower(v)
+	for _, dummy := range []string{"changeme", "password", "example", "your_", "xxxx", "****", "<", "{{", "%s", "${"} {
+		if strings.Contains(lower, dummy) {
+			return false
+		}
+	}
+	return true
+}
+
+// writeRedactionReport lists every replacement, without the original values
+func writeRedactionReport(corpus *Corpus) error {
+	if err := WriteReportJSON("redaction_report.json", corpus.Redactions); err != nil {
+		return err
+	}
+
+	var sb strings.Builder
+	sb.WriteString("# Redaction Report\n\n")
+	if !config.Redaction {
+		sb.WriteString("Redaction is disabled (REDACTION=false).\n")
+		return WriteReportFile("redaction_report.md", []byte(sb.String()))
+	}
+
+	counts := map[string]int{}
+	for _, r := range corpus.Redactions {
+		counts[r.Rule]++
+	}
+	fmt.Fprintf(&sb, "Replaced %d values before sending the legacy code to the LLM.\n", len(corpus.Redactions))
+	if len(corpus.Redactions) == 0 {
+		return WriteReportFile("redaction_report.md", []byte(sb.String()))
+	}
+
+	rules := make([]string, 0, len(counts))
+	for rule := range counts {
+		rules = append(rules, rule)
+	}
+	sort.Strings(rules)
+	sb.WriteString("\n| Rule | Count |\n|------|------:|\n")
+	for _, rule := range rules {
+		fmt.Fprintf(&sb, "| %s | %d |\n", rule, counts[rule])
+	}
+
+	sb.WriteString("\n| File | Line | Rule | Placeholder |\n|------|-----:|------|-------------|\n")
+	for _, r := range corpus.Redactions {
+		fmt.Fprintf(&sb, "| %s | %d | %s | `%s` |\n", r.File, r.Line, r.Rule, r.Placeholder)
+	}
+	return WriteReportFile("redaction_report.md", []byte(sb.String()))
+}
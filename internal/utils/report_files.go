@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"lcma/internal/config"
+	"os"
+	"path/filepath"
+)
+
+// WriteReportFile writes an artifact with the given name into REPORT_PATH
+func WriteReportFile(name string, data []byte) error {
+	reportPath := filepath.Join(config.ReportPath, name)
+	// Create report directory if it doesn't exist
+	if err := os.MkdirAll(filepath.Dir(reportPath), 0755); err != nil {
+		return fmt.Errorf("failed to create report directory for %s: %w", name, err)
+	}
+
+	if err := os.WriteFile(reportPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write report %s: %w", name, err)
+	}
+	return nil
+}
+
+// WriteReportJSON writes v as indented JSON into REPORT_PATH
+func WriteReportJSON(name string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal report %s: %w", name, err)
+	}
+	return WriteReportFile(name, append(data, '\n'))
+}
@@ -0,0 +1,407 @@
+package utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"lcma/internal/config"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Kinds of legacy sources accepted in LEGACY_CODE_PATH
+const (
+	sourceDir = "dir"
+	sourceZip = "zip"
+	sourceTar = "tar"
+	sourceGit = "git"
+)
+
+// sourceFile is a legacy file found in a directory, archive or git revision
+type sourceFile struct {
+	Path    string // slash separated, relative to the source root
+	Size    int64
+	Version string // cheap identity used to skip unchanged files without reading them
+	read    func() ([]byte, error)
+}
+
+// legacySource is the set of legacy files read from LEGACY_CODE_PATH
+type legacySource struct {
+	Kind     string
+	Location string
+	Revision string // resolved commit id for git sources
+	Files    []sourceFile
+	closer   io.Closer
+}
+
+// Close releases any archive handles held by the source
+func (s *legacySource) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
+
+// openLegacySource lists the legacy files for spec, which can be a directory, a
+// .zip/.tar/.tar.gz/.tgz archive, or a git repository given as <repo>@<ref>.
+// Archives and git revisions are read in place, without extracting to disk.
+func openLegacySource(spec string) (*legacySource, error) {
+	var (
+		src *legacySource
+		err error
+	)
+
+	info, statErr := os.Stat(spec)
+	lower := strings.ToLower(spec)
+	switch {
+	case statErr == nil && info.IsDir() && isBareGitRepo(spec):
+		src, err = openGitSource(spec, "HEAD")
+	case statErr == nil && info.IsDir():
+		src, err = openDirSource(spec)
+	case statErr == nil && strings.HasSuffix(lower, ".zip"):
+		src, err = openZipSource(spec)
+	case statErr == nil && (strings.HasSuffix(lower, ".tar") || strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz")):
+		src, err = openTarSource(spec)
+	case statErr != nil && isGitSpec(spec):
+		i := strings.LastIndex(spec, "@")
+		src, err = openGitSource(spec[:i], spec[i+1:])
+	case statErr != nil:
+		return nil, fmt.Errorf("error accessing legacy code path %s: %w", spec, statErr)
+	default:
+		return nil, fmt.Errorf("unsupported legacy code path %s: expected a directory, .zip/.tar/.tar.gz archive or <repo>@<ref>", spec)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(src.Files, func(i, j int) bool { return src.Files[i].Path < src.Files[j].Path })
+	return src, nil
+}
+
+// isGitSpec reports whether spec is <repo>@<ref> with an existing repository
+// part, so a mistyped path containing @ is reported as missing
+func isGitSpec(spec string) bool {
+	i := strings.LastIndex(spec, "@")
+	if i <= 0 || i == len(spec)-1 {
+		return false
+	}
+	info, err := os.Stat(spec[:i])
+	return err == nil && info.IsDir()
+}
+
+// isLegacySourceFile reports whether relPath should be ingested
+func isLegacySourceFile(relPath string) bool {
+	// Skip .venv directories and everything in them
+	for _, dir := range strings.Split(path.Dir(relPath), "/") {
+		if dir == ".venv" {
+			return false
+		}
+	}
+
+	return fileKind(relPath) != ""
+}
+
+// fileKind classifies relPath by extension, returning "" for files that are not ingested
+func fileKind(relPath string) string {
+	if IsDependencyFile(relPath) {
+		return KindConfig
+	}
+	switch strings.ToLower(path.Ext(relPath)) {
+	case ".py", ".html":
+		return KindCode
+	case ".ipynb":
+		return KindNotebook
+	case ".sql", ".ddl":
+		return KindSchema
+	case ".ini", ".cfg", ".yaml", ".yml", ".toml":
+		return KindConfig
+	}
+	return ""
+}
+
+// IsDependencyFile reports whether relPath is a pip requirements file or a Pipfile
+func IsDependencyFile(relPath string) bool {
+	base := strings.ToLower(path.Base(relPath))
+	switch {
+	case base == "pipfile":
+		return true
+	case path.Ext(base) != ".txt":
+		return false
+	}
+	return strings.Contains(base, "requirements") || strings.HasPrefix(base, "constraints") ||
+		path.Base(path.Dir(relPath)) == "requirements"
+}
+
+func openDirSource(dirPath string) (*legacySource, error) {
+	src := &legacySource{Kind: sourceDir, Location: dirPath}
+
+	err := filepath.WalkDir(dirPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("error accessing path %s: %w", p, err)
+		}
+
+		// Skip directories, including .venv directories
+		if d.IsDir() {
+			if d.Name() == ".venv" {
+				return filepath.SkipDir // Skip this directory and all its contents
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(dirPath, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !isLegacySourceFile(rel) {
+			return nil
+		}
+
+		// Symlinks to files are read through, as the original walk did;
+		// symlinked directories are not descended into and dangling links are skipped
+		var info fs.FileInfo
+		switch {
+		case d.Type().IsRegular():
+			info, err = d.Info()
+		case d.Type()&fs.ModeSymlink != 0:
+			if info, err = os.Stat(p); err != nil {
+				fmt.Println("Skipping dangling symlink:", rel)
+				return nil
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+		default:
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error accessing path %s: %w", p, err)
+		}
+		filePath := p
+		src.Files = append(src.Files, sourceFile{
+			Path:    rel,
+			Size:    info.Size(),
+			Version: fmt.Sprintf("mtime:%d-%d", info.ModTime().UnixNano(), info.Size()),
+			read:    func() ([]byte, error) { return os.ReadFile(filePath) },
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking directory: %w", err)
+	}
+	return src, nil
+}
+
+func openZipSource(archivePath string) (*legacySource, error) {
+	zr, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening zip archive %s: %w", archivePath, err)
+	}
+	src := &legacySource{Kind: sourceZip, Location: archivePath, closer: zr}
+
+	for _, f := range zr.File {
+		rel := strings.TrimPrefix(path.Clean(f.Name), "/")
+		if f.FileInfo().IsDir() || !isLegacySourceFile(rel) {
+			continue
+		}
+		entry := f
+		src.Files = append(src.Files, sourceFile{
+			Path:    rel,
+			Size:    int64(entry.UncompressedSize64),
+			Version: fmt.Sprintf("crc32:%08x-%d", entry.CRC32, entry.UncompressedSize64),
+			read: func() ([]byte, error) {
+				rc, err := entry.Open()
+				if err != nil {
+					return nil, err
+				}
+				defer rc.Close()
+				return io.ReadAll(rc)
+			},
+		})
+	}
+	return src, nil
+}
+
+func openTarSource(archivePath string) (*legacySource, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening tar archive %s: %w", archivePath, err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	lower := strings.ToLower(archivePath)
+	if strings.HasSuffix(lower, ".gz") || strings.HasSuffix(lower, ".tgz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("error opening gzip stream %s: %w", archivePath, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	// Tar streams cannot be read out of order, so matching files are loaded up front
+	src := &legacySource{Kind: sourceTar, Location: archivePath}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading tar archive %s: %w", archivePath, err)
+		}
+		rel := strings.TrimPrefix(path.Clean(hdr.Name), "/")
+		if hdr.Typeflag != tar.TypeReg || !isLegacySourceFile(rel) {
+			continue
+		}
+		// Files over MAX_FILE_SIZE are skipped by size without being loaded
+		if config.MaxFileSize > 0 && hdr.Size > config.MaxFileSize {
+			name := hdr.Name
+			src.Files = append(src.Files, sourceFile{
+				Path:    rel,
+				Size:    hdr.Size,
+				Version: fmt.Sprintf("tar:%d-%d", hdr.ModTime.UnixNano(), hdr.Size),
+				read:    func() ([]byte, error) { return nil, fmt.Errorf("%s in %s is over MAX_FILE_SIZE", name, archivePath) },
+			})
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s from %s: %w", hdr.Name, archivePath, err)
+		}
+		src.Files = append(src.Files, sourceFile{
+			Path:    rel,
+			Size:    hdr.Size,
+			Version: fmt.Sprintf("sha256:%x", sha256.Sum256(data)),
+			read:    func() ([]byte, error) { return data, nil },
+		})
+	}
+	return src, nil
+}
+
+// isBareGitRepo reports whether dir looks like a bare git repository
+func isBareGitRepo(dir string) bool {
+	for _, name := range []string{"HEAD", "objects", "refs"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// openGitSource lists the files of ref in repo straight from the object database.
+// The ref is resolved to a commit id first so every file comes from the same revision.
+func openGitSource(repo, ref string) (*legacySource, error) {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	out, err := runGit(repo, "rev-parse", "--verify", ref+"^{commit}")
+	if err != nil {
+		return nil, fmt.Errorf("error resolving %s in git repository %s: %w", ref, repo, err)
+	}
+	commit := strings.TrimSpace(string(out))
+	src := &legacySource{Kind: sourceGit, Location: repo, Revision: commit}
+
+	out, err = runGit(repo, "ls-tree", "-r", "-z", "--long", commit)
+	if err != nil {
+		return nil, fmt.Errorf("error listing files of %s in %s: %w", commit, repo, err)
+	}
+	for _, entry := range strings.Split(string(out), "\x00") {
+		// <mode> SP <type> SP <object> SP+ <size> TAB <path>
+		meta, rel, ok := strings.Cut(entry, "\t")
+		if !ok || !isLegacySourceFile(rel) {
+			continue
+		}
+		fields := strings.Fields(meta)
+		if len(fields) != 4 || fields[1] != "blob" {
+			continue
+		}
+		size, _ := strconv.ParseInt(fields[3], 10, 64)
+		object := fields[2]
+		src.Files = append(src.Files, sourceFile{
+			Path:    rel,
+			Size:    size,
+			Version: "blob:" + object,
+			read:    func() ([]byte, error) { return runGit(repo, "cat-file", "blob", object) },
+		})
+	}
+	return src, nil
+}
+
+func runGit(repo string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", repo}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// FileChurn is how often a legacy file changed in its git history
+type FileChurn struct {
+	Commits      int `json:"commits"`
+	LinesChanged int `json:"lines_changed"` // added plus deleted
+	Authors      int `json:"authors"`
+}
+
+// CorpusChurn reads the per-file change history of the corpus when it comes from
+// a git repository, either as <repo>@<ref> or a directory inside a work tree.
+// Paths are relative to the source root, like CorpusFile.Path. ok is false when
+// the source has no git history.
+func CorpusChurn(corpus *Corpus) (churn map[string]FileChurn, ok bool, err error) {
+	args := []string{"log", "--numstat", "--no-renames", "--format=%x00%ae"}
+	switch {
+	case corpus.Revision != "":
+		args = append(args, corpus.Revision)
+	case corpus.Source != "":
+		if out, err := runGit(corpus.Source, "rev-parse", "--is-inside-work-tree"); err != nil || strings.TrimSpace(string(out)) != "true" {
+			return nil, false, nil
+		}
+		args = append(args, "--relative", "HEAD", "--", ".")
+	default:
+		return nil, false, nil
+	}
+	out, err := runGit(corpus.Source, args...)
+	if err != nil {
+		return nil, false, fmt.Errorf("error reading git history of %s: %w", corpus.Source, err)
+	}
+
+	churn = map[string]FileChurn{}
+	authors := map[string]map[string]bool{}
+	author := ""
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(line, "\x00") {
+			author = line[1:]
+			continue
+		}
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		added, _ := strconv.Atoi(fields[0]) // "-" for binary files
+		deleted, _ := strconv.Atoi(fields[1])
+		c := churn[fields[2]]
+		c.Commits++
+		c.LinesChanged += added + deleted
+		if authors[fields[2]] == nil {
+			authors[fields[2]] = map[string]bool{}
+		}
+		authors[fields[2]][author] = true
+		c.Authors = len(authors[fields[2]])
+		churn[fields[2]] = c
+	}
+	return churn, true, nil
+}
@@ -0,0 +1,239 @@
+package utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"lcma/internal/config"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// legacyFiles is the tree every test source is built from; only the .py,
+// .html, .sql, .cfg and requirements files are legacy source files
+var legacyFiles = map[string]string{
+	"app.py":                 "print('app')\n",
+	"templates/index.html":   "<p>index</p>\n",
+	"db/schema.sql":          "CREATE TABLE t (id int);\n",
+	"settings.cfg":           "[app]\n",
+	"requirements.txt":       "flask==2.0\n",
+	"README.md":              "# readme\n",
+	"static/logo.png":        "\x89PNG",
+	".venv/lib/site.py":      "import os\n",
+	"notes/todo.txt":         "later\n",
+	"pkg/__init__.py":        "",
+	"pkg/module_with_@.py":   "x = 1\n",
+	"templates/partial.html": "<b>partial</b>\n",
+}
+
+var wantLegacyPaths = []string{
+	"app.py", "db/schema.sql", "pkg/__init__.py", "pkg/module_with_@.py",
+	"requirements.txt", "settings.cfg", "templates/index.html", "templates/partial.html",
+}
+
+func writeLegacyTree(t *testing.T, dir string) {
+	t.Helper()
+	for name, content := range legacyFiles {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func writeZip(t *testing.T, file string) {
+	t.Helper()
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for name, content := range legacyFiles {
+		w, err := zw.Create("project/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTarGz(t *testing.T, file string) {
+	t.Helper()
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for name, content := range legacyFiles {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(content))
+	}
+	tw.WriteHeader(&tar.Header{Name: "link.py", Linkname: "app.py", Typeflag: tar.TypeSymlink})
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func initGitRepo(t *testing.T, dir string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	writeLegacyTree(t, dir)
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "-A"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "legacy"},
+		{"tag", "v1"},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	// Changes after the tag must not show up in v1
+	os.WriteFile(filepath.Join(dir, "app.py"), []byte("print('changed')\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "later.py"), []byte("x = 2\n"), 0644)
+}
+
+func TestOpenLegacySource(t *testing.T) {
+	tmp := t.TempDir()
+	tests := []struct {
+		name   string
+		setup  func(t *testing.T) string
+		kind   string
+		prefix string // archive root the paths are listed under
+	}{
+		{"directory", func(t *testing.T) string {
+			dir := filepath.Join(tmp, "dir")
+			writeLegacyTree(t, dir)
+			return dir
+		}, sourceDir, ""},
+		{"zip", func(t *testing.T) string {
+			file := filepath.Join(tmp, "legacy.zip")
+			writeZip(t, file)
+			return file
+		}, sourceZip, "project/"},
+		{"tar.gz", func(t *testing.T) string {
+			file := filepath.Join(tmp, "legacy.tar.gz")
+			writeTarGz(t, file)
+			return file
+		}, sourceTar, ""},
+		{"repo@ref", func(t *testing.T) string {
+			dir := filepath.Join(tmp, "repo")
+			initGitRepo(t, dir)
+			return dir + "@v1"
+		}, sourceGit, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, err := openLegacySource(tt.setup(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer src.Close()
+			if src.Kind != tt.kind {
+				t.Errorf("kind = %s, want %s", src.Kind, tt.kind)
+			}
+			var paths []string
+			for _, f := range src.Files {
+				paths = append(paths, f.Path)
+				rel := f.Path[len(tt.prefix):]
+				data, err := f.read()
+				if err != nil {
+					t.Fatalf("read %s: %v", f.Path, err)
+				}
+				if string(data) != legacyFiles[rel] {
+					t.Errorf("%s = %q, want %q", f.Path, data, legacyFiles[rel])
+				}
+				if f.Version == "" {
+					t.Errorf("%s has no version", f.Path)
+				}
+			}
+			var want []string
+			for _, p := range wantLegacyPaths {
+				want = append(want, tt.prefix+p)
+			}
+			if !reflect.DeepEqual(paths, want) {
+				t.Errorf("paths = %v, want %v", paths, want)
+			}
+			if tt.kind == sourceGit && len(src.Revision) != 40 {
+				t.Errorf("revision = %q, want a commit id", src.Revision)
+			}
+		})
+	}
+}
+
+func TestOpenLegacySourceErrors(t *testing.T) {
+	tmp := t.TempDir()
+	file := filepath.Join(tmp, "notes.txt")
+	os.WriteFile(file, []byte("x"), 0644)
+	for name, spec := range map[string]string{
+		"missing path":         filepath.Join(tmp, "missing"),
+		"missing path with @":  filepath.Join(tmp, "user@host/app"),
+		"unsupported file":     file,
+		"@ after a plain file": file + "@main",
+	} {
+		if _, err := openLegacySource(spec); err == nil {
+			t.Errorf("%s: openLegacySource(%s) succeeded", name, spec)
+		}
+	}
+}
+
+func TestOpenDirSourceSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	writeLegacyTree(t, dir)
+	if err := os.Symlink(filepath.Join(dir, "app.py"), filepath.Join(dir, "linked.py")); err != nil {
+		t.Skip("symlinks are not supported:", err)
+	}
+	os.Symlink(filepath.Join(dir, "gone.py"), filepath.Join(dir, "dangling.py"))
+
+	src, err := openLegacySource(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := map[string]bool{}
+	for _, f := range src.Files {
+		found[f.Path] = true
+		if f.Path == "linked.py" {
+			if data, _ := f.read(); string(data) != legacyFiles["app.py"] {
+				t.Errorf("linked.py = %q", data)
+			}
+		}
+	}
+	if !found["linked.py"] || found["dangling.py"] {
+		t.Errorf("files = %v, want linked.py without dangling.py", found)
+	}
+}
+
+func TestTarSkipsOversizedEntries(t *testing.T) {
+	defer func(v int64) { config.MaxFileSize = v }(config.MaxFileSize)
+	config.MaxFileSize = 10
+
+	file := filepath.Join(t.TempDir(), "legacy.tar.gz")
+	writeTarGz(t, file)
+	src, err := openLegacySource(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range src.Files {
+		_, err := f.read()
+		if big := f.Size > 10; big != (err != nil) {
+			t.Errorf("%s (%d bytes): read error = %v", f.Path, f.Size, err)
+		}
+	}
+}